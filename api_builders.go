@@ -5,6 +5,7 @@ import (
 	"github.com/iv-menshenin/go-ast"
 	"go/ast"
 	"go/token"
+	"strconv"
 	"strings"
 )
 
@@ -116,22 +117,28 @@ func makeFindFunction(variant findVariant) ApiFuncBuilder {
 					rowStructName,
 					sqlTextName,
 					func(sql ast.Expr) ast.Expr {
-						return builders.Call(
-							builders.SprintfFn,
+						var placeholder = codeDialect.PlaceholderFormat()
+						var callArgs = []ast.Expr{
 							&ast.BasicLit{
 								Kind:  token.STRING,
-								Value: `"with query as (%s) select query.*, (select count(*) from query) from query limit $%d offset $%d;"`,
+								Value: strconv.Quote("with query as (%s) select query.*, (select count(*) from query) from query limit " + placeholder + " offset " + placeholder + ";"),
 							},
 							sql,
-							builders.Add(
-								builders.Call(builders.LengthFn, ast.NewIdent("args")),
-								builders.IntegerConstant(1).Expr(),
-							),
-							builders.Add(
-								builders.Call(builders.LengthFn, ast.NewIdent("args")),
-								builders.IntegerConstant(2).Expr(),
-							),
-						)
+						}
+						if strings.Contains(placeholder, "%d") {
+							callArgs = append(
+								callArgs,
+								builders.Add(
+									builders.Call(builders.LengthFn, ast.NewIdent("args")),
+									builders.IntegerConstant(1).Expr(),
+								),
+								builders.Add(
+									builders.Call(builders.LengthFn, ast.NewIdent("args")),
+									builders.IntegerConstant(2).Expr(),
+								),
+							)
+						}
+						return builders.Call(builders.SprintfFn, callArgs...)
 					},
 					func(e ast.Expr) ast.Expr {
 						return builders.Call(
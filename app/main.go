@@ -1,12 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"flag"
 	"fmt"
 	"github.com/ghodss/yaml"
 	"github.com/iv-menshenin/dragonfly"
 	"io"
+	"io/ioutil"
 	"os"
 	"strings"
 )
@@ -16,11 +18,28 @@ type (
 	ProgramParams struct {
 		ToDo         ToDo
 		InputFile    *string
+		FromFile     *string
+		ToFile       *string
 		OutputFile   *string
 		OutputFormat *string
 		Schema       *string
 		PackageName  *string
 		Connection   *string
+		OutputDir    *string
+		Title        *string
+		Destructive  *bool
+		Deprecate    *bool
+		DropSchemas  *bool
+		Online       *bool
+		DryRun       *bool
+		Check        *bool
+		Targets      *string
+		Parallel     *int
+		Schemas      *string
+		Tables       *string
+		Kinds        *string
+		Exclude      *string
+		Dialect      *string
 		ShowHelp     *bool
 	}
 )
@@ -70,6 +89,13 @@ func initFlags() ProgramParams {
 		OutputFormat: fsGenerate.String("format", "sql", "go or sql"),
 		PackageName:  fsGenerate.String("package", "generated", "go package name"),
 		Schema:       fsGenerate.String("schema", "", "generate code for schema"),
+		OutputDir:    fsGenerate.String("out-dir", "", "directory for versioned sql migrations"),
+		Title:        fsGenerate.String("title", "migration", "short description of the new migration"),
+		Destructive:  fsGenerate.Bool("allow-destructive", false, "allow statements that can lead to data loss"),
+		Deprecate:    fsGenerate.Bool("deprecate-dropped", false, "rename dropped objects to _deprecated_<name>"),
+		DropSchemas:  fsGenerate.Bool("drop-schemas", false, "drop schemas that are missing in the project along with all their objects"),
+		Online:       fsGenerate.Bool("online", false, "split changes of existing tables into phases without long locks, the script must not be run in a transaction"),
+		Dialect:      fsGenerate.String("dialect", "", "postgres, sqlite or mysql, the dialect of the project file is used by default"),
 		ShowHelp:     fsGenerate.Bool("help", false, "show this page"),
 	}
 	flagSets[ToDoGenerate] = fsGenerate
@@ -84,12 +110,28 @@ func initFlags() ProgramParams {
 
 	fsDiff := flag.NewFlagSet(string(ToDoDiff), flag.PanicOnError)
 	parameters[ToDoDiff] = ProgramParams{
-		ToDo:        ToDoDiff,
-		InputFile:   fsDiff.String("input", os.Stdin.Name(), "file to input"),
-		OutputFile:  fsDiff.String("output", os.Stdout.Name(), "file to output"),
-		PackageName: fsDiff.String("package", "generated", "go package name"),
-		Schema:      fsDiff.String("schema", "", "generate code for schema"),
-		Connection:  fsDiff.String("connection", "", "connection string"),
+		ToDo:         ToDoDiff,
+		InputFile:    fsDiff.String("input", os.Stdin.Name(), "file to input"),
+		FromFile:     fsDiff.String("from", "", "compare with the project file instead of the database, git:REF:path is allowed"),
+		ToFile:       fsDiff.String("to", "", "the new project file, git:REF:path is allowed, the input file is used by default"),
+		OutputFile:   fsDiff.String("output", os.Stdout.Name(), "file to output"),
+		OutputFormat: fsDiff.String("format", "sql", "sql or json"),
+		PackageName:  fsDiff.String("package", "generated", "go package name"),
+		Schema:       fsDiff.String("schema", "", "generate code for schema"),
+		Connection:   fsDiff.String("connection", "", "connection string"),
+		Destructive:  fsDiff.Bool("allow-destructive", false, "allow statements that can lead to data loss"),
+		Deprecate:    fsDiff.Bool("deprecate-dropped", false, "rename dropped objects to _deprecated_<name>"),
+		DropSchemas:  fsDiff.Bool("drop-schemas", false, "drop schemas that are missing in the project along with all their objects"),
+		Online:       fsDiff.Bool("online", false, "split changes of existing tables into phases without long locks, the script must not be run in a transaction"),
+		DryRun:       fsDiff.Bool("dry-run", false, "apply the script to the database inside a transaction that is rolled back and check the result"),
+		Check:        fsDiff.Bool("check", false, "print the differences between the database and the project instead of the script, fail if there are any"),
+		Targets:      fsDiff.String("targets", "", "file with the connection strings of the databases the project is applied to, one per line"),
+		Parallel:     fsDiff.Int("parallel", 4, "the number of databases or tenant schemas processed at once"),
+		Schemas:      fsDiff.String("schemas", "", "comma separated patterns of the schemas that are migrated, all of them by default"),
+		Tables:       fsDiff.String("tables", "", "comma separated patterns of the tables that are migrated: schema.table"),
+		Kinds:        fsDiff.String("kinds", "", "comma separated kinds of the objects that are changed: schema, domain, type, table, column, constraint, index, row, hook"),
+		Exclude:      fsDiff.String("exclude", "", "comma separated patterns of the schemas and the tables (schema.table) that are never touched"),
+		Dialect:      fsDiff.String("dialect", "", "postgres, sqlite or mysql, the dialect of the project file is used by default"),
 	}
 	flagSets[ToDoDiff] = fsDiff
 
@@ -98,6 +140,10 @@ func initFlags() ProgramParams {
 		ToDo:       ToDoReverse,
 		OutputFile: fsReverse.String("output", os.Stdout.Name(), "file to output"),
 		Connection: fsReverse.String("connection", os.Stdout.Name(), "connection string"),
+		Schemas:    fsReverse.String("schemas", "", "comma separated patterns of the schemas that are read, all of them by default"),
+		Tables:     fsReverse.String("tables", "", "comma separated patterns of the tables that are read: schema.table"),
+		Exclude:    fsReverse.String("exclude", "", "comma separated patterns of the schemas and the tables (schema.table) that are not read"),
+		Dialect:    fsReverse.String("dialect", "", "postgres, sqlite or mysql"),
 	}
 	flagSets[ToDoReverse] = fsReverse
 
@@ -137,15 +183,261 @@ func openFileForWrite(fileName string, onOpened func(w io.Writer) error) error {
 	return onOpened(f)
 }
 
+func (p ProgramParams) destructivePolicy() dragonfly.DestructivePolicy {
+	return dragonfly.DestructivePolicy{
+		Allow:       *p.Destructive,
+		Deprecate:   *p.Deprecate,
+		DropSchemas: *p.DropSchemas,
+	}
+}
+
+// the dialect of the project is used to connect to the database, the command line option is used without the project
+func (p ProgramParams) connectionOptions(root *dragonfly.Root) dragonfly.ConnectionOptions {
+	return p.connectionOptionsFor(root, *p.Connection)
+}
+
+func (p ProgramParams) connectionOptionsFor(root *dragonfly.Root, connStr string) dragonfly.ConnectionOptions {
+	var (
+		dialect = *p.Dialect
+		scope   = p.scope()
+	)
+	if root != nil {
+		dialect = root.Dialect
+		scope = root.Scope
+	}
+	return dragonfly.ConnectionOptions{
+		UserName: "postgres",
+		Password: os.Getenv("DB_PASSWORD"),
+		Host:     os.Getenv("DB_HOST"),
+		Database: os.Getenv("DB_NAME"),
+		ConnStr:  connStr,
+		Dialect:  dialect,
+		Scope:    scope,
+	}
+}
+
+// the connection strings of the targets file, the empty lines and the lines starting with # are skipped
+func (p ProgramParams) targetConnections() ([]string, error) {
+	if *p.Targets == "" {
+		return []string{*p.Connection}, nil
+	}
+	data, err := ioutil.ReadFile(*p.Targets)
+	if err != nil {
+		return nil, err
+	}
+	var result = make([]string, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			result = append(result, line)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("there are no connection strings in %s", *p.Targets)
+	}
+	return result, nil
+}
+
+// runs the script against the database and rolls it back, the report is printed to stderr
+func dryRun(diff *dragonfly.Diff, root *dragonfly.Root, options dragonfly.ConnectionOptions, state ProgramParams) error {
+	if *state.FromFile != "" {
+		return errors.New("the dry run needs the database, it cannot be used along with the `from` option")
+	}
+	report, err := diff.DryRun(options, root)
+	if err != nil {
+		return err
+	}
+	report.Print(os.Stderr)
+	if !report.Succeeded() {
+		return errors.New("the dry run failed")
+	}
+	return nil
+}
+
+// prints the drift summary, the error makes the exit code non-zero if the database differs from the project
+func checkDrift(w io.Writer, actual, root *dragonfly.Root) error {
+	report := dragonfly.CheckDrift(actual, root)
+	report.Print(w)
+	if len(report) > 0 {
+		return fmt.Errorf("the database does not match the project: %d difference(s)", len(report))
+	}
+	return nil
+}
+
+// the command line options take precedence over the migration mode and the dialect of the project file
+func (p ProgramParams) applyMigrationMode(root *dragonfly.Root) {
+	if p.Online != nil && *p.Online {
+		root.SetMigrationMode(dragonfly.MigrationModeOnline)
+	}
+	if p.Dialect != nil && *p.Dialect != "" {
+		root.SetDialect(*p.Dialect)
+	}
+	root.Scope = root.Scope.Merge(p.scope())
+}
+
+func splitPatterns(s *string) []string {
+	var result []string
+	if s == nil {
+		return result
+	}
+	for _, pattern := range strings.Split(*s, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			result = append(result, pattern)
+		}
+	}
+	return result
+}
+
+// the scope of the command line, the excluded pattern with the dot is the table, otherwise it is the schema
+func (p ProgramParams) scope() *dragonfly.Scope {
+	var scope = dragonfly.Scope{
+		Schemas: dragonfly.Filter{Include: splitPatterns(p.Schemas)},
+		Tables:  dragonfly.Filter{Include: splitPatterns(p.Tables)},
+		Kinds:   dragonfly.Filter{Include: splitPatterns(p.Kinds)},
+	}
+	for _, pattern := range splitPatterns(p.Exclude) {
+		if strings.Contains(pattern, ".") {
+			scope.Tables.Exclude = append(scope.Tables.Exclude, pattern)
+		} else {
+			scope.Schemas.Exclude = append(scope.Schemas.Exclude, pattern)
+		}
+	}
+	if len(scope.Schemas.Include)+len(scope.Schemas.Exclude)+len(scope.Tables.Include)+len(scope.Tables.Exclude)+len(scope.Kinds.Include) == 0 {
+		return nil
+	}
+	return &scope
+}
+
+// the settings of the project and of the command line are checked before anything is compared
+func validateProject(root *dragonfly.Root) {
+	if err := root.Validate(); err != nil {
+		raise(err)
+	}
+}
+
+// prints the summary of changes to stderr and refuses destructive changes unless they are allowed
+func guardDiff(diff *dragonfly.Diff, state ProgramParams) error {
+	err := diff.ApplyDestructivePolicy(state.destructivePolicy())
+	diff.PrintSummary(os.Stderr)
+	return err
+}
+
+// prints the drift or the script of one target, the dry run is made if it is required
+func diffTarget(w io.Writer, dump, root *dragonfly.Root, options dragonfly.ConnectionOptions, state ProgramParams) error {
+	if *state.Check {
+		return checkDrift(w, dump, root)
+	}
+	diff := dragonfly.MakeDiff(dump, root)
+	dragonfly.ResolveDependencies(&diff)
+	if err := guardDiff(&diff, state); err != nil {
+		return err
+	}
+	if strings.EqualFold(*state.OutputFormat, "json") {
+		if err := diff.PrintJSON(w); err != nil {
+			return err
+		}
+	} else {
+		diff.Print(w)
+	}
+	if *state.DryRun {
+		return dryRun(&diff, root, options, state)
+	}
+	return nil
+}
+
+// applies the project to each of the databases and to each tenant schema of them,
+// the shared schemas of all the databases go first. The output of each target is preceded by its name
+func diffTargets(w io.Writer, root *dragonfly.Root, state ProgramParams) error {
+	connections, err := state.targetConnections()
+	if err != nil {
+		return err
+	}
+	var (
+		names    = make([]string, len(connections))
+		projects = make([][]dragonfly.TenantProject, len(connections))
+	)
+	for i := range connections {
+		names[i] = fmt.Sprintf("#%d", i+1)
+	}
+	results := dragonfly.RunTargets(names, *state.Parallel, func(i int) error {
+		dump, err := dragonfly.MakeDatabaseDump(state.connectionOptionsFor(root, connections[i]))
+		if err != nil {
+			return err
+		}
+		projects[i] = dragonfly.SplitTenants(&dump, root)
+		return nil
+	})
+	type target struct {
+		name    string
+		options dragonfly.ConnectionOptions
+		project dragonfly.TenantProject
+		output  bytes.Buffer
+	}
+	var shared, tenants = make([]*target, 0), make([]*target, 0)
+	for i, tenantProjects := range projects {
+		for _, project := range tenantProjects {
+			var t = target{
+				name:    names[i] + " " + project.Name(),
+				options: state.connectionOptionsFor(root, connections[i]),
+				project: project,
+			}
+			if project.Tenant == "" {
+				shared = append(shared, &t)
+			} else {
+				tenants = append(tenants, &t)
+			}
+		}
+	}
+	for _, group := range [][]*target{shared, tenants} {
+		var groupNames = make([]string, len(group))
+		for i, t := range group {
+			groupNames[i] = t.name
+		}
+		results = append(results, dragonfly.RunTargets(groupNames, *state.Parallel, func(i int) error {
+			var t = group[i]
+			if err := t.project.ReadState(t.options); err != nil {
+				return err
+			}
+			return diffTarget(&t.output, t.project.Current, t.project.Project, t.options, state)
+		})...)
+		for _, t := range group {
+			if _, err = fmt.Fprintf(w, "\n/* TARGET %s */\n", t.name); err != nil {
+				return err
+			}
+			if _, err = t.output.WriteTo(w); err != nil {
+				return err
+			}
+		}
+	}
+	results.Print(os.Stderr)
+	if failed := results.Failed(); failed > 0 {
+		return fmt.Errorf("%d of %d target(s) failed", failed, len(results))
+	}
+	return nil
+}
+
 func main() {
 	var root *dragonfly.Root
 	state := initFlags()
 	readAndParse := func() {
 		root = dragonfly.ReadDatabaseProjectFile(*state.InputFile)
+		state.applyMigrationMode(root)
+		validateProject(root)
 	}
 	switch state.ToDo {
 	case ToDoGenerate:
-
+		if *state.OutputDir != "" && strings.EqualFold(*state.OutputFormat, "sql") {
+			readAndParse()
+			files, err := dragonfly.GenerateMigration(*state.OutputDir, *state.Title, root, state.destructivePolicy())
+			if err != nil {
+				raise(err)
+			}
+			if files == nil {
+				fmt.Println("nothing to migrate")
+			} else {
+				fmt.Printf("migration #%d:\n%s\n%s\n", files.Version, files.Up, files.Down)
+			}
+			return
+		}
 		err := openFileForWrite(*state.OutputFile, func(w io.Writer) error {
 			readAndParse()
 			switch strings.ToLower(*state.OutputFormat) {
@@ -153,6 +445,9 @@ func main() {
 				var dump = dragonfly.MakeEmptyRoot()
 				diff := dragonfly.MakeDiff(&dump, root)
 				dragonfly.ResolveDependencies(&diff)
+				if err := guardDiff(&diff, state); err != nil {
+					return err
+				}
 				diff.Print(w)
 			case "go":
 				dragonfly.GenerateGO(root, *state.Schema, *state.PackageName, w)
@@ -166,24 +461,33 @@ func main() {
 		readAndParse()
 	case ToDoDiff:
 		err := openFileForWrite(*state.OutputFile, func(w io.Writer) error {
-			readAndParse()
 			var (
 				dump dragonfly.Root
 				e    error
 			)
-			if dump, e = dragonfly.MakeDatabaseDump(dragonfly.ConnectionOptions{
-				Driver:   "postgres",
-				UserName: "postgres",
-				Password: os.Getenv("DB_PASSWORD"),
-				Host:     os.Getenv("DB_HOST"),
-				Database: os.Getenv("DB_NAME"),
-				ConnStr:  *state.Connection,
-			}); e != nil {
+			if *state.ToFile != "" {
+				root = dragonfly.ReadDatabaseProjectSource(*state.ToFile)
+				state.applyMigrationMode(root)
+				validateProject(root)
+			} else {
+				readAndParse()
+			}
+			if *state.DryRun && *state.Online {
+				return errors.New("the dry run cannot be used along with the `online` option, the online script must not be run in a transaction")
+			}
+			if *state.FromFile == "" && (*state.Targets != "" || root.HasTemplates()) {
+				return diffTargets(w, root, state)
+			}
+			if *state.FromFile != "" {
+				dump = *dragonfly.ReadDatabaseProjectSource(*state.FromFile)
+			} else if dump, e = dragonfly.MakeDatabaseDump(state.connectionOptions(root)); e != nil {
+				return e
+			} else if e = dragonfly.ReadSeedData(state.connectionOptions(root), &dump, root); e != nil {
+				return e
+			} else if e = dragonfly.ReadHookHistory(state.connectionOptions(root), &dump, root); e != nil {
 				return e
 			}
-			diff := dragonfly.MakeDiff(&dump, root)
-			diff.Print(w)
-			return nil
+			return diffTarget(w, &dump, root, state.connectionOptions(root), state)
 		})
 		if err != nil {
 			raise(err)
@@ -195,14 +499,10 @@ func main() {
 				data []byte
 				e    error
 			)
-			if dump, e = dragonfly.MakeDatabaseDump(dragonfly.ConnectionOptions{
-				Driver:   "postgres",
-				UserName: "postgres",
-				Password: os.Getenv("DB_PASSWORD"),
-				Host:     os.Getenv("DB_HOST"),
-				Database: os.Getenv("DB_NAME"),
-				ConnStr:  *state.Connection,
-			}); e != nil {
+			if e = state.scope().Validate(); e != nil {
+				return e
+			}
+			if dump, e = dragonfly.MakeDatabaseDump(state.connectionOptions(nil)); e != nil {
 				return e
 			}
 			if data, e = yaml.Marshal(&dump); e != nil {
@@ -78,13 +78,7 @@ func (op opRegular) makeArrayQueryOption(
 						builders.Call(
 							builders.AppendFn,
 							ast.NewIdent(arrVariableName),
-							builders.Add(
-								builders.StringConstant("$").Expr(),
-								builders.Call(
-									builders.ConvertItoaFn,
-									builders.Call(builders.LengthFn, ast.NewIdent(options.variableForColumnValues.String())),
-								),
-							),
+							makePlaceholder(options.variableForColumnValues.String()),
 						),
 					),
 				},
@@ -135,13 +129,7 @@ func (op opRegular) makeUnionQueryOption(
 		callArgs = append(
 			callArgs,
 			builders.StringConstant(c).Expr(),
-			builders.Add(
-				builders.StringConstant("$").Expr(),
-				builders.Call(
-					builders.ConvertItoaFn,
-					builders.Call(builders.LengthFn, ast.NewIdent(options.variableForColumnValues.String())),
-				),
-			),
+			makePlaceholder(options.variableForColumnValues.String()),
 		)
 	}
 	return []ast.Stmt{
@@ -171,6 +159,8 @@ func (op opRegular) makeUnionQueryOption(
 
 //  args = append(args, filter.Id)
 //  filters = append(filters, fmt.Sprintf("%s = %s", "id", "$"+strconv.Itoa(len(args))))
+//
+// the placeholder depends on the dialect, it is written as "?" if the parameters are not numbered
 func (op opRegular) makeScalarQueryOption(
 	optionName, fieldName, columnName string,
 	ci, ref bool,
@@ -204,13 +194,7 @@ func (op opRegular) makeScalarQueryOption(
 					builders.SprintfFn,
 					builders.StringConstant(op.operator).Expr(),
 					builders.StringConstant(columnName).Expr(),
-					builders.Add(
-						builders.StringConstant("$").Expr(),
-						builders.Call(
-							builders.ConvertItoaFn,
-							builders.Call(builders.LengthFn, ast.NewIdent(options.variableForColumnValues.String())),
-						),
-					),
+					makePlaceholder(options.variableForColumnValues.String()),
 				),
 			),
 		),
@@ -248,13 +232,7 @@ func (op opInline) makeArrayQueryOption(
 					builders.Call(
 						builders.AppendFn,
 						ast.NewIdent(arrVariableName),
-						builders.Add(
-							builders.StringConstant("$").Expr(),
-							builders.Call(
-								builders.ConvertItoaFn,
-								builders.Call(builders.LengthFn, ast.NewIdent(options.variableForColumnValues.String())),
-							),
-						),
+						makePlaceholder(options.variableForColumnValues.String()),
 					),
 				),
 			),
@@ -395,6 +373,24 @@ func doFuncPicker(funcName string, funcArgs ...string) (ast.Expr, bool) {
 	return nil, false
 }
 
+// makePlaceholder generates the placeholder of the value that is last appended to the variable
+//
+//   Example:
+//   "$"+strconv.Itoa(len(args))
+func makePlaceholder(valueVarName string) ast.Expr {
+	var format = codeDialect.PlaceholderFormat()
+	if !strings.Contains(format, "%d") {
+		return builders.StringConstant(format).Expr()
+	}
+	return builders.Add(
+		builders.StringConstant(strings.TrimSuffix(format, "%d")).Expr(),
+		builders.Call(
+			builders.ConvertItoaFn,
+			builders.Call(builders.LengthFn, ast.NewIdent(valueVarName)),
+		),
+	)
+}
+
 // makeInputValueProcessor generates handler code for one cell of incoming data (one field)
 //
 //   Example:
@@ -405,12 +401,31 @@ func doFuncPicker(funcName string, funcArgs ...string) (ast.Expr, bool) {
 //
 // the `fields` variable are further used to build a sql query,
 //
-// and the `args` variable is used as a tuple of values for placeholders
+// and the `args` variable is used as a tuple of values for placeholders.
+// If the parameters are not numbered, the expression is appended as is
 func makeInputValueProcessor(
 	sqlExpr string,
 	goExpr ast.Expr,
 	valueVarName, columnVarName string,
 ) []ast.Stmt {
+	if !strings.Contains(sqlExpr, "%d") {
+		return []ast.Stmt{
+			builders.Assign(
+				builders.MakeVarNames(valueVarName),
+				builders.Assignment,
+				builders.Call(builders.AppendFn, ast.NewIdent(valueVarName), goExpr),
+			),
+			builders.Assign(
+				builders.MakeVarNames(columnVarName),
+				builders.Assignment,
+				builders.Call(
+					builders.AppendFn,
+					ast.NewIdent(columnVarName),
+					builders.StringConstant(sqlExpr).Expr(),
+				),
+			),
+		}
+	}
 	return []ast.Stmt{
 		builders.Assign(
 			builders.MakeVarNames(valueVarName),
@@ -20,6 +20,7 @@ type (
 	sqlDataCompareOperator string
 
 	builderOptions struct {
+		// formats the column expression along with the placeholder format of the dialect
 		appendValueFormat       string
 		variableForColumnNames  *variableName
 		variableForColumnValues variableName
@@ -283,25 +284,25 @@ func (v variableWrap) makeExpr() ast.Expr {
 var (
 	fieldsVariableRef  = FieldsVariable
 	FindBuilderOptions = builderOptions{
-		appendValueFormat:       "%s = $%%d",
+		appendValueFormat:       "%s = %s",
 		variableForColumnNames:  nil,
 		variableForColumnValues: "args",
 		variableForColumnExpr:   FiltersVariable,
 	}
 	InsertBuilderOptions = builderOptions{
-		appendValueFormat:       "/* %s */ $%%d",
+		appendValueFormat:       "/* %s */ %s",
 		variableForColumnNames:  &fieldsVariableRef,
 		variableForColumnValues: ArgsVariable,
 		variableForColumnExpr:   ValuesVariable,
 	}
 	UpdateBuilderOptions = builderOptions{
-		appendValueFormat:       "%s = $%%d",
+		appendValueFormat:       "%s = %s",
 		variableForColumnNames:  nil,
 		variableForColumnValues: ArgsVariable,
 		variableForColumnExpr:   FieldsVariable,
 	}
 	DeleteBuilderOptions = builderOptions{
-		appendValueFormat:       "%s = $%%d",
+		appendValueFormat:       "%s = %s",
 		variableForColumnNames:  nil,
 		variableForColumnValues: ArgsVariable,
 		variableForColumnExpr:   FiltersVariable,
@@ -812,7 +813,7 @@ func (f dataCellField) generateInputArgumentCode(
 		))
 	}
 	stmt = append(stmt, makeInputValueProcessor(
-		fmt.Sprintf(options.appendValueFormat, colName.sqlExpr()),
+		fmt.Sprintf(options.appendValueFormat, colName.sqlExpr(), codeDialect.PlaceholderFormat()),
 		valueExpr,
 		options.variableForColumnValues.String(),
 		options.variableForColumnExpr.String(),
@@ -0,0 +1,144 @@
+package dragonfly
+
+import (
+	"fmt"
+	sqt "github.com/iv-menshenin/sql-ast"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+	DialectMySQL    = "mysql"
+)
+
+type (
+	// Dialect describes what differs from one database engine to another: the names of types, the statements
+	// that change the structure, the way the structure is read and how the parameters of queries are written.
+	// The project is always described in terms of PostgreSQL, the dialect translates it
+	Dialect interface {
+		Name() string
+		// DriverName is the name of the database/sql driver used if the connection options do not specify it
+		DriverName() string
+		// TypeName returns the name of the column type in the database
+		TypeName(t TypeBase) string
+		// PlaceholderFormat is the format of the query parameter, it contains %d if the parameters are numbered
+		PlaceholderFormat() string
+		// CanAlter returns false if the change of the existing table cannot be made by altering it,
+		// then the table is rebuilt
+		CanAlter(change Change) bool
+		// TransactionalDDL returns false if the structure changes are committed implicitly, they cannot be rolled back
+		TransactionalDDL() bool
+		// makeDiff generates the statements that turn the current structure into the new one
+		makeDiff(current, new *Root) Diff
+		// readStructure reads the structure of the database in the form of the project
+		readStructure(db queryer, database string) (Root, error)
+		// qualifiedName is the name of the table used in the queries of the generated code
+		qualifiedName(schema, table string) string
+		connectionString(options ConnectionOptions) string
+	}
+	postgresDialect struct{}
+)
+
+var (
+	dialects = map[string]Dialect{
+		DialectPostgres: postgresDialect{},
+		DialectSQLite:   sqliteDialect{},
+		DialectMySQL:    mysqlDialect{},
+	}
+	// the dialect of the generated Go code, it is set by GenerateGO
+	codeDialect Dialect = postgresDialect{}
+)
+
+// getDialect returns PostgreSQL if the name is empty
+func getDialect(name string) Dialect {
+	if name == "" {
+		return dialects[DialectPostgres]
+	}
+	if dialect, ok := dialects[strings.ToLower(name)]; ok {
+		return dialect
+	}
+	var known = make([]string, 0, len(dialects))
+	for dialectName := range dialects {
+		known = append(known, dialectName)
+	}
+	sort.Strings(known)
+	panic(fmt.Sprintf("unknown dialect `%s`, expected one of: %s", name, strings.Join(known, ", ")))
+}
+
+func (c *Root) getDialect() Dialect {
+	return getDialect(c.Dialect)
+}
+
+// SetDialect overrides the dialect described in the project file
+func (c *Root) SetDialect(name string) {
+	c.Dialect = getDialect(name).Name()
+}
+
+func (postgresDialect) Name() string {
+	return DialectPostgres
+}
+
+func (postgresDialect) DriverName() string {
+	return "postgres"
+}
+
+func (postgresDialect) TypeName(t TypeBase) string {
+	return typeBaseString(t)
+}
+
+func (postgresDialect) PlaceholderFormat() string {
+	return "$%d"
+}
+
+// CanAlter returns true, PostgreSQL can alter everything
+func (postgresDialect) CanAlter(Change) bool {
+	return true
+}
+
+// TransactionalDDL returns true, PostgreSQL rolls back the structure changes
+func (postgresDialect) TransactionalDDL() bool {
+	return true
+}
+
+func (postgresDialect) makeDiff(current, new *Root) Diff {
+	return makePostgresDiff(current, new)
+}
+
+func (postgresDialect) readStructure(db queryer, database string) (Root, error) {
+	return getAllDatabaseInformation(db, database)
+}
+
+func (postgresDialect) qualifiedName(schema, table string) string {
+	return fmt.Sprintf("%s.%s", schema, table)
+}
+
+func (postgresDialect) connectionString(options ConnectionOptions) string {
+	return fmt.Sprintf(
+		"%s://%s:%s@%s/%s",
+		options.Driver,
+		url.QueryEscape(options.UserName),
+		url.QueryEscape(options.Password),
+		options.Host,
+		options.Database,
+	)
+}
+
+// scriptStatement makes the statement that has no dependencies, so it keeps its place in the script
+func scriptStatement(script string, change Change, class StatementClass) sqt.SqlStmt {
+	var stmt sqt.SqlStmt = &scriptStmt{SqlStmt: &sqt.SelectStmt{}, Script: script}
+	if change.Kind != "" {
+		stmt = describeStatement(stmt, change)
+	}
+	return markStatement(stmt, class)
+}
+
+// referenceAction returns the empty string for the default action
+func referenceAction(action *string) string {
+	if action == nil || strings.EqualFold(*action, "no action") {
+		return ""
+	}
+	return strings.ToLower(*action)
+}
@@ -0,0 +1,613 @@
+package dragonfly
+
+import (
+	"fmt"
+	"github.com/iv-menshenin/dragonfly/utils"
+	sqt "github.com/iv-menshenin/sql-ast"
+	"sort"
+	"strings"
+)
+
+type (
+	mysqlDialect struct{}
+	// mysqlTable is the table as MySQL sees it: the types are mapped to the MySQL types,
+	// the tables of all the schemas are placed in the database the migration is applied to
+	mysqlTable struct {
+		Schema      string
+		Name        string
+		Columns     []mysqlColumn
+		PrimaryKey  *mysqlKey
+		Unique      []mysqlKey
+		ForeignKeys []mysqlForeignKey
+		Checks      []mysqlCheck
+		Indices     IndicesContainer
+	}
+	mysqlColumn struct {
+		Name          string
+		Type          string
+		NotNull       bool
+		Default       string
+		AutoIncrement bool
+		source        Column
+	}
+	mysqlKey struct {
+		Name    string         `json:"name"`
+		Type    ConstraintType `json:"-"`
+		Columns []string       `json:"columns"`
+	}
+	mysqlForeignKey struct {
+		mysqlKey
+		Table      string
+		RefColumns []string
+		OnUpdate   string
+		OnDelete   string
+	}
+	mysqlCheck struct {
+		Name       string
+		Expression string
+	}
+)
+
+func (mysqlDialect) Name() string {
+	return DialectMySQL
+}
+
+func (mysqlDialect) DriverName() string {
+	return "mysql"
+}
+
+// TypeName maps the type to the type of MySQL, arrays are stored as json
+func (mysqlDialect) TypeName(t TypeBase) string {
+	if t.IsArray {
+		return "json"
+	}
+	if strings.HasPrefix(strings.ToLower(t.Type), "enum(") {
+		// the enum column read from the database keeps its labels
+		return t.Type
+	}
+	switch typeName := canonicalTypeName(t.Type); typeName {
+	case "int2":
+		return "smallint"
+	case "int4":
+		return "int"
+	case "int8":
+		return "bigint"
+	case "bool":
+		return "tinyint(1)"
+	case "float4":
+		return "float"
+	case "float8":
+		return "double"
+	case "numeric":
+		if t.Length == nil {
+			// the precision of PostgreSQL numeric is not limited, this is the widest decimal of MySQL
+			return "decimal(65,30)"
+		}
+		var precision = 0
+		if t.Precision != nil {
+			precision = *t.Precision
+		}
+		return fmt.Sprintf("decimal(%d,%d)", *t.Length, precision)
+	case "varchar":
+		if t.Length == nil {
+			return "text"
+		}
+		return fmt.Sprintf("varchar(%d)", *t.Length)
+	case "char":
+		if t.Length == nil {
+			return "char(1)"
+		}
+		return fmt.Sprintf("char(%d)", *t.Length)
+	case "uuid":
+		return "char(36)"
+	case "json", "jsonb":
+		return "json"
+	case "bytea", "blob":
+		return "blob"
+	case "timestamp":
+		return "datetime"
+	case "timestamptz":
+		return "timestamp"
+	case "date", "time", "text":
+		return typeName
+	}
+	return "text"
+}
+
+// PlaceholderFormat returns the positional parameter, the parameters of MySQL are not numbered
+func (mysqlDialect) PlaceholderFormat() string {
+	return "?"
+}
+
+// CanAlter returns true, MySQL alters the tables in place
+func (mysqlDialect) CanAlter(Change) bool {
+	return true
+}
+
+// TransactionalDDL returns false, MySQL commits each statement that changes the structure
+func (mysqlDialect) TransactionalDDL() bool {
+	return false
+}
+
+func (mysqlDialect) qualifiedName(_, table string) string {
+	return table
+}
+
+// connectionString returns the data source name in the form of the go-sql-driver/mysql
+func (mysqlDialect) connectionString(options ConnectionOptions) string {
+	return fmt.Sprintf("%s:%s@tcp(%s)/%s", options.UserName, options.Password, options.Host, options.Database)
+}
+
+// makeDiff compares the tables of all the schemas as if they were in one database. Constraints are dropped before
+// the columns are changed and created after that, the foreign keys of new tables are created when all tables exist
+func (c mysqlDialect) makeDiff(current, new *Root) Diff {
+	for _, schema := range new.Schemas {
+		if len(schema.Value.Data) > 0 {
+			panic(fmt.Sprintf("seed data is not supported by the `%s` dialect", DialectMySQL))
+		}
+	}
+	var (
+		result = Diff{
+			preInstall:   make([]sqt.SqlStmt, 0),
+			install:      make([]sqt.SqlStmt, 0),
+			afterInstall: make([]sqt.SqlStmt, 0),
+		}
+		currentTables = c.tables(current)
+		newTables     = c.tables(new)
+	)
+	for _, name := range mysqlTableNames(newTables) {
+		table := newTables[name]
+		actual, ok := currentTables[name]
+		if !ok {
+			result.install = append(result.install, scriptStatement(
+				table.createScript(),
+				Change{Kind: ObjectTable, Schema: table.Schema, Name: table.Name, Action: ActionCreate},
+				StatementSafe,
+			))
+			for _, key := range table.ForeignKeys {
+				result.afterInstall = append(result.afterInstall, table.addConstraint(key, Change{}))
+			}
+			result.afterInstall = append(result.afterInstall, table.createIndices(table.Indices)...)
+			continue
+		}
+		for _, change := range actual.changes(table) {
+			switch {
+			case change.Kind == ObjectColumn:
+				result.install = append(result.install, actual.alterColumn(table, change))
+			case change.Action == ActionCreate:
+				result.afterInstall = append(result.afterInstall, table.addConstraint(change.New, change))
+			case change.Action == ActionDrop:
+				result.preInstall = append(result.preInstall, actual.dropConstraint(change.Old, change))
+			default:
+				result.preInstall = append(result.preInstall, actual.dropConstraint(change.Old, change))
+				result.afterInstall = append(result.afterInstall, table.addConstraint(change.New, change))
+			}
+		}
+		drop, create := actual.diffIndices(table)
+		result.preInstall = append(result.preInstall, drop...)
+		result.afterInstall = append(result.afterInstall, create...)
+	}
+	for _, name := range mysqlTableNames(currentTables) {
+		if _, ok := newTables[name]; ok {
+			continue
+		}
+		actual := currentTables[name]
+		result.install = append(result.install, scriptStatement(
+			"drop table "+actual.Name,
+			Change{Kind: ObjectTable, Schema: actual.Schema, Name: actual.Name, Action: ActionDrop},
+			StatementDestructive,
+		))
+	}
+	return result
+}
+
+// tables collects the tables of all the schemas, the names of tables must be unique across the schemas
+func (c mysqlDialect) tables(db *Root) map[string]mysqlTable {
+	var result = make(map[string]mysqlTable)
+	for _, schema := range db.Schemas {
+		for name, table := range schema.Value.Tables {
+			if _, ok := result[strings.ToLower(name)]; ok {
+				panic(fmt.Sprintf("table `%s` is described in more than one schema, all the tables are placed in one MySQL database", name))
+			}
+			if table.hasStorageOptions() {
+				panic(fmt.Sprintf("storage options of `%s` are not supported by the `%s` dialect", name, DialectMySQL))
+			}
+			result[strings.ToLower(name)] = c.makeTable(db, schema.Value.Name, name, table)
+		}
+	}
+	for _, table := range result {
+		for i, key := range table.ForeignKeys {
+			if len(key.RefColumns) > 0 {
+				continue
+			}
+			// MySQL requires the referenced columns, the primary key is referenced by default
+			target, ok := result[strings.ToLower(key.Table)]
+			if !ok || target.PrimaryKey == nil {
+				panic(fmt.Sprintf("cannot find the primary key of `%s` referenced by `%s`", key.Table, key.Name))
+			}
+			table.ForeignKeys[i].RefColumns = target.PrimaryKey.Columns
+		}
+	}
+	return result
+}
+
+func mysqlTableNames(tables map[string]mysqlTable) []string {
+	var names = make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c mysqlDialect) makeTable(db *Root, schema, name string, table Table) mysqlTable {
+	var result = mysqlTable{Schema: schema, Name: name, Indices: table.Indices}
+	for _, constraint := range table.getAllConstraints() {
+		var key = mysqlKey{Name: constraint.Constraint.Name, Type: constraint.Constraint.Type, Columns: constraint.Columns}
+		switch constraint.Constraint.Type {
+		case ConstraintPrimaryKey:
+			result.PrimaryKey = &key
+		case ConstraintUniqueKey:
+			result.Unique = append(result.Unique, key)
+		case ConstraintForeignKey:
+			fk, _ := constraint.Constraint.Parameters.Parameter.(ForeignKey)
+			var refColumns = constraint.RefColumns
+			if len(refColumns) == 0 && fk.ToColumn != "" {
+				refColumns = []string{fk.ToColumn}
+			}
+			var tableName = strings.Split(fk.ToTable, ".")
+			result.ForeignKeys = append(result.ForeignKeys, mysqlForeignKey{
+				mysqlKey:   key,
+				Table:      tableName[len(tableName)-1],
+				RefColumns: refColumns,
+				OnUpdate:   mysqlAction(fk.OnUpdate),
+				OnDelete:   mysqlAction(fk.OnDelete),
+			})
+		case ConstraintCheck:
+			if check, ok := constraint.Constraint.Parameters.Parameter.(Check); ok {
+				result.Checks = append(result.Checks, mysqlCheck{Name: key.Name, Expression: check.Expression})
+			}
+		}
+	}
+	for _, ref := range table.Columns {
+		var (
+			schema       = ref.Value.Schema.Value
+			base, custom = db.resolveLiteralType(schema.TypeBase)
+			column       = mysqlColumn{
+				Name:          ref.Value.Name,
+				Type:          "json",
+				NotNull:       schema.NotNull,
+				Default:       mysqlDefault(schema.Default),
+				AutoIncrement: strings.Contains(strings.ToLower(base.Type), "serial"),
+				source:        ref.Value,
+			}
+		)
+		switch {
+		case custom == nil:
+			column.Type = c.TypeName(base)
+		case strings.EqualFold(custom.Type, "enum") && !base.IsArray:
+			column.Type = mysqlEnumType(custom.Enum)
+		}
+		if column.AutoIncrement || result.PrimaryKey != nil && utils.ArrayContainsCI(result.PrimaryKey.Columns, column.Name) {
+			column.NotNull = true
+		}
+		result.Columns = append(result.Columns, column)
+	}
+	return result
+}
+
+// mysqlEnumType makes the enum column of the labels of the enum type, MySQL has no user types
+func mysqlEnumType(labels []EnumEntity) string {
+	var values = make([]string, 0, len(labels))
+	for _, label := range labels {
+		values = append(values, "'"+strings.ReplaceAll(label.Value, "'", "''")+"'")
+	}
+	return fmt.Sprintf("enum(%s)", strings.Join(values, ","))
+}
+
+// mysqlDefault brings the default value to the form in which it is compared and written to the table definition,
+// boolean values are stored as numbers
+func mysqlDefault(value interface{}) string {
+	expr := defaultExpression(value)
+	if expr == nil {
+		return ""
+	}
+	switch normalized := normalizeExpression(*expr); normalized {
+	case "null":
+		return ""
+	case "now()":
+		return "current_timestamp"
+	case "true":
+		return "1"
+	case "false":
+		return "0"
+	default:
+		return normalized
+	}
+}
+
+// mysqlAction returns the empty string for the default action, RESTRICT is the same as NO ACTION in MySQL
+func mysqlAction(action *string) string {
+	if action != nil && strings.EqualFold(*action, "restrict") {
+		return ""
+	}
+	return referenceAction(action)
+}
+
+func (c mysqlTable) column(name string) (mysqlColumn, bool) {
+	for _, column := range c.Columns {
+		if strings.EqualFold(column.Name, name) {
+			return column, true
+		}
+	}
+	return mysqlColumn{}, false
+}
+
+func (c mysqlColumn) equal(column mysqlColumn) bool {
+	return strings.EqualFold(c.Type, column.Type) &&
+		c.NotNull == column.NotNull &&
+		c.Default == column.Default &&
+		c.AutoIncrement == column.AutoIncrement
+}
+
+func (c mysqlColumn) definition() string {
+	var result = c.Name + " " + c.Type
+	if c.NotNull {
+		result += " not null"
+	}
+	if c.Default != "" {
+		if len(tokenizeExpression(c.Default)) > 1 {
+			// the expression must be enclosed in parentheses, literals and current_timestamp are written as is
+			result += " default (" + c.Default + ")"
+		} else {
+			result += " default " + c.Default
+		}
+	}
+	if c.AutoIncrement {
+		result += " auto_increment"
+	}
+	return result
+}
+
+func (c *mysqlKey) equal(key *mysqlKey) bool {
+	if c == nil || key == nil {
+		return c == key
+	}
+	return isSameColumns(c.Columns, key.Columns)
+}
+
+func (c mysqlForeignKey) equal(key mysqlForeignKey) bool {
+	return isSameColumns(c.Columns, key.Columns) &&
+		strings.EqualFold(c.Table, key.Table) &&
+		isSameColumns(c.RefColumns, key.RefColumns) &&
+		c.OnUpdate == key.OnUpdate &&
+		c.OnDelete == key.OnDelete
+}
+
+// changes describes what differs in the new table. The check constraints are not compared,
+// MySQL rewrites their expressions, so they are created along with the table only
+func (c mysqlTable) changes(table mysqlTable) []Change {
+	var (
+		result = make([]Change, 0)
+		add    = func(kind ObjectKind, name string, action ChangeAction, old, new interface{}) {
+			result = append(result, Change{
+				Kind:   kind,
+				Schema: table.Schema,
+				Table:  table.Name,
+				Name:   name,
+				Action: action,
+				Old:    old,
+				New:    new,
+			})
+		}
+	)
+	for _, column := range table.Columns {
+		current, ok := c.column(column.Name)
+		if !ok {
+			add(ObjectColumn, column.Name, ActionCreate, nil, column.source)
+		} else if !current.equal(column) {
+			add(ObjectColumn, column.Name, ActionAlter, current.source, column.source)
+		}
+	}
+	for _, column := range c.Columns {
+		if _, ok := table.column(column.Name); !ok {
+			add(ObjectColumn, column.Name, ActionDrop, column.source, nil)
+		}
+	}
+	if !c.PrimaryKey.equal(table.PrimaryKey) {
+		switch {
+		case c.PrimaryKey == nil:
+			add(ObjectConstraint, table.PrimaryKey.Name, ActionCreate, nil, *table.PrimaryKey)
+		case table.PrimaryKey == nil:
+			add(ObjectConstraint, c.PrimaryKey.Name, ActionDrop, *c.PrimaryKey, nil)
+		default:
+			add(ObjectConstraint, table.PrimaryKey.Name, ActionAlter, *c.PrimaryKey, *table.PrimaryKey)
+		}
+	}
+	for _, key := range table.Unique {
+		if !c.hasUnique(key) {
+			add(ObjectConstraint, key.Name, ActionCreate, nil, key)
+		}
+	}
+	for _, key := range c.Unique {
+		if !table.hasUnique(key) {
+			add(ObjectConstraint, key.Name, ActionDrop, key, nil)
+		}
+	}
+	for _, key := range table.ForeignKeys {
+		if !c.hasForeignKey(key) {
+			add(ObjectConstraint, key.Name, ActionCreate, nil, key)
+		}
+	}
+	for _, key := range c.ForeignKeys {
+		if !table.hasForeignKey(key) {
+			add(ObjectConstraint, key.Name, ActionDrop, key, nil)
+		}
+	}
+	return result
+}
+
+func (c mysqlTable) hasUnique(key mysqlKey) bool {
+	for _, unique := range c.Unique {
+		if isSameColumns(unique.Columns, key.Columns) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c mysqlTable) hasForeignKey(key mysqlForeignKey) bool {
+	for _, fk := range c.ForeignKeys {
+		if fk.equal(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// alterColumn makes the change of the column, the column of the new table is taken to describe it
+func (c mysqlTable) alterColumn(table mysqlTable, change Change) sqt.SqlStmt {
+	switch change.Action {
+	case ActionCreate:
+		column, _ := table.column(change.Name)
+		return scriptStatement(fmt.Sprintf("alter table %s add column %s", c.Name, column.definition()), change, StatementSafe)
+	case ActionAlter:
+		// the table is copied if the type is changed, so the statement locks it
+		column, _ := table.column(change.Name)
+		return scriptStatement(fmt.Sprintf("alter table %s modify column %s", c.Name, column.definition()), change, StatementBlocking)
+	case ActionDrop:
+		return scriptStatement(fmt.Sprintf("alter table %s drop column %s", c.Name, change.Name), change, StatementDestructive)
+	}
+	panic(fmt.Sprintf("cannot %s %s `%s` of `%s`", change.Action, change.Kind, change.Name, c.Name))
+}
+
+func (c mysqlTable) addConstraint(constraint interface{}, change Change) sqt.SqlStmt {
+	if change.Kind == "" {
+		change = Change{Kind: ObjectConstraint, Schema: c.Schema, Table: c.Name, Action: ActionCreate}
+	}
+	switch key := constraint.(type) {
+	case mysqlKey:
+		change.Name = key.Name
+		if key.Type == ConstraintPrimaryKey {
+			return scriptStatement(fmt.Sprintf("alter table %s add primary key (%s)", c.Name, strings.Join(key.Columns, ", ")), change, StatementBlocking)
+		}
+		return scriptStatement(fmt.Sprintf("alter table %s add %s", c.Name, key.definition()), change, StatementBlocking)
+	case mysqlForeignKey:
+		change.Name = key.Name
+		return scriptStatement(fmt.Sprintf("alter table %s add %s", c.Name, key.definition()), change, StatementBlocking)
+	}
+	panic(fmt.Sprintf("unexpected constraint %T of `%s`", constraint, c.Name))
+}
+
+func (c mysqlTable) dropConstraint(constraint interface{}, change Change) sqt.SqlStmt {
+	switch key := constraint.(type) {
+	case mysqlKey:
+		if key.Type == ConstraintPrimaryKey {
+			return scriptStatement(fmt.Sprintf("alter table %s drop primary key", c.Name), change, StatementBlocking)
+		}
+		// the unique constraint of MySQL is the unique index
+		return scriptStatement(fmt.Sprintf("alter table %s drop index %s", c.Name, key.Name), change, StatementSafe)
+	case mysqlForeignKey:
+		return scriptStatement(fmt.Sprintf("alter table %s drop foreign key %s", c.Name, key.Name), change, StatementSafe)
+	}
+	panic(fmt.Sprintf("unexpected constraint %T of `%s`", constraint, c.Name))
+}
+
+func (c mysqlKey) definition() string {
+	return mysqlConstraint(c.Name, fmt.Sprintf("unique (%s)", strings.Join(c.Columns, ", ")))
+}
+
+func (c mysqlForeignKey) definition() string {
+	var references = fmt.Sprintf("references %s (%s)", c.Table, strings.Join(c.RefColumns, ", "))
+	if c.OnUpdate != "" {
+		references += " on update " + c.OnUpdate
+	}
+	if c.OnDelete != "" {
+		references += " on delete " + c.OnDelete
+	}
+	return mysqlConstraint(c.Name, fmt.Sprintf("foreign key (%s) %s", strings.Join(c.Columns, ", "), references))
+}
+
+func mysqlConstraint(name, definition string) string {
+	if name == "" {
+		return definition
+	}
+	return fmt.Sprintf("constraint %s %s", name, definition)
+}
+
+// createScript describes the table without foreign keys, they are added when all the tables are created
+func (c mysqlTable) createScript() string {
+	var definitions = make([]string, 0, len(c.Columns)+len(c.Unique)+len(c.Checks)+1)
+	for _, column := range c.Columns {
+		definitions = append(definitions, column.definition())
+	}
+	if c.PrimaryKey != nil {
+		definitions = append(definitions, fmt.Sprintf("primary key (%s)", strings.Join(c.PrimaryKey.Columns, ", ")))
+	}
+	for _, key := range c.Unique {
+		definitions = append(definitions, key.definition())
+	}
+	for _, check := range c.Checks {
+		definitions = append(definitions, mysqlConstraint(check.Name, fmt.Sprintf("check (%s)", check.Expression)))
+	}
+	return fmt.Sprintf("create table %s (\n\t%s\n)", c.Name, strings.Join(definitions, ",\n\t"))
+}
+
+func (c mysqlTable) createIndices(indices IndicesContainer) []sqt.SqlStmt {
+	var result = make([]sqt.SqlStmt, 0, len(indices))
+	for _, index := range indices {
+		if index.Where != "" {
+			panic(fmt.Sprintf("partial index of `%s` is not supported by the `%s` dialect", c.Name, DialectMySQL))
+		}
+		var (
+			name   = c.indexName(index)
+			script = fmt.Sprintf("create index %s on %s (%s)", name, c.Name, strings.Join(index.Columns, ", "))
+		)
+		if index.IndexType == IndexTypeUnique {
+			script = "create unique" + strings.TrimPrefix(script, "create")
+		}
+		result = append(result, scriptStatement(
+			script,
+			Change{Kind: ObjectIndex, Schema: c.Schema, Table: c.Name, Name: name, Action: ActionCreate},
+			StatementSafe,
+		))
+	}
+	return result
+}
+
+// indexName makes the name of the index if the project does not name it
+func (c mysqlTable) indexName(index Index) string {
+	if index.Name != "" {
+		return index.Name
+	}
+	return fmt.Sprintf("%s_%s_idx", c.Name, strings.Join(index.Columns, "_"))
+}
+
+// diffIndices returns the indices that are dropped and the indices that are created, the changed index is created again
+func (c mysqlTable) diffIndices(table mysqlTable) (drop, create []sqt.SqlStmt) {
+	var created = make(IndicesContainer, 0)
+	for _, index := range table.Indices {
+		i := c.Indices.indexOf(index)
+		if i >= 0 && isSameColumns(c.Indices[i].Columns, index.Columns) && c.Indices[i].IndexType == index.IndexType {
+			continue
+		}
+		if i >= 0 {
+			drop = append(drop, c.dropIndex(c.Indices[i]))
+		}
+		created = append(created, index)
+	}
+	for _, index := range c.Indices {
+		if table.Indices.indexOf(index) < 0 {
+			drop = append(drop, c.dropIndex(index))
+		}
+	}
+	return drop, table.createIndices(created)
+}
+
+func (c mysqlTable) dropIndex(index Index) sqt.SqlStmt {
+	return scriptStatement(
+		fmt.Sprintf("drop index %s on %s", index.Name, c.Name),
+		Change{Kind: ObjectIndex, Schema: c.Schema, Table: c.Name, Name: index.Name, Action: ActionDrop},
+		StatementSafe,
+	)
+}
@@ -0,0 +1,481 @@
+package dragonfly
+
+import (
+	"fmt"
+	"github.com/iv-menshenin/go-ast"
+	"go/ast"
+	"strings"
+)
+
+const (
+	// the statement that changes the data, the changed rows are read by `sqlText` then
+	mysqlExecTextName   = "execText"
+	mysqlChangedName    = "changed"
+	mysqlInsertedIDName = "insertedID"
+	mysqlFilterArgsName = "filterArgs"
+)
+
+type (
+	// mysqlRowKey describes how the inserted row is found, MySQL cannot return the changed rows
+	mysqlRowKey struct {
+		Columns []string
+		// the key is the only column filled by AUTO_INCREMENT, its value is returned by LAST_INSERT_ID
+		AutoIncrement bool
+	}
+)
+
+var (
+	// the templates of the functions that change the data, they are used instead of funcTemplates for MySQL
+	mysqlFuncTemplates = map[ApiType]func(key mysqlRowKey) ApiFuncBuilder{
+		apiTypeInsertOne: func(key mysqlRowKey) ApiFuncBuilder { return mysqlInsertBuilder(key, false) },
+		apiTypeUpsertOne: func(key mysqlRowKey) ApiFuncBuilder { return mysqlInsertBuilder(key, true) },
+		apiTypeUpdateOne: func(mysqlRowKey) ApiFuncBuilder { return mysqlUpdateBuilder(findVariantOnce) },
+		apiTypeUpdateAll: func(mysqlRowKey) ApiFuncBuilder { return mysqlUpdateBuilder(findVariantAll) },
+		apiTypeDeleteOne: func(mysqlRowKey) ApiFuncBuilder { return mysqlDeleteBuilder(findVariantOnce) },
+		apiTypeDeleteAll: func(mysqlRowKey) ApiFuncBuilder { return mysqlDeleteBuilder(findVariantAll) },
+	}
+	mysqlDbExecFn = builders.CallFunctionDescriber{
+		FunctionName:                builders.SimpleSelector("db", "Exec"),
+		MinimumNumberOfArguments:    1,
+		ExtensibleNumberOfArguments: true,
+	}
+	mysqlLastInsertIdFn = builders.CallFunctionDescriber{
+		FunctionName:                builders.SimpleSelector(mysqlChangedName, "LastInsertId"),
+		MinimumNumberOfArguments:    0,
+		ExtensibleNumberOfArguments: false,
+	}
+	mysqlRowsCloseFn = builders.CallFunctionDescriber{
+		FunctionName:                builders.SimpleSelector("rows", "Close"),
+		MinimumNumberOfArguments:    0,
+		ExtensibleNumberOfArguments: false,
+	}
+)
+
+// makeMysqlRowKey returns the primary key of the table
+func makeMysqlRowKey(table *Table) mysqlRowKey {
+	for _, constraint := range table.getAllConstraints() {
+		if constraint.Constraint.Type != ConstraintPrimaryKey {
+			continue
+		}
+		var key = mysqlRowKey{Columns: constraint.Columns}
+		if len(key.Columns) == 1 {
+			if column, ok := table.Columns.tryToFind(key.Columns[0]); ok {
+				key.AutoIncrement = strings.Contains(strings.ToLower(column.Value.Schema.Value.Type), "serial")
+			}
+		}
+		return key
+	}
+	return mysqlRowKey{}
+}
+
+// mysqlExecStatement generates
+//
+//	if <resultVarName>, err = db.Exec(execText, args...); err != nil {
+//	  return
+//	}
+func mysqlExecStatement(resultVarName string) ast.Stmt {
+	return builders.MakeCallWithErrChecking(
+		resultVarName,
+		builders.CallEllipsis(mysqlDbExecFn, ast.NewIdent(mysqlExecTextName), ast.NewIdent(ArgsVariable.String())),
+	)
+}
+
+// mysqlFormatStatement generates
+//
+//	<varName> = fmt.Sprintf(<varName>, args...)
+func mysqlFormatStatement(varName string, args ...ast.Expr) ast.Stmt {
+	return builders.Assign(
+		builders.MakeVarNames(varName),
+		builders.Assignment,
+		builders.Call(builders.SprintfFn, append([]ast.Expr{ast.NewIdent(varName)}, args...)...),
+	)
+}
+
+// mysqlJoinExpr generates
+//
+//	strings.Join(<varName>, <separator>)
+func mysqlJoinExpr(varName, separator string) ast.Expr {
+	return builders.Call(builders.StringsJoinFn, ast.NewIdent(varName), builders.StringConstant(separator).Expr())
+}
+
+// mysqlFiltersExpr generates
+//
+//	"(" + strings.Join(filters, ") and (") + ")"
+func mysqlFiltersExpr() ast.Expr {
+	return builders.Add(
+		builders.StringConstant("(").Expr(),
+		mysqlJoinExpr(FiltersVariable.String(), ") and ("),
+		builders.StringConstant(")").Expr(),
+	)
+}
+
+func mysqlStringsVariable(varName string, count int) ast.Spec {
+	return builders.VariableValue(
+		varName,
+		builders.Call(builders.MakeFn, builders.ArrayType(ast.NewIdent("string")), builders.Zero, builders.IntegerConstant(count).Expr()),
+	)
+}
+
+func mysqlArgsVariable(count int) ast.Spec {
+	return builders.VariableValue(
+		ArgsVariable.String(),
+		builders.Call(builders.MakeFn, builders.ArrayType(builders.EmptyInterface), builders.Zero, builders.IntegerConstant(count).Expr()),
+	)
+}
+
+// mysqlInsertBuilder inserts the row, then reads it by the key. The key is taken from LAST_INSERT_ID if it is filled
+// by AUTO_INCREMENT, otherwise from the inserted values. The upsert finds the row by the columns of the conflict,
+// the existing row of the table with AUTO_INCREMENT is found by LAST_INSERT_ID, it is set by the update
+func mysqlInsertBuilder(key mysqlRowKey, upsert bool) ApiFuncBuilder {
+	const (
+		sqlTextName = "sqlText"
+	)
+	return func(
+		fullTableName, functionName, rowStructName string,
+		optionFields, mutableFields, rowFields []dataCellFactory,
+	) AstDataChain {
+		var (
+			fieldRefs, outColumnList = ExtractDestinationFieldRefsFromStruct(ScanDestVariable.String(), rowFields)
+			keyColumns               = key.Columns
+			execQuery                = fmt.Sprintf("insert into %s (%%s) values (%%s)", fullTableName)
+			formatArgs               = []ast.Expr{mysqlJoinExpr(FieldsVariable.String(), ", "), mysqlJoinExpr(ValuesVariable.String(), ", ")}
+		)
+		functionBody, functionTypes, functionAttrs := buildInputValuesProcessor(
+			"record",
+			makeExportedName(functionName+"Values"),
+			mutableFields,
+			InsertBuilderOptions,
+		)
+		if upsert {
+			if !key.AutoIncrement {
+				_, keyColumns = ExtractDestinationFieldRefsFromStruct("", optionFields)
+			}
+			var update = "%s"
+			if key.AutoIncrement {
+				update = fmt.Sprintf("%s = last_insert_id(%s), %%s", key.Columns[0], key.Columns[0])
+			}
+			execQuery += " on duplicate key update " + update
+			formatArgs = append(formatArgs, mysqlJoinExpr("update", ", "))
+			functionBody = append(
+				functionBody,
+				builders.Assign(
+					builders.MakeVarNames("update"),
+					builders.Definition,
+					builders.Call(
+						builders.MakeFn,
+						builders.ArrayType(ast.NewIdent("string")),
+						builders.Zero,
+						builders.Call(builders.LengthFn, ast.NewIdent(FieldsVariable.String())),
+					),
+				),
+				builders.Range(
+					true, "i", "", ast.NewIdent(FieldsVariable.String()),
+					builders.Assign(
+						builders.MakeVarNames("update"),
+						builders.Assignment,
+						builders.Call(
+							builders.AppendFn,
+							ast.NewIdent("update"),
+							builders.Call(
+								builders.SprintfFn,
+								builders.StringConstant("%s = values(%s)").Expr(),
+								builders.Index(ast.NewIdent(FieldsVariable.String()), builders.VariableName("i")),
+								builders.Index(ast.NewIdent(FieldsVariable.String()), builders.VariableName("i")),
+							),
+						),
+					),
+				),
+			)
+		}
+		if len(keyColumns) == 0 {
+			panic(fmt.Sprintf("cannot find the row inserted by `%s`, the table `%s` has no primary key", functionName, fullTableName))
+		}
+		var (
+			keyFilters = make([]string, 0, len(keyColumns))
+			variables  = []ast.Spec{
+				mysqlArgsVariable(len(mutableFields)),
+				mysqlStringsVariable(FieldsVariable.String(), len(mutableFields)),
+				mysqlStringsVariable(ValuesVariable.String(), len(mutableFields)),
+				builders.VariableValue(mysqlExecTextName, builders.StringConstant(execQuery).Expr()),
+			}
+		)
+		for _, column := range keyColumns {
+			keyFilters = append(keyFilters, column+" = ?")
+		}
+		sqlQuery := fmt.Sprintf("select %s from %s where %s", strings.Join(outColumnList, ", "), fullTableName, strings.Join(keyFilters, " and "))
+		functionBody = append(functionBody, mysqlFormatStatement(mysqlExecTextName, formatArgs...))
+		if key.AutoIncrement {
+			variables = append(
+				variables,
+				builders.VariableType(mysqlChangedName, builders.SimpleSelector("sql", "Result")),
+				builders.VariableType(mysqlInsertedIDName, ast.NewIdent("int64")),
+			)
+			functionBody = append(
+				functionBody,
+				mysqlExecStatement(mysqlChangedName),
+				builders.MakeCallWithErrChecking(mysqlInsertedIDName, builders.Call(mysqlLastInsertIdFn)),
+				mysqlKeyArgsStatement(ast.NewIdent(mysqlInsertedIDName)),
+			)
+		} else {
+			var keyValues = make([]ast.Expr, 0, len(keyColumns))
+			for _, column := range keyColumns {
+				keyValues = append(keyValues, mysqlInsertedValue(functionName, column, mutableFields))
+			}
+			functionBody = append(functionBody, mysqlExecStatement("_"), mysqlKeyArgsStatement(keyValues...))
+		}
+		functionBody = append(
+			append(
+				functionBody,
+				BuildExecutionBlockForFunction(wrapFetchOnceForScanner, fieldRefs, MakeExecutionOption(rowStructName, sqlTextName))...,
+			),
+			builders.Return(ast.NewIdent("result"), ast.NewIdent(sqlEmptyResultErrorName)),
+		)
+		functionBody = addVariablesToFunctionBody(functionBody, sqlTextName, sqlQuery, variables...)
+		return AstDataChain{
+			Types:     functionTypes,
+			Constants: nil,
+			Implementations: map[string]*ast.FuncDecl{
+				functionName: MakeDatabaseApiFunction(functionName, simpleResultOneRecord(rowStructName), functionBody, functionAttrs...),
+			},
+		}
+	}
+}
+
+// mysqlKeyArgsStatement generates
+//
+//	args = []interface{}{<values>}
+func mysqlKeyArgsStatement(values ...ast.Expr) ast.Stmt {
+	return builders.Assign(
+		builders.MakeVarNames(ArgsVariable.String()),
+		builders.Assignment,
+		&ast.CompositeLit{Type: builders.ArrayType(builders.EmptyInterface), Elts: values},
+	)
+}
+
+// mysqlInsertedValue returns the field of the inserted record that contains the value of the column
+func mysqlInsertedValue(functionName, column string, mutableFields []dataCellFactory) ast.Expr {
+	for _, field := range mutableFields {
+		if !strings.EqualFold(field.sqlExpr(), column) {
+			continue
+		}
+		for _, name := range field.getField().Names {
+			return builders.SimpleSelector("record", name.Name)
+		}
+	}
+	panic(fmt.Sprintf("cannot find the row inserted by `%s`, the column `%s` of the key is not inserted", functionName, column))
+}
+
+// mysqlUpdateBuilder updates the rows, then reads them by the same filters. The rows are not returned if the update
+// changes the columns they are filtered by
+func mysqlUpdateBuilder(variant findVariant) ApiFuncBuilder {
+	const (
+		sqlTextName = "sqlText"
+	)
+	var (
+		scanBlockWrapper ScanWrapper
+		resultExprFn     func(string) []*ast.Field
+		lastReturn       ast.Stmt
+	)
+	switch variant {
+	case findVariantOnce:
+		scanBlockWrapper = wrapFetchOnceForScanner
+		resultExprFn = simpleResultOneRecord
+		lastReturn = builders.Return(ast.NewIdent("result"), ast.NewIdent(sqlEmptyResultErrorName))
+	case findVariantAll:
+		scanBlockWrapper = wrapIteratorForScanner
+		resultExprFn = simpleResultArray
+		lastReturn = builders.ReturnEmpty()
+	default:
+		panic("cannot resolve 'variant'")
+	}
+	return func(
+		fullTableName, functionName, rowStructName string,
+		optionFields, mutableFields, rowFields []dataCellFactory,
+	) AstDataChain {
+		var (
+			fieldRefs, outColumnList = ExtractDestinationFieldRefsFromStruct(ScanDestVariable.String(), rowFields)
+		)
+		sqlQuery := fmt.Sprintf("select %s from %s where %%s", strings.Join(outColumnList, ", "), fullTableName)
+		functionBody, inputTypes, inputAttrs := buildInputValuesProcessor(
+			"values",
+			makeExportedName(functionName+"Values"),
+			mutableFields,
+			UpdateBuilderOptions,
+		)
+		findBlock, findTypes, findAttrs := buildFindArgumentsProcessor(
+			"filter",
+			makeExportedName(functionName+"Option"),
+			optionFields,
+			IncomingArgumentsBuilderOptions,
+		)
+		functionBody = append(
+			functionBody,
+			// the arguments of the filters follow the values
+			builders.Assign(
+				builders.MakeVarNames(mysqlFilterArgsName),
+				builders.Definition,
+				builders.Call(builders.LengthFn, ast.NewIdent(ArgsVariable.String())),
+			),
+		)
+		functionBody = append(functionBody, findBlock...)
+		functionBody = append(
+			functionBody,
+			mysqlFormatStatement(mysqlExecTextName, mysqlJoinExpr(FieldsVariable.String(), ", "), mysqlFiltersExpr()),
+			mysqlFormatStatement(sqlTextName, mysqlFiltersExpr()),
+			mysqlExecStatement("_"),
+			builders.Assign(
+				builders.MakeVarNames(ArgsVariable.String()),
+				builders.Assignment,
+				&ast.SliceExpr{X: ast.NewIdent(ArgsVariable.String()), Low: ast.NewIdent(mysqlFilterArgsName)},
+			),
+		)
+		functionBody = append(
+			append(
+				functionBody,
+				BuildExecutionBlockForFunction(scanBlockWrapper, fieldRefs, MakeExecutionOption(rowStructName, sqlTextName))...,
+			),
+			lastReturn,
+		)
+		functionBody = addVariablesToFunctionBody(
+			functionBody,
+			sqlTextName,
+			sqlQuery,
+			builders.VariableValue(mysqlExecTextName, builders.StringConstant(fmt.Sprintf("update %s set %%s where %%s", fullTableName)).Expr()),
+			mysqlArgsVariable(len(mutableFields)),
+			mysqlStringsVariable(FieldsVariable.String(), len(mutableFields)),
+			mysqlStringsVariable(FiltersVariable.String(), len(mutableFields)),
+		)
+		for key := range findTypes {
+			inputTypes[key] = findTypes[key]
+		}
+		return AstDataChain{
+			Types:     inputTypes,
+			Constants: nil,
+			Implementations: map[string]*ast.FuncDecl{
+				functionName: MakeDatabaseApiFunction(functionName, resultExprFn(rowStructName), functionBody, append(inputAttrs, findAttrs...)...),
+			},
+		}
+	}
+}
+
+// mysqlDeleteBuilder reads the rows and locks them, then deletes them by the same filters.
+// Unlike other dialects, nothing is deleted if deleteOne finds more than one row
+func mysqlDeleteBuilder(variant findVariant) ApiFuncBuilder {
+	const (
+		sqlTextName = "sqlText"
+	)
+	var (
+		scanBlockWrapper ScanWrapper
+		resultExprFn     func(string) []*ast.Field
+		lastStmts        []ast.Stmt
+		// rows are closed before the next statement, the connection can be busy with them
+		deleteStmts = []ast.Stmt{
+			builders.MakeCallWithErrChecking("", builders.Call(mysqlRowsCloseFn)),
+			mysqlExecStatement("_"),
+		}
+	)
+	switch variant {
+	case findVariantOnce:
+		scanBlockWrapper = func(stmts ...ast.Stmt) ast.Stmt {
+			return mysqlWrapFetchOnceBeforeDelete(deleteStmts, stmts...)
+		}
+		resultExprFn = simpleResultOneRecord
+		lastStmts = []ast.Stmt{builders.Return(ast.NewIdent("result"), ast.NewIdent(sqlEmptyResultErrorName))}
+	case findVariantAll:
+		scanBlockWrapper = wrapIteratorForScanner
+		resultExprFn = simpleResultArray
+		lastStmts = append(deleteStmts, builders.ReturnEmpty())
+	default:
+		panic("cannot resolve 'variant'")
+	}
+	return func(
+		fullTableName, functionName, rowStructName string,
+		optionFields, _, rowFields []dataCellFactory,
+	) AstDataChain {
+		var (
+			fieldRefs, columnList = ExtractDestinationFieldRefsFromStruct(ScanDestVariable.String(), rowFields)
+		)
+		sqlQuery := fmt.Sprintf("select %s from %s where %%s for update", strings.Join(columnList, ", "), fullTableName)
+		functionBody, findTypes, findAttrs := buildFindArgumentsProcessor(
+			"find",
+			functionName+"Option",
+			optionFields,
+			DeleteBuilderOptions,
+		)
+		functionBody = append(
+			functionBody,
+			&ast.IfStmt{
+				Cond: builders.MakeLenGreatThanZero(FiltersVariable.String()),
+				Body: builders.Block(
+					mysqlFormatStatement(sqlTextName, mysqlFiltersExpr()),
+					mysqlFormatStatement(mysqlExecTextName, mysqlFiltersExpr()),
+				),
+				Else: builders.Block(
+					mysqlFormatStatement(sqlTextName, builders.StringConstant("/* ERROR: CANNOT DELETE ALL */ !").Expr()),
+					mysqlFormatStatement(mysqlExecTextName, builders.StringConstant("/* ERROR: CANNOT DELETE ALL */ !").Expr()),
+				),
+			},
+		)
+		functionBody = append(
+			append(
+				functionBody,
+				BuildExecutionBlockForFunction(scanBlockWrapper, fieldRefs, MakeExecutionOption(rowStructName, sqlTextName))...,
+			),
+			lastStmts...,
+		)
+		functionBody = addVariablesToFunctionBody(
+			functionBody,
+			sqlTextName,
+			sqlQuery,
+			builders.VariableValue(mysqlExecTextName, builders.StringConstant(fmt.Sprintf("delete from %s where %%s", fullTableName)).Expr()),
+			mysqlArgsVariable(len(optionFields)),
+			mysqlStringsVariable(FiltersVariable.String(), len(optionFields)),
+		)
+		return AstDataChain{
+			Types:     findTypes,
+			Constants: nil,
+			Implementations: map[string]*ast.FuncDecl{
+				functionName: MakeDatabaseApiFunction(functionName, resultExprFn(rowStructName), functionBody, findAttrs...),
+			},
+		}
+	}
+}
+
+// mysqlWrapFetchOnceBeforeDelete generates a code to read the only record before it is deleted
+//
+//	Example:
+//	if rows.Next() {
+//	  if err = rows.Err(); err != nil {
+//	    return
+//	  }
+//	  // *** starts printing `stmts` from arguments
+//	  var row BaseAccountServiceRow
+//	  if err = rows.Scan(&row.Id, &row.AccountId, &row.ServiceId); err != nil {
+//	    return
+//	  }
+//	  // *** ends printing `stmts` from arguments
+//	  if rows.Next() {
+//	    return row, SingletonViolation
+//	  }
+//	  // *** starts printing `deleteStmts` from arguments
+//	  if err = rows.Close(); err != nil {
+//	    return
+//	  }
+//	  if _, err = db.Exec(execText, args...); err != nil {
+//	    return
+//	  }
+//	  // *** ends printing `deleteStmts` from arguments
+//	  return row, nil
+//	}
+func mysqlWrapFetchOnceBeforeDelete(deleteStmts []ast.Stmt, stmts ...ast.Stmt) ast.Stmt {
+	var body = append([]ast.Stmt{builders.MakeCallWithErrChecking("", builders.Call(builders.RowsErrFn))}, stmts...)
+	body = append(body, builders.If(
+		builders.Call(builders.RowsNextFn),
+		builders.Return(ast.NewIdent("row"), ast.NewIdent(sqlSingletonViolationErrorName)),
+	))
+	body = append(body, deleteStmts...)
+	return builders.If(
+		builders.Call(builders.RowsNextFn),
+		append(body, builders.Return(ast.NewIdent("row"), builders.Nil))...,
+	)
+}
@@ -0,0 +1,354 @@
+package dragonfly
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	mysqlTablesQuery = `
+select table_name
+  from information_schema.tables
+ where table_schema = ?
+   and table_type = 'BASE TABLE'
+ order by table_name;`
+	mysqlColumnsQuery = `
+select table_name, column_name, column_type, data_type, is_nullable, column_default, extra
+  from information_schema.columns
+ where table_schema = ?
+ order by table_name, ordinal_position;`
+	mysqlConstraintsQuery = `
+select tc.table_name, tc.constraint_name, tc.constraint_type, kcu.column_name,
+       kcu.referenced_table_name, kcu.referenced_column_name,
+       coalesce(rc.update_rule, ''), coalesce(rc.delete_rule, '')
+  from information_schema.table_constraints tc
+  join information_schema.key_column_usage kcu
+    on kcu.constraint_schema = tc.constraint_schema
+   and kcu.table_name = tc.table_name
+   and kcu.constraint_name = tc.constraint_name
+  left join information_schema.referential_constraints rc
+    on rc.constraint_schema = tc.constraint_schema
+   and rc.table_name = tc.table_name
+   and rc.constraint_name = tc.constraint_name
+ where tc.table_schema = ?
+   and tc.constraint_type in ('PRIMARY KEY', 'UNIQUE', 'FOREIGN KEY')
+ order by tc.table_name, tc.constraint_name, kcu.ordinal_position;`
+	mysqlIndicesQuery = `
+select table_name, index_name, non_unique = 0, column_name
+  from information_schema.statistics
+ where table_schema = ?
+ order by table_name, index_name, seq_in_index;`
+
+	mysqlConstraintPrimaryKey = "PRIMARY KEY"
+	mysqlConstraintUnique     = "UNIQUE"
+	mysqlConstraintForeignKey = "FOREIGN KEY"
+)
+
+type (
+	mysqlRawTable struct {
+		Name        string
+		Columns     []mysqlRawColumn
+		Constraints []mysqlRawConstraint
+		Indices     []mysqlRawIndex
+	}
+	mysqlRawColumn struct {
+		Table      string
+		Name       string
+		ColumnType string
+		DataType   string
+		Nullable   string
+		Default    *string
+		Extra      string
+	}
+	// mysqlRawConstraint is the column of the constraint, the constraint of several columns is described by several rows
+	mysqlRawConstraint struct {
+		Table     string
+		Name      string
+		Type      string
+		Column    string
+		RefTable  *string
+		RefColumn *string
+		OnUpdate  string
+		OnDelete  string
+	}
+	mysqlRawIndex struct {
+		Table  string
+		Name   string
+		Unique bool
+		Column string
+	}
+)
+
+// readStructure reads the tables of the database, all of them are placed in the schema named as the database
+func (c mysqlDialect) readStructure(db queryer, database string) (Root, error) {
+	var (
+		tables = make(map[string]*mysqlRawTable)
+		names  = make([]string, 0)
+	)
+	rows, err := db.Query(mysqlTablesQuery, database)
+	if err != nil {
+		return Root{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return Root{}, err
+		}
+		tables[name], names = &mysqlRawTable{Name: name}, append(names, name)
+	}
+	if err = rows.Err(); err != nil {
+		return Root{}, err
+	}
+	if err = readMysqlColumns(db, database, tables); err != nil {
+		return Root{}, err
+	}
+	if err = readMysqlConstraints(db, database, tables); err != nil {
+		return Root{}, err
+	}
+	if err = readMysqlIndices(db, database, tables); err != nil {
+		return Root{}, err
+	}
+	var result = make(TablesContainer, len(tables))
+	for _, name := range names {
+		result[name] = tables[name].toTable()
+	}
+	return Root{
+		Dialect: DialectMySQL,
+		Schemas: []SchemaRef{{Value: Schema{Name: database, Tables: result}}},
+	}, nil
+}
+
+func readMysqlColumns(db queryer, database string, tables map[string]*mysqlRawTable) error {
+	rows, err := db.Query(mysqlColumnsQuery, database)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var column mysqlRawColumn
+		if err = rows.Scan(&column.Table, &column.Name, &column.ColumnType, &column.DataType, &column.Nullable, &column.Default, &column.Extra); err != nil {
+			return err
+		}
+		if table, ok := tables[column.Table]; ok {
+			table.Columns = append(table.Columns, column)
+		}
+	}
+	return rows.Err()
+}
+
+func readMysqlConstraints(db queryer, database string, tables map[string]*mysqlRawTable) error {
+	rows, err := db.Query(mysqlConstraintsQuery, database)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var constraint mysqlRawConstraint
+		if err = rows.Scan(
+			&constraint.Table,
+			&constraint.Name,
+			&constraint.Type,
+			&constraint.Column,
+			&constraint.RefTable,
+			&constraint.RefColumn,
+			&constraint.OnUpdate,
+			&constraint.OnDelete,
+		); err != nil {
+			return err
+		}
+		if table, ok := tables[constraint.Table]; ok {
+			table.Constraints = append(table.Constraints, constraint)
+		}
+	}
+	return rows.Err()
+}
+
+func readMysqlIndices(db queryer, database string, tables map[string]*mysqlRawTable) error {
+	rows, err := db.Query(mysqlIndicesQuery, database)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var index mysqlRawIndex
+		if err = rows.Scan(&index.Table, &index.Name, &index.Unique, &index.Column); err != nil {
+			return err
+		}
+		if table, ok := tables[index.Table]; ok {
+			table.Indices = append(table.Indices, index)
+		}
+	}
+	return rows.Err()
+}
+
+// toTable describes the table in the form of the project. The primary key of MySQL is always named PRIMARY,
+// so its name is made from the name of the table
+func (c mysqlRawTable) toTable() Table {
+	var table = Table{Columns: make(ColumnsContainer, 0, len(c.Columns))}
+	for i, raw := range c.Columns {
+		table.Columns = append(table.Columns, ColumnRef{
+			Value: Column{
+				Name: raw.Name,
+				Schema: ColumnSchemaRef{
+					Value: DomainSchema{
+						TypeBase: parseMysqlType(raw.ColumnType, raw.Extra),
+						NotNull:  strings.EqualFold(raw.Nullable, "no"),
+						Default:  raw.defaultValue(),
+					},
+				},
+			},
+			ord: i,
+		})
+	}
+	var (
+		constraints = make(map[string]int)
+		names       = make(map[string]struct{})
+	)
+	for _, raw := range c.Constraints {
+		names[strings.ToLower(raw.Name)] = struct{}{}
+		i, ok := constraints[raw.Name]
+		if !ok {
+			i, constraints[raw.Name] = len(table.Constraints), len(table.Constraints)
+			table.Constraints = append(table.Constraints, raw.constraint(c.Name))
+		}
+		table.Constraints[i].Columns = append(table.Constraints[i].Columns, raw.Column)
+		if raw.RefColumn != nil {
+			table.Constraints[i].RefColumns = append(table.Constraints[i].RefColumns, *raw.RefColumn)
+		}
+	}
+	for i, constraint := range table.Constraints {
+		// the single referenced column is described by the parameters of the foreign key
+		if fk, ok := constraint.Constraint.Parameters.Parameter.(ForeignKey); ok && len(constraint.RefColumns) == 1 {
+			fk.ToColumn = constraint.RefColumns[0]
+			table.Constraints[i].Constraint.Parameters.Parameter, table.Constraints[i].RefColumns = fk, nil
+		}
+	}
+	var indices = make(map[string]int)
+	for _, raw := range c.Indices {
+		if _, ok := names[strings.ToLower(raw.Name)]; ok || raw.Name == "PRIMARY" {
+			// the index is made by the constraint
+			continue
+		}
+		i, ok := indices[raw.Name]
+		if !ok {
+			var indexType = IndexTypeIndex
+			if raw.Unique {
+				indexType = IndexTypeUnique
+			}
+			i, indices[raw.Name] = len(table.Indices), len(table.Indices)
+			table.Indices = append(table.Indices, Index{Name: raw.Name, IndexType: indexType})
+		}
+		table.Indices[i].Columns = append(table.Indices[i].Columns, raw.Column)
+	}
+	return table
+}
+
+func (c mysqlRawConstraint) constraint(tableName string) ConstraintSchema {
+	switch c.Type {
+	case mysqlConstraintPrimaryKey:
+		return ConstraintSchema{Constraint: Constraint{Name: "pk_" + tableName, Type: ConstraintPrimaryKey}}
+	case mysqlConstraintUnique:
+		return ConstraintSchema{Constraint: Constraint{Name: c.Name, Type: ConstraintUniqueKey}}
+	case mysqlConstraintForeignKey:
+		var fk = ForeignKey{OnUpdate: mysqlRawAction(c.OnUpdate), OnDelete: mysqlRawAction(c.OnDelete)}
+		if c.RefTable != nil {
+			fk.ToTable = *c.RefTable
+		}
+		return ConstraintSchema{Constraint: Constraint{Name: c.Name, Type: ConstraintForeignKey, Parameters: ConstraintParameters{Parameter: fk}}}
+	}
+	panic(fmt.Sprintf("unexpected constraint type `%s` of `%s`", c.Type, c.Name))
+}
+
+func mysqlRawAction(action string) *string {
+	if action == "" || strings.EqualFold(action, "restrict") || strings.EqualFold(action, "no action") {
+		return nil
+	}
+	action = strings.ToLower(action)
+	return &action
+}
+
+// defaultValue brings the default value to the form of the project. MySQL describes the string literal without quotes,
+// MariaDB quotes it and describes the absence of the default value as NULL
+func (c mysqlRawColumn) defaultValue() *string {
+	if c.Default == nil || *c.Default == "NULL" {
+		return nil
+	}
+	var value = *c.Default
+	switch {
+	case strings.Contains(strings.ToUpper(c.Extra), "DEFAULT_GENERATED"):
+		// the expression
+	case strings.HasPrefix(strings.ToLower(value), "current_timestamp"):
+		// the current time is not marked as the expression by MySQL 5.7
+		value = "current_timestamp"
+	case strings.HasPrefix(value, "'"):
+		// MariaDB quotes the literal
+	case mysqlQuotedDataTypes[strings.ToLower(c.DataType)]:
+		value = "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	}
+	return &value
+}
+
+var (
+	// the types whose default values are string literals
+	mysqlQuotedDataTypes = map[string]bool{
+		"char": true, "varchar": true, "tinytext": true, "text": true, "mediumtext": true, "longtext": true,
+		"enum": true, "set": true, "date": true, "time": true, "datetime": true, "timestamp": true,
+	}
+	// the types of MySQL in terms of PostgreSQL, TypeName brings them back
+	mysqlTypeNames = map[string]string{
+		"tinyint":    "int2",
+		"smallint":   "int2",
+		"mediumint":  "int4",
+		"int":        "int4",
+		"integer":    "int4",
+		"bigint":     "int8",
+		"float":      "float4",
+		"double":     "float8",
+		"real":       "float8",
+		"decimal":    "numeric",
+		"tinytext":   "text",
+		"mediumtext": "text",
+		"longtext":   "text",
+		"tinyblob":   "bytea",
+		"blob":       "bytea",
+		"mediumblob": "bytea",
+		"longblob":   "bytea",
+		"binary":     "bytea",
+		"varbinary":  "bytea",
+		"datetime":   "timestamp",
+		"timestamp":  "timestamptz",
+	}
+	// the auto incremented integers are described as serial types
+	mysqlSerialTypes = map[string]string{
+		"int2": "smallserial",
+		"int4": "serial",
+		"int8": "bigserial",
+	}
+)
+
+// parseMysqlType describes the column type like `int(11) unsigned` or `decimal(10,2)` in terms of PostgreSQL
+func parseMysqlType(columnType, extra string) TypeBase {
+	var declared = strings.TrimSpace(columnType)
+	if strings.HasPrefix(strings.ToLower(declared), "enum(") {
+		// the labels are case sensitive
+		return TypeBase{Type: declared}
+	}
+	declared = strings.ToLower(declared)
+	if declared == "tinyint(1)" {
+		return TypeBase{Type: "bool"}
+	}
+	declared = strings.TrimSpace(strings.NewReplacer(" unsigned", "", " zerofill", "").Replace(declared))
+	var result = parseDeclaredType(declared)
+	if typeName, ok := mysqlTypeNames[result.Type]; ok {
+		result.Type = typeName
+		if typeName != "numeric" {
+			// the display width of integers is not the length
+			result.Length, result.Precision = nil, nil
+		}
+	}
+	if serial, ok := mysqlSerialTypes[result.Type]; ok && strings.Contains(strings.ToLower(extra), "auto_increment") {
+		result.Type = serial
+	}
+	return result
+}
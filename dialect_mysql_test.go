@@ -0,0 +1,307 @@
+package dragonfly
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMysqlDialect_makeDiff(t *testing.T) {
+	const current = `
+dialect: mysql
+schemas:
+  - name: shop
+    tables:
+      items:
+        columns:
+          - name: id
+            schema: { type: bigserial }
+            constraints:
+              - name: pk_items
+                type: primary key
+          - name: code
+            schema: { type: varchar, length: 20, not_null: true }
+            constraints:
+              - name: uq_items_code
+                type: unique
+          - name: title
+            schema: { type: varchar, length: 20 }
+        indices:
+          - name: ix_items_title
+            type: index
+            columns: [title]
+      logs:
+        columns:
+          - name: message
+            schema: { type: text }
+`
+	tests := []struct {
+		name    string
+		project string
+		want    []string
+	}{
+		{
+			name:    "nothing changed",
+			project: current,
+			want:    []string{},
+		},
+		{
+			name: "columns and constraints are changed",
+			project: `
+dialect: mysql
+schemas:
+  - name: shop
+    types:
+      status:
+        type: enum
+        enum:
+          - value: new
+          - value: done
+    tables:
+      items:
+        columns:
+          - name: id
+            schema: { type: bigserial }
+            constraints:
+              - name: pk_items
+                type: primary key
+          - name: code
+            schema: { type: varchar, length: 20, not_null: true }
+          - name: title
+            schema: { type: varchar, length: 100, not_null: true, default: untitled }
+          - name: state
+            schema: { type: shop.status, not_null: true, default: new }
+        indices:
+          - name: ix_items_title
+            type: unique
+            columns: [title]
+      logs:
+        columns:
+          - name: message
+            schema: { type: text }
+`,
+			want: []string{
+				"alter table items drop index uq_items_code",
+				"drop index ix_items_title on items",
+				"alter table items modify column title varchar(100) not null default 'untitled'",
+				"alter table items add column state enum('new','done') not null default 'new'",
+				"create unique index ix_items_title on items (title)",
+			},
+		},
+		{
+			name: "tables are created and dropped",
+			project: `
+dialect: mysql
+schemas:
+  - name: shop
+    tables:
+      items:
+        columns:
+          - name: id
+            schema: { type: bigserial }
+            constraints:
+              - name: pk_items
+                type: primary key
+          - name: code
+            schema: { type: varchar, length: 20, not_null: true }
+            constraints:
+              - name: uq_items_code
+                type: unique
+          - name: title
+            schema: { type: varchar, length: 20 }
+        indices:
+          - name: ix_items_title
+            type: index
+            columns: [title]
+  - name: sales
+    tables:
+      orders:
+        columns:
+          - name: item_id
+            schema: { type: int8, not_null: true }
+            constraints:
+              - name: fk_orders_item
+                type: foreign key
+                parameters: { table: shop.items, on_delete: cascade }
+          - name: paid
+            schema: { type: bool, not_null: true, default: false }
+          - name: created
+            schema: { type: timestamp, not_null: true, default: "now()" }
+`,
+			want: []string{
+				"create table orders (\n\titem_id bigint not null,\n\tpaid tinyint(1) not null default 0,\n\tcreated datetime not null default current_timestamp\n)",
+				"drop table logs",
+				"alter table orders add constraint fk_orders_item foreign key (item_id) references items (id) on delete cascade",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := readProjectSnapshot([]byte(current))
+			if err != nil {
+				t.Fatalf("readProjectSnapshot() error = %v", err)
+			}
+			project, err := readProjectSnapshot([]byte(tt.project))
+			if err != nil {
+				t.Fatalf("readProjectSnapshot() error = %v", err)
+			}
+			diff := MakeDiff(actual, project)
+			var got = make([]string, 0)
+			for _, stmt := range diff.allStatements() {
+				got = append(got, stmt.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("makeDiff() got:\n%s\nwant:\n%s", strings.Join(got, ";\n"), strings.Join(tt.want, ";\n"))
+			}
+		})
+	}
+}
+
+func Test_parseMysqlType(t *testing.T) {
+	var intPtr = func(i int) *int { return &i }
+	tests := []struct {
+		columnType string
+		extra      string
+		want       TypeBase
+	}{
+		{columnType: "int(11)", want: TypeBase{Type: "int4"}},
+		{columnType: "bigint unsigned", extra: "auto_increment", want: TypeBase{Type: "bigserial"}},
+		{columnType: "tinyint(1)", want: TypeBase{Type: "bool"}},
+		{columnType: "decimal(10,2)", want: TypeBase{Type: "numeric", Length: intPtr(10), Precision: intPtr(2)}},
+		{columnType: "varchar(20)", want: TypeBase{Type: "varchar", Length: intPtr(20)}},
+		{columnType: "datetime", extra: "DEFAULT_GENERATED", want: TypeBase{Type: "timestamp"}},
+		{columnType: "enum('New','Done')", want: TypeBase{Type: "enum('New','Done')"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.columnType, func(t *testing.T) {
+			got := parseMysqlType(tt.columnType, tt.extra)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMysqlType() = %+v, want %+v", got, tt.want)
+			}
+			// the type read from the database is the same type for the dialect
+			if (mysqlDialect{}).TypeName(got) != strings.NewReplacer("(11)", "", " unsigned", "").Replace(tt.columnType) {
+				t.Errorf("TypeName() = %s, want %s", (mysqlDialect{}).TypeName(got), tt.columnType)
+			}
+		})
+	}
+}
+
+func Test_mysqlRawTable_toTable(t *testing.T) {
+	var (
+		stringPtr = func(s string) *string { return &s }
+		intPtr    = func(i int) *int { return &i }
+		raw       = mysqlRawTable{
+			Name: "orders",
+			Columns: []mysqlRawColumn{
+				{Name: "id", ColumnType: "bigint", DataType: "bigint", Nullable: "NO", Extra: "auto_increment"},
+				{Name: "customer_id", ColumnType: "int", DataType: "int", Nullable: "NO"},
+				{Name: "code", ColumnType: "varchar(20)", DataType: "varchar", Nullable: "YES", Default: stringPtr("a'b")},
+				{Name: "created", ColumnType: "timestamp", DataType: "timestamp", Nullable: "NO", Default: stringPtr("CURRENT_TIMESTAMP"), Extra: "DEFAULT_GENERATED"},
+			},
+			Constraints: []mysqlRawConstraint{
+				{Name: "PRIMARY", Type: "PRIMARY KEY", Column: "id"},
+				{Name: "fk_orders_customer", Type: "FOREIGN KEY", Column: "customer_id", RefTable: stringPtr("customers"), RefColumn: stringPtr("id"), OnUpdate: "RESTRICT", OnDelete: "CASCADE"},
+				{Name: "uq_orders_code", Type: "UNIQUE", Column: "code"},
+			},
+			Indices: []mysqlRawIndex{
+				{Name: "PRIMARY", Unique: true, Column: "id"},
+				{Name: "fk_orders_customer", Column: "customer_id"},
+				{Name: "ix_orders_code", Column: "code"},
+				{Name: "ix_orders_code", Column: "created"},
+				{Name: "uq_orders_code", Unique: true, Column: "code"},
+			},
+		}
+		want = Table{
+			Columns: ColumnsContainer{
+				{Value: Column{Name: "id", Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "bigserial"}, NotNull: true, Default: (*string)(nil)}}}, ord: 0},
+				{Value: Column{Name: "customer_id", Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "int4"}, NotNull: true, Default: (*string)(nil)}}}, ord: 1},
+				{Value: Column{Name: "code", Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "varchar", Length: intPtr(20)}, Default: stringPtr("'a''b'")}}}, ord: 2},
+				{Value: Column{Name: "created", Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "timestamptz"}, NotNull: true, Default: stringPtr("CURRENT_TIMESTAMP")}}}, ord: 3},
+			},
+			Constraints: TableConstraints{
+				{Columns: []string{"id"}, Constraint: Constraint{Name: "pk_orders", Type: ConstraintPrimaryKey}},
+				{
+					Columns: []string{"customer_id"},
+					Constraint: Constraint{
+						Name:       "fk_orders_customer",
+						Type:       ConstraintForeignKey,
+						Parameters: ConstraintParameters{Parameter: ForeignKey{ToTable: "customers", ToColumn: "id", OnDelete: stringPtr("cascade")}},
+					},
+				},
+				{Columns: []string{"code"}, Constraint: Constraint{Name: "uq_orders_code", Type: ConstraintUniqueKey}},
+			},
+			Indices: IndicesContainer{
+				{Name: "ix_orders_code", IndexType: IndexTypeIndex, Columns: []string{"code", "created"}},
+			},
+		}
+	)
+	if got := raw.toTable(); !reflect.DeepEqual(got, want) {
+		t.Errorf("toTable() = %+v, want %+v", got, want)
+	}
+}
+
+func TestGenerateGO_mysql(t *testing.T) {
+	defer func() {
+		codeDialect = getDialect(DialectPostgres)
+	}()
+	const project = `
+dialect: mysql
+schemas:
+  - name: shop
+    tables:
+      items:
+        columns:
+          - name: id
+            schema: { type: bigserial }
+            constraints:
+              - name: pk_items
+                type: primary key
+          - name: code
+            schema: { type: varchar, length: 20, not_null: true }
+        api:
+          - type: insertOne
+          - type: upsertOne
+            find_by:
+              - column: code
+          - type: deleteOne
+`
+	root, err := readProjectSnapshot([]byte(project))
+	if err != nil {
+		t.Fatalf("readProjectSnapshot() error = %v", err)
+	}
+	var buf bytes.Buffer
+	GenerateGO(root, "", "generated", &buf)
+	// the alignment of the generated code does not matter
+	var code = strings.Join(strings.Fields(buf.String()), " ")
+	for _, want := range []string{
+		`execText = "insert into items (%s) values (%s)"`,
+		`execText = "insert into items (%s) values (%s) on duplicate key update id = last_insert_id(id), %s"`,
+		`sqlText = "select id, code from items where id = ?"`,
+		`if insertedID, err = changed.LastInsertId(); err != nil {`,
+		`sqlText = "select id, code from items where %s for update"`,
+		`execText = "delete from items where %s"`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("GenerateGO() does not contain %s", want)
+		}
+	}
+	if strings.Contains(code, "returning") {
+		t.Errorf("GenerateGO() contains returning:\n%s", code)
+	}
+}
+
+func TestDiff_DryRun_mysql(t *testing.T) {
+	var (
+		diff    Diff
+		project = Root{Dialect: DialectMySQL}
+	)
+	// the dialect is checked before connecting to the database
+	if _, err := diff.DryRun(ConnectionOptions{Dialect: DialectMySQL, ConnStr: "unreachable"}, &project); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("DryRun() error = %v, want the dialect is not supported", err)
+	}
+	project.Schemas = Schemas{{Value: Schema{Name: "shop", Data: []DataContainer{{Name: "items"}}}}}
+	if err := (&Root{}).readSeedData(nil, &project); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("readSeedData() error = %v, want the dialect is not supported", err)
+	}
+}
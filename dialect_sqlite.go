@@ -0,0 +1,580 @@
+package dragonfly
+
+import (
+	"fmt"
+	"github.com/iv-menshenin/dragonfly/utils"
+	sqt "github.com/iv-menshenin/sql-ast"
+	"sort"
+	"strings"
+)
+
+const (
+	// SQLite has no schemas, all the tables of the project are placed in the main database
+	sqliteSchemaName = "main"
+	// the table that cannot be altered is created again under the temporary name, then it replaces the old one
+	sqliteRebuildPrefix = "_new_"
+)
+
+type (
+	sqliteDialect struct{}
+	// sqliteTable is the table as SQLite sees it: the types are mapped to the SQLite types, the schemas are omitted
+	sqliteTable struct {
+		Name        string
+		Columns     []sqliteColumn
+		PrimaryKey  *sqliteKey
+		Unique      []sqliteKey
+		ForeignKeys []sqliteForeignKey
+		Checks      []sqliteCheck
+		Indices     IndicesContainer
+	}
+	sqliteColumn struct {
+		Name    string
+		Type    string
+		NotNull bool
+		Default string
+		// the column is the integer primary key, its values are never reused
+		AutoIncrement bool
+		source        Column
+	}
+	sqliteKey struct {
+		Name    string   `json:"name"`
+		Columns []string `json:"columns"`
+	}
+	sqliteForeignKey struct {
+		sqliteKey
+		Table      string
+		RefColumns []string
+		OnUpdate   string
+		OnDelete   string
+	}
+	sqliteCheck struct {
+		Name       string
+		Expression string
+	}
+)
+
+func (sqliteDialect) Name() string {
+	return DialectSQLite
+}
+
+func (sqliteDialect) DriverName() string {
+	return "sqlite3"
+}
+
+// TypeName maps the type to the type affinity of SQLite, arrays are stored as text
+func (sqliteDialect) TypeName(t TypeBase) string {
+	if t.IsArray {
+		return "text"
+	}
+	switch canonicalTypeName(t.Type) {
+	case "int2", "int4", "int8", "bool":
+		return "integer"
+	case "float4", "float8":
+		return "real"
+	case "numeric":
+		return "numeric"
+	case "bytea", "blob":
+		return "blob"
+	}
+	return "text"
+}
+
+// PlaceholderFormat returns the numbered parameter, SQLite allows to refer to the same parameter more than once
+func (sqliteDialect) PlaceholderFormat() string {
+	return "?%d"
+}
+
+// TransactionalDDL returns true, SQLite rolls back the structure changes
+func (sqliteDialect) TransactionalDDL() bool {
+	return true
+}
+
+// CanAlter returns true for the changes that SQLite makes by `alter table`: tables are renamed, columns are added,
+// renamed and dropped. The column can be added only if it is nullable or has the constant default value
+func (sqliteDialect) CanAlter(change Change) bool {
+	switch change.Kind {
+	case ObjectColumn:
+		switch change.Action {
+		case ActionCreate:
+			column, ok := change.New.(Column)
+			return ok && sqliteCanAddColumn(column)
+		case ActionDrop, ActionRename:
+			return true
+		}
+		return false
+	case ObjectConstraint, ObjectDomain, ObjectType:
+		return false
+	}
+	return true
+}
+
+func sqliteCanAddColumn(column Column) bool {
+	for _, constraint := range column.Constraints {
+		if constraint.Type == ConstraintPrimaryKey || constraint.Type == ConstraintUniqueKey {
+			return false
+		}
+	}
+	var defaultValue = sqliteDefault(column.Schema.Value.Default)
+	if strings.HasPrefix(defaultValue, "current_") || len(tokenizeExpression(defaultValue)) > 1 {
+		return false
+	}
+	return defaultValue != "" || !column.Schema.Value.NotNull
+}
+
+func (sqliteDialect) qualifiedName(_, table string) string {
+	return table
+}
+
+// connectionString returns the name of the database file
+func (sqliteDialect) connectionString(options ConnectionOptions) string {
+	return options.Database
+}
+
+// makeDiff compares the tables of all the schemas as if they were in one database, the tables that cannot be altered
+// are rebuilt, foreign keys are not checked while the tables are replaced
+func (c sqliteDialect) makeDiff(current, new *Root) Diff {
+	for _, schema := range new.Schemas {
+		if len(schema.Value.Data) > 0 {
+			panic(fmt.Sprintf("seed data is not supported by the `%s` dialect", DialectSQLite))
+		}
+	}
+	var (
+		result = Diff{
+			preInstall:   make([]sqt.SqlStmt, 0),
+			install:      make([]sqt.SqlStmt, 0),
+			afterInstall: make([]sqt.SqlStmt, 0),
+		}
+		currentTables = c.tables(current)
+		newTables     = c.tables(new)
+		rebuilt       = false
+	)
+	for _, name := range sqliteTableNames(newTables) {
+		table := newTables[name]
+		actual, ok := currentTables[name]
+		if !ok {
+			result.install = append(result.install, scriptStatement(
+				table.createScript(table.Name),
+				Change{Kind: ObjectTable, Schema: sqliteSchemaName, Name: table.Name, Action: ActionCreate},
+				StatementSafe,
+			))
+			result.afterInstall = append(result.afterInstall, table.createIndices(table.Indices)...)
+			continue
+		}
+		changes := actual.changes(table)
+		if !c.canAlterAll(changes) {
+			result.install = append(result.install, actual.rebuild(table)...)
+			result.afterInstall = append(result.afterInstall, table.createIndices(table.Indices)...)
+			rebuilt = true
+			continue
+		}
+		for _, change := range changes {
+			result.install = append(result.install, actual.alter(table, change))
+		}
+		drop, create := actual.diffIndices(table)
+		result.preInstall = append(result.preInstall, drop...)
+		result.afterInstall = append(result.afterInstall, create...)
+	}
+	for _, name := range sqliteTableNames(currentTables) {
+		if _, ok := newTables[name]; ok {
+			continue
+		}
+		actual := currentTables[name]
+		result.install = append(result.install, scriptStatement(
+			"drop table "+actual.Name,
+			Change{Kind: ObjectTable, Schema: sqliteSchemaName, Name: actual.Name, Action: ActionDrop},
+			StatementDestructive,
+		))
+	}
+	if rebuilt {
+		// the pragma has no effect inside the transaction, so the script must be run outside of it
+		result.preInstall = append([]sqt.SqlStmt{scriptStatement("pragma foreign_keys = off", Change{}, StatementSafe)}, result.preInstall...)
+		result.afterInstall = append(
+			result.afterInstall,
+			scriptStatement("pragma foreign_key_check", Change{}, StatementSafe),
+			scriptStatement("pragma foreign_keys = on", Change{}, StatementSafe),
+		)
+	}
+	return result
+}
+
+func (c sqliteDialect) canAlterAll(changes []Change) bool {
+	for _, change := range changes {
+		if !c.CanAlter(change) {
+			return false
+		}
+	}
+	return true
+}
+
+// tables collects the tables of all the schemas, the names of tables must be unique across the schemas
+func (c sqliteDialect) tables(db *Root) map[string]sqliteTable {
+	var result = make(map[string]sqliteTable)
+	for _, schema := range db.Schemas {
+		for name, table := range schema.Value.Tables {
+			if _, ok := result[strings.ToLower(name)]; ok {
+				panic(fmt.Sprintf("table `%s` is described in more than one schema, SQLite has no schemas", name))
+			}
+			if table.hasStorageOptions() {
+				panic(fmt.Sprintf("storage options of `%s` are not supported by the `%s` dialect", name, DialectSQLite))
+			}
+			result[strings.ToLower(name)] = c.makeTable(db, name, table)
+		}
+	}
+	return result
+}
+
+func sqliteTableNames(tables map[string]sqliteTable) []string {
+	var names = make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c sqliteDialect) makeTable(db *Root, name string, table Table) sqliteTable {
+	var result = sqliteTable{Name: name, Indices: table.Indices}
+	for _, constraint := range table.getAllConstraints() {
+		var key = sqliteKey{Name: constraint.Constraint.Name, Columns: constraint.Columns}
+		switch constraint.Constraint.Type {
+		case ConstraintPrimaryKey:
+			result.PrimaryKey = &key
+		case ConstraintUniqueKey:
+			result.Unique = append(result.Unique, key)
+		case ConstraintForeignKey:
+			fk, _ := constraint.Constraint.Parameters.Parameter.(ForeignKey)
+			var refColumns = constraint.RefColumns
+			if len(refColumns) == 0 && fk.ToColumn != "" {
+				refColumns = []string{fk.ToColumn}
+			}
+			var tableName = strings.Split(fk.ToTable, ".")
+			result.ForeignKeys = append(result.ForeignKeys, sqliteForeignKey{
+				sqliteKey:  key,
+				Table:      tableName[len(tableName)-1],
+				RefColumns: refColumns,
+				OnUpdate:   referenceAction(fk.OnUpdate),
+				OnDelete:   referenceAction(fk.OnDelete),
+			})
+		case ConstraintCheck:
+			if check, ok := constraint.Constraint.Parameters.Parameter.(Check); ok {
+				result.Checks = append(result.Checks, sqliteCheck{Name: key.Name, Expression: check.Expression})
+			}
+		}
+	}
+	for _, ref := range table.Columns {
+		var (
+			schema       = ref.Value.Schema.Value
+			base, custom = db.resolveLiteralType(schema.TypeBase)
+			column       = sqliteColumn{
+				Name:    ref.Value.Name,
+				Type:    "text",
+				NotNull: schema.NotNull,
+				Default: sqliteDefault(schema.Default),
+				source:  ref.Value,
+			}
+		)
+		if custom == nil {
+			column.Type = c.TypeName(base)
+		}
+		if result.PrimaryKey != nil && utils.ArrayContainsCI(result.PrimaryKey.Columns, column.Name) {
+			// unlike other databases, SQLite allows nulls in the primary key if the column is not declared as not null
+			column.NotNull = true
+			column.AutoIncrement = len(result.PrimaryKey.Columns) == 1 && strings.Contains(strings.ToLower(base.Type), "serial")
+		}
+		result.Columns = append(result.Columns, column)
+	}
+	return result
+}
+
+// sqliteDefault brings the default value to the form in which it is compared and written to the table definition
+func sqliteDefault(value interface{}) string {
+	expr := defaultExpression(value)
+	if expr == nil {
+		return ""
+	}
+	switch normalized := normalizeExpression(*expr); normalized {
+	case "null":
+		return ""
+	case "now()":
+		return "current_timestamp"
+	default:
+		return normalized
+	}
+}
+
+func (c sqliteTable) column(name string) (sqliteColumn, bool) {
+	for _, column := range c.Columns {
+		if strings.EqualFold(column.Name, name) {
+			return column, true
+		}
+	}
+	return sqliteColumn{}, false
+}
+
+func (c sqliteColumn) equal(column sqliteColumn) bool {
+	return strings.EqualFold(c.Type, column.Type) &&
+		c.NotNull == column.NotNull &&
+		c.Default == column.Default &&
+		c.AutoIncrement == column.AutoIncrement
+}
+
+func (c sqliteColumn) definition() string {
+	var result = c.Name + " " + c.Type
+	if c.NotNull {
+		result += " not null"
+	}
+	if c.AutoIncrement {
+		result += " primary key autoincrement"
+	}
+	if c.Default != "" {
+		if len(tokenizeExpression(c.Default)) > 1 {
+			// the expression must be enclosed in parentheses, literals and keywords are written as is
+			result += " default (" + c.Default + ")"
+		} else {
+			result += " default " + c.Default
+		}
+	}
+	return result
+}
+
+func (c *sqliteKey) equal(key *sqliteKey) bool {
+	if c == nil || key == nil {
+		return c == key
+	}
+	return isSameColumns(c.Columns, key.Columns)
+}
+
+func (c sqliteForeignKey) equal(key sqliteForeignKey) bool {
+	return isSameColumns(c.Columns, key.Columns) &&
+		strings.EqualFold(c.Table, key.Table) &&
+		isSameColumns(c.RefColumns, key.RefColumns) &&
+		c.OnUpdate == key.OnUpdate &&
+		c.OnDelete == key.OnDelete
+}
+
+// changes describes what differs in the new table. The check constraints are not compared: SQLite does not describe them,
+// so they are changed along with other changes that rebuild the table
+func (c sqliteTable) changes(table sqliteTable) []Change {
+	var (
+		result = make([]Change, 0)
+		add    = func(kind ObjectKind, name string, action ChangeAction, old, new interface{}) {
+			result = append(result, Change{
+				Kind:   kind,
+				Schema: sqliteSchemaName,
+				Table:  table.Name,
+				Name:   name,
+				Action: action,
+				Old:    old,
+				New:    new,
+			})
+		}
+	)
+	for _, column := range table.Columns {
+		current, ok := c.column(column.Name)
+		if !ok {
+			add(ObjectColumn, column.Name, ActionCreate, nil, column.source)
+		} else if !current.equal(column) {
+			add(ObjectColumn, column.Name, ActionAlter, current.source, column.source)
+		}
+	}
+	for _, column := range c.Columns {
+		if _, ok := table.column(column.Name); !ok {
+			add(ObjectColumn, column.Name, ActionDrop, column.source, nil)
+		}
+	}
+	if !c.PrimaryKey.equal(table.PrimaryKey) {
+		switch {
+		case c.PrimaryKey == nil:
+			add(ObjectConstraint, table.PrimaryKey.Name, ActionCreate, nil, *table.PrimaryKey)
+		case table.PrimaryKey == nil:
+			add(ObjectConstraint, c.PrimaryKey.Name, ActionDrop, *c.PrimaryKey, nil)
+		default:
+			add(ObjectConstraint, table.PrimaryKey.Name, ActionAlter, *c.PrimaryKey, *table.PrimaryKey)
+		}
+	}
+	for _, key := range table.Unique {
+		if !c.hasUnique(key) {
+			add(ObjectConstraint, key.Name, ActionCreate, nil, key)
+		}
+	}
+	for _, key := range c.Unique {
+		if !table.hasUnique(key) {
+			add(ObjectConstraint, key.Name, ActionDrop, key, nil)
+		}
+	}
+	for _, key := range table.ForeignKeys {
+		if !c.hasForeignKey(key) {
+			add(ObjectConstraint, key.Name, ActionCreate, nil, key.sqliteKey)
+		}
+	}
+	for _, key := range c.ForeignKeys {
+		if !table.hasForeignKey(key) {
+			add(ObjectConstraint, key.Name, ActionDrop, key.sqliteKey, nil)
+		}
+	}
+	return result
+}
+
+func (c sqliteTable) hasUnique(key sqliteKey) bool {
+	for _, unique := range c.Unique {
+		if isSameColumns(unique.Columns, key.Columns) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c sqliteTable) hasForeignKey(key sqliteForeignKey) bool {
+	for _, fk := range c.ForeignKeys {
+		if fk.equal(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// alter makes the change of the new table that SQLite can make by `alter table`
+func (c sqliteTable) alter(table sqliteTable, change Change) sqt.SqlStmt {
+	switch change.Action {
+	case ActionCreate:
+		column, _ := table.column(change.Name)
+		return scriptStatement(fmt.Sprintf("alter table %s add column %s", c.Name, column.definition()), change, StatementSafe)
+	case ActionDrop:
+		return scriptStatement(fmt.Sprintf("alter table %s drop column %s", c.Name, change.Name), change, StatementDestructive)
+	case ActionRename:
+		return scriptStatement(fmt.Sprintf("alter table %s rename column %s to %s", c.Name, change.OldName, change.Name), change, StatementSafe)
+	}
+	panic(fmt.Sprintf("cannot %s %s `%s` of `%s` by altering the table", change.Action, change.Kind, change.Name, c.Name))
+}
+
+// rebuild replaces the table with the new one: the new table is created under the temporary name,
+// the data of the common columns is copied, then the old table is dropped and the new one takes its name
+func (c sqliteTable) rebuild(table sqliteTable) []sqt.SqlStmt {
+	var (
+		temporary = sqliteRebuildPrefix + table.Name
+		change    = Change{Kind: ObjectTable, Schema: sqliteSchemaName, Name: table.Name, Action: ActionAlter}
+		copied    = make([]string, 0, len(table.Columns))
+		dropClass = StatementBlocking
+	)
+	for _, column := range table.Columns {
+		if _, ok := c.column(column.Name); ok {
+			copied = append(copied, column.Name)
+		}
+	}
+	if len(copied) < len(c.Columns) {
+		// some of the columns are not copied, their data is lost
+		dropClass = StatementDestructive
+	}
+	var columns = strings.Join(copied, ", ")
+	return []sqt.SqlStmt{
+		scriptStatement(table.createScript(temporary), change, StatementSafe),
+		scriptStatement(fmt.Sprintf("insert into %s (%s) select %s from %s", temporary, columns, columns, c.Name), change, StatementBlocking),
+		scriptStatement("drop table "+c.Name, change, dropClass),
+		scriptStatement(fmt.Sprintf("alter table %s rename to %s", temporary, table.Name), change, StatementSafe),
+	}
+}
+
+func (c sqliteTable) createScript(name string) string {
+	var definitions = make([]string, 0, len(c.Columns)+len(c.Unique)+len(c.ForeignKeys)+len(c.Checks)+1)
+	for _, column := range c.Columns {
+		definitions = append(definitions, column.definition())
+	}
+	if c.PrimaryKey != nil && !c.hasAutoIncrement() {
+		definitions = append(definitions, sqliteConstraint(c.PrimaryKey.Name, fmt.Sprintf("primary key (%s)", strings.Join(c.PrimaryKey.Columns, ", "))))
+	}
+	for _, key := range c.Unique {
+		definitions = append(definitions, sqliteConstraint(key.Name, fmt.Sprintf("unique (%s)", strings.Join(key.Columns, ", "))))
+	}
+	for _, key := range c.ForeignKeys {
+		var references = "references " + key.Table
+		if len(key.RefColumns) > 0 {
+			references += fmt.Sprintf(" (%s)", strings.Join(key.RefColumns, ", "))
+		}
+		if key.OnUpdate != "" {
+			references += " on update " + key.OnUpdate
+		}
+		if key.OnDelete != "" {
+			references += " on delete " + key.OnDelete
+		}
+		definitions = append(definitions, sqliteConstraint(key.Name, fmt.Sprintf("foreign key (%s) %s", strings.Join(key.Columns, ", "), references)))
+	}
+	for _, check := range c.Checks {
+		definitions = append(definitions, sqliteConstraint(check.Name, fmt.Sprintf("check (%s)", check.Expression)))
+	}
+	return fmt.Sprintf("create table %s (\n\t%s\n)", name, strings.Join(definitions, ",\n\t"))
+}
+
+func (c sqliteTable) hasAutoIncrement() bool {
+	for _, column := range c.Columns {
+		if column.AutoIncrement {
+			return true
+		}
+	}
+	return false
+}
+
+func sqliteConstraint(name, definition string) string {
+	if name == "" {
+		return definition
+	}
+	return fmt.Sprintf("constraint %s %s", name, definition)
+}
+
+func (c sqliteTable) createIndices(indices IndicesContainer) []sqt.SqlStmt {
+	var result = make([]sqt.SqlStmt, 0, len(indices))
+	for _, index := range indices {
+		var (
+			name   = c.indexName(index)
+			script = fmt.Sprintf("create index %s on %s (%s)", name, c.Name, strings.Join(index.Columns, ", "))
+		)
+		if index.IndexType == IndexTypeUnique {
+			script = "create unique" + strings.TrimPrefix(script, "create")
+		}
+		if index.Where != "" {
+			script += " where " + index.Where
+		}
+		result = append(result, scriptStatement(
+			script,
+			Change{Kind: ObjectIndex, Schema: sqliteSchemaName, Table: c.Name, Name: name, Action: ActionCreate},
+			StatementSafe,
+		))
+	}
+	return result
+}
+
+// indexName makes the name of the index if the project does not name it, SQLite requires the name
+func (c sqliteTable) indexName(index Index) string {
+	if index.Name != "" {
+		return index.Name
+	}
+	return fmt.Sprintf("%s_%s_idx", c.Name, strings.Join(index.Columns, "_"))
+}
+
+// diffIndices returns the indices that are dropped and the indices that are created, the changed index is created again
+func (c sqliteTable) diffIndices(table sqliteTable) (drop, create []sqt.SqlStmt) {
+	var created = make(IndicesContainer, 0)
+	for _, index := range table.Indices {
+		i := c.Indices.indexOf(index)
+		if i >= 0 && isSameColumns(c.Indices[i].Columns, index.Columns) && c.Indices[i].IndexType == index.IndexType {
+			continue
+		}
+		if i >= 0 {
+			drop = append(drop, c.dropIndex(c.Indices[i]))
+		}
+		created = append(created, index)
+	}
+	for _, index := range c.Indices {
+		if table.Indices.indexOf(index) < 0 {
+			drop = append(drop, c.dropIndex(index))
+		}
+	}
+	return drop, table.createIndices(created)
+}
+
+func (c sqliteTable) dropIndex(index Index) sqt.SqlStmt {
+	return scriptStatement(
+		"drop index "+index.Name,
+		Change{Kind: ObjectIndex, Schema: sqliteSchemaName, Table: c.Name, Name: index.Name, Action: ActionDrop},
+		StatementSafe,
+	)
+}
@@ -0,0 +1,324 @@
+package dragonfly
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	sqliteTablesQuery = `
+select name, coalesce(sql, '')
+  from sqlite_master
+ where type = 'table'
+   and name not like 'sqlite_%'
+ order by name;`
+	sqliteColumnsQuery = `
+select name, type, "notnull", dflt_value, pk
+  from pragma_table_info(?)
+ order by cid;`
+	sqliteIndicesQuery = `
+select name, "unique", origin
+  from pragma_index_list(?)
+ order by name;`
+	sqliteIndexColumnsQuery = `
+select name
+  from pragma_index_info(?)
+ order by seqno;`
+	sqliteForeignKeysQuery = `
+select id, "table", "from", "to", on_update, on_delete
+  from pragma_foreign_key_list(?)
+ order by id, seq;`
+
+	// the index made by the unique constraint
+	sqliteIndexOriginUnique = "u"
+	// the index made by the primary key
+	sqliteIndexOriginPrimaryKey = "pk"
+)
+
+type (
+	sqliteRawTable struct {
+		Name        string
+		SQL         string
+		Columns     []sqliteRawColumn
+		Indices     []sqliteRawIndex
+		ForeignKeys []sqliteRawForeignKey
+	}
+	sqliteRawColumn struct {
+		Name    string
+		Type    string
+		NotNull bool
+		Default *string
+		// the position of the column in the primary key, zero if the column is not in the primary key
+		PrimaryKey int
+	}
+	sqliteRawIndex struct {
+		Name    string
+		Unique  bool
+		Origin  string
+		Columns []string
+	}
+	sqliteRawForeignKey struct {
+		ID       int
+		Table    string
+		From     string
+		To       *string
+		OnUpdate string
+		OnDelete string
+	}
+)
+
+// readStructure reads the tables of the main database, the database name is not used
+func (c sqliteDialect) readStructure(db queryer, _ string) (Root, error) {
+	tables, err := readSqliteTables(db)
+	if err != nil {
+		return Root{}, err
+	}
+	var result = make(TablesContainer, len(tables))
+	for _, table := range tables {
+		if table.Columns, err = readSqliteColumns(db, table.Name); err != nil {
+			return Root{}, err
+		}
+		if table.Indices, err = readSqliteIndices(db, table.Name); err != nil {
+			return Root{}, err
+		}
+		if table.ForeignKeys, err = readSqliteForeignKeys(db, table.Name); err != nil {
+			return Root{}, err
+		}
+		result[table.Name] = table.toTable()
+	}
+	return Root{
+		Dialect: DialectSQLite,
+		Schemas: []SchemaRef{{Value: Schema{Name: sqliteSchemaName, Tables: result}}},
+	}, nil
+}
+
+func readSqliteTables(db queryer) ([]sqliteRawTable, error) {
+	rows, err := db.Query(sqliteTablesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tables = make([]sqliteRawTable, 0)
+	for rows.Next() {
+		var table sqliteRawTable
+		if err = rows.Scan(&table.Name, &table.SQL); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+func readSqliteColumns(db queryer, tableName string) ([]sqliteRawColumn, error) {
+	rows, err := db.Query(sqliteColumnsQuery, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns = make([]sqliteRawColumn, 0)
+	for rows.Next() {
+		var column sqliteRawColumn
+		if err = rows.Scan(&column.Name, &column.Type, &column.NotNull, &column.Default, &column.PrimaryKey); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+func readSqliteIndices(db queryer, tableName string) ([]sqliteRawIndex, error) {
+	rows, err := db.Query(sqliteIndicesQuery, tableName)
+	if err != nil {
+		return nil, err
+	}
+	var indices = make([]sqliteRawIndex, 0)
+	for rows.Next() {
+		var index sqliteRawIndex
+		if err = rows.Scan(&index.Name, &index.Unique, &index.Origin); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		indices = append(indices, index)
+	}
+	// the connection to the database can be the only one, so the rows are closed before the next query
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+	for i := range indices {
+		if indices[i].Columns, err = readSqliteIndexColumns(db, indices[i].Name); err != nil {
+			return nil, err
+		}
+	}
+	return indices, nil
+}
+
+func readSqliteIndexColumns(db queryer, indexName string) ([]string, error) {
+	rows, err := db.Query(sqliteIndexColumnsQuery, indexName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns = make([]string, 0)
+	for rows.Next() {
+		var column string
+		if err = rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+func readSqliteForeignKeys(db queryer, tableName string) ([]sqliteRawForeignKey, error) {
+	rows, err := db.Query(sqliteForeignKeysQuery, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys = make([]sqliteRawForeignKey, 0)
+	for rows.Next() {
+		var key sqliteRawForeignKey
+		if err = rows.Scan(&key.ID, &key.Table, &key.From, &key.To, &key.OnUpdate, &key.OnDelete); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// toTable describes the table in the form of the project. The constraints of SQLite have no names,
+// so the names are made from the name of the table
+func (c sqliteRawTable) toTable() Table {
+	var (
+		table      = Table{Columns: make(ColumnsContainer, 0, len(c.Columns))}
+		primaryKey = make([]sqliteRawColumn, 0, 1)
+	)
+	for i, raw := range c.Columns {
+		var column = ColumnRef{
+			Value: Column{
+				Name: raw.Name,
+				Schema: ColumnSchemaRef{
+					Value: DomainSchema{
+						TypeBase: parseDeclaredType(raw.Type),
+						NotNull:  raw.NotNull,
+						Default:  raw.Default,
+					},
+				},
+			},
+			ord: i,
+		}
+		table.Columns = append(table.Columns, column)
+		if raw.PrimaryKey > 0 {
+			primaryKey = append(primaryKey, raw)
+		}
+	}
+	sort.Slice(primaryKey, func(i, j int) bool {
+		return primaryKey[i].PrimaryKey < primaryKey[j].PrimaryKey
+	})
+	if len(primaryKey) > 0 {
+		var columns = make([]string, 0, len(primaryKey))
+		for _, column := range primaryKey {
+			columns = append(columns, column.Name)
+		}
+		table.Constraints = append(table.Constraints, ConstraintSchema{
+			Columns:    columns,
+			Constraint: Constraint{Name: "pk_" + c.Name, Type: ConstraintPrimaryKey},
+		})
+		if len(columns) == 1 && strings.Contains(strings.ToLower(c.SQL), "autoincrement") {
+			// only the integer primary key can be autoincremented
+			column, _ := table.Columns.tryToFind(columns[0])
+			column.Value.Schema.Value.Type = "bigserial"
+		}
+	}
+	for _, index := range c.Indices {
+		switch index.Origin {
+		case sqliteIndexOriginPrimaryKey:
+			continue
+		case sqliteIndexOriginUnique:
+			table.Constraints = append(table.Constraints, ConstraintSchema{
+				Columns:    index.Columns,
+				Constraint: Constraint{Name: index.Name, Type: ConstraintUniqueKey},
+			})
+		default:
+			var indexType = IndexTypeIndex
+			if index.Unique {
+				indexType = IndexTypeUnique
+			}
+			table.Indices = append(table.Indices, Index{Name: index.Name, IndexType: indexType, Columns: index.Columns})
+		}
+	}
+	table.Constraints = append(table.Constraints, c.foreignKeys()...)
+	return table
+}
+
+// foreignKeys groups the columns of composite foreign keys
+func (c sqliteRawTable) foreignKeys() TableConstraints {
+	var (
+		result  = make(TableConstraints, 0)
+		indexes = make(map[int]int)
+	)
+	for _, raw := range c.ForeignKeys {
+		i, ok := indexes[raw.ID]
+		if !ok {
+			i, indexes[raw.ID] = len(result), len(result)
+			result = append(result, ConstraintSchema{
+				Constraint: Constraint{
+					Name: fmt.Sprintf("fk_%s_%d", c.Name, raw.ID),
+					Type: ConstraintForeignKey,
+					Parameters: ConstraintParameters{Parameter: ForeignKey{
+						ToTable:  raw.Table,
+						OnUpdate: sqliteRawAction(raw.OnUpdate),
+						OnDelete: sqliteRawAction(raw.OnDelete),
+					}},
+				},
+			})
+		}
+		result[i].Columns = append(result[i].Columns, raw.From)
+		if raw.To != nil {
+			result[i].RefColumns = append(result[i].RefColumns, *raw.To)
+		}
+	}
+	for i, constraint := range result {
+		// the single referenced column is described by the parameters of the foreign key
+		if len(constraint.RefColumns) == 1 {
+			fk := constraint.Constraint.Parameters.Parameter.(ForeignKey)
+			fk.ToColumn = constraint.RefColumns[0]
+			result[i].Constraint.Parameters.Parameter, result[i].RefColumns = fk, nil
+		}
+	}
+	return result
+}
+
+func sqliteRawAction(action string) *string {
+	if action == "" || strings.EqualFold(action, "no action") {
+		return nil
+	}
+	action = strings.ToLower(action)
+	return &action
+}
+
+// parseDeclaredType splits the declared type like `varchar(20)` or `numeric(10, 2)`, the column without the type is blob
+func parseDeclaredType(declared string) TypeBase {
+	var result = TypeBase{Type: strings.ToLower(strings.TrimSpace(declared))}
+	if result.Type == "" {
+		result.Type = "blob"
+		return result
+	}
+	open, close := strings.Index(result.Type, "("), strings.LastIndex(result.Type, ")")
+	if open < 0 || close < open {
+		return result
+	}
+	var params = strings.Split(result.Type[open+1:close], ",")
+	result.Type = strings.TrimSpace(result.Type[:open])
+	if length, err := strconv.Atoi(strings.TrimSpace(params[0])); err == nil {
+		result.Length = &length
+	}
+	if len(params) > 1 {
+		if precision, err := strconv.Atoi(strings.TrimSpace(params[1])); err == nil {
+			result.Precision = &precision
+		}
+	}
+	return result
+}
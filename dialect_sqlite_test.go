@@ -0,0 +1,303 @@
+package dragonfly
+
+import (
+	"bytes"
+	"go/printer"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSqliteDialect_makeDiff(t *testing.T) {
+	const current = `
+dialect: sqlite
+schemas:
+  - name: main
+    tables:
+      items:
+        columns:
+          - name: id
+            schema: { type: bigserial }
+            constraints:
+              - name: pk_items
+                type: primary key
+          - name: title
+            schema: { type: varchar, length: 20, not_null: true }
+        indices:
+          - name: ix_items_title
+            type: index
+            columns: [title]
+      logs:
+        columns:
+          - name: message
+            schema: { type: text }
+`
+	tests := []struct {
+		name    string
+		project string
+		want    []string
+	}{
+		{
+			name:    "nothing changed",
+			project: current,
+			want:    []string{},
+		},
+		{
+			name: "nullable column is added",
+			project: `
+dialect: sqlite
+schemas:
+  - name: main
+    tables:
+      items:
+        columns:
+          - name: id
+            schema: { type: bigserial }
+            constraints:
+              - name: pk_items
+                type: primary key
+          - name: title
+            schema: { type: varchar, length: 20, not_null: true }
+          - name: price
+            schema: { type: numeric, length: 10, precision: 2 }
+        indices:
+          - name: ix_items_title
+            type: unique
+            columns: [title]
+      logs:
+        columns:
+          - name: message
+            schema: { type: text }
+`,
+			want: []string{
+				"drop index ix_items_title",
+				"alter table items add column price numeric",
+				"create unique index ix_items_title on items (title)",
+			},
+		},
+		{
+			name: "type is changed, the table is rebuilt",
+			project: `
+dialect: sqlite
+schemas:
+  - name: main
+    tables:
+      items:
+        columns:
+          - name: id
+            schema: { type: bigserial }
+            constraints:
+              - name: pk_items
+                type: primary key
+          - name: title
+            schema: { type: int4, not_null: true, default: 0 }
+        indices:
+          - name: ix_items_title
+            type: index
+            columns: [title]
+      logs:
+        columns:
+          - name: message
+            schema: { type: text }
+`,
+			want: []string{
+				"pragma foreign_keys = off",
+				"create table _new_items (\n\tid integer not null primary key autoincrement,\n\ttitle integer not null default 0\n)",
+				"insert into _new_items (id, title) select id, title from items",
+				"drop table items",
+				"alter table _new_items rename to items",
+				"create index ix_items_title on items (title)",
+				"pragma foreign_key_check",
+				"pragma foreign_keys = on",
+			},
+		},
+		{
+			name: "tables are created and dropped",
+			project: `
+dialect: sqlite
+schemas:
+  - name: main
+    tables:
+      items:
+        columns:
+          - name: id
+            schema: { type: bigserial }
+            constraints:
+              - name: pk_items
+                type: primary key
+          - name: title
+            schema: { type: varchar, length: 20, not_null: true }
+        indices:
+          - name: ix_items_title
+            type: index
+            columns: [title]
+  - name: shop
+    tables:
+      orders:
+        columns:
+          - name: item_id
+            schema: { type: int8, not_null: true }
+            constraints:
+              - name: fk_orders_item
+                type: foreign key
+                parameters: { table: main.items, column: id, on_delete: cascade }
+          - name: created
+            schema: { type: timestamp, not_null: true, default: "now()" }
+`,
+			want: []string{
+				"create table orders (\n\titem_id integer not null,\n\tcreated text not null default current_timestamp,\n\tconstraint fk_orders_item foreign key (item_id) references items (id) on delete cascade\n)",
+				"drop table logs",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := readProjectSnapshot([]byte(current))
+			if err != nil {
+				t.Fatalf("readProjectSnapshot() error = %v", err)
+			}
+			project, err := readProjectSnapshot([]byte(tt.project))
+			if err != nil {
+				t.Fatalf("readProjectSnapshot() error = %v", err)
+			}
+			diff := MakeDiff(actual, project)
+			var got = make([]string, 0)
+			for _, stmt := range diff.allStatements() {
+				got = append(got, stmt.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("makeDiff() got:\n%s\nwant:\n%s", strings.Join(got, ";\n"), strings.Join(tt.want, ";\n"))
+			}
+		})
+	}
+}
+
+func TestSqliteDialect_CanAlter(t *testing.T) {
+	var stringPtr = func(s string) *string { return &s }
+	tests := []struct {
+		name   string
+		change Change
+		want   bool
+	}{
+		{
+			name:   "nullable column",
+			change: Change{Kind: ObjectColumn, Action: ActionCreate, New: Column{Name: "a", Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "text"}}}}},
+			want:   true,
+		},
+		{
+			name:   "not null column without default",
+			change: Change{Kind: ObjectColumn, Action: ActionCreate, New: Column{Name: "a", Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "text"}, NotNull: true}}}},
+			want:   false,
+		},
+		{
+			name:   "not null column with default",
+			change: Change{Kind: ObjectColumn, Action: ActionCreate, New: Column{Name: "a", Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "int4"}, NotNull: true, Default: stringPtr("0")}}}},
+			want:   true,
+		},
+		{
+			name:   "column with the current time by default",
+			change: Change{Kind: ObjectColumn, Action: ActionCreate, New: Column{Name: "a", Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "timestamp"}, Default: stringPtr("now()")}}}},
+			want:   false,
+		},
+		{
+			name:   "column type",
+			change: Change{Kind: ObjectColumn, Action: ActionAlter},
+			want:   false,
+		},
+		{
+			name:   "dropped column",
+			change: Change{Kind: ObjectColumn, Action: ActionDrop},
+			want:   true,
+		},
+		{
+			name:   "constraint",
+			change: Change{Kind: ObjectConstraint, Action: ActionCreate},
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (sqliteDialect{}).CanAlter(tt.change); got != tt.want {
+				t.Errorf("CanAlter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sqliteRawTable_toTable(t *testing.T) {
+	var (
+		stringPtr = func(s string) *string { return &s }
+		intPtr    = func(i int) *int { return &i }
+		raw       = sqliteRawTable{
+			Name: "orders",
+			SQL:  "create table orders (id integer not null primary key autoincrement, ...)",
+			Columns: []sqliteRawColumn{
+				{Name: "id", Type: "INTEGER", NotNull: true, PrimaryKey: 1},
+				{Name: "region", Type: "integer"},
+				{Name: "customer_id", Type: "integer"},
+				{Name: "code", Type: "varchar(20)", Default: stringPtr("'a'")},
+			},
+			Indices: []sqliteRawIndex{
+				{Name: "sqlite_autoindex_orders_1", Unique: true, Origin: "u", Columns: []string{"code"}},
+				{Name: "ix_orders_region", Origin: "c", Columns: []string{"region"}},
+			},
+			ForeignKeys: []sqliteRawForeignKey{
+				{ID: 0, Table: "customers", From: "region", To: stringPtr("region"), OnUpdate: "NO ACTION", OnDelete: "CASCADE"},
+				{ID: 0, Table: "customers", From: "customer_id", To: stringPtr("id"), OnUpdate: "NO ACTION", OnDelete: "CASCADE"},
+			},
+		}
+		want = Table{
+			Columns: ColumnsContainer{
+				{Value: Column{Name: "id", Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "bigserial"}, NotNull: true, Default: (*string)(nil)}}}, ord: 0},
+				{Value: Column{Name: "region", Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "integer"}, Default: (*string)(nil)}}}, ord: 1},
+				{Value: Column{Name: "customer_id", Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "integer"}, Default: (*string)(nil)}}}, ord: 2},
+				{Value: Column{Name: "code", Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "varchar", Length: intPtr(20)}, Default: stringPtr("'a'")}}}, ord: 3},
+			},
+			Constraints: TableConstraints{
+				{Columns: []string{"id"}, Constraint: Constraint{Name: "pk_orders", Type: ConstraintPrimaryKey}},
+				{Columns: []string{"code"}, Constraint: Constraint{Name: "sqlite_autoindex_orders_1", Type: ConstraintUniqueKey}},
+				{
+					Columns:    []string{"region", "customer_id"},
+					RefColumns: []string{"region", "id"},
+					Constraint: Constraint{
+						Name:       "fk_orders_0",
+						Type:       ConstraintForeignKey,
+						Parameters: ConstraintParameters{Parameter: ForeignKey{ToTable: "customers", OnDelete: stringPtr("cascade")}},
+					},
+				},
+			},
+			Indices: IndicesContainer{
+				{Name: "ix_orders_region", IndexType: IndexTypeIndex, Columns: []string{"region"}},
+			},
+		}
+	)
+	if got := raw.toTable(); !reflect.DeepEqual(got, want) {
+		t.Errorf("toTable() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_makePlaceholder(t *testing.T) {
+	defer func() {
+		codeDialect = getDialect(DialectPostgres)
+	}()
+	tests := []struct {
+		dialect string
+		want    string
+	}{
+		{dialect: DialectPostgres, want: `"$" + strconv.Itoa(len(args))`},
+		{dialect: DialectSQLite, want: `"?" + strconv.Itoa(len(args))`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dialect, func(t *testing.T) {
+			codeDialect = getDialect(tt.dialect)
+			var buf bytes.Buffer
+			if err := printer.Fprint(&buf, token.NewFileSet(), makePlaceholder("args")); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("makePlaceholder() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
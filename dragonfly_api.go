@@ -10,7 +10,6 @@ import (
 	"go/printer"
 	"go/token"
 	"io"
-	"net/url"
 	"os"
 	"strings"
 )
@@ -19,16 +18,13 @@ func databaseWork(
 	options ConnectionOptions,
 	fn func(*sql.DB) error,
 ) error {
+	dialect := getDialect(options.Dialect)
+	if options.Driver == "" {
+		options.Driver = dialect.DriverName()
+	}
 	dbConnectionString := options.ConnStr
 	if dbConnectionString == "" {
-		dbConnectionString = fmt.Sprintf(
-			"%s://%s:%s@%s/%s",
-			options.Driver,
-			url.QueryEscape(options.UserName),
-			url.QueryEscape(options.Password),
-			options.Host,
-			options.Database,
-		)
+		dbConnectionString = dialect.connectionString(options)
 	}
 	if db, err := sql.Open(options.Driver, dbConnectionString); err != nil {
 		return err
@@ -49,24 +45,61 @@ type (
 		preInstall   []sqt.SqlStmt
 		install      []sqt.SqlStmt
 		afterInstall []sqt.SqlStmt
+		// seed data is changed when the structure is ready
+		data []sqt.SqlStmt
+		// schemas that are missing in the new structure, they are dropped only if the policy requires it
+		removedSchemas []string
 	}
 )
 
+func (c *Diff) isEmpty() bool {
+	return len(c.preInstall)+len(c.install)+len(c.afterInstall)+len(c.data) == 0
+}
+
 func ResolveDependencies(d *Diff) {
-	fixTheOrderOf(d.preInstall)
-	fixTheOrderOf(d.install)
-	fixTheOrderOf(d.afterInstall)
+	d.preInstall = orderWithHooks(d.preInstall, fixTheOrderOf)
+	d.install = orderWithHooks(d.install, fixTheOrderOf)
+	d.afterInstall = orderWithHooks(d.afterInstall, fixTheOrderOf)
 }
 
 func MakeDatabaseDump(options ConnectionOptions) (dump Root, err error) {
 	err = databaseWork(options, func(db *sql.DB) (e error) {
-		dump, e = getAllDatabaseInformation(db, options.Database)
+		dump, e = getDialect(options.Dialect).readStructure(db, options.Database)
 		return
 	})
+	if err == nil {
+		dump = *options.Scope.apply(&dump)
+	}
 	return
 }
 
+// ReadSeedData adds the rows of the tables that have seed data in the project to the dump of the database
+func ReadSeedData(options ConnectionOptions, dump, project *Root) error {
+	return databaseWork(options, func(db *sql.DB) error {
+		return dump.readSeedData(db, project)
+	})
+}
+
+// ReadHookHistory adds the hooks that have already been run to the dump of the database
+func ReadHookHistory(options ConnectionOptions, dump, project *Root) error {
+	return databaseWork(options, func(db *sql.DB) error {
+		return dump.readHookHistory(db, project)
+	})
+}
+
+// MakeDiff generates the statements in the dialect of the new structure,
+// the objects out of the scope of the new structure and the deprecated objects are neither created nor dropped
 func MakeDiff(current, new *Root) Diff {
+	current, new = new.Scope.apply(current), new.Scope.apply(new)
+	current = forgetDeprecated(current, new)
+	current.forgetHistoryTable(new.Migrations)
+	diff := new.getDialect().makeDiff(current, new)
+	new.Scope.filterDiff(&diff)
+	new.addHooks(&diff, current)
+	return diff
+}
+
+func makePostgresDiff(current, new *Root) Diff {
 	var (
 		result = Diff{
 			preInstall:   make([]sqt.SqlStmt, 0, 0),
@@ -75,6 +108,9 @@ func MakeDiff(current, new *Root) Diff {
 		}
 		postponedSchemaObjects = make(map[string]postponedObjects, 0)
 	)
+	schemaChanges, current := makeSchemaChanges(current, new)
+	result.preInstall = append(result.preInstall, schemaChanges...)
+	result.removedSchemas = getRemovedSchemas(current, new)
 	for _, schema := range new.Schemas {
 		// process all
 		pre, ins, after, postponed := schema.diffKnown(current, schema.Value.Name, new)
@@ -102,6 +138,7 @@ func MakeDiff(current, new *Root) Diff {
 		result.install = append(result.install, ins...)
 		result.afterInstall = append(result.afterInstall, after...)
 	}
+	result.data = makeDataChanges(current, new)
 	return result
 }
 
@@ -131,13 +168,8 @@ func MakeDataSQL(file *Root) []sqt.SqlStmt {
 					if !ok {
 						panic(fmt.Sprintf("cannot find column `%s` in `%s.%s`", f, data.Name, schema.Value.Name))
 					}
-					var value string
-					if fm, ok := formatTypes[column.Value.Schema.Value.TypeBase.Type]; ok && fm == "%s" {
-						value = fmt.Sprintf("'%v'", i)
-					} else {
-						value = fmt.Sprintf("%v", i)
-					}
-					setExps[f] = &sqt.Literal{Text: value}
+					var value = file.encodeLiteral(column.Value.Schema.Value.TypeBase, i)
+					setExps[f] = &seedValueExpr{Literal: &sqt.Literal{Text: value}}
 					var found = false
 					for _, k := range keys {
 						if strings.EqualFold(k.Value.Name, f) {
@@ -150,7 +182,7 @@ func MakeDataSQL(file *Root) []sqt.SqlStmt {
 					}
 					onConflict = append(onConflict, &sqt.BinaryExpr{
 						Left:  &sqt.Literal{Text: f},
-						Right: &sqt.Literal{Text: value},
+						Right: setExps[f],
 						Op:    token.ASSIGN,
 					})
 				}
@@ -198,6 +230,7 @@ func GenerateGO(db *Root, schemaName, packageName string, w io.Writer) {
 			}
 		}
 	}
+	codeDialect = db.getDialect()
 	var astData AstData
 	for _, schema := range db.Schemas {
 		if schemaName == "" || schemaName == schema.Value.Name {
@@ -217,6 +250,8 @@ func GenerateGO(db *Root, schemaName, packageName string, w io.Writer) {
 func RegisterApiBuilder(typeName string, operation ApiDbOperation, builderFunc ApiFuncBuilder) {
 	apiTypeIsOperation[ApiType(typeName)] = operation
 	funcTemplates[ApiType(typeName)] = builderFunc
+	// the registered builder is used for every dialect
+	delete(mysqlFuncTemplates, ApiType(typeName))
 }
 
 func RegisterFieldValueGenerator(alias, funcName string, minimumArgumentsCount int, isExtensible bool) {
@@ -250,15 +285,31 @@ func RegisterSqlFieldEncryptFunction(encryptFn func(valueForEncrypt ast.Expr) *a
 func (c *Diff) Print(w io.Writer) {
 	utils.WriteWrapper(w, "\n/* SECTION BEFORE INSTALL %s */", strings.Repeat("=", 58))
 	for _, stmt := range c.preInstall {
-		utils.WriteWrapper(w, "\n%s;\n", stmt)
+		writeStatement(w, stmt)
 	}
 	utils.WriteWrapper(w, "\n/* SECTION INSTALL %s */", strings.Repeat("=", 58))
 	for _, stmt := range c.install {
-		utils.WriteWrapper(w, "\n%s;\n", stmt)
+		writeStatement(w, stmt)
 	}
 	utils.WriteWrapper(w, "\n/* SECTION AFTER INSTALL %s */", strings.Repeat("=", 52))
 	for _, stmt := range c.afterInstall {
-		utils.WriteWrapper(w, "\n%s;\n", stmt)
+		writeStatement(w, stmt)
+	}
+	if len(c.data) > 0 {
+		utils.WriteWrapper(w, "\n/* SECTION DATA %s */", strings.Repeat("=", 61))
+		for _, stmt := range c.data {
+			utils.WriteWrapper(w, "\n%s;\n", stmt)
+		}
 	}
 	utils.WriteWrapper(w, "\n/* END OF UPDATE SCRIPT %s */", strings.Repeat("=", 53))
 }
+
+// writeStatement writes the statement preceded by the comment explaining why it is there
+func writeStatement(w io.Writer, stmt sqt.SqlStmt) {
+	if m, ok := stmt.(*migrationStmt); ok && m.change != nil {
+		if provenance := m.change.provenance(); provenance != nil {
+			utils.WriteWrapper(w, "\n%s", provenance.comment(m.change.Action))
+		}
+	}
+	utils.WriteWrapper(w, "\n%s;\n", stmt)
+}
@@ -1,11 +1,13 @@
 package dragonfly
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"gopkg.in/yaml.v2"
 	"io"
-	"os"
+	"io/ioutil"
+	"os/exec"
 	"path"
 	"strings"
 )
@@ -22,42 +24,72 @@ func yamlDecoder(r io.Reader) func(v interface{}) error {
 	return decoder.Decode
 }
 
+type (
+	// fileReader returns the content of the project file
+	fileReader func(fileName string) ([]byte, error)
+)
+
+const (
+	gitSourcePrefix = "git:"
+)
+
 func readAndParseFile(fileName string, i interface{}) {
+	readAndParseFileWith(ioutil.ReadFile, fileName, i)
+}
+
+func readAndParseFileWith(readFile fileReader, fileName string, i interface{}) {
 	var (
 		decoder func(r io.Reader) func(v interface{}) error
 	)
-	if file, err := os.Open(fileName); err != nil {
+	data, err := readFile(fileName)
+	if err != nil {
 		panic(err)
-	} else {
-		defer func() {
-			if err := file.Close(); err != nil {
-				panic(err)
-			}
-		}()
-		switch strings.ToLower(path.Ext(fileName)) {
-		case ".json":
+	}
+	switch strings.ToLower(path.Ext(fileName)) {
+	case ".json":
+		decoder = jsonDecoder
+	case ".yaml", ".yml":
+		decoder = yamlDecoder
+	default:
+		if len(data) == 0 {
+			panic(io.EOF)
+		}
+		if data[0] == '{' {
 			decoder = jsonDecoder
-		case ".yaml", ".yml":
+		} else {
 			decoder = yamlDecoder
-		default:
-			var b = make([]byte, 1, 1)
-			if _, err := file.Read(b); err != nil {
-				panic(err)
-			} else {
-				if _, err := file.Seek(0, 0); err != nil {
-					panic(err)
-				}
-			}
-			if b[0] == '{' {
-				decoder = jsonDecoder
-			} else {
-				decoder = yamlDecoder
-			}
 		}
-		if err := decoder(file)(i); err != nil {
-			panic(fmt.Sprintf("<%T>: %s\nOn parsing: "+fileName, err, err))
+	}
+	if err := decoder(bytes.NewReader(data))(i); err != nil {
+		panic(fmt.Sprintf("<%T>: %s\nOn parsing: "+fileName, err, err))
+	}
+}
+
+// makeGitFileReader reads files of the git revision instead of the working tree,
+// relative file names are resolved from the current directory as well as for the working tree
+func makeGitFileReader(revision string) fileReader {
+	return func(fileName string) ([]byte, error) {
+		if !path.IsAbs(fileName) && !strings.HasPrefix(fileName, "./") && !strings.HasPrefix(fileName, "../") {
+			fileName = "./" + fileName
+		}
+		var (
+			stderr bytes.Buffer
+			cmd    = exec.Command("git", "show", revision+":"+fileName)
+		)
+		cmd.Stderr = &stderr
+		data, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read `%s` of git revision `%s`: %s", fileName, revision, strings.TrimSpace(stderr.String()))
 		}
+		return data, nil
+	}
+}
+
+func (c *Root) fileReader() fileReader {
+	if c.readFile != nil {
+		return c.readFile
 	}
+	return ioutil.ReadFile
 }
 
 func ReadDatabaseProjectFile(fileName string) *Root {
@@ -66,3 +98,19 @@ func ReadDatabaseProjectFile(fileName string) *Root {
 	root.normalize()
 	return &root
 }
+
+// ReadDatabaseProjectSource reads the project file from the working tree or, if the source looks like `git:REF:path`,
+// from the git revision REF. Files included by the project are taken from the same revision
+func ReadDatabaseProjectSource(source string) *Root {
+	if !strings.HasPrefix(source, gitSourcePrefix) {
+		return ReadDatabaseProjectFile(source)
+	}
+	revision := strings.SplitN(strings.TrimPrefix(source, gitSourcePrefix), ":", 2)
+	if len(revision) < 2 || revision[0] == "" || revision[1] == "" {
+		panic(fmt.Sprintf("wrong source `%s`, expected git:REF:path", source))
+	}
+	var root = Root{readFile: makeGitFileReader(revision[0])}
+	readAndParseFileWith(root.readFile, revision[1], &root)
+	root.normalize()
+	return &root
+}
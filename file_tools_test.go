@@ -0,0 +1,44 @@
+package dragonfly
+
+import (
+	"os"
+	"testing"
+)
+
+func Test_readAndParseFileWith(t *testing.T) {
+	var files = map[string]string{
+		"project.yml": `
+schemas:
+  - name: test
+    tables:
+      table1:
+        columns:
+          - $ref: "!include columns/id.yml"
+`,
+		"columns/id.yml": `
+name: id
+schema: { type: int8, not_null: true }
+`,
+	}
+	var root = Root{
+		readFile: func(fileName string) ([]byte, error) {
+			if data, ok := files[fileName]; ok {
+				return []byte(data), nil
+			}
+			return nil, os.ErrNotExist
+		},
+	}
+	readAndParseFileWith(root.readFile, "project.yml", &root)
+	root.normalize()
+	schema, ok := root.Schemas.tryToFind("test")
+	if !ok {
+		t.Fatal("readAndParseFileWith() schema `test` is not found")
+	}
+	column, ok := schema.Value.Tables["table1"].Columns.tryToFind("id")
+	if !ok {
+		t.Fatal("readAndParseFileWith() the included column `id` is not found")
+	}
+	if column.Value.Schema.Value.Type != "int8" {
+		t.Errorf("readAndParseFileWith() column type = %s, want int8", column.Value.Schema.Value.Type)
+	}
+}
@@ -614,7 +614,7 @@ type (
 	apiBuilder func(*SchemaRef, string, string, []dataCellFactory, []dataCellFactory, []dataCellFactory) AstDataChain
 )
 
-func (c *TableApi) getApiBuilder(functionName string) apiBuilder {
+func (c *TableApi) getApiBuilder(functionName string, table *Table) apiBuilder {
 	var (
 		ok     bool
 		tplSet ApiFuncBuilder
@@ -622,13 +622,19 @@ func (c *TableApi) getApiBuilder(functionName string) apiBuilder {
 	if tplSet, ok = funcTemplates[c.Type]; !ok {
 		panic(fmt.Sprintf("cannot find template `%s`", c.Type))
 	}
+	if _, ok = codeDialect.(mysqlDialect); ok {
+		// MySQL cannot return the changed rows, they are read by the next query
+		if template, ok := mysqlFuncTemplates[c.Type]; ok {
+			tplSet = template(makeMysqlRowKey(table))
+		}
+	}
 	return func(
 		schema *SchemaRef,
 		tableName, rowStructName string,
 		queryOptionFields, queryInputFields, queryOutputFields []dataCellFactory,
 	) AstDataChain {
 		return tplSet(
-			fmt.Sprintf("%s.%s", schema.Value.Name, tableName),
+			codeDialect.qualifiedName(schema.Value.Name, tableName),
 			functionName,
 			rowStructName,
 			queryOptionFields,
@@ -738,7 +744,7 @@ func (c *SchemaRef) generateGO(schemaName string, w *AstData) {
 				}
 				var (
 					optionFields, mutableFields = api.generateOptions(&table, w)
-					builder                     = api.getApiBuilder(apiName)
+					builder                     = api.getApiBuilder(apiName, &table)
 				)
 				if err := mergeCodeBase(w, []AstDataChain{
 					builder(c, tableName, apiResultStructName, optionFields, mutableFields, append(resultFields, additionFields...)),
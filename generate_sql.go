@@ -2,9 +2,15 @@ package dragonfly
 
 import (
 	"fmt"
+	"github.com/iv-menshenin/dragonfly/utils"
 	"strings"
 )
 
+// these keywords are the values of sql functions, they are not quoted as strings
+var sqlValueKeywords = []string{
+	"current_timestamp", "current_date", "current_time", "localtime", "localtimestamp", "current_user", "session_user",
+}
+
 func defaultToSQL(d interface{}) *string {
 	if d == nil {
 		return nil
@@ -12,7 +18,7 @@ func defaultToSQL(d interface{}) *string {
 	var result = "null"
 	switch val := d.(type) {
 	case string:
-		if strings.ContainsAny(val, "():-+") {
+		if strings.ContainsAny(val, "():-+") || utils.ArrayContainsCI(sqlValueKeywords, val) {
 			result = val
 		} else {
 			result = fmt.Sprintf("'%s'", strings.Replace(val, "'", "''", -1))
@@ -0,0 +1,243 @@
+package dragonfly
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	migrationsSnapshotDir   = "snapshots"
+	migrationsFileTemplate  = "%04d_%s.%s.sql"
+	migrationsSnapshotTempl = "%04d_%s.yaml"
+	migrationsUp            = "up"
+	migrationsDown          = "down"
+)
+
+var (
+	// compatible with golang-migrate: {version}_{title}.{up|down}.sql
+	migrationFilePattern  = regexp.MustCompile(`^([0-9]+)_(.*)\.(up|down)\.sql$`)
+	migrationSnapPattern  = regexp.MustCompile(`^([0-9]+)_(.*)\.yaml$`)
+	migrationTitleCleaner = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+type (
+	// MigrationFiles describes one generated version in the migrations directory
+	MigrationFiles struct {
+		Version  int
+		Up       string
+		Down     string
+		Snapshot string
+	}
+	migrationVersion struct {
+		version int
+		name    string
+	}
+)
+
+// GenerateMigration compares the project with the snapshot of the latest migration stored in the directory
+// and writes the next pair of the up/down files together with the new project snapshot.
+// The database is not needed at all, returns nil if there is nothing to migrate.
+// The destructive policy is applied to the up migration only, the down migration reverts everything that was done
+func GenerateMigration(dir, title string, project *Root, policy DestructivePolicy) (*MigrationFiles, error) {
+	if err := os.MkdirAll(path.Join(dir, migrationsSnapshotDir), os.ModePerm); err != nil {
+		return nil, err
+	}
+	lastMigration, err := getLastMigrationVersion(dir)
+	if err != nil {
+		return nil, err
+	}
+	lastSnapshot, err := getLastMigrationVersion(path.Join(dir, migrationsSnapshotDir))
+	if err != nil {
+		return nil, err
+	}
+	newSnapshot, err := makeProjectSnapshot(project)
+	if err != nil {
+		return nil, err
+	}
+	var oldSnapshot []byte
+	if lastSnapshot.version > 0 {
+		fileName := path.Join(dir, migrationsSnapshotDir, fmt.Sprintf(migrationsSnapshotTempl, lastSnapshot.version, lastSnapshot.name))
+		if oldSnapshot, err = ioutil.ReadFile(fileName); err != nil {
+			return nil, err
+		}
+	}
+	up, err := diffSnapshots(oldSnapshot, newSnapshot, project.Migrations)
+	if err != nil {
+		return nil, err
+	}
+	if err = up.ApplyDestructivePolicy(policy); err != nil {
+		return nil, err
+	}
+	if up.isEmpty() {
+		return nil, nil
+	}
+	down, err := diffSnapshots(newSnapshot, oldSnapshot, project.Migrations)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		version = lastMigration.version + 1
+		name    = makeMigrationTitle(title)
+		result  = MigrationFiles{
+			Version:  version,
+			Up:       path.Join(dir, fmt.Sprintf(migrationsFileTemplate, version, name, migrationsUp)),
+			Down:     path.Join(dir, fmt.Sprintf(migrationsFileTemplate, version, name, migrationsDown)),
+			Snapshot: path.Join(dir, migrationsSnapshotDir, fmt.Sprintf(migrationsSnapshotTempl, version, name)),
+		}
+	)
+	for fileName, diff := range map[string]Diff{result.Up: up, result.Down: down} {
+		var buf bytes.Buffer
+		diff.Print(&buf)
+		if err = ioutil.WriteFile(fileName, buf.Bytes(), 0644); err != nil {
+			return nil, err
+		}
+	}
+	if err = ioutil.WriteFile(result.Snapshot, newSnapshot, 0644); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func makeMigrationTitle(title string) string {
+	title = strings.Trim(migrationTitleCleaner.ReplaceAllString(strings.ToLower(title), "_"), "_")
+	if title == "" {
+		return "migration"
+	}
+	return title
+}
+
+// returns zero version if the directory does not contain any migration
+func getLastMigrationVersion(dir string) (last migrationVersion, err error) {
+	var files []os.FileInfo
+	if files, err = ioutil.ReadDir(dir); err != nil {
+		return
+	}
+	var versions = make([]migrationVersion, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		var chains []string
+		if chains = migrationFilePattern.FindStringSubmatch(file.Name()); chains == nil {
+			if chains = migrationSnapPattern.FindStringSubmatch(file.Name()); chains == nil {
+				continue
+			}
+		}
+		version, e := strconv.Atoi(chains[1])
+		if e != nil {
+			continue
+		}
+		versions = append(versions, migrationVersion{version: version, name: chains[2]})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].version > versions[j].version
+	})
+	if len(versions) > 0 {
+		last = versions[0]
+	}
+	return
+}
+
+// makes a self-sufficient copy of the normalized project: inherited and included objects are already merged,
+// so the snapshot must not refer to them again
+func makeProjectSnapshot(project *Root) ([]byte, error) {
+	var snapshot = Root{
+		Schemas:    make(Schemas, 0, len(project.Schemas)),
+		Dialect:    project.Dialect,
+		Components: project.Components,
+	}
+	if project.Migrations != nil && len(project.Migrations.Hooks) > 0 {
+		// the hooks of the snapshot are already in the migrations, they are not repeated
+		snapshot.Migrations = &MigrationSettings{Hooks: project.Migrations.Hooks}
+	}
+	for _, schema := range project.Schemas {
+		var schemaCopy = SchemaRef{
+			Value: schema.Value,
+			Ref:   schema.Ref,
+		}
+		if isIncludeRef(schemaCopy.Ref) {
+			schemaCopy.Ref = nil
+		}
+		// the rows of the external files are already read, the snapshot keeps them inline
+		schemaCopy.Value.Data = make([]DataContainer, 0, len(schema.Value.Data))
+		for _, data := range schema.Value.Data {
+			data.Source = nil
+			schemaCopy.Value.Data = append(schemaCopy.Value.Data, data)
+		}
+		schemaCopy.Value.Tables = make(TablesContainer, len(schema.Value.Tables))
+		for tableName, table := range schema.Value.Tables {
+			table.Inherits = nil
+			table.Columns = append(make(ColumnsContainer, 0, len(table.Columns)), table.Columns...)
+			for i, column := range table.Columns {
+				if isIncludeRef(column.Ref) {
+					table.Columns[i].Ref = nil
+				}
+				if isIncludeRef(column.Value.Schema.Ref) {
+					table.Columns[i].Value.Schema.Ref = nil
+				}
+			}
+			schemaCopy.Value.Tables[tableName] = table
+		}
+		snapshot.Schemas = append(snapshot.Schemas, schemaCopy)
+	}
+	return yaml.Marshal(&snapshot)
+}
+
+func isIncludeRef(ref *string) bool {
+	return ref != nil && strings.HasPrefix(strings.TrimSpace(*ref), "!include ")
+}
+
+func readProjectSnapshot(snapshot []byte) (*Root, error) {
+	var root Root
+	decoder := yaml.NewDecoder(bytes.NewReader(snapshot))
+	decoder.SetStrict(true)
+	if err := decoder.Decode(&root); err != nil {
+		return nil, err
+	}
+	root.normalize()
+	return &root, nil
+}
+
+// makes the root with the same set of schemas but without any objects
+func makeEmptyRootOf(project *Root) *Root {
+	var root = Root{Schemas: make(Schemas, 0, len(project.Schemas)), Dialect: project.Dialect}
+	for _, schema := range project.Schemas {
+		root.Schemas = append(root.Schemas, SchemaRef{Value: Schema{Name: schema.Value.Name}})
+	}
+	return &root
+}
+
+// any of the snapshots can be empty, that means the state before the first migration.
+// Snapshots keep only the hooks of the migration settings, so the settings of the project are applied in both directions
+func diffSnapshots(current, new []byte, settings *MigrationSettings) (diff Diff, err error) {
+	var currentRoot, newRoot *Root
+	if current != nil {
+		if currentRoot, err = readProjectSnapshot(current); err != nil {
+			return
+		}
+	}
+	if new != nil {
+		if newRoot, err = readProjectSnapshot(new); err != nil {
+			return
+		}
+	}
+	if currentRoot == nil {
+		var empty = MakeEmptyRoot()
+		currentRoot = &empty
+	}
+	if newRoot == nil {
+		newRoot = makeEmptyRootOf(currentRoot)
+	}
+	newRoot.Migrations = settings
+	diff = MakeDiff(currentRoot, newRoot)
+	ResolveDependencies(&diff)
+	return
+}
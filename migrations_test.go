@@ -0,0 +1,96 @@
+package dragonfly
+
+import (
+	"github.com/iv-menshenin/dragonfly/utils"
+	"testing"
+)
+
+func Test_makeMigrationTitle(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+		want  string
+	}{
+		{
+			name:  "simple",
+			title: "init",
+			want:  "init",
+		},
+		{
+			name:  "spaces and case",
+			title: " Add Email to users ",
+			want:  "add_email_to_users",
+		},
+		{
+			name:  "empty",
+			title: "---",
+			want:  "migration",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := makeMigrationTitle(tt.title); got != tt.want {
+				t.Errorf("makeMigrationTitle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_diffSnapshots(t *testing.T) {
+	var project = Root{
+		Schemas: Schemas{
+			{Value: Schema{
+				Name: "test",
+				Domains: DomainsContainer{
+					"code": {TypeBase: TypeBase{Type: "varchar"}, NotNull: true},
+				},
+				Tables: TablesContainer{
+					"table1": {
+						Columns: ColumnsContainer{
+							{Value: Column{
+								Name:   "id",
+								Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "int8"}, NotNull: true}},
+								Constraints: []Constraint{
+									{Type: ConstraintPrimaryKey},
+								},
+							}},
+							{Value: Column{
+								Name:   "code",
+								Schema: ColumnSchemaRef{Ref: utils.StringToRef("#/schemas/test/domains/code")},
+							}},
+						},
+						Indices: IndicesContainer{
+							{Name: "ix_test", IndexType: IndexTypeUnique, Columns: []string{"code"}},
+						},
+					},
+				},
+			}},
+		},
+	}
+	project.normalize()
+	snapshot, err := makeProjectSnapshot(&project)
+	if err != nil {
+		t.Fatalf("makeProjectSnapshot() error = %v", err)
+	}
+	same, err := diffSnapshots(snapshot, snapshot, nil)
+	if err != nil {
+		t.Fatalf("diffSnapshots() error = %v", err)
+	}
+	if !same.isEmpty() {
+		t.Errorf("diffSnapshots() expected empty diff for the same snapshots, got:\n%s%s%s", same.preInstall, same.install, same.afterInstall)
+	}
+	install, err := diffSnapshots(nil, snapshot, nil)
+	if err != nil {
+		t.Fatalf("diffSnapshots() error = %v", err)
+	}
+	if len(install.preInstall) != 2 || len(install.install) != 1 {
+		t.Errorf("diffSnapshots() expected schema, domain and table creation, got:\n%s%s%s", install.preInstall, install.install, install.afterInstall)
+	}
+	uninstall, err := diffSnapshots(snapshot, nil, nil)
+	if err != nil {
+		t.Fatalf("diffSnapshots() error = %v", err)
+	}
+	if len(uninstall.install) != 1 || len(uninstall.afterInstall) != 1 {
+		t.Errorf("diffSnapshots() expected table and domain deletion, got:\n%s%s%s", uninstall.preInstall, uninstall.install, uninstall.afterInstall)
+	}
+}
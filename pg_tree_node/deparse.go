@@ -0,0 +1,518 @@
+package pg_tree_node
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Catalog contains the names of database objects by their identifiers
+	Catalog struct {
+		Functions map[int]string
+		Operators map[int]string
+		Types     map[int]string
+	}
+	deparser struct {
+		catalog Catalog
+		columns map[int]string
+		// the argument of the case expression that is compared in the conditions
+		caseArg []string
+	}
+)
+
+const (
+	// CoercionForm of postgres
+	coerceExplicitCall = 0
+	coerceExplicitCast = 1
+	coerceImplicitCast = 2
+
+	// NullTestType of postgres
+	nullTestIsNull = 0
+
+	typeFloat4  = 700
+	typeFloat8  = 701
+	typeNumeric = 1700
+
+	// the header of numeric values
+	numericSignMask = 0xC000
+	numericNegative = 0x4000
+	numericShort    = 0x8000
+	numericSpecial  = 0xC000
+)
+
+var (
+	simpleIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+	// the keywords of SQLValueFunctionOp of postgres
+	sqlValueFunctions = []string{
+		"current_date", "current_time", "current_time", "current_timestamp", "current_timestamp",
+		"localtime", "localtime", "localtimestamp", "localtimestamp",
+		"current_role", "current_user", "user", "session_user", "current_catalog", "current_schema",
+	}
+)
+
+// Deparse turns the expression tree back into the sql text. The identifiers of functions, operators and types
+// are resolved by the catalog, the columns of the table are identified by their numbers
+func Deparse(node Node, catalog Catalog, columns map[int]string) (string, error) {
+	var d = deparser{catalog: catalog, columns: columns}
+	return d.deparse(node)
+}
+
+func (d *deparser) deparse(node Node) (string, error) {
+	switch n := node.(type) {
+	case *VarNode:
+		if name, ok := d.columns[n.VarAttrNo]; ok {
+			return QuoteIdent(name), nil
+		}
+		return "", fmt.Errorf("unknown column number %d", n.VarAttrNo)
+	case *ConstNode:
+		return d.deparseConst(n)
+	case *ReLabelNode:
+		return d.deparseCoercion(n.Arg, n.ResultType, n.ReLabelFormat)
+	case *CoerceViaIONode:
+		return d.deparseCoercion(n.Arg, n.ResultType, n.CoerceFormat)
+	case *FuncNode:
+		return d.deparseFunc(n)
+	case *OpNode:
+		return d.deparseOp(n)
+	case *SQLValueFunctionNode:
+		return deparseSQLValueFunction(n)
+	case *BoolNode:
+		return d.deparseBool(n)
+	case *NullTestNode:
+		arg, err := d.deparseOperand(n.Arg)
+		if err != nil {
+			return "", err
+		}
+		if n.NullTestType == nullTestIsNull {
+			return arg + " is null", nil
+		}
+		return arg + " is not null", nil
+	case *ScalarArrayOpNode:
+		return d.deparseScalarArrayOp(n)
+	case *CaseNode:
+		return d.deparseCase(n)
+	case *CaseTestNode:
+		if len(d.caseArg) == 0 {
+			return "", fmt.Errorf("the case argument is out of the case expression")
+		}
+		return d.caseArg[len(d.caseArg)-1], nil
+	case *ArrayExprNode:
+		elements, err := d.deparseList(n.Elements)
+		if err != nil {
+			return "", err
+		}
+		return "array[" + strings.Join(elements, ", ") + "]", nil
+	case *SubLinkNode:
+		return "", fmt.Errorf("sub-selects are not supported")
+	case nil:
+		return "", fmt.Errorf("empty node")
+	}
+	return "", fmt.Errorf("unsupported node %T", node)
+}
+
+func (d *deparser) deparseList(nodes []Node) ([]string, error) {
+	var result = make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		s, err := d.deparse(node)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// deparseOperand wraps the operand of operators in parentheses if it is an expression with operators itself
+func (d *deparser) deparseOperand(node Node) (string, error) {
+	s, err := d.deparse(node)
+	if err != nil {
+		return "", err
+	}
+	switch n := node.(type) {
+	case *OpNode, *BoolNode, *NullTestNode, *ScalarArrayOpNode:
+		return "(" + s + ")", nil
+	case *ReLabelNode:
+		if n.ReLabelFormat == coerceImplicitCast {
+			return d.deparseOperand(n.Arg)
+		}
+	case *FuncNode:
+		if n.FuncFormat == coerceImplicitCast && len(n.Args) > 0 {
+			return d.deparseOperand(n.Args[0])
+		}
+	}
+	return s, nil
+}
+
+func (d *deparser) deparseCoercion(arg Node, resultType, format int) (string, error) {
+	if format != coerceExplicitCast {
+		return d.deparse(arg)
+	}
+	s, err := d.deparseOperand(arg)
+	if err != nil {
+		return "", err
+	}
+	typeName, ok := d.catalog.Types[resultType]
+	if !ok {
+		return "", fmt.Errorf("unknown type %d", resultType)
+	}
+	return s + "::" + typeName, nil
+}
+
+func (d *deparser) deparseFunc(n *FuncNode) (string, error) {
+	switch n.FuncFormat {
+	case coerceImplicitCast:
+		if len(n.Args) > 0 {
+			return d.deparse(n.Args[0])
+		}
+	case coerceExplicitCast:
+		if len(n.Args) > 0 {
+			return d.deparseCoercion(n.Args[0], n.FuncResultType, coerceExplicitCast)
+		}
+	}
+	name, ok := d.catalog.Functions[n.FuncId]
+	if !ok {
+		return "", fmt.Errorf("unknown function %d", n.FuncId)
+	}
+	args, err := d.deparseList(n.Args)
+	if err != nil {
+		return "", err
+	}
+	return name + "(" + strings.Join(args, ", ") + ")", nil
+}
+
+func (d *deparser) deparseOp(n *OpNode) (string, error) {
+	name, ok := d.catalog.Operators[n.OpNo]
+	if !ok {
+		return "", fmt.Errorf("unknown operator %d", n.OpNo)
+	}
+	var args = make([]string, 0, len(n.Args))
+	for _, arg := range n.Args {
+		s, err := d.deparseOperand(arg)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, s)
+	}
+	switch len(args) {
+	case 1:
+		return name + " " + args[0], nil
+	case 2:
+		return args[0] + " " + name + " " + args[1], nil
+	}
+	return "", fmt.Errorf("wrong args count of operator %s", name)
+}
+
+func deparseSQLValueFunction(n *SQLValueFunctionNode) (string, error) {
+	if n.Op < 0 || n.Op >= len(sqlValueFunctions) {
+		return "", fmt.Errorf("unknown sql value function %d", n.Op)
+	}
+	var name = sqlValueFunctions[n.Op]
+	if n.TypMod >= 0 && n.Op >= svfCurrentTimeN && n.Op <= svfLocalTimestampN && n.Op%2 == 0 {
+		// the functions with the precision have even numbers
+		return fmt.Sprintf("%s(%d)", name, n.TypMod), nil
+	}
+	return name, nil
+}
+
+func (d *deparser) deparseBool(n *BoolNode) (string, error) {
+	var args = make([]string, 0, len(n.Args))
+	for _, arg := range n.Args {
+		s, err := d.deparse(arg)
+		if err != nil {
+			return "", err
+		}
+		// the logical expressions are wrapped if they differ from the parent
+		switch a := arg.(type) {
+		case *BoolNode:
+			if a.BoolOp != n.BoolOp && a.BoolOp != "not" {
+				s = "(" + s + ")"
+			}
+		case *OpNode, *NullTestNode, *ScalarArrayOpNode:
+			if n.BoolOp == "not" {
+				s = "(" + s + ")"
+			}
+		}
+		args = append(args, s)
+	}
+	switch n.BoolOp {
+	case "and", "or":
+		return strings.Join(args, " "+n.BoolOp+" "), nil
+	case "not":
+		if len(args) == 1 {
+			return "not " + args[0], nil
+		}
+	}
+	return "", fmt.Errorf("unknown logical operator %s", n.BoolOp)
+}
+
+// deparseScalarArrayOp makes `x in (...)` for the lists and `x op any (...)` for other arrays
+func (d *deparser) deparseScalarArrayOp(n *ScalarArrayOpNode) (string, error) {
+	if len(n.Args) != 2 {
+		return "", fmt.Errorf("wrong args count of array operator")
+	}
+	name, ok := d.catalog.Operators[n.OpNo]
+	if !ok {
+		return "", fmt.Errorf("unknown operator %d", n.OpNo)
+	}
+	left, err := d.deparseOperand(n.Args[0])
+	if err != nil {
+		return "", err
+	}
+	var elements []string
+	switch a := Simplify(n.Args[1]).(type) {
+	case *ArrayExprNode:
+		if elements, err = d.deparseList(a.Elements); err != nil {
+			return "", err
+		}
+	case *ConstNode:
+		elements, _ = constArrayElements(a)
+	}
+	if elements != nil && name == "=" && n.UseOr {
+		return left + " in (" + strings.Join(elements, ", ") + ")", nil
+	}
+	if elements != nil && name == "<>" && !n.UseOr {
+		return left + " not in (" + strings.Join(elements, ", ") + ")", nil
+	}
+	right, err := d.deparse(n.Args[1])
+	if err != nil {
+		return "", err
+	}
+	if n.UseOr {
+		return left + " " + name + " any (" + right + ")", nil
+	}
+	return left + " " + name + " all (" + right + ")", nil
+}
+
+func (d *deparser) deparseCase(n *CaseNode) (string, error) {
+	var parts = []string{"case"}
+	if n.Arg != nil {
+		arg, err := d.deparse(n.Arg)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, arg)
+		d.caseArg = append(d.caseArg, arg)
+		defer func() { d.caseArg = d.caseArg[:len(d.caseArg)-1] }()
+	}
+	for _, arg := range n.Args {
+		when, ok := arg.(*CaseWhenNode)
+		if !ok {
+			return "", fmt.Errorf("unexpected node %T in case expression", arg)
+		}
+		var (
+			condition string
+			err       error
+		)
+		if op, ok := when.Expr.(*OpNode); ok && n.Arg != nil && len(op.Args) == 2 {
+			// the condition of the simple case compares the argument with the value
+			condition, err = d.deparse(op.Args[1])
+		} else {
+			condition, err = d.deparse(when.Expr)
+		}
+		if err != nil {
+			return "", err
+		}
+		result, err := d.deparse(when.Result)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, "when", condition, "then", result)
+	}
+	if n.DefResult != nil {
+		if c, ok := n.DefResult.(*ConstNode); !ok || !c.ConstIsNull {
+			def, err := d.deparse(n.DefResult)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, "else", def)
+		}
+	}
+	return strings.Join(append(parts, "end"), " "), nil
+}
+
+func (d *deparser) deparseConst(c *ConstNode) (string, error) {
+	if c.ConstIsNull {
+		return "null", nil
+	}
+	if literal, ok := constLiteral(c.ConstType, c.ConstLen, c.ConstValue); ok {
+		return literal, nil
+	}
+	if elements, ok := constArrayElements(c); ok {
+		return "array[" + strings.Join(elements, ", ") + "]", nil
+	}
+	return "", fmt.Errorf("unsupported constant of type %d", c.ConstType)
+}
+
+// constLiteral returns the sql literal of the constant value
+func constLiteral(constType, constLen int, data []byte) (string, bool) {
+	switch constType {
+	case typeBool, typeInt2, typeInt4, typeInt8, typeText, typeVarChar, typeBpChar, typeName:
+		value, ok := ConstValue(&ConstNode{ConstType: constType, ConstLen: constLen, ConstValue: data})
+		if !ok {
+			return "", false
+		}
+		switch v := value.(type) {
+		case string:
+			return QuoteLiteral(v), true
+		default:
+			return fmt.Sprintf("%v", v), true
+		}
+	case typeFloat4:
+		if len(data) < 4 {
+			return "", false
+		}
+		return strconv.FormatFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(data))), 'f', -1, 32), true
+	case typeFloat8:
+		if len(data) < 8 {
+			return "", false
+		}
+		return strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(data)), 'f', -1, 64), true
+	case typeNumeric:
+		return decodeNumeric(data)
+	}
+	return "", false
+}
+
+// decodeNumeric makes the decimal representation of the numeric value that consists of base 10000 digits
+func decodeNumeric(data []byte) (string, bool) {
+	raw, ok := varLenaData(data)
+	if !ok || len(raw) < 2 {
+		return "", false
+	}
+	var (
+		header   = binary.LittleEndian.Uint16(raw)
+		negative bool
+		scale    int
+		weight   int
+		digits   []byte
+	)
+	switch header & numericSignMask {
+	case numericSpecial:
+		return "", false
+	case numericShort:
+		negative = header&0x2000 != 0
+		scale = int(header&0x1F80) >> 7
+		weight = int(header & 0x003F)
+		if header&0x0040 != 0 {
+			weight |= ^0x003F
+		}
+		digits = raw[2:]
+	default:
+		if len(raw) < 4 {
+			return "", false
+		}
+		negative = header&numericSignMask == numericNegative
+		scale = int(header & 0x3FFF)
+		weight = int(int16(binary.LittleEndian.Uint16(raw[2:])))
+		digits = raw[4:]
+	}
+	var (
+		count = len(digits) / 2
+		digit = func(i int) int {
+			if i < 0 || i >= count {
+				return 0
+			}
+			return int(binary.LittleEndian.Uint16(digits[i*2:]))
+		}
+		intPart  strings.Builder
+		fracPart strings.Builder
+	)
+	if weight < 0 {
+		intPart.WriteString("0")
+	}
+	for i := 0; i <= weight; i++ {
+		if i == 0 {
+			intPart.WriteString(strconv.Itoa(digit(i)))
+		} else {
+			intPart.WriteString(fmt.Sprintf("%04d", digit(i)))
+		}
+	}
+	for i := weight + 1; fracPart.Len() < scale; i++ {
+		fracPart.WriteString(fmt.Sprintf("%04d", digit(i)))
+	}
+	var result = intPart.String()
+	if scale > 0 {
+		result += "." + fracPart.String()[:scale]
+	}
+	if negative {
+		result = "-" + result
+	}
+	return result, true
+}
+
+// constArrayElements decodes one-dimensional arrays without null elements
+func constArrayElements(c *ConstNode) ([]string, bool) {
+	size, header := varLenaSize(c.ConstValue)
+	if header != 4 || size > len(c.ConstValue) || size < 16 {
+		return nil, false
+	}
+	var (
+		data     = c.ConstValue[:size]
+		ndim     = int(int32(binary.LittleEndian.Uint32(data[4:])))
+		nulls    = int32(binary.LittleEndian.Uint32(data[8:]))
+		elemType = int(binary.LittleEndian.Uint32(data[12:]))
+	)
+	if ndim != 1 || nulls != 0 || len(data) < 24 {
+		return nil, false
+	}
+	var (
+		count    = int(int32(binary.LittleEndian.Uint32(data[16:])))
+		offset   = 24
+		elements = make([]string, 0, count)
+	)
+	for i := 0; i < count; i++ {
+		var elemLen int
+		switch elemType {
+		case typeBool:
+			elemLen = 1
+		case typeInt2:
+			offset, elemLen = align(offset, 2), 2
+		case typeInt4, typeFloat4:
+			offset, elemLen = align(offset, 4), 4
+		case typeInt8, typeFloat8:
+			offset, elemLen = align(offset, 8), 8
+		case typeText, typeVarChar, typeBpChar, typeNumeric:
+			if offset < len(data) && data[offset] == 0 {
+				// the padding bytes are zero, the short header is not aligned
+				offset = align(offset, 4)
+			}
+			if offset >= len(data) {
+				return nil, false
+			}
+			elemLen, _ = varLenaSize(data[offset:])
+		default:
+			return nil, false
+		}
+		if elemLen <= 0 || offset+elemLen > len(data) {
+			return nil, false
+		}
+		literal, ok := constLiteral(elemType, elemLen, data[offset:offset+elemLen])
+		if !ok {
+			return nil, false
+		}
+		elements = append(elements, literal)
+		offset += elemLen
+	}
+	return elements, true
+}
+
+func align(offset, alignment int) int {
+	return (offset + alignment - 1) / alignment * alignment
+}
+
+// QuoteIdent quotes the identifier if it is not lowercase or contains special characters
+func QuoteIdent(name string) string {
+	if simpleIdentifier.MatchString(name) {
+		return name
+	}
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// QuoteLiteral makes the sql string literal
+func QuoteLiteral(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
@@ -0,0 +1,102 @@
+package pg_tree_node
+
+import (
+	"testing"
+)
+
+func TestDeparse(t *testing.T) {
+	var (
+		catalog = Catalog{
+			Functions: map[int]string{870: "lower", 1299: "now"},
+			Operators: map[int]string{98: "=", 531: "<>", 1756: ">", 1754: "<", 521: ">"},
+			Types:     map[int]string{25: "text", 1043: "character varying", 23: "integer"},
+		}
+		columns = map[int]string{1: "id", 2: "price", 3: "status", 4: "Name"}
+	)
+	const (
+		varPrice   = "{VAR :varno 1 :varattno 2 :vartype 1700 :vartypmod 786438 :varcollid 0 :varlevelsup 0 :varnoold 1 :varoattno 2 :location 7}"
+		varStatus  = "{VAR :varno 1 :varattno 3 :vartype 25 :vartypmod -1 :varcollid 100 :varlevelsup 0 :varnoold 1 :varoattno 3 :location 7}"
+		varName    = "{VAR :varno 1 :varattno 4 :vartype 1043 :vartypmod 68 :varcollid 100 :varlevelsup 0 :varnoold 1 :varoattno 4 :location 7}"
+		varId      = "{VAR :varno 1 :varattno 1 :vartype 23 :vartypmod -1 :varcollid 0 :varlevelsup 0 :varnoold 1 :varoattno 1 :location 7}"
+		constZero  = "{CONST :consttype 1700 :consttypmod -1 :constcollid 0 :constlen -1 :constbyval false :constisnull false :location 15 :constvalue 6 [ 24 0 0 0 0 -128 ]}"
+		constLimit = "{CONST :consttype 1700 :consttypmod -1 :constcollid 0 :constlen -1 :constbyval false :constisnull false :location 15 :constvalue 10 [ 40 0 0 0 0 -127 -24 3 -120 19 ]}"
+		constTextA = "{CONST :consttype 25 :consttypmod -1 :constcollid 100 :constlen -1 :constbyval false :constisnull false :location 33 :constvalue 5 [ 20 0 0 0 97 ]}"
+		constTextB = "{CONST :consttype 25 :consttypmod -1 :constcollid 100 :constlen -1 :constbyval false :constisnull false :location 33 :constvalue 5 [ 20 0 0 0 98 ]}"
+		constEmpty = "{CONST :consttype 25 :consttypmod -1 :constcollid 100 :constlen -1 :constbyval false :constisnull false :location 33 :constvalue 4 [ 16 0 0 0 ]}"
+		constInt   = "{CONST :consttype 23 :consttypmod -1 :constcollid 0 :constlen 4 :constbyval true :constisnull false :location 134 :constvalue 4 [ 5 0 0 0 0 0 0 0 ]}"
+		// '{a,b}'::text[]
+		constArray = "{CONST :consttype 1009 :consttypmod -1 :constcollid 100 :constlen -1 :constbyval false :constisnull false :location 20 :constvalue 37 [ -108 0 0 0 1 0 0 0 0 0 0 0 25 0 0 0 2 0 0 0 1 0 0 0 20 0 0 0 97 0 0 0 20 0 0 0 98 ]}"
+	)
+	tests := []struct {
+		name    string
+		tree    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "numeric comparison",
+			tree: "{OPEXPR :opno 1756 :opfuncid 1720 :opresulttype 16 :opretset false :opcollid 0 :inputcollid 0 :args (" + varPrice + " " + constZero + ") :location 13}",
+			want: "price > 0",
+		},
+		{
+			name: "logical expression",
+			tree: "{BOOLEXPR :boolop and :args ({OPEXPR :opno 1756 :opfuncid 1720 :opresulttype 16 :opretset false :opcollid 0 :inputcollid 0 :args (" + varPrice + " " + constZero + ") :location 13} {OPEXPR :opno 1754 :opfuncid 1722 :opresulttype 16 :opretset false :opcollid 0 :inputcollid 0 :args (" + varPrice + " " + constLimit + ") :location 13}) :location 20}",
+			want: "price > 0 and price < 1000.50",
+		},
+		{
+			name: "null test inside of the negation",
+			tree: "{BOOLEXPR :boolop not :args ({NULLTEST :arg " + varStatus + " :nulltesttype 0 :argisrow false :location 30}) :location 20}",
+			want: "not (status is null)",
+		},
+		{
+			name: "list of values",
+			tree: "{SCALARARRAYOPEXPR :opno 98 :opfuncid 67 :hashfuncid 0 :negfuncid 0 :useOr true :inputcollid 100 :args (" + varStatus + " " + constArray + ") :location 28}",
+			want: "status in ('a', 'b')",
+		},
+		{
+			name: "array expression",
+			tree: "{SCALARARRAYOPEXPR :opno 531 :opfuncid 67 :useOr false :inputcollid 100 :args (" + varStatus + " {ARRAY :array_typeid 1009 :array_collid 100 :element_typeid 25 :elements (" + constTextA + " " + constTextB + ") :multidims false :location 10}) :location 28}",
+			want: "status not in ('a', 'b')",
+		},
+		{
+			name: "implicit and explicit casts",
+			tree: "{OPEXPR :opno 531 :opfuncid 67 :opresulttype 16 :opretset false :opcollid 0 :inputcollid 100 :args ({FUNCEXPR :funcid 870 :funcresulttype 25 :funcretset false :funcvariadic false :funcformat 0 :funccollid 100 :inputcollid 100 :args ({RELABELTYPE :arg " + varName + " :resulttype 25 :resulttypmod -1 :resultcollid 100 :relabelformat 2 :location -1}) :location 10} {COERCEVIAIO :arg " + varId + " :resulttype 25 :resultcollid 100 :coerceformat 1 :location 10}) :location 13}",
+			want: `lower("Name") <> id::text`,
+		},
+		{
+			name: "simple case",
+			tree: "{CASE :casetype 25 :casecollid 100 :arg " + varStatus + " :args ({CASEWHEN :expr {OPEXPR :opno 98 :opfuncid 67 :opresulttype 16 :opretset false :opcollid 0 :inputcollid 100 :args ({CASETESTEXPR :typeId 25 :typeMod -1 :collation 100} " + constTextA + ") :location 10} :result " + constInt + " :location 10}) :defresult " + constEmpty + " :location 10}",
+			want: "case status when 'a' then 5 else '' end",
+		},
+		{
+			name: "current timestamp",
+			tree: "{SQLVALUEFUNCTION :op 4 :type 1184 :typmod 3 :location 40}",
+			want: "current_timestamp(3)",
+		},
+		{
+			name:    "sub-select",
+			tree:    "{SUBLINK :subLinkType 0 :subLinkId 0 :testexpr <> :operName <> :subselect {QUERY :commandType 1} :location 10}",
+			wantErr: true,
+		},
+		{
+			name:    "unknown function",
+			tree:    "{FUNCEXPR :funcid 1 :funcresulttype 25 :funcretset false :funcvariadic false :funcformat 0 :funccollid 100 :inputcollid 100 :args <> :location 10}",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := Parse(tt.tree)
+			if err != nil || len(nodes) != 1 {
+				t.Fatalf("Parse() error = %v, nodes = %v", err, nodes)
+			}
+			got, err := Deparse(nodes[0], catalog, columns)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Deparse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Deparse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package pg_tree_node
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// object identifiers of the built-in types and functions that are recognized in the expression trees
+const (
+	typeBool    = 16
+	typeName    = 19
+	typeInt8    = 20
+	typeInt2    = 21
+	typeInt4    = 23
+	typeText    = 25
+	typeBpChar  = 1042
+	typeVarChar = 1043
+
+	funcNow                  = 1299
+	funcTransactionTimestamp = 2647
+
+	// SQLValueFunctionOp of postgres
+	svfCurrentTimeN      = 2
+	svfCurrentTimestamp  = 3
+	svfCurrentTimestampN = 4
+	svfLocalTimestampN   = 8
+)
+
+// Parse parses the text representation of the pg_node_tree (adbin, conbin and so on),
+// the error is returned if the tree contains unknown nodes
+func Parse(tree string) (nodes []Node, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			nodes, err = nil, fmt.Errorf("cannot parse node tree: %v", r)
+		}
+	}()
+	return parsePgNodeTrees(tree), nil
+}
+
+// Simplify removes the binary compatible type relabeling, it does not change the meaning of the expression
+func Simplify(node Node) Node {
+	switch n := node.(type) {
+	case *ReLabelNode:
+		return Simplify(n.Arg)
+	case *FuncNode:
+		var f = *n
+		f.Args = simplifyAll(n.Args)
+		return &f
+	case *OpNode:
+		var o = *n
+		o.Args = simplifyAll(n.Args)
+		return &o
+	}
+	return node
+}
+
+func simplifyAll(nodes []Node) []Node {
+	if nodes == nil {
+		return nil
+	}
+	var result = make([]Node, 0, len(nodes))
+	for _, node := range nodes {
+		result = append(result, Simplify(node))
+	}
+	return result
+}
+
+// IsCurrentTimestamp returns true if the node is one of now(), transaction_timestamp() or CURRENT_TIMESTAMP
+func IsCurrentTimestamp(node Node) bool {
+	switch n := Simplify(node).(type) {
+	case *FuncNode:
+		return len(n.Args) == 0 && (n.FuncId == funcNow || n.FuncId == funcTransactionTimestamp)
+	case *SQLValueFunctionNode:
+		return n.Op == svfCurrentTimestamp || n.Op == svfCurrentTimestampN
+	}
+	return false
+}
+
+// ConstValue decodes the value of the constant: string, int64, bool or nil for null,
+// returns false if the node is not a constant or its type is not supported
+func ConstValue(node Node) (interface{}, bool) {
+	c, ok := Simplify(node).(*ConstNode)
+	if !ok {
+		return nil, false
+	}
+	if c.ConstIsNull {
+		return nil, true
+	}
+	switch c.ConstType {
+	case typeBool:
+		if len(c.ConstValue) < 1 {
+			return nil, false
+		}
+		return c.ConstValue[0] != 0, true
+	case typeInt2, typeInt4, typeInt8:
+		return decodeInteger(c.ConstValue, c.ConstLen)
+	case typeText, typeVarChar, typeBpChar:
+		return decodeVarLena(c.ConstValue)
+	case typeName:
+		// the fixed length string terminated with zero
+		for i, b := range c.ConstValue {
+			if b == 0 {
+				return string(c.ConstValue[:i]), true
+			}
+		}
+		return string(c.ConstValue), true
+	}
+	return nil, false
+}
+
+// integers are passed by value, the datum is written in the byte order of the server (little endian is expected)
+func decodeInteger(data []byte, size int) (interface{}, bool) {
+	if size <= 0 || len(data) < size {
+		return nil, false
+	}
+	switch size {
+	case 2:
+		return int64(int16(binary.LittleEndian.Uint16(data))), true
+	case 4:
+		return int64(int32(binary.LittleEndian.Uint32(data))), true
+	case 8:
+		return int64(binary.LittleEndian.Uint64(data)), true
+	}
+	return nil, false
+}
+
+// decodeVarLena extracts the string of the variable length value
+func decodeVarLena(data []byte) (interface{}, bool) {
+	if raw, ok := varLenaData(data); ok {
+		return string(raw), true
+	}
+	return nil, false
+}
+
+// varLenaData extracts the data of the variable length value, the header contains the length of the whole value
+func varLenaData(data []byte) ([]byte, bool) {
+	var size, header = varLenaSize(data)
+	if size < header || size > len(data) {
+		return nil, false
+	}
+	return data[header:size], true
+}
+
+// varLenaSize returns the size of the whole value and the size of its header
+func varLenaSize(data []byte) (size, header int) {
+	if len(data) == 0 {
+		return -1, 0
+	}
+	if data[0]&0x01 == 0x01 {
+		// short header of one byte
+		return int(data[0] >> 1), 1
+	}
+	if len(data) < 4 {
+		return -1, 4
+	}
+	return int(binary.LittleEndian.Uint32(data) >> 2), 4
+}
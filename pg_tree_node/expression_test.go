@@ -0,0 +1,115 @@
+package pg_tree_node
+
+import (
+	"testing"
+)
+
+func TestConstValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		tree   string
+		want   interface{}
+		wantOk bool
+	}{
+		{
+			name:   "text",
+			tree:   "{CONST :consttype 25 :consttypmod -1 :constcollid 100 :constlen -1 :constbyval false :constisnull false :location 33 :constvalue 5 [ 20 0 0 0 97 ]}",
+			want:   "a",
+			wantOk: true,
+		},
+		{
+			name:   "relabeled varchar",
+			tree:   "{RELABELTYPE :arg {CONST :consttype 1043 :consttypmod 24 :constcollid 100 :constlen -1 :constbyval false :constisnull false :location 12 :constvalue 7 [ 28 0 0 0 110 101 119 ]} :resulttype 25 :resulttypmod -1 :resultcollid 100 :relabelformat 2 :location -1}",
+			want:   "new",
+			wantOk: true,
+		},
+		{
+			name:   "integer",
+			tree:   "{CONST :consttype 23 :consttypmod -1 :constcollid 0 :constlen 4 :constbyval true :constisnull false :location 134 :constvalue 4 [ 5 0 0 0 0 0 0 0 ]}",
+			want:   int64(5),
+			wantOk: true,
+		},
+		{
+			name:   "negative bigint",
+			tree:   "{CONST :consttype 20 :consttypmod -1 :constcollid 0 :constlen 8 :constbyval true :constisnull false :location 10 :constvalue 8 [ -1 -1 -1 -1 -1 -1 -1 -1 ]}",
+			want:   int64(-1),
+			wantOk: true,
+		},
+		{
+			name:   "boolean",
+			tree:   "{CONST :consttype 16 :consttypmod -1 :constcollid 0 :constlen 1 :constbyval true :constisnull false :location 10 :constvalue 1 [ 1 0 0 0 0 0 0 0 ]}",
+			want:   true,
+			wantOk: true,
+		},
+		{
+			name:   "null",
+			tree:   "{CONST :consttype 25 :consttypmod -1 :constcollid 100 :constlen -1 :constbyval false :constisnull true :location 10 :constvalue <>}",
+			want:   nil,
+			wantOk: true,
+		},
+		{
+			name:   "function",
+			tree:   "{FUNCEXPR :funcid 1299 :funcresulttype 1184 :funcretset false :funcvariadic false :funcformat 0 :funccollid 0 :inputcollid 0 :args <> :location 40}",
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := Parse(tt.tree)
+			if err != nil || len(nodes) != 1 {
+				if tt.wantOk {
+					t.Fatalf("Parse() error = %v, nodes = %v", err, nodes)
+				}
+				return
+			}
+			got, ok := ConstValue(nodes[0])
+			if ok != tt.wantOk {
+				t.Fatalf("ConstValue() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if ok && got != tt.want {
+				t.Errorf("ConstValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsCurrentTimestamp(t *testing.T) {
+	tests := []struct {
+		name string
+		tree string
+		want bool
+	}{
+		{
+			name: "now",
+			tree: "{FUNCEXPR :funcid 1299 :funcresulttype 1184 :funcretset false :funcvariadic false :funcformat 0 :funccollid 0 :inputcollid 0 :args <> :location 40}",
+			want: true,
+		},
+		{
+			name: "current_timestamp",
+			tree: "{SQLVALUEFUNCTION :op 3 :type 1184 :typmod -1 :location 40}",
+			want: true,
+		},
+		{
+			name: "current_date",
+			tree: "{SQLVALUEFUNCTION :op 0 :type 1082 :typmod -1 :location 40}",
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := Parse(tt.tree)
+			if err != nil || len(nodes) != 1 {
+				t.Fatalf("Parse() error = %v, nodes = %v", err, nodes)
+			}
+			if got := IsCurrentTimestamp(nodes[0]); got != tt.want {
+				t.Errorf("IsCurrentTimestamp() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	if _, err := Parse("{UNKNOWNEXPR :field 1}"); err == nil {
+		t.Error("Parse() expected error for unknown node")
+	}
+}
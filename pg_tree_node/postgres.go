@@ -25,6 +25,7 @@ type (
 		FuncId         int  `field:"funcid"`
 		FuncResultType int  `field:"funcresulttype"`
 		FuncRetSet     bool `field:"funcretset"`
+		FuncFormat     int  `field:"funcformat"`
 	}
 	// RELABELTYPE
 	ReLabelNode struct {
@@ -46,10 +47,10 @@ type (
 	// OPEXPR
 	OpNode struct {
 		BaseNode
-		OpNo         int `field:"opno"`
-		OpFuncId     int `field:"opfuncid"`
-		OpResultType int `field:"opresulttype"`
-		OpRetSet     int `field:"opretset"`
+		OpNo         int  `field:"opno"`
+		OpFuncId     int  `field:"opfuncid"`
+		OpResultType int  `field:"opresulttype"`
+		OpRetSet     bool `field:"opretset"`
 	}
 	// CONST
 	ConstNode struct {
@@ -60,16 +61,88 @@ type (
 		ConstIsNull  bool   `field:"constisnull"`
 		ConstValue   []byte `field:"constvalue"`
 	}
+	// SQLVALUEFUNCTION
+	SQLValueFunctionNode struct {
+		Op     int `field:"op"`
+		Type   int `field:"type"`
+		TypMod int `field:"typmod"`
+	}
+	// BOOLEXPR
+	BoolNode struct {
+		BaseNode
+		BoolOp string `field:"boolop"`
+	}
+	// NULLTEST
+	NullTestNode struct {
+		Arg          Node
+		NullTestType int  `field:"nulltesttype"`
+		ArgIsRow     bool `field:"argisrow"`
+	}
+	// SCALARARRAYOPEXPR
+	ScalarArrayOpNode struct {
+		BaseNode
+		OpNo     int  `field:"opno"`
+		OpFuncId int  `field:"opfuncid"`
+		UseOr    bool `field:"useOr"`
+	}
+	// COERCEVIAIO
+	CoerceViaIONode struct {
+		Arg          Node
+		ResultType   int `field:"resulttype"`
+		CoerceFormat int `field:"coerceformat"`
+	}
+	// CASE
+	CaseNode struct {
+		BaseNode  // CASEWHEN nodes
+		Arg       Node
+		DefResult Node
+		CaseType  int `field:"casetype"`
+	}
+	// CASEWHEN
+	CaseWhenNode struct {
+		Expr   Node
+		Result Node
+	}
+	// CASETESTEXPR is the value of the case argument in the conditions
+	CaseTestNode struct {
+		TypeId  int `field:"typeId"`
+		TypeMod int `field:"typeMod"`
+	}
+	// ARRAY
+	ArrayExprNode struct {
+		ArrayTypeId   int `field:"array_typeid"`
+		ElementTypeId int `field:"element_typeid"`
+		Elements      []Node
+		MultiDims     bool `field:"multidims"`
+	}
+	// SUBLINK, the sub-select is kept as is
+	SubLinkNode struct {
+		SubLinkType int    `field:"subLinkType"`
+		SubLinkId   int    `field:"subLinkId"`
+		TestExpr    string `field:"testexpr"`
+		OperName    string `field:"operName"`
+		SubSelect   string `field:"subselect"`
+	}
 
 	chainType int
 )
 
 const (
-	FUNCEXPR    = "FUNCEXPR"
-	RELABELTYPE = "RELABELTYPE"
-	VAR         = "VAR"
-	OPEXPR      = "OPEXPR"
-	CONST       = "CONST"
+	FUNCEXPR         = "FUNCEXPR"
+	RELABELTYPE      = "RELABELTYPE"
+	VAR              = "VAR"
+	OPEXPR           = "OPEXPR"
+	CONST            = "CONST"
+	SQLVALUEFUNCTION = "SQLVALUEFUNCTION"
+	BOOLEXPR         = "BOOLEXPR"
+	NULLTEST         = "NULLTEST"
+	SCALARARRAYOP    = "SCALARARRAYOPEXPR"
+	COERCEVIAIO      = "COERCEVIAIO"
+	CASE             = "CASE"
+	CASEWHEN         = "CASEWHEN"
+	CASETESTEXPR     = "CASETESTEXPR"
+	ARRAY            = "ARRAY"
+	SUBLINK          = "SUBLINK"
 
 	ctNone chainType = iota
 	ctArray
@@ -130,6 +203,104 @@ func (c *ConstNode) setFieldValue(s string) {
 	setFieldValue(c, s)
 }
 
+func (c *SQLValueFunctionNode) setFieldValue(s string) {
+	setFieldValue(c, s)
+}
+
+func (c *BoolNode) setFieldValue(s string) {
+	if !setFieldValue(c, s) {
+		if fieldName, fieldValue, ok := splitField(s); ok && fieldName == "args" {
+			c.Args = parsePgNodeTrees(fieldValue)
+		}
+	}
+}
+
+func (c *NullTestNode) setFieldValue(s string) {
+	if !setFieldValue(c, s) {
+		if fieldName, fieldValue, ok := splitField(s); ok && fieldName == "arg" {
+			c.Arg = parseNodeField(fieldValue)
+		}
+	}
+}
+
+func (c *ScalarArrayOpNode) setFieldValue(s string) {
+	if !setFieldValue(c, s) {
+		if fieldName, fieldValue, ok := splitField(s); ok && fieldName == "args" {
+			c.Args = parsePgNodeTrees(fieldValue)
+		}
+	}
+}
+
+func (c *CoerceViaIONode) setFieldValue(s string) {
+	if !setFieldValue(c, s) {
+		if fieldName, fieldValue, ok := splitField(s); ok && fieldName == "arg" {
+			c.Arg = parseNodeField(fieldValue)
+		}
+	}
+}
+
+func (c *CaseNode) setFieldValue(s string) {
+	if !setFieldValue(c, s) {
+		if fieldName, fieldValue, ok := splitField(s); ok {
+			switch fieldName {
+			case "arg":
+				c.Arg = parseNodeField(fieldValue)
+			case "args":
+				c.Args = parsePgNodeTrees(fieldValue)
+			case "defresult":
+				c.DefResult = parseNodeField(fieldValue)
+			}
+		}
+	}
+}
+
+func (c *CaseWhenNode) setFieldValue(s string) {
+	if fieldName, fieldValue, ok := splitField(s); ok {
+		switch fieldName {
+		case "expr":
+			c.Expr = parseNodeField(fieldValue)
+		case "result":
+			c.Result = parseNodeField(fieldValue)
+		}
+	}
+}
+
+func (c *CaseTestNode) setFieldValue(s string) {
+	setFieldValue(c, s)
+}
+
+func (c *ArrayExprNode) setFieldValue(s string) {
+	if !setFieldValue(c, s) {
+		if fieldName, fieldValue, ok := splitField(s); ok && fieldName == "elements" {
+			c.Elements = parsePgNodeTrees(fieldValue)
+		}
+	}
+}
+
+func (c *SubLinkNode) setFieldValue(s string) {
+	setFieldValue(c, s)
+}
+
+func splitField(s string) (fieldName, fieldValue string, ok bool) {
+	if del := strings.Index(s, " "); del > 0 {
+		return strings.TrimSpace(s[:del]), strings.TrimSpace(s[del:]), true
+	}
+	return "", "", false
+}
+
+// parseNodeField parses the field that contains a single node, <> means that the node is omitted
+func parseNodeField(s string) Node {
+	var nodes = parsePgNodeTrees(s)
+	switch len(nodes) {
+	case 0:
+		return nil
+	case 1:
+		return nodes[0]
+	default:
+		panic("wrong args count")
+	}
+}
+
 func parseBytes(s string) ([]byte, error) {
 	s = strings.TrimSpace(s)
 	if s[0] != '[' && s[len(s)-1] == ']' {
@@ -145,8 +316,11 @@ func parseBytes(s string) ([]byte, error) {
 	f := strings.Fields(s[1 : len(s)-1])
 	result := make([]byte, 0, len(f))
 	for _, n := range f {
-		if i, err := strconv.ParseUint(n, 10, 8); err != nil {
+		// postgres prints bytes as signed chars
+		if i, err := strconv.ParseInt(n, 10, 16); err != nil {
 			return nil, err
+		} else if i < -128 || i > 255 {
+			return nil, errors.New("byte value is out of range")
 		} else {
 			result = append(result, byte(i))
 		}
@@ -168,7 +342,7 @@ func setFieldValue(c interface{}, s string) bool {
 	for nn := 0; nn < t.NumField(); nn++ {
 		fieldNameTag := strings.Split(t.Field(nn).Tag.Get("field"), ",")
 		if strings.TrimSpace(fieldNameTag[0]) == fieldName {
-			if fieldValue == "" {
+			if fieldValue == "" || fieldValue == "<>" {
 				v.Elem().Field(nn).Set(reflect.Zero(t.Field(nn).Type))
 			} else {
 				switch t.Field(nn).Type.Kind() {
@@ -216,6 +390,10 @@ func setFieldValue(c interface{}, s string) bool {
 
 func parsePgNodeTrees(s string) []Node {
 	var result = make([]Node, 0, 10)
+	if strings.TrimSpace(s) == "<>" {
+		// empty list
+		return result
+	}
 	for s != "" {
 		var (
 			chain string
@@ -250,8 +428,28 @@ func parseObject(s string) Node {
 					node = new(OpNode)
 				case CONST:
 					node = new(ConstNode)
+				case SQLVALUEFUNCTION:
+					node = new(SQLValueFunctionNode)
+				case BOOLEXPR:
+					node = new(BoolNode)
+				case NULLTEST:
+					node = new(NullTestNode)
+				case SCALARARRAYOP:
+					node = new(ScalarArrayOpNode)
+				case COERCEVIAIO:
+					node = new(CoerceViaIONode)
+				case CASE:
+					node = new(CaseNode)
+				case CASEWHEN:
+					node = new(CaseWhenNode)
+				case CASETESTEXPR:
+					node = new(CaseTestNode)
+				case ARRAY:
+					node = new(ArrayExprNode)
+				case SUBLINK:
+					node = new(SubLinkNode)
 				default:
-					panic("not implemented")
+					panic("not implemented: " + chain)
 				}
 			} else {
 				node.setFieldValue(chain)
@@ -67,6 +67,7 @@ func getTransaction(ctx context.Context) (*sql.Tx, error) {
 type (
 	queryExecInterface struct {
 		Query func(query string, args ...interface{}) (*sql.Rows, error)
+		Exec  func(query string, args ...interface{}) (sql.Result, error)
 	}
 )
 
@@ -75,12 +76,12 @@ func getQueryExecPoint(ctx context.Context) (queryExecInterface, error) {
 		return queryExecInterface{}, err
 	} else {
 		if tx != nil {
-			return queryExecInterface{Query: tx.Query}, nil
+			return queryExecInterface{Query: tx.Query, Exec: tx.Exec}, nil
 		}
 		if db, err := getDatabase(ctx); err != nil {
 			return queryExecInterface{}, err
 		} else {
-			return queryExecInterface{Query: db.Query}, nil
+			return queryExecInterface{Query: db.Query, Exec: db.Exec}, nil
 		}
 	}
 }
@@ -0,0 +1,160 @@
+package dragonfly
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"math/big"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	DataFormatCSV   = "csv"
+	DataFormatJSONL = "jsonl"
+	DataFormatYAML  = "yaml"
+)
+
+// normalize adds the rows of the external file to the rows described in the project,
+// the values are converted to the types of the table columns
+func (c *DataContainer) normalize(schema *SchemaRef, db *Root) {
+	if c.Source == nil {
+		return
+	}
+	table, ok := schema.Value.Tables.tryToFind(c.Name)
+	if !ok {
+		panic(fmt.Sprintf("cannot find table `%s` in `%s`", c.Name, schema.Value.Name))
+	}
+	data, err := db.fileReader()(c.Source.File)
+	if err != nil {
+		panic(err)
+	}
+	rows, err := c.Source.parse(data)
+	if err != nil {
+		panic(fmt.Sprintf("cannot read seed data of `%s.%s` from `%s`: %v", schema.Value.Name, c.Name, c.Source.File, err))
+	}
+	for i, row := range rows {
+		var converted = make(TableDataRow, len(row))
+		for name, value := range row {
+			if len(c.Source.Columns) > 0 {
+				if name = c.Source.Columns[name]; name == "" {
+					continue
+				}
+			}
+			column, ok := table.Columns.tryToFind(name)
+			if !ok {
+				panic(fmt.Sprintf("cannot find column `%s` in `%s.%s`", name, schema.Value.Name, c.Name))
+			}
+			if converted[name], err = convertSeedValue(column.Value.Schema.Value.TypeBase, value); err != nil {
+				panic(fmt.Sprintf("wrong value of `%s` in row #%d of `%s`: %v", name, i+1, c.Source.File, err))
+			}
+		}
+		c.Data = append(c.Data, converted)
+	}
+}
+
+func (c DataSource) format() string {
+	if c.Format != "" {
+		return strings.ToLower(c.Format)
+	}
+	switch strings.ToLower(path.Ext(c.File)) {
+	case ".csv":
+		return DataFormatCSV
+	case ".jsonl", ".ndjson":
+		return DataFormatJSONL
+	case ".yaml", ".yml":
+		return DataFormatYAML
+	}
+	panic(fmt.Sprintf("cannot resolve the format of `%s`, use `%s`, `%s` or `%s`", c.File, DataFormatCSV, DataFormatJSONL, DataFormatYAML))
+}
+
+func (c DataSource) parse(data []byte) ([]map[string]interface{}, error) {
+	switch format := c.format(); format {
+	case DataFormatCSV:
+		return parseCSVRows(data)
+	case DataFormatJSONL:
+		return parseJSONLinesRows(data)
+	case DataFormatYAML:
+		var rows []map[string]interface{}
+		err := yaml.Unmarshal(data, &rows)
+		return rows, err
+	default:
+		panic(fmt.Sprintf("unknown seed data format `%s`", format))
+	}
+}
+
+// parseCSVRows takes the column names from the first line, the empty values are null
+func parseCSVRows(data []byte) ([]map[string]interface{}, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	var (
+		header = records[0]
+		rows   = make([]map[string]interface{}, 0, len(records)-1)
+	)
+	for _, record := range records[1:] {
+		var row = make(map[string]interface{}, len(header))
+		for i, name := range header {
+			if record[i] == "" {
+				row[name] = nil
+			} else {
+				row[name] = record[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseJSONLinesRows reads one object per line, the numbers are kept as they are written
+func parseJSONLinesRows(data []byte) ([]map[string]interface{}, error) {
+	var (
+		rows    = make([]map[string]interface{}, 0)
+		decoder = json.NewDecoder(bytes.NewReader(data))
+	)
+	decoder.UseNumber()
+	for {
+		var row map[string]interface{}
+		if err := decoder.Decode(&row); err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+// convertSeedValue converts the text of the file to the value of the column type,
+// the values that are already typed by the decoder are kept as is
+func convertSeedValue(t TypeBase, value interface{}) (interface{}, error) {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case json.Number:
+		text = v.String()
+	default:
+		return value, nil
+	}
+	if t.IsArray {
+		return text, nil
+	}
+	switch canonicalTypeName(t.Type) {
+	case "int2", "int4", "int8":
+		return strconv.ParseInt(text, 10, 64)
+	case "numeric", "float4", "float8":
+		// the text is kept to avoid losing the precision of numeric values
+		if _, ok := new(big.Rat).SetString(text); !ok {
+			return nil, fmt.Errorf("`%s` is not a number", text)
+		}
+		return text, nil
+	case "bool":
+		return strconv.ParseBool(text)
+	}
+	return text, nil
+}
@@ -0,0 +1,82 @@
+package dragonfly
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDataContainer_normalize(t *testing.T) {
+	const project = `
+schemas:
+  - name: ref
+    tables:
+      currencies:
+        columns:
+          - name: code
+            schema: { type: varchar, length: 3 }
+          - name: digits
+            schema: { type: int2 }
+          - name: rate
+            schema: { type: numeric, length: 10, precision: 4 }
+          - name: active
+            schema: { type: bool }
+    data:
+      - name: currencies
+        data:
+          - { code: USD, digits: 2, rate: 1, active: true }
+        source:
+          file: %s
+          columns: { iso: code, minor_units: digits, rate: rate, enabled: active }
+`
+	var want = TableData{
+		{"code": "USD", "digits": 2, "rate": 1, "active": true},
+		{"code": "EUR", "digits": int64(2), "rate": "0.9210", "active": true},
+		{"code": "JPY", "digits": int64(0), "rate": nil, "active": false},
+	}
+	tests := []struct {
+		name string
+		file string
+		data string
+	}{
+		{
+			name: "csv",
+			file: "currencies.csv",
+			data: "iso,name,minor_units,rate,enabled\nEUR,Euro,2,0.9210,true\nJPY,Yen,0,,false\n",
+		},
+		{
+			name: "json lines",
+			file: "currencies.jsonl",
+			data: `{"iso": "EUR", "minor_units": 2, "rate": 0.9210, "enabled": true}` + "\n" +
+				`{"iso": "JPY", "minor_units": "0", "rate": null, "enabled": false}` + "\n",
+		},
+		{
+			name: "yaml",
+			file: "currencies.yml",
+			data: "- { iso: EUR, minor_units: '2', rate: '0.9210', enabled: true }\n- { iso: JPY, minor_units: '0', rate: null, enabled: false }\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var files = map[string]string{
+				"project.yml": fmt.Sprintf(project, tt.file),
+				tt.file:       tt.data,
+			}
+			var root = Root{
+				readFile: func(fileName string) ([]byte, error) {
+					if data, ok := files[fileName]; ok {
+						return []byte(data), nil
+					}
+					return nil, os.ErrNotExist
+				},
+			}
+			readAndParseFileWith(root.readFile, "project.yml", &root)
+			root.normalize()
+			schema, _ := root.Schemas.tryToFind("ref")
+			if got := schema.Value.Data[0].Data; !reflect.DeepEqual(got, want) {
+				t.Errorf("normalize() rows = %#v, want %#v", got, want)
+			}
+		})
+	}
+}
@@ -7,6 +7,30 @@ import (
 	"strings"
 )
 
+type (
+	// keywordExpr is printed as is, unlike the literal which quotes reserved words
+	keywordExpr struct {
+		*sqt.Literal
+	}
+	// cascadeDropStmt drops the object along with all the objects that depend on it
+	cascadeDropStmt struct {
+		*sqt.DropStmt
+	}
+)
+
+func (c keywordExpr) String() string {
+	return c.Text
+}
+
+func (c *cascadeDropStmt) String() string {
+	return c.DropStmt.String() + " cascade"
+}
+
+// makeDropDefaultExpr makes `drop default`, the default expression without a value is printed as an empty string
+func makeDropDefaultExpr() sqt.SqlExpr {
+	return makeSetDropExpr(false, keywordExpr{&sqt.Literal{Text: "default"}})
+}
+
 func makeSetDropExpr(setDrop bool, expr sqt.SqlExpr) sqt.SqlExpr {
 	return &sqt.SetDropExpr{
 		SetDrop: sqt.SetDrop(setDrop),
@@ -28,14 +52,24 @@ func makeAddColumnExpr(column ColumnRef) sqt.SqlExpr {
 	}
 }
 
-func makeAddConstraintExpr(columns []string, constraint Constraint) sqt.SqlExpr {
+func makeAddConstraintExpr(constraint ConstraintSchema) *sqt.AddExpr {
 	return &sqt.AddExpr{
 		Target: sqt.TargetConstraint,
-		Name:   &sqt.Literal{Text: constraint.Name},
-		Definition: &sqt.ConstraintWithColumns{
-			Columns:    columns,
-			Constraint: &sqt.UnnamedConstraintExpr{Constraint: makeConstraintInterface(false, constraint)},
-		},
+		Name:   &sqt.Literal{Text: constraint.Constraint.Name},
+		Definition: makeConstraintWithColumns(constraint, &sqt.UnnamedConstraintExpr{
+			Constraint: makeTableConstraintInterface(constraint),
+		}),
+	}
+}
+
+// makeConstraintWithColumns adds the list of columns to the table constraint, the check constraint has no columns
+func makeConstraintWithColumns(constraint ConstraintSchema, constraintExpr sqt.ConstraintExpr) sqt.ConstraintExpr {
+	if constraint.Constraint.Type == ConstraintCheck {
+		return constraintExpr
+	}
+	return &sqt.ConstraintWithColumns{
+		Columns:    constraint.Columns,
+		Constraint: constraintExpr,
 	}
 }
 
@@ -95,6 +129,18 @@ func makeTypeRename(schema string, rename NameComparator) sqt.SqlStmt {
 	}
 }
 
+// makeTypeAlter makes the altering of type, for those clauses that are not supported by the syntax tree
+func makeTypeAlter(schemaName, typeName, alter string) sqt.SqlStmt {
+	return &sqt.AlterStmt{
+		Target: sqt.TargetType,
+		Name: &sqt.Selector{
+			Name:      typeName,
+			Container: schemaName,
+		},
+		Alter: &sqt.Literal{Text: alter},
+	}
+}
+
 func makeTypeAlterAttributeDataType(schemaName, typeName, attrName string, typeSchema TypeBase) sqt.SqlStmt {
 	return &sqt.AlterStmt{
 		Target: sqt.TargetType,
@@ -130,7 +176,7 @@ func makeDomainSetNotNull(schema, domain string, notNull bool) sqt.SqlStmt {
 }
 
 func makeDomainSetDefault(schema, domain string, defaultValue interface{}) sqt.SqlStmt {
-	var setDefault = makeSetDropExpr(false, &sqt.Default{})
+	var setDefault = makeDropDefaultExpr()
 	if defaultValue != nil {
 		setDefault = makeSetDropExpr(true, &sqt.Default{Default: &sqt.Literal{Text: *defaultToSQL(defaultValue)}})
 	}
@@ -299,6 +345,47 @@ func makeTypeDrop(schema, typeName string) sqt.SqlStmt {
 	}
 }
 
+/* SCHEMAS */
+
+func makeSchemaCreate(schema, owner string) sqt.SqlStmt {
+	var create = &sqt.CreateStmt{
+		Target: sqt.TargetSchema,
+		Name:   &sqt.Literal{Text: schema},
+		IfNotX: true,
+	}
+	if owner != "" {
+		create.Create = keywordExpr{&sqt.Literal{Text: "authorization " + owner}}
+	}
+	return create
+}
+
+func makeSchemaRename(rename NameComparator) sqt.SqlStmt {
+	return &sqt.AlterStmt{
+		Target: sqt.TargetSchema,
+		Name:   &sqt.Literal{Text: rename.Actual},
+		Alter: &sqt.SqlRename{
+			NewName: &sqt.Literal{Text: rename.New},
+		},
+	}
+}
+
+func makeSchemaOwner(schema, owner string) sqt.SqlStmt {
+	return &sqt.AlterStmt{
+		Target: sqt.TargetSchema,
+		Name:   &sqt.Literal{Text: schema},
+		Alter:  keywordExpr{&sqt.Literal{Text: "owner to " + owner}},
+	}
+}
+
+func makeSchemaDrop(schema string) sqt.SqlStmt {
+	return &cascadeDropStmt{
+		DropStmt: &sqt.DropStmt{
+			Target: sqt.TargetSchema,
+			Name:   &sqt.Literal{Text: schema},
+		},
+	}
+}
+
 /* COLUMNS */
 
 func makeColumnRename(schema, table string, name NameComparator) sqt.SqlStmt {
@@ -375,7 +462,7 @@ func makeAlterColumnSetNotNull(schema, table, column string, notNull bool) sqt.S
 }
 
 func makeAlterColumnSetDefault(schema, table, column string, defaultValue interface{}) sqt.SqlStmt {
-	var setDefault = makeSetDropExpr(false, &sqt.Default{})
+	var setDefault = makeDropDefaultExpr()
 	if defaultValue != nil {
 		setDefault = makeSetDropExpr(true, &sqt.Default{Default: &sqt.Literal{Text: *defaultToSQL(defaultValue)}})
 	}
@@ -393,7 +480,7 @@ func makeAlterColumnSetDefault(schema, table, column string, defaultValue interf
 	}
 }
 
-func makeAlterColumnSetType(schema, table, column string, domainSchema DomainSchema) sqt.SqlStmt {
+func makeAlterColumnSetType(schema, table, column string, domainSchema DomainSchema, using string) sqt.SqlStmt {
 	// TODO
 	var columnType = domainSchema.Type
 	switch domainSchema.Type {
@@ -413,18 +500,18 @@ func makeAlterColumnSetType(schema, table, column string, domainSchema DomainSch
 		Alter: &sqt.AlterExpr{
 			Target: sqt.TargetColumn,
 			Name:   &sqt.Literal{Text: column},
-			Alter: &sqt.DataTypeExpr{
+			Alter: makeTypeUsing(&sqt.DataTypeExpr{
 				DataType:  columnType,
 				IsArray:   domainSchema.IsArray,
 				Length:    domainSchema.Length,
 				Precision: domainSchema.Precision,
 				Collation: domainSchema.Collate,
-			},
+			}, using),
 		},
 	}
 }
 
-func makeAlterColumnSetDomain(schema, table, column, domainName string) sqt.SqlStmt {
+func makeAlterColumnSetDomain(schema, table, column, domainName, using string) sqt.SqlStmt {
 	return &sqt.AlterStmt{
 		Target: sqt.TargetTable,
 		Name: &sqt.Selector{
@@ -434,9 +521,9 @@ func makeAlterColumnSetDomain(schema, table, column, domainName string) sqt.SqlS
 		Alter: &sqt.AlterExpr{
 			Target: sqt.TargetColumn,
 			Name:   &sqt.Literal{Text: column},
-			Alter: &sqt.DataTypeExpr{
+			Alter: makeTypeUsing(&sqt.DataTypeExpr{
 				DataType: domainName,
-			},
+			}, using),
 		},
 	}
 }
@@ -513,7 +600,9 @@ func stringToOnDeleteUpdateRule(s *string) sqt.OnDeleteUpdateRule {
 		return sqt.RuleRestrict
 	case "set null":
 		return sqt.RuleSetNull
-	case "default", "nothing":
+	case "no action":
+		return sqt.RuleNoAction
+	case "default", "nothing", "set default":
 		return sqt.RuleSetDefault
 	default:
 		panic(fmt.Sprintf("cannot resolve update (delete) rule `%s`", *s))
@@ -549,12 +638,15 @@ func makeConstraintInterface(inColumn bool, constraintDef Constraint) sqt.Constr
 		}
 	case ConstraintForeignKey:
 		if params, ok := constraintDef.Parameters.Parameter.(ForeignKey); ok {
-			newConstraint = &sqt.ConstraintForeignKeyExpr{
-				ConstraintCommon: sqt.ConstraintCommon{InColumn: inColumn},
-				ToTable:          &sqt.Literal{Text: params.ToTable},
-				ToColumn:         params.ToColumn,
-				OnDelete:         stringToOnDeleteUpdateRule(params.OnDelete),
-				OnUpdate:         stringToOnDeleteUpdateRule(params.OnUpdate),
+			newConstraint = &foreignKeyExpr{
+				ConstraintForeignKeyExpr: &sqt.ConstraintForeignKeyExpr{
+					ConstraintCommon: sqt.ConstraintCommon{InColumn: inColumn},
+					ToTable:          &sqt.Literal{Text: params.ToTable},
+					ToColumn:         params.ToColumn,
+					OnDelete:         stringToOnDeleteUpdateRule(params.OnDelete),
+					OnUpdate:         stringToOnDeleteUpdateRule(params.OnUpdate),
+				},
+				Match: makeForeignKeyMatch(params.Match),
 			}
 		} else {
 			panic("the foreign key constraint should contains the parameters")
@@ -563,6 +655,18 @@ func makeConstraintInterface(inColumn bool, constraintDef Constraint) sqt.Constr
 	return newConstraint
 }
 
+// makeTableConstraintInterface makes the constraint of the table, the foreign key can refer to several columns
+func makeTableConstraintInterface(constraint ConstraintSchema) sqt.ConstraintInterface {
+	newConstraint := makeConstraintInterface(false, constraint.Constraint)
+	if fk, ok := newConstraint.(*foreignKeyExpr); ok {
+		fk.RefColumns = constraint.referencedColumns()
+		if len(fk.RefColumns) > 0 {
+			fk.ToColumn = fk.RefColumns[0]
+		}
+	}
+	return newConstraint
+}
+
 func makeConstraintsExpr(inColumn bool, constraintSet []Constraint) []sqt.ConstraintExpr {
 	var constraints = make([]sqt.ConstraintExpr, 0, len(constraintSet))
 	for _, constraintDef := range constraintSet {
@@ -631,7 +735,7 @@ func makeTableCreate(schemaName, tableName string, tableStruct Table) sqt.SqlStm
 		})
 	}
 	for _, constraint := range tableStruct.Constraints {
-		constraintInterface := makeConstraintInterface(false, constraint.Constraint)
+		constraintInterface := makeTableConstraintInterface(constraint)
 		var constraintExpr sqt.ConstraintExpr
 		if constraint.Constraint.Name != "" {
 			constraintExpr = &sqt.NamedConstraintExpr{
@@ -643,10 +747,7 @@ func makeTableCreate(schemaName, tableName string, tableStruct Table) sqt.SqlStm
 				Constraint: constraintInterface,
 			}
 		}
-		constraints = append(constraints, &sqt.ConstraintWithColumns{
-			Columns:    constraint.Columns,
-			Constraint: constraintExpr,
-		})
+		constraints = append(constraints, makeConstraintWithColumns(constraint, constraintExpr))
 	}
 	return &sqt.CreateStmt{
 		Target: sqt.TargetTable,
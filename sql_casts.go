@@ -0,0 +1,291 @@
+package dragonfly
+
+import (
+	"fmt"
+	"github.com/iv-menshenin/dragonfly/utils"
+	sqt "github.com/iv-menshenin/sql-ast"
+	"strings"
+)
+
+type (
+	// typeUsingExpr is the data type of the altered column along with the expression converting the old values
+	typeUsingExpr struct {
+		*sqt.DataTypeExpr
+		Using string
+	}
+	typeCategory int
+)
+
+const (
+	categoryUnknown typeCategory = iota
+	categoryNumeric
+	categoryString
+	categoryBoolean
+	categoryTemporal
+	categoryJSON
+	categoryCustom
+
+	// the column is altered in place with `alter column ... type ... using ...`
+	MigrationStrategyAlter = "alter"
+	// the new column is added, filled with converted values and swapped with the old one
+	MigrationStrategyStaged = "staged"
+
+	stagedNewSuffix = "__new"
+	stagedOldSuffix = "__old"
+)
+
+var (
+	typeCategories = map[string]typeCategory{
+		"int2":        categoryNumeric,
+		"int4":        categoryNumeric,
+		"int8":        categoryNumeric,
+		"numeric":     categoryNumeric,
+		"float4":      categoryNumeric,
+		"float8":      categoryNumeric,
+		"char":        categoryString,
+		"varchar":     categoryString,
+		"text":        categoryString,
+		"bool":        categoryBoolean,
+		"date":        categoryTemporal,
+		"time":        categoryTemporal,
+		"timetz":      categoryTemporal,
+		"timestamp":   categoryTemporal,
+		"timestamptz": categoryTemporal,
+		"json":        categoryJSON,
+		"jsonb":       categoryJSON,
+	}
+	// temporal types that can be converted to each other by assignment
+	temporalAssignments = map[string][]string{
+		"date":        {"timestamp", "timestamptz"},
+		"timestamp":   {"date", "time", "timestamptz"},
+		"timestamptz": {"date", "time", "timetz", "timestamp"},
+		"time":        {"timetz"},
+		"timetz":      {"time"},
+	}
+)
+
+func (c *typeUsingExpr) String() string {
+	// the alter expression does not add `type` keyword for anything but the data type itself
+	return utils.NonEmptyStringsConcatSpaceSeparated("type", c.DataTypeExpr, "using", c.Using)
+}
+
+func getTypeCategory(typeName string) typeCategory {
+	if category, ok := typeCategories[typeName]; ok {
+		return category
+	}
+	if strings.Contains(typeName, ".") {
+		return categoryCustom
+	}
+	return categoryUnknown
+}
+
+func makeCastType(column string, newType TypeBase) string {
+	var typeName = strings.ToLower(newType.Type)
+	switch typeName {
+	case "smallserial", "serial2":
+		typeName = "int2"
+	case "serial", "serial4":
+		typeName = "int4"
+	case "bigserial", "serial8":
+		typeName = "int8"
+	}
+	if newType.IsArray {
+		typeName += "[]"
+	}
+	return fmt.Sprintf("%s::%s", column, typeName)
+}
+
+// makeColumnTypeCast returns the expression that converts the column value from the old type to the new one.
+// An empty expression means that the database converts the values by itself, false means that there is no known way
+func makeColumnTypeCast(column string, old, new TypeBase) (string, bool) {
+	oldType, newType := canonicalTypeName(old.Type), canonicalTypeName(new.Type)
+	if old.IsArray != new.IsArray {
+		if !old.IsArray {
+			var element = TypeBase{Type: new.Type}
+			if _, ok := makeColumnTypeCast(column, old, element); ok {
+				return fmt.Sprintf("array[%s]", makeCastType(column, element)), true
+			}
+		}
+		return "", false
+	}
+	if oldType == newType {
+		return "", true
+	}
+	var (
+		oldCategory = getTypeCategory(oldType)
+		newCategory = getTypeCategory(newType)
+	)
+	switch {
+	case oldCategory == categoryUnknown || newCategory == categoryUnknown:
+		if newCategory == categoryString && !old.IsArray {
+			// any value has its text representation
+			return "", true
+		}
+		return "", false
+	case newCategory == categoryString:
+		return "", true
+	case oldCategory == categoryString:
+		return makeCastType(column, new), true
+	case new.IsArray:
+		// elements of the arrays can be converted only with explicit casting
+		if _, ok := makeColumnTypeCast(column, TypeBase{Type: old.Type}, TypeBase{Type: new.Type}); ok {
+			return makeCastType(column, new), true
+		}
+		return "", false
+	case oldCategory == categoryNumeric && newCategory == categoryNumeric:
+		return "", true
+	case oldCategory == categoryNumeric && newCategory == categoryBoolean:
+		return fmt.Sprintf("%s <> 0", column), true
+	case oldCategory == categoryBoolean && newCategory == categoryNumeric:
+		return fmt.Sprintf("case when %s then 1 else 0 end", column), true
+	case oldCategory == categoryNumeric && (newType == "timestamptz" || newType == "timestamp"):
+		// numbers are considered as unix time
+		return makeCastType(fmt.Sprintf("to_timestamp(%s)", column), new), true
+	case (oldType == "timestamptz" || oldType == "timestamp" || oldType == "date") && newCategory == categoryNumeric:
+		return makeCastType(fmt.Sprintf("extract(epoch from %s)", column), new), true
+	case oldCategory == categoryTemporal && newCategory == categoryTemporal:
+		if utils.ArrayContainsCI(temporalAssignments[oldType], newType) {
+			return "", true
+		}
+		return "", false
+	case oldCategory == categoryJSON && newCategory == categoryJSON:
+		return makeCastType(column, new), true
+	case oldCategory == categoryCustom && newCategory == categoryCustom:
+		// enumerations and records can be converted through their text representation only
+		return makeCastType(column+"::text", new), true
+	case newCategory == categoryCustom:
+		return makeCastType(column, new), true
+	}
+	return "", false
+}
+
+func makeTypeUsing(dataType *sqt.DataTypeExpr, using string) sqt.SqlExpr {
+	if using == "" {
+		return dataType
+	}
+	return &typeUsingExpr{
+		DataTypeExpr: dataType,
+		Using:        using,
+	}
+}
+
+func makeSuffixedName(name, suffix string) string {
+	if len(name)+len(suffix) > maxIdentLength {
+		name = name[:maxIdentLength-len(suffix)]
+	}
+	return name + suffix
+}
+
+// getStrategy returns the strategy in lower case, it is empty if it is not set
+func (c *ColumnMigration) getStrategy() (string, error) {
+	if c == nil || c.Strategy == "" {
+		return "", nil
+	}
+	switch strategy := strings.ToLower(c.Strategy); strategy {
+	case MigrationStrategyAlter, MigrationStrategyStaged:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown migration strategy `%s`, expected %s or %s", c.Strategy, MigrationStrategyAlter, MigrationStrategyStaged)
+}
+
+// isKeyColumn returns true if the column is in a constraint or an index of the table, or it is referenced by a foreign key.
+// They are dropped along with the old column by the staged change, so such a column is always altered in place
+func (c *Root) isKeyColumn(schemaName, tableName string, table *Table, columnName string) bool {
+	if len(table.getAllColumnConstraints(columnName)) > 0 {
+		return true
+	}
+	for _, index := range table.Indices {
+		if utils.ArrayContainsCI(index.Columns, columnName) {
+			return true
+		}
+	}
+	for _, schema := range c.Schemas {
+		for _, other := range schema.Value.Tables {
+			for _, constraint := range other.getAllConstraints() {
+				fk, ok := constraint.Constraint.Parameters.Parameter.(ForeignKey)
+				if !ok || constraint.Constraint.Type != ConstraintForeignKey {
+					continue
+				}
+				refSchema, refTable := schema.Value.Name, fk.ToTable
+				if parts := strings.SplitN(fk.ToTable, ".", 2); len(parts) == 2 {
+					refSchema, refTable = parts[0], parts[1]
+				}
+				if strings.EqualFold(refSchema, schemaName) && strings.EqualFold(refTable, tableName) &&
+					(strings.EqualFold(fk.ToColumn, columnName) || utils.ArrayContainsCI(constraint.RefColumns, columnName)) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// checkColumnMigration returns an error if the strategy of the column is unknown or cannot be used for the column
+func (c *Root) checkColumnMigration(schemaName, tableName string, table *Table, column Column) error {
+	strategy, err := column.Migration.getStrategy()
+	if err != nil {
+		return fmt.Errorf("column `%s.%s.%s`: %v", schemaName, tableName, column.Name, err)
+	}
+	if strategy == MigrationStrategyStaged && c.isKeyColumn(schemaName, tableName, table, column.Name) {
+		return fmt.Errorf(
+			"column `%s.%s.%s` cannot be changed by the `%s` strategy, its constraints and indices would be dropped along with the old column",
+			schemaName, tableName, column.Name, MigrationStrategyStaged,
+		)
+	}
+	return nil
+}
+
+// makeStagedTypeChange makes the new column of the new type, fills it with converted values of the old column and swaps them.
+// The old column is dropped at the end, so the policy of destructive changes is applied to it.
+// In the online mode the new column is filled in batches while the trigger converts the values of changed rows
+func makeStagedTypeChange(
+	schema, table string,
+	column Column,
+	using string,
+	online *onlineMigration,
+) (
+	install []sqt.SqlStmt,
+	afterInstall []sqt.SqlStmt,
+) {
+	var (
+		newColumn  = column
+		newName    = makeSuffixedName(column.Name, stagedNewSuffix)
+		oldName    = makeSuffixedName(column.Name, stagedOldSuffix)
+		columnType = column.Schema.Value
+	)
+	newColumn.Name = newName
+	if def := defaultToSQL(columnType.Default); def != nil {
+		using = fmt.Sprintf("coalesce(%s, %s)", using, *def)
+	}
+	install = []sqt.SqlStmt{makeColumnAdd(schema, table, ColumnRef{Value: newColumn})}
+	if online != nil {
+		createTrigger, dropTrigger := makeSyncTrigger(schema, table, newName, using)
+		install = append(install, createTrigger...)
+		install = append(install, online.makeBackfill(schema, table, newName, using))
+		// the trigger refers to the new column by its temporary name, so it is dropped right before the swap
+		install = append(install, dropTrigger...)
+	} else {
+		install = append(install, makeColumnFill(schema, table, newName, using))
+	}
+	install = append(
+		install,
+		makeColumnRename(schema, table, NameComparator{Actual: column.Name, New: oldName}),
+		makeColumnRename(schema, table, NameComparator{Actual: newName, New: column.Name}),
+		// the old column must not prevent the insertion of new rows until it is dropped
+		makeAlterColumnSetNotNull(schema, table, oldName, false),
+	)
+	if columnType.Default != nil {
+		install = append(install, makeAlterColumnSetDefault(schema, table, column.Name, columnType.Default))
+	}
+	if columnType.NotNull {
+		if online != nil {
+			install = append(install, online.makeSetNotNull(schema, table, column.Name)...)
+		} else {
+			install = append(install, makeAlterColumnSetNotNull(schema, table, column.Name, true))
+		}
+	}
+	afterInstall = []sqt.SqlStmt{
+		makeColumnDropStmt(schema, table, oldName, true, true),
+	}
+	return
+}
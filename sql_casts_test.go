@@ -0,0 +1,193 @@
+package dragonfly
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_makeColumnTypeCast(t *testing.T) {
+	tests := []struct {
+		name   string
+		old    TypeBase
+		new    TypeBase
+		want   string
+		wantOk bool
+	}{
+		{
+			name:   "implicit numeric",
+			old:    TypeBase{Type: "int4"},
+			new:    TypeBase{Type: "bigint"},
+			want:   "",
+			wantOk: true,
+		},
+		{
+			name:   "string to integer",
+			old:    TypeBase{Type: "character varying"},
+			new:    TypeBase{Type: "int4"},
+			want:   "field::int4",
+			wantOk: true,
+		},
+		{
+			name:   "string to enum",
+			old:    TypeBase{Type: "text"},
+			new:    TypeBase{Type: "public.status"},
+			want:   "field::public.status",
+			wantOk: true,
+		},
+		{
+			name:   "enum to another enum",
+			old:    TypeBase{Type: "public.status"},
+			new:    TypeBase{Type: "public.state"},
+			want:   "field::text::public.state",
+			wantOk: true,
+		},
+		{
+			name:   "integer to boolean",
+			old:    TypeBase{Type: "int2"},
+			new:    TypeBase{Type: "bool"},
+			want:   "field <> 0",
+			wantOk: true,
+		},
+		{
+			name:   "unix time",
+			old:    TypeBase{Type: "int8"},
+			new:    TypeBase{Type: "timestamptz"},
+			want:   "to_timestamp(field)::timestamptz",
+			wantOk: true,
+		},
+		{
+			name:   "scalar to array",
+			old:    TypeBase{Type: "varchar"},
+			new:    TypeBase{Type: "int8", IsArray: true},
+			want:   "array[field::int8]",
+			wantOk: true,
+		},
+		{
+			name:   "array to scalar",
+			old:    TypeBase{Type: "int8", IsArray: true},
+			new:    TypeBase{Type: "int8"},
+			wantOk: false,
+		},
+		{
+			name:   "time to date",
+			old:    TypeBase{Type: "time"},
+			new:    TypeBase{Type: "date"},
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := makeColumnTypeCast("field", tt.old, tt.new)
+			if ok != tt.wantOk {
+				t.Fatalf("makeColumnTypeCast() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if got != tt.want {
+				t.Errorf("makeColumnTypeCast() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoot_Validate_migrationStrategy(t *testing.T) {
+	const project = `
+schemas:
+  - name: shop
+    tables:
+      items:
+        columns:
+          - name: id
+            schema: { type: int8, not_null: true }
+            constraints:
+              - name: pk_items
+                type: primary key
+          - name: price
+            schema: { type: numeric }
+            migration: { strategy: %s }
+      orders:
+        columns:
+          - name: item_id
+            schema: { type: int8 }
+            migration: { strategy: %s }
+            constraints:
+              - name: fk_orders_item
+                type: foreign key
+                parameters: { table: items, column: id }
+`
+	tests := []struct {
+		name    string
+		price   string
+		itemID  string
+		wantErr string
+	}{
+		{name: "known strategies", price: "staged", itemID: "alter"},
+		{name: "unknown strategy", price: "copy", itemID: "alter", wantErr: "unknown migration strategy `copy`"},
+		{name: "staged key column", price: "alter", itemID: "staged", wantErr: "column `shop.orders.item_id` cannot be changed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := readProjectSnapshot([]byte(fmt.Sprintf(project, tt.price, tt.itemID)))
+			if err != nil {
+				t.Fatalf("readProjectSnapshot() error = %v", err)
+			}
+			err = root.Validate()
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestColumnComparator_makeTypeChange_keyColumn(t *testing.T) {
+	const project = `
+migrations:
+  mode: online
+schemas:
+  - name: shop
+    tables:
+      items:
+        columns:
+          - name: id
+            schema: { type: %s, not_null: true }
+            constraints:
+              - name: pk_items
+                type: primary key
+          - name: code
+            schema: { type: %s }
+`
+	tests := []struct {
+		name    string
+		oldType string
+		newType string
+	}{
+		{name: "known cast", oldType: "varchar", newType: "int8"},
+		{name: "no known cast", oldType: "uuid", newType: "int8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := readProjectSnapshot([]byte(fmt.Sprintf(project, tt.oldType, "varchar")))
+			if err != nil {
+				t.Fatalf("readProjectSnapshot() error = %v", err)
+			}
+			root, err := readProjectSnapshot([]byte(fmt.Sprintf(project, tt.newType, "int8")))
+			if err != nil {
+				t.Fatalf("readProjectSnapshot() error = %v", err)
+			}
+			diff := MakeDiff(actual, root)
+			var script = make([]string, 0)
+			for _, stmt := range diff.allStatements() {
+				script = append(script, stmt.String())
+			}
+			var got = strings.Join(script, ";\n")
+			if strings.Contains(got, "id__new") || strings.Contains(got, "id__old") || !strings.Contains(got, "alter column id type") {
+				t.Errorf("the primary key column must be altered in place:\n%s", got)
+			}
+			if !strings.Contains(got, "code__new") {
+				t.Errorf("the column out of the keys must be changed by the staged strategy:\n%s", got)
+			}
+		})
+	}
+}
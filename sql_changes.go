@@ -0,0 +1,451 @@
+package dragonfly
+
+import (
+	"encoding/json"
+	"fmt"
+	sqt "github.com/iv-menshenin/sql-ast"
+	"io"
+	"strings"
+)
+
+type (
+	ObjectKind   string
+	ChangeAction string
+	// ChangeStatement is one of the SQL statements that implement the change
+	ChangeStatement struct {
+		SQL   string `json:"sql"`
+		Class string `json:"class"`
+	}
+	// Change describes what happens with one database object
+	Change struct {
+		Kind   ObjectKind   `json:"kind"`
+		Schema string       `json:"schema"`
+		Table  string       `json:"table,omitempty"` // for columns and constraints
+		Name   string       `json:"name"`
+		Action ChangeAction `json:"action"`
+		// the previous name of the renamed object
+		OldName    string            `json:"old_name,omitempty"`
+		Old        interface{}       `json:"old,omitempty"`
+		New        interface{}       `json:"new,omitempty"`
+		Provenance *Provenance       `json:"provenance,omitempty"`
+		Statements []ChangeStatement `json:"statements"`
+		// the name of the existing object that rename detection matched with the project object
+		matchedName string
+	}
+	// Provenance explains why the statements of the change are in the script
+	Provenance struct {
+		// the path of the object in the project file
+		Path        string       `json:"path"`
+		RenamedFrom string       `json:"renamed_from,omitempty"`
+		Differences []Difference `json:"differences,omitempty"`
+	}
+	// Difference is one of the attributes whose value triggered the change
+	Difference struct {
+		Attribute string `json:"attribute"`
+		Old       string `json:"old"`
+		New       string `json:"new"`
+	}
+	ChangeReport struct {
+		Changes []Change       `json:"changes"`
+		Summary map[string]int `json:"summary"`
+	}
+)
+
+const (
+	ObjectSchema     ObjectKind = "schema"
+	ObjectDomain     ObjectKind = "domain"
+	ObjectType       ObjectKind = "type"
+	ObjectTable      ObjectKind = "table"
+	ObjectColumn     ObjectKind = "column"
+	ObjectConstraint ObjectKind = "constraint"
+	ObjectIndex      ObjectKind = "index"
+	ObjectRow        ObjectKind = "row"
+	ObjectHook       ObjectKind = "hook"
+
+	ActionCreate ChangeAction = "create"
+	ActionAlter  ChangeAction = "alter"
+	ActionRename ChangeAction = "rename"
+	ActionDrop   ChangeAction = "drop"
+	ActionRun    ChangeAction = "run"
+)
+
+var (
+	objectKindByTarget = map[sqt.SqlTarget]ObjectKind{
+		sqt.TargetSchema:     ObjectSchema,
+		sqt.TargetTable:      ObjectTable,
+		sqt.TargetColumn:     ObjectColumn,
+		sqt.TargetDomain:     ObjectDomain,
+		sqt.TargetType:       ObjectType,
+		sqt.TargetConstraint: ObjectConstraint,
+	}
+)
+
+// describeStatement attaches the change to the statement, the first description wins
+func describeStatement(stmt sqt.SqlStmt, change Change) sqt.SqlStmt {
+	m := toMigrationStmt(stmt)
+	if m.change == nil {
+		m.change = &change
+	}
+	return m
+}
+
+func (c Change) key() string {
+	return strings.ToLower(strings.Join([]string{string(c.Kind), c.Schema, c.Table, c.Name, string(c.Action)}, "/"))
+}
+
+// if the comparator did not describe the statement, we can still learn something about it
+func inferChange(stmt sqt.SqlStmt) Change {
+	var change = Change{Action: ActionAlter}
+	var name sqt.SqlIdent
+	switch s := stmt.(type) {
+	case *sqt.CreateStmt:
+		change.Kind, change.Action, name = objectKindByTarget[s.Target], ActionCreate, s.Name
+	case *sqt.DropStmt:
+		change.Kind, change.Action, name = objectKindByTarget[s.Target], ActionDrop, s.Name
+	case *sqt.AlterStmt:
+		change.Kind, name = objectKindByTarget[s.Target], s.Name
+		if _, ok := s.Alter.(*sqt.SqlRename); ok {
+			change.Action = ActionRename
+		}
+	case *sqt.UpdateStmt:
+		change.Kind, name = ObjectTable, s.Table.Table
+	case *sqt.InsertStmt:
+		change.Kind, name = ObjectTable, s.Table.Table
+	}
+	if selector, ok := name.(*sqt.Selector); ok {
+		change.Schema, change.Name = selector.Container, selector.Name
+	} else if name != nil {
+		change.Name = identName(name)
+		if change.Kind == ObjectSchema {
+			change.Schema = change.Name
+		}
+	}
+	return change
+}
+
+// Changes groups all the statements of the diff by changed objects, the order of statements is kept
+func (c *Diff) Changes() []Change {
+	var (
+		changes = make([]Change, 0)
+		indexes = make(map[string]int)
+	)
+	for _, stmt := range c.allStatements() {
+		var change Change
+		if m, ok := stmt.(*migrationStmt); ok && m.change != nil {
+			change = *m.change
+		} else {
+			change = inferChange(unwrapStatement(stmt))
+		}
+		statement := ChangeStatement{
+			SQL:   stmt.String(),
+			Class: classifyStatement(stmt).String(),
+		}
+		if i, ok := indexes[change.key()]; ok {
+			changes[i].Statements = append(changes[i].Statements, statement)
+			continue
+		}
+		change.Statements = []ChangeStatement{statement}
+		change.Provenance = change.provenance()
+		indexes[change.key()] = len(changes)
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// Report returns the changes along with the number of statements of each class
+func (c *Diff) Report() ChangeReport {
+	var report = ChangeReport{
+		Changes: c.Changes(),
+		Summary: make(map[string]int, len(statementClassNames)),
+	}
+	for _, name := range statementClassNames {
+		report.Summary[name] = 0
+	}
+	for _, stmt := range c.allStatements() {
+		report.Summary[classifyStatement(stmt).String()]++
+	}
+	return report
+}
+
+func (c *Diff) PrintJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c.Report())
+}
+
+func (c DomainComparator) describe(action ChangeAction, stmt sqt.SqlStmt) sqt.SqlStmt {
+	var change = Change{
+		Kind:   ObjectDomain,
+		Schema: nonEmptyName(c.Schema),
+		Name:   nonEmptyName(c.Name),
+		Action: action,
+	}
+	if c.DomainStruct.OldStructure != nil {
+		change.Old = c.DomainStruct.OldStructure
+	}
+	if c.DomainStruct.NewStructure != nil {
+		change.New = c.DomainStruct.NewStructure
+	}
+	if action == ActionRename {
+		change.OldName = fmt.Sprintf("%s.%s", c.Schema.Actual, c.Name.Actual)
+	}
+	change.matchedName = matchedName(c.Schema, c.Name)
+	return describeStatement(stmt, change)
+}
+
+func (c TypeComparator) describe(action ChangeAction, stmt sqt.SqlStmt) sqt.SqlStmt {
+	var change = Change{
+		Kind:   ObjectType,
+		Schema: nonEmptyName(c.Schema),
+		Name:   nonEmptyName(c.Name),
+		Action: action,
+	}
+	if c.TypeStruct.OldStructure != nil {
+		change.Old = c.TypeStruct.OldStructure
+	}
+	if c.TypeStruct.NewStructure != nil {
+		change.New = c.TypeStruct.NewStructure
+	}
+	if action == ActionRename {
+		change.OldName = fmt.Sprintf("%s.%s", c.Schema.Actual, c.Name.Actual)
+	}
+	change.matchedName = matchedName(c.Schema, c.Name)
+	return describeStatement(stmt, change)
+}
+
+func (c TableComparator) describe(action ChangeAction, stmt sqt.SqlStmt) sqt.SqlStmt {
+	var change = Change{
+		Kind:   ObjectTable,
+		Schema: nonEmptyName(c.Schema),
+		Name:   nonEmptyName(c.Name),
+		Action: action,
+	}
+	if c.TableStruct.OldStructure != nil {
+		change.Old = c.TableStruct.OldStructure
+	}
+	if c.TableStruct.NewStructure != nil {
+		change.New = c.TableStruct.NewStructure
+	}
+	if action == ActionRename {
+		change.OldName = fmt.Sprintf("%s.%s", c.Schema.Actual, c.Name.Actual)
+	}
+	change.matchedName = matchedName(c.Schema, c.Name)
+	return describeStatement(stmt, change)
+}
+
+func (c TableComparator) describeConstraint(action ChangeAction, old, new *ConstraintSchema, stmt sqt.SqlStmt) sqt.SqlStmt {
+	var change = Change{
+		Kind:   ObjectConstraint,
+		Schema: nonEmptyName(c.Schema),
+		Table:  nonEmptyName(c.Name),
+		Action: action,
+	}
+	if old != nil {
+		change.Name, change.Old = old.Constraint.Name, *old
+	}
+	if new != nil {
+		change.Name, change.New = new.Constraint.Name, *new
+	}
+	change.matchedName = matchedName(c.Schema, c.Name)
+	return describeStatement(stmt, change)
+}
+
+func (c ColumnComparator) describe(action ChangeAction, stmt sqt.SqlStmt) sqt.SqlStmt {
+	var change = Change{
+		Kind:   ObjectColumn,
+		Schema: c.SchemaName,
+		Table:  c.TableName,
+		Name:   nonEmptyName(c.Name),
+		Action: action,
+	}
+	if c.ActualStruct != nil {
+		change.Old = c.ActualStruct.Value
+	}
+	if c.NewStruct != nil {
+		change.New = c.NewStruct.Value
+	}
+	if action == ActionRename {
+		change.OldName = c.Name.Actual
+	}
+	if c.Name.Actual != "" && c.Name.New != "" && !strings.EqualFold(c.Name.Actual, c.Name.New) {
+		change.matchedName = c.Name.Actual
+	}
+	return describeStatement(stmt, change)
+}
+
+func nonEmptyName(name NameComparator) string {
+	if name.New != "" {
+		return name.New
+	}
+	return name.Actual
+}
+
+// matchedName returns the name of the existing object if it differs from the project one
+func matchedName(schema, name NameComparator) string {
+	if schema.Actual == "" || name.Actual == "" || schema.New == "" || name.New == "" {
+		return ""
+	}
+	if strings.EqualFold(schema.Actual, schema.New) && strings.EqualFold(name.Actual, name.New) {
+		return ""
+	}
+	return fmt.Sprintf("%s.%s", schema.Actual, name.Actual)
+}
+
+// path returns the location of the object in the project file
+func (c Change) path() string {
+	var schema = fmt.Sprintf("schemas[%s]", c.Schema)
+	switch c.Kind {
+	case ObjectSchema:
+		return schema
+	case ObjectDomain:
+		return fmt.Sprintf("%s.domains.%s", schema, c.Name)
+	case ObjectType:
+		return fmt.Sprintf("%s.types.%s", schema, c.Name)
+	case ObjectTable:
+		return fmt.Sprintf("%s.tables.%s", schema, c.Name)
+	case ObjectColumn:
+		return fmt.Sprintf("%s.tables.%s.columns[%s]", schema, c.Table, c.Name)
+	case ObjectConstraint:
+		return fmt.Sprintf("%s.tables.%s.constraints[%s]", schema, c.Table, c.Name)
+	case ObjectIndex:
+		return fmt.Sprintf("%s.tables.%s.indices[%s]", schema, c.Table, c.Name)
+	case ObjectRow:
+		return fmt.Sprintf("%s.data[%s].data[%s]", schema, c.Table, c.Name)
+	case ObjectHook:
+		return fmt.Sprintf("migrations.hooks[%s]", c.Name)
+	}
+	return ""
+}
+
+// provenance tells where the change came from, the statements of unknown objects have no provenance
+func (c Change) provenance() *Provenance {
+	var path = c.path()
+	if path == "" {
+		return nil
+	}
+	var result = Provenance{
+		Path:        path,
+		RenamedFrom: c.matchedName,
+		Differences: c.differences(),
+	}
+	if c.OldName != "" {
+		result.RenamedFrom = c.OldName
+	}
+	return &result
+}
+
+// differences lists the attributes of the existing object that do not match the project
+func (c Change) differences() []Difference {
+	var result = make([]Difference, 0)
+	switch old := c.Old.(type) {
+	case Column:
+		if new, ok := c.New.(Column); ok {
+			result = append(result, domainDifferences(old.Schema.Value, new.Schema.Value)...)
+		}
+	case *DomainSchema:
+		if new, ok := c.New.(*DomainSchema); ok {
+			result = append(result, domainDifferences(*old, *new)...)
+			if oldCheck, newCheck := stringOrNone(old.Check), stringOrNone(new.Check); oldCheck != newCheck {
+				result = append(result, Difference{Attribute: "check", Old: oldCheck, New: newCheck})
+			}
+		}
+	case *TypeSchema:
+		if new, ok := c.New.(*TypeSchema); ok {
+			if oldType, newType := typeBaseString(old.TypeBase), typeBaseString(new.TypeBase); oldType != newType {
+				result = append(result, Difference{Attribute: "type", Old: oldType, New: newType})
+			}
+			if oldEnum, newEnum := enumLabels(old.Enum), enumLabels(new.Enum); oldEnum != newEnum {
+				result = append(result, Difference{Attribute: "enum", Old: oldEnum, New: newEnum})
+			}
+			if oldFields, newFields := columnNames(old.Fields), columnNames(new.Fields); oldFields != newFields {
+				result = append(result, Difference{Attribute: "fields", Old: oldFields, New: newFields})
+			}
+		}
+	case *Table:
+		if new, ok := c.New.(*Table); ok {
+			result = append(result, storageDifferences(
+				old.Storage.isUnlogged(), new.Storage.isUnlogged(),
+				old.Storage.getStorage(), new.Storage.getStorage(),
+				old.Storage.parameters(), new.Storage.parameters(),
+			)...)
+		}
+	case Index:
+		if new, ok := c.New.(Index); ok {
+			result = append(result, storageDifferences(false, false, old.Storage, new.Storage, old.Storage.parameters(), new.Storage.parameters())...)
+		}
+	case ConstraintSchema:
+		if new, ok := c.New.(ConstraintSchema); ok {
+			if old.Constraint.Type != new.Constraint.Type {
+				result = append(result, Difference{Attribute: "type", Old: old.Constraint.Type.String(), New: new.Constraint.Type.String()})
+			}
+			if oldColumns, newColumns := strings.Join(old.Columns, ", "), strings.Join(new.Columns, ", "); oldColumns != newColumns {
+				result = append(result, Difference{Attribute: "columns", Old: oldColumns, New: newColumns})
+			}
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// domainDifferences compares the attributes that define the values of the column or domain
+func domainDifferences(old, new DomainSchema) []Difference {
+	var result = make([]Difference, 0, 3)
+	if !isMatchedTypes(old.TypeBase, new.TypeBase) {
+		result = append(result, Difference{Attribute: "type", Old: typeBaseString(old.TypeBase), New: typeBaseString(new.TypeBase)})
+	}
+	if old.NotNull != new.NotNull {
+		result = append(result, Difference{Attribute: "not_null", Old: nullability(old.NotNull), New: nullability(new.NotNull)})
+	}
+	if compareDefault(old.Default, new.Default) != matchedElement {
+		result = append(result, Difference{Attribute: "default", Old: expressionString(old.Default), New: expressionString(new.Default)})
+	}
+	return result
+}
+
+func nullability(notNull bool) string {
+	if notNull {
+		return "not null"
+	}
+	return "nullable"
+}
+
+func stringOrNone(s *string) string {
+	if s == nil || *s == "" {
+		return "none"
+	}
+	return *s
+}
+
+func enumLabels(enum []EnumEntity) string {
+	var labels = make([]string, 0, len(enum))
+	for _, entity := range enum {
+		labels = append(labels, entity.Value)
+	}
+	return strings.Join(labels, ", ")
+}
+
+func columnNames(columns ColumnsContainer) string {
+	var names = make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, column.Value.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// comment renders the provenance as the SQL comment, the comment cannot be closed by the values
+func (c Provenance) comment(action ChangeAction) string {
+	var text = fmt.Sprintf("%s %s", action, c.Path)
+	if c.RenamedFrom != "" {
+		text += fmt.Sprintf(" (renamed from %s)", c.RenamedFrom)
+	}
+	if len(c.Differences) > 0 {
+		var differences = make([]string, 0, len(c.Differences))
+		for _, difference := range c.Differences {
+			differences = append(differences, fmt.Sprintf("%s %s -> %s", difference.Attribute, difference.Old, difference.New))
+		}
+		text += ": " + strings.Join(differences, ", ")
+	}
+	return fmt.Sprintf("/* %s */", strings.Replace(text, "*/", "* /", -1))
+}
@@ -0,0 +1,212 @@
+package dragonfly
+
+import (
+	"bytes"
+	sqt "github.com/iv-menshenin/sql-ast"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff_Changes(t *testing.T) {
+	var project = Root{
+		Schemas: Schemas{
+			{Value: Schema{
+				Name: "test",
+				Tables: TablesContainer{
+					"table1": {
+						Columns: ColumnsContainer{
+							{Value: Column{
+								Name:   "id",
+								Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "int8"}, NotNull: true}},
+							}},
+						},
+					},
+				},
+			}},
+		},
+	}
+	project.normalize()
+	var extended = project
+	extended.Schemas = Schemas{{Value: project.Schemas[0].Value}}
+	extended.Schemas[0].Value.Tables = TablesContainer{
+		"table1": {
+			Columns: append(ColumnsContainer{}, project.Schemas[0].Value.Tables["table1"].Columns[0], ColumnRef{
+				Value: Column{
+					Name:   "code",
+					Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "varchar"}, NotNull: true, Default: "none"}},
+				},
+			}),
+		},
+	}
+	extended.normalize()
+	oldSnapshot, err := makeProjectSnapshot(&project)
+	if err != nil {
+		t.Fatalf("makeProjectSnapshot() error = %v", err)
+	}
+	newSnapshot, err := makeProjectSnapshot(&extended)
+	if err != nil {
+		t.Fatalf("makeProjectSnapshot() error = %v", err)
+	}
+	tests := []struct {
+		name    string
+		current []byte
+		new     []byte
+		want    []Change
+	}{
+		{
+			name: "install",
+			new:  oldSnapshot,
+			want: []Change{
+				{Kind: ObjectSchema, Schema: "test", Name: "test", Action: ActionCreate},
+				{Kind: ObjectTable, Schema: "test", Name: "table1", Action: ActionCreate},
+			},
+		},
+		{
+			name:    "add column",
+			current: oldSnapshot,
+			new:     newSnapshot,
+			want: []Change{
+				{Kind: ObjectColumn, Schema: "test", Table: "table1", Name: "code", Action: ActionCreate},
+			},
+		},
+		{
+			name:    "drop column",
+			current: newSnapshot,
+			new:     oldSnapshot,
+			want: []Change{
+				{Kind: ObjectColumn, Schema: "test", Table: "table1", Name: "code", Action: ActionDrop},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := diffSnapshots(tt.current, tt.new, nil)
+			if err != nil {
+				t.Fatalf("diffSnapshots() error = %v", err)
+			}
+			got := diff.Changes()
+			if len(got) != len(tt.want) {
+				t.Fatalf("Changes() got %d changes, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, change := range got {
+				if change.key() != tt.want[i].key() {
+					t.Errorf("Changes() got `%s`, want `%s`", change.key(), tt.want[i].key())
+				}
+				if len(change.Statements) == 0 {
+					t.Errorf("Changes() got change `%s` without statements", change.key())
+				}
+			}
+		})
+	}
+}
+
+func TestDiff_Print_provenance(t *testing.T) {
+	const current = `
+schemas:
+  - name: shop
+    tables:
+      users:
+        columns:
+          - name: id
+            schema: { type: int8, not_null: true }
+          - name: login
+            schema: { type: varchar, length: 20 }
+`
+	tests := []struct {
+		name       string
+		project    string
+		want       []string
+		provenance Provenance
+	}{
+		{
+			name: "column type is changed",
+			project: `
+schemas:
+  - name: shop
+    tables:
+      users:
+        columns:
+          - name: id
+            schema: { type: int8, not_null: true }
+          - name: login
+            schema: { type: varchar, length: 100 }
+`,
+			want: []string{
+				"/* alter schemas[shop].tables.users.columns[login]: type varchar(20) -> varchar(100) */\nalter table shop.users alter column login type varchar(100);",
+			},
+			provenance: Provenance{
+				Path:        "schemas[shop].tables.users.columns[login]",
+				Differences: []Difference{{Attribute: "type", Old: "varchar(20)", New: "varchar(100)"}},
+			},
+		},
+		{
+			name: "column is renamed",
+			project: `
+schemas:
+  - name: shop
+    tables:
+      users:
+        columns:
+          - name: id
+            schema: { type: int8, not_null: true }
+          - name: name
+            schema: { type: varchar, length: 20 }
+`,
+			want: []string{
+				"/* rename schemas[shop].tables.users.columns[name] (renamed from login) */\nalter table shop.users rename column login to name;",
+			},
+			provenance: Provenance{
+				Path:        "schemas[shop].tables.users.columns[name]",
+				RenamedFrom: "login",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := readProjectSnapshot([]byte(current))
+			if err != nil {
+				t.Fatalf("readProjectSnapshot() error = %v", err)
+			}
+			project, err := readProjectSnapshot([]byte(tt.project))
+			if err != nil {
+				t.Fatalf("readProjectSnapshot() error = %v", err)
+			}
+			diff := MakeDiff(actual, project)
+			var buf bytes.Buffer
+			diff.Print(&buf)
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("Print() does not contain `%s`:\n%s", want, buf.String())
+				}
+			}
+			changes := diff.Changes()
+			if len(changes) != 1 || changes[0].Provenance == nil {
+				t.Fatalf("Changes() = %+v, want one change with provenance", changes)
+			}
+			if !reflect.DeepEqual(*changes[0].Provenance, tt.provenance) {
+				t.Errorf("Provenance = %+v, want %+v", *changes[0].Provenance, tt.provenance)
+			}
+		})
+	}
+}
+
+func TestProvenance_comment(t *testing.T) {
+	var provenance = Provenance{
+		Path:        "schemas[shop].domains.code",
+		Differences: []Difference{{Attribute: "check", Old: "none", New: "value like '*/%'"}},
+	}
+	want := "/* alter schemas[shop].domains.code: check none -> value like '* /%' */"
+	if got := provenance.comment(ActionAlter); got != want {
+		t.Errorf("comment() = %s, want %s", got, want)
+	}
+}
+
+func TestDiff_Changes_markedStatement(t *testing.T) {
+	// the statement is classified, but it is not described by the comparator
+	var diff = Diff{install: []sqt.SqlStmt{markStatement(makeTableDrop("shop", "items"), StatementDestructive)}}
+	got := diff.Changes()
+	if len(got) != 1 || got[0].Kind != ObjectTable || got[0].Name != "items" || got[0].Action != ActionDrop {
+		t.Errorf("Changes() = %+v, want the dropped table shop.items", got)
+	}
+}
@@ -0,0 +1,394 @@
+package dragonfly
+
+import (
+	"fmt"
+	"github.com/iv-menshenin/dragonfly/utils"
+	sqt "github.com/iv-menshenin/sql-ast"
+	"io"
+	"strings"
+)
+
+type (
+	StatementClass int8
+	// migrationStmt keeps the knowledge collected by comparators along with the generated statement
+	migrationStmt struct {
+		sqt.SqlStmt
+		class  StatementClass
+		change *Change
+		// the statement drops an object whose data is kept elsewhere by the same migration
+		preserved bool
+		// the statement is run by the hook, it is placed next to the statements of the event of the hook
+		hook *MigrationHook
+	}
+	// DestructivePolicy describes what to do with statements that can lead to data loss
+	DestructivePolicy struct {
+		// output destructive statements as is
+		Allow bool
+		// rename dropped tables, columns, domains and types to _deprecated_<name> instead of dropping them
+		Deprecate bool
+		// drop schemas that are missing in the project along with all their objects
+		DropSchemas bool
+	}
+	DestructiveChangesError struct {
+		Statements []string
+	}
+)
+
+const (
+	// the statement does not lock anything for a long time and does not lose data
+	StatementSafe StatementClass = iota
+	// the statement holds an exclusive lock while scanning or rewriting the whole table
+	StatementBlocking
+	// the statement can lead to data loss
+	StatementDestructive
+
+	deprecatedPrefix = "_deprecated_"
+	maxIdentLength   = 63
+)
+
+var (
+	statementClassNames = map[StatementClass]string{
+		StatementSafe:        "safe",
+		StatementBlocking:    "blocking",
+		StatementDestructive: "destructive",
+	}
+	// each chain lists the types in which the data can be converted without loss from left to right
+	wideningTypeChains = [][]string{
+		{"int2", "int4", "int8", "numeric"},
+		{"float4", "float8"},
+		{"char", "varchar", "text"},
+		{"date", "timestamp", "timestamptz"},
+		{"time", "timetz"},
+		{"json", "jsonb"},
+	}
+	typeCanonicalNames = map[string]string{
+		"smallint":                    "int2",
+		"smallserial":                 "int2",
+		"serial2":                     "int2",
+		"integer":                     "int4",
+		"int":                         "int4",
+		"serial":                      "int4",
+		"serial4":                     "int4",
+		"bigint":                      "int8",
+		"bigserial":                   "int8",
+		"serial8":                     "int8",
+		"decimal":                     "numeric",
+		"real":                        "float4",
+		"double precision":            "float8",
+		"character":                   "char",
+		"character varying":           "varchar",
+		"boolean":                     "bool",
+		"bpchar":                      "char",
+		"timestamp without time zone": "timestamp",
+		"timestamp with time zone":    "timestamptz",
+		"time without time zone":      "time",
+		"time with time zone":         "timetz",
+	}
+)
+
+func (c StatementClass) String() string {
+	if name, ok := statementClassNames[c]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+func (e DestructiveChangesError) Error() string {
+	return fmt.Sprintf(
+		"the migration contains %d destructive statement(s), use the destructive option to allow them:\n%s",
+		len(e.Statements), strings.Join(e.Statements, ";\n"),
+	)
+}
+
+func toMigrationStmt(stmt sqt.SqlStmt) *migrationStmt {
+	if m, ok := stmt.(*migrationStmt); ok {
+		return m
+	}
+	return &migrationStmt{SqlStmt: stmt}
+}
+
+// markStatement raises the class of the statement if comparator knows more than can be seen from the statement itself
+func markStatement(stmt sqt.SqlStmt, class StatementClass) sqt.SqlStmt {
+	m := toMigrationStmt(stmt)
+	if m.class < class {
+		m.class = class
+	}
+	return m
+}
+
+// markPreserved tells that the data of the dropped object is not lost, so the drop is neither destructive nor deprecated
+func markPreserved(stmt sqt.SqlStmt) sqt.SqlStmt {
+	m := toMigrationStmt(stmt)
+	m.preserved = true
+	return m
+}
+
+func classifyStatement(stmt sqt.SqlStmt) StatementClass {
+	var (
+		class     = StatementSafe
+		preserved bool
+	)
+	if m, ok := stmt.(*migrationStmt); ok {
+		class, stmt, preserved = m.class, m.SqlStmt, m.preserved
+	}
+	var inferred = StatementSafe
+	switch s := stmt.(type) {
+	case *sqt.DropStmt, *cascadeDropStmt:
+		inferred = StatementDestructive
+	case *sqt.UpdateStmt:
+		inferred = StatementBlocking
+	case *sqt.AlterStmt:
+		switch alter := s.Alter.(type) {
+		case *sqt.DropExpr:
+			if alter.Target == sqt.TargetColumn {
+				inferred = StatementDestructive
+			}
+		case *sqt.AddExpr:
+			if alter.Target == sqt.TargetConstraint {
+				// validation of a new constraint scans the whole table
+				inferred = StatementBlocking
+			}
+		case *sqt.AlterExpr:
+			switch a := alter.Alter.(type) {
+			case *sqt.DataTypeExpr, *typeUsingExpr:
+				inferred = StatementBlocking
+			case *sqt.SetDropExpr:
+				if _, ok := a.Expr.(*sqt.NotNullClause); ok && a.SetDrop == sqt.SetDropSet {
+					inferred = StatementBlocking
+				}
+			}
+		case *sqt.AlterAttributeExpr:
+			inferred = StatementBlocking
+		case *sqt.SetDropExpr:
+			if _, ok := alter.Expr.(*sqt.NotNullClause); ok && alter.SetDrop == sqt.SetDropSet && s.Target == sqt.TargetDomain {
+				// all the columns of the domain are checked
+				inferred = StatementBlocking
+			}
+		}
+	}
+	if preserved && inferred == StatementDestructive {
+		inferred = StatementBlocking
+	}
+	if inferred > class {
+		return inferred
+	}
+	return class
+}
+
+// isWideningTypeChange returns true if all the values of the old type can be stored in the new type without loss
+func isWideningTypeChange(old, new TypeBase) bool {
+	if old.IsArray != new.IsArray {
+		return false
+	}
+	oldType, newType := canonicalTypeName(old.Type), canonicalTypeName(new.Type)
+	if oldType == newType {
+		if new.Length != nil && (old.Length == nil || *old.Length > *new.Length) {
+			return false
+		}
+		if new.Precision != nil && (old.Precision == nil || *old.Precision > *new.Precision) {
+			return false
+		}
+		if new.Length != nil && new.Precision != nil && *new.Length-*new.Precision < *old.Length-*old.Precision {
+			// numeric: the number of the integer digits is decreased
+			return false
+		}
+		return true
+	}
+	for _, chain := range wideningTypeChains {
+		oldPos, newPos := utils.ArrayFind(chain, oldType), utils.ArrayFind(chain, newType)
+		if oldPos > -1 && newPos > -1 {
+			if oldPos > newPos {
+				return false
+			}
+			if new.Length != nil {
+				// the length limit of the new type must not cut the data
+				return newType != "numeric" && old.Length != nil && *old.Length <= *new.Length
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func canonicalTypeName(typeName string) string {
+	typeName = strings.ToLower(typeName)
+	if canonical, ok := typeCanonicalNames[typeName]; ok {
+		return canonical
+	}
+	return typeName
+}
+
+func (c *Diff) allStatements() []sqt.SqlStmt {
+	var result = make([]sqt.SqlStmt, 0, len(c.preInstall)+len(c.install)+len(c.afterInstall)+len(c.data))
+	result = append(result, c.preInstall...)
+	result = append(result, c.install...)
+	result = append(result, c.afterInstall...)
+	return append(result, c.data...)
+}
+
+// Destructive returns all the statements that can lead to data loss
+func (c *Diff) Destructive() []string {
+	var result = make([]string, 0)
+	for _, stmt := range c.allStatements() {
+		if classifyStatement(stmt) == StatementDestructive {
+			result = append(result, stmt.String())
+		}
+	}
+	return result
+}
+
+// PrintSummary writes the number of statements for each class and lists the destructive statements
+func (c *Diff) PrintSummary(w io.Writer) {
+	var counters = make(map[StatementClass]int, len(statementClassNames))
+	for _, stmt := range c.allStatements() {
+		counters[classifyStatement(stmt)]++
+	}
+	utils.WriteWrapper(
+		w, "/* statements: %d safe, %d blocking, %d destructive */\n",
+		counters[StatementSafe], counters[StatementBlocking], counters[StatementDestructive],
+	)
+	for _, stmt := range c.Destructive() {
+		utils.WriteWrapper(w, "/* destructive: %s */\n", stmt)
+	}
+}
+
+// ApplyDestructivePolicy replaces the dropping of objects with deprecation if it is required by the policy
+// and returns DestructiveChangesError if some destructive statements are still there and they are not allowed
+func (c *Diff) ApplyDestructivePolicy(policy DestructivePolicy) error {
+	if policy.DropSchemas {
+		c.dropRemovedSchemas()
+	}
+	if policy.Deprecate {
+		c.preInstall = deprecateDropped(c.preInstall)
+		c.install = deprecateDropped(c.install)
+		c.afterInstall = deprecateDropped(c.afterInstall)
+	}
+	if destructive := c.Destructive(); len(destructive) > 0 && !policy.Allow {
+		return DestructiveChangesError{Statements: destructive}
+	}
+	return nil
+}
+
+func deprecateDropped(heap []sqt.SqlStmt) []sqt.SqlStmt {
+	var result = make([]sqt.SqlStmt, 0, len(heap))
+	for _, stmt := range heap {
+		result = append(result, makeDeprecation(stmt)...)
+	}
+	return result
+}
+
+func isDeprecatedName(name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), deprecatedPrefix)
+}
+
+// forgetDeprecated returns the structure without the deprecated objects that are not described in the project.
+// They are kept intentionally, so they are neither dropped nor deprecated again. The structure itself is not changed
+func forgetDeprecated(current, project *Root) *Root {
+	var result = *current
+	result.Schemas = make(Schemas, 0, len(current.Schemas))
+	for _, schema := range current.Schemas {
+		newSchema, ok := project.Schemas.tryToFind(schema.Value.Name)
+		if !ok {
+			if !isDeprecatedName(schema.Value.Name) {
+				result.Schemas = append(result.Schemas, schema)
+			}
+			continue
+		}
+		var (
+			tables  = make(TablesContainer, len(schema.Value.Tables))
+			domains = make(DomainsContainer, len(schema.Value.Domains))
+			types   = make(TypesContainer, len(schema.Value.Types))
+		)
+		for tableName, table := range schema.Value.Tables {
+			newTable, ok := newSchema.Value.Tables.tryToFind(tableName)
+			if !ok {
+				if !isDeprecatedName(tableName) {
+					tables[tableName] = table
+				}
+				continue
+			}
+			var columns = make(ColumnsContainer, 0, len(table.Columns))
+			for _, column := range table.Columns {
+				if _, ok := newTable.Columns.tryToFind(column.Value.Name); ok || !isDeprecatedName(column.Value.Name) {
+					columns = append(columns, column)
+				}
+			}
+			table.Columns = columns
+			tables[tableName] = table
+		}
+		for domainName, domain := range schema.Value.Domains {
+			if !isDeprecatedName(domainName) || utils.ArrayContainsCI(newSchema.Value.Domains.getNames(), domainName) {
+				domains[domainName] = domain
+			}
+		}
+		for typeName, typeSchema := range schema.Value.Types {
+			if !isDeprecatedName(typeName) || utils.ArrayContainsCI(newSchema.Value.Types.getNames(), typeName) {
+				types[typeName] = typeSchema
+			}
+		}
+		schema.Value.Tables, schema.Value.Domains, schema.Value.Types = tables, domains, types
+		result.Schemas = append(result.Schemas, schema)
+	}
+	return &result
+}
+
+func makeDeprecatedName(name string) string {
+	name = deprecatedPrefix + name
+	if len(name) > maxIdentLength {
+		return name[:maxIdentLength]
+	}
+	return name
+}
+
+func identName(ident sqt.SqlIdent) string {
+	if literal, ok := ident.(*sqt.Literal); ok {
+		return literal.Text
+	}
+	return ident.GetName()
+}
+
+// makeDeprecation returns the statement as is if it cannot be turned into renaming
+func makeDeprecation(stmt sqt.SqlStmt) []sqt.SqlStmt {
+	var original = stmt
+	if m, ok := stmt.(*migrationStmt); ok {
+		if m.preserved {
+			return []sqt.SqlStmt{original}
+		}
+		stmt = m.SqlStmt
+	}
+	switch s := stmt.(type) {
+	case *cascadeDropStmt:
+		if schemaName := identName(s.Name); s.Target == sqt.TargetSchema && !isDeprecatedName(schemaName) {
+			return []sqt.SqlStmt{makeSchemaRename(NameComparator{Actual: schemaName, New: makeDeprecatedName(schemaName)})}
+		}
+	case *sqt.DropStmt:
+		selector, ok := s.Name.(*sqt.Selector)
+		if !ok || isDeprecatedName(selector.Name) {
+			break
+		}
+		rename := NameComparator{Actual: selector.Name, New: makeDeprecatedName(selector.Name)}
+		switch s.Target {
+		case sqt.TargetTable:
+			return []sqt.SqlStmt{makeTableRename(selector.Container, rename)}
+		case sqt.TargetDomain:
+			return []sqt.SqlStmt{makeDomainRename(selector.Container, rename)}
+		case sqt.TargetType:
+			return []sqt.SqlStmt{makeTypeRename(selector.Container, rename)}
+		}
+	case *sqt.AlterStmt:
+		selector, ok := s.Name.(*sqt.Selector)
+		if !ok || s.Target != sqt.TargetTable {
+			break
+		}
+		if drop, ok := s.Alter.(*sqt.DropExpr); ok && drop.Target == sqt.TargetColumn && !isDeprecatedName(identName(drop.Name)) {
+			columnName := identName(drop.Name)
+			rename := NameComparator{Actual: columnName, New: makeDeprecatedName(columnName)}
+			// the deprecated column should not prevent the insertion of new rows
+			return []sqt.SqlStmt{
+				makeColumnRename(selector.Container, selector.Name, rename),
+				makeAlterColumnSetNotNull(selector.Container, selector.Name, rename.New, false),
+			}
+		}
+	}
+	return []sqt.SqlStmt{original}
+}
@@ -0,0 +1,188 @@
+package dragonfly
+
+import (
+	sqt "github.com/iv-menshenin/sql-ast"
+	"testing"
+)
+
+func Test_isWideningTypeChange(t *testing.T) {
+	var ten, twenty, two = 10, 20, 2
+	tests := []struct {
+		name string
+		old  TypeBase
+		new  TypeBase
+		want bool
+	}{
+		{
+			name: "integer widening",
+			old:  TypeBase{Type: "int4"},
+			new:  TypeBase{Type: "bigint"},
+			want: true,
+		},
+		{
+			name: "integer narrowing",
+			old:  TypeBase{Type: "int8"},
+			new:  TypeBase{Type: "int2"},
+			want: false,
+		},
+		{
+			name: "varchar length increased",
+			old:  TypeBase{Type: "varchar", Length: &ten},
+			new:  TypeBase{Type: "varchar", Length: &twenty},
+			want: true,
+		},
+		{
+			name: "varchar length decreased",
+			old:  TypeBase{Type: "varchar", Length: &twenty},
+			new:  TypeBase{Type: "character varying", Length: &ten},
+			want: false,
+		},
+		{
+			name: "varchar to text",
+			old:  TypeBase{Type: "varchar", Length: &twenty},
+			new:  TypeBase{Type: "text"},
+			want: true,
+		},
+		{
+			name: "text to varchar",
+			old:  TypeBase{Type: "text"},
+			new:  TypeBase{Type: "varchar", Length: &twenty},
+			want: false,
+		},
+		{
+			name: "numeric scale increased without integer digits",
+			old:  TypeBase{Type: "numeric", Length: &ten, Precision: &two},
+			new:  TypeBase{Type: "decimal", Length: &ten, Precision: &ten},
+			want: false,
+		},
+		{
+			name: "unrelated types",
+			old:  TypeBase{Type: "varchar"},
+			new:  TypeBase{Type: "int4"},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isWideningTypeChange(tt.old, tt.new); got != tt.want {
+				t.Errorf("isWideningTypeChange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_classifyStatement(t *testing.T) {
+	tests := []struct {
+		name string
+		stmt sqt.SqlStmt
+		want StatementClass
+	}{
+		{
+			name: "drop table",
+			stmt: makeTableDrop("public", "test"),
+			want: StatementDestructive,
+		},
+		{
+			name: "drop column",
+			stmt: makeColumnDropStmt("public", "test", "field", true, true),
+			want: StatementDestructive,
+		},
+		{
+			name: "drop constraint",
+			stmt: makeConstraintDropStmt("public", "test", "pk_test", true, true),
+			want: StatementSafe,
+		},
+		{
+			name: "set not null",
+			stmt: makeAlterColumnSetNotNull("public", "test", "field", true),
+			want: StatementBlocking,
+		},
+		{
+			name: "marked type change",
+			stmt: markStatement(makeAlterColumnSetType("public", "test", "field", DomainSchema{TypeBase: TypeBase{Type: "int2"}}, ""), StatementDestructive),
+			want: StatementDestructive,
+		},
+		{
+			name: "rename column",
+			stmt: makeColumnRename("public", "test", NameComparator{Actual: "a", New: "b"}),
+			want: StatementSafe,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyStatement(tt.stmt); got != tt.want {
+				t.Errorf("classifyStatement() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiff_ApplyDestructivePolicy(t *testing.T) {
+	var diff = Diff{
+		install: []sqt.SqlStmt{
+			makeColumnDropStmt("public", "test", "field", true, true),
+		},
+		afterInstall: []sqt.SqlStmt{
+			makeTableDrop("public", "test"),
+		},
+	}
+	if err := diff.ApplyDestructivePolicy(DestructivePolicy{}); err == nil {
+		t.Error("ApplyDestructivePolicy() expected error")
+	}
+	if err := diff.ApplyDestructivePolicy(DestructivePolicy{Deprecate: true}); err != nil {
+		t.Errorf("ApplyDestructivePolicy() unexpected error: %v", err)
+	}
+	var want = []string{
+		"alter table public.test rename column field to _deprecated_field",
+		"alter table public.test alter column _deprecated_field drop not null",
+		"alter table public.test rename to _deprecated_test",
+	}
+	var got = diff.allStatements()
+	if len(got) != len(want) {
+		t.Fatalf("ApplyDestructivePolicy() got %d statements, want %d", len(got), len(want))
+	}
+	for i, stmt := range got {
+		if stmt.String() != want[i] {
+			t.Errorf("ApplyDestructivePolicy() got `%s`, want `%s`", stmt, want[i])
+		}
+	}
+}
+
+func TestMakeDiff_deprecatedObjects(t *testing.T) {
+	const project = `
+schemas:
+  - name: public
+    tables:
+      test:
+        columns:
+          - name: id
+            schema: { type: int8 }
+`
+	actual, err := readProjectSnapshot([]byte(project + `
+          - name: _deprecated_field
+            schema: { type: varchar }
+      _deprecated_old:
+        columns:
+          - name: id
+            schema: { type: int8 }
+  - name: _deprecated_archive
+`))
+	if err != nil {
+		t.Fatalf("readProjectSnapshot() error = %v", err)
+	}
+	root, err := readProjectSnapshot([]byte(project))
+	if err != nil {
+		t.Fatalf("readProjectSnapshot() error = %v", err)
+	}
+	diff := MakeDiff(actual, root)
+	if err = diff.ApplyDestructivePolicy(DestructivePolicy{Deprecate: true, DropSchemas: true}); err != nil {
+		t.Errorf("ApplyDestructivePolicy() unexpected error: %v", err)
+	}
+	if got := diff.allStatements(); len(got) != 0 {
+		t.Errorf("the deprecated objects are changed again: %v", got)
+	}
+	// the deprecated object is never renamed twice
+	if got := makeDeprecation(makeTableDrop("public", "_deprecated_test")); got[0].String() != makeTableDrop("public", "_deprecated_test").String() {
+		t.Errorf("makeDeprecation() = %s, want the statement as is", got[0])
+	}
+}
@@ -7,7 +7,6 @@ import (
 	_ "github.com/lib/pq"
 	"go/token"
 	"math/rand"
-	"reflect"
 	"strings"
 	"time"
 )
@@ -22,6 +21,9 @@ type (
 		KeyName      string
 		MainTable    TableColumn
 		ForeignTable TableColumn
+		Match        *string
+		UpdateRule   *string
+		DeleteRule   *string
 	}
 )
 
@@ -287,6 +289,7 @@ func makeTablesComparator(
 ) {
 	tablesComparator = make(TablesComparator, 0, len(tables)) // matched
 	postpone = make([]string, 0, 0)                           // not matched
+	online := new.getOnlineMigration()
 	for tableName, tableStruct := range tables {
 		var (
 			newStruct = tables[tableName]
@@ -294,7 +297,7 @@ func makeTablesComparator(
 		)
 		if oldStruct != nil {
 			// both tables has same name
-			tablesComparator = append(tablesComparator, TableComparator{
+			comparator := TableComparator{
 				Name: NameComparator{
 					Actual: tableName,
 					New:    tableName,
@@ -308,7 +311,12 @@ func makeTablesComparator(
 					NewStructure: &newStruct,
 				},
 				ColumnsComparator: makeColumnsComparator(current, new, schema, tableName, tableStruct, *oldStruct),
-			})
+				online:            online.forTable(current, *oldStruct),
+			}
+			for i := range comparator.ColumnsComparator {
+				comparator.ColumnsComparator[i].online = comparator.online
+			}
+			tablesComparator = append(tablesComparator, comparator)
 		} else {
 			// new tables
 			postpone = append(postpone, tableName)
@@ -330,6 +338,21 @@ func (c *Table) getAllColumnConstraints(columnName string) []Constraint {
 	return constraints
 }
 
+// returns table constraints along with the constraints declared in the columns
+func (c *Table) getAllConstraints() TableConstraints {
+	var constraints = make(TableConstraints, 0, len(c.Constraints)+len(c.Columns))
+	constraints = append(constraints, c.Constraints...)
+	for _, column := range c.Columns {
+		for i := range column.Value.Constraints {
+			constraints = append(constraints, ConstraintSchema{
+				Columns:    []string{column.Value.Name},
+				Constraint: column.Value.Constraints[i],
+			})
+		}
+	}
+	return constraints
+}
+
 func makeColumnsComparator(
 	current, new *Root,
 	schemaName, tableName string,
@@ -426,6 +449,12 @@ func makeColumnsComparator(
 			})
 		}
 	}
+	for ci, column := range columns {
+		if column.NewStruct != nil && column.ActualStruct != nil {
+			columns[ci].keyed = new.isKeyColumn(schemaName, tableName, &table, column.Name.New) ||
+				current.isKeyColumn(schemaName, tableName, &currTable, column.Name.Actual)
+		}
+	}
 	return columns
 }
 
@@ -472,11 +501,6 @@ func (c *SchemaRef) diffKnown(
 ) {
 	preInstall = make([]sqt.SqlStmt, 0, 0)
 	install = make([]sqt.SqlStmt, 0, 0)
-	preInstall = append(preInstall, &sqt.CreateStmt{
-		Target: sqt.TargetSchema,
-		Name:   &sqt.Literal{Text: schema},
-		IfNotX: true,
-	})
 	domains, domainsPostponed := makeDomainsComparator(current, schema, c.Value.Domains)
 	postponed.domains = domainsPostponed
 	for _, domain := range domains {
@@ -563,7 +587,56 @@ func (c *SchemaRef) prepareDeleting(
 	preInstall = make([]sqt.SqlStmt, 0, 0)
 	install = make([]sqt.SqlStmt, 0, 0)
 	afterInstall = make([]sqt.SqlStmt, 0, 0)
-	// TODO drop tables
+	for tableSchemaName, unusedTables := range current.getUnusedTables() {
+		if !strings.EqualFold(tableSchemaName, schema) {
+			continue
+		}
+		for _, tableName := range TablesContainer(unusedTables).getNames() {
+			unusedTable := unusedTables[tableName]
+			comparator := TableComparator{
+				Name: NameComparator{
+					Actual: tableName,
+					New:    "",
+				},
+				Schema: NameComparator{
+					Actual: tableSchemaName,
+					New:    "",
+				},
+				TableStruct: TableStructComparator{
+					OldStructure: &unusedTable,
+					NewStructure: nil,
+				},
+			}
+			first, second := comparator.makeSolution(current)
+			install = append(install, first...)
+			afterInstall = append(afterInstall, second...)
+		}
+	}
+	for typeSchemaName, unusedTypes := range current.getUnusedTypes() {
+		if !strings.EqualFold(typeSchemaName, schema) {
+			continue
+		}
+		for _, typeName := range TypesContainer(unusedTypes).getNames() {
+			unusedType := unusedTypes[typeName]
+			comparator := TypeComparator{
+				Name: NameComparator{
+					Actual: typeName,
+					New:    "",
+				},
+				Schema: NameComparator{
+					Actual: typeSchemaName,
+					New:    "",
+				},
+				TypeStruct: TypeStructComparator{
+					OldStructure: &unusedType,
+					NewStructure: nil,
+				},
+			}
+			first, second := comparator.makeSolution(current)
+			preInstall = append(preInstall, first...)
+			afterInstall = append(afterInstall, second...)
+		}
+	}
 	for domainSchemaName, unusedDomains := range current.getUnusedDomains() {
 		for domainName, unusedDomain := range unusedDomains {
 			if strings.EqualFold(domainSchemaName, schema) {
@@ -600,6 +673,9 @@ type (
 		Name                  NameComparator
 		ActualStruct          *ColumnRef
 		NewStruct             *ColumnRef
+		online                *onlineMigration
+		// the column is in a constraint or an index, or it is referenced by a foreign key
+		keyed bool
 	}
 	ColumnsComparator []ColumnComparator
 
@@ -612,6 +688,7 @@ type (
 		Schema            NameComparator
 		TableStruct       TableStructComparator
 		ColumnsComparator ColumnsComparator
+		online            *onlineMigration
 	}
 	TablesComparator []TableComparator
 
@@ -656,14 +733,7 @@ func compareDefault(old, new interface{}) migrationAction {
 	if old != nil && new == nil {
 		return dropElement
 	}
-	oldV, newV := reflect.ValueOf(old), reflect.ValueOf(new)
-	if old != nil && oldV.Kind() == reflect.Ptr {
-		oldV = oldV.Elem()
-	}
-	if new != nil && newV.Kind() == reflect.Ptr {
-		newV = newV.Elem()
-	}
-	if fmt.Sprintf("%T:%v", oldV, oldV) == fmt.Sprintf("%T:%v", newV, newV) {
+	if isSameDefault(old, new) {
 		return matchedElement
 	}
 	return alterElement
@@ -677,89 +747,65 @@ func (c DomainComparator) makeSolution() (preInstall []sqt.SqlStmt, postInstall
 	preInstall = make([]sqt.SqlStmt, 0, 0)
 	postInstall = make([]sqt.SqlStmt, 0, 0)
 	if c.DomainStruct.OldStructure == nil {
-		preInstall = append(preInstall, makeDomain(c.Schema.New, c.Name.New, *c.DomainStruct.NewStructure))
+		preInstall = append(preInstall, c.describe(ActionCreate, makeDomain(c.Schema.New, c.Name.New, *c.DomainStruct.NewStructure)))
 		return
 	}
 	if c.DomainStruct.NewStructure == nil {
-		postInstall = append(postInstall, makeDomainDrop(c.Schema.Actual, c.Name.Actual))
+		postInstall = append(postInstall, c.describe(ActionDrop, makeDomainDrop(c.Schema.Actual, c.Name.Actual)))
 		return
 	}
 	if !strings.EqualFold(c.Schema.New, c.Schema.Actual) {
-		preInstall = append(preInstall, makeDomainSetSchema(c.Name.Actual, c.Schema))
+		preInstall = append(preInstall, c.describe(ActionRename, makeDomainSetSchema(c.Name.Actual, c.Schema)))
 	}
 	if !strings.EqualFold(c.Name.New, c.Name.Actual) {
-		preInstall = append(preInstall, makeDomainRename(c.Schema.New, c.Name))
+		preInstall = append(preInstall, c.describe(ActionRename, makeDomainRename(c.Schema.New, c.Name)))
 	}
 	if c.DomainStruct.NewStructure.NotNull && !c.DomainStruct.OldStructure.NotNull {
-		postInstall = append(postInstall, makeDomainSetNotNull(c.Schema.New, c.Name.New, true))
+		postInstall = append(postInstall, c.describe(ActionAlter, makeDomainSetNotNull(c.Schema.New, c.Name.New, true)))
 	} else if !c.DomainStruct.NewStructure.NotNull && c.DomainStruct.OldStructure.NotNull {
-		preInstall = append(preInstall, makeDomainSetNotNull(c.Schema.New, c.Name.New, false))
+		preInstall = append(preInstall, c.describe(ActionAlter, makeDomainSetNotNull(c.Schema.New, c.Name.New, false)))
 	}
 	switch compareDefault(c.DomainStruct.NewStructure.Default, c.DomainStruct.OldStructure.Default) {
 	case alterElement:
-		preInstall = append(preInstall, makeDomainSetDefault(c.Schema.New, c.Name.New, c.DomainStruct.NewStructure.Default))
+		preInstall = append(preInstall, c.describe(ActionAlter, makeDomainSetDefault(c.Schema.New, c.Name.New, c.DomainStruct.NewStructure.Default)))
 	case createElement:
-		preInstall = append(preInstall, makeDomainSetDefault(c.Schema.New, c.Name.New, c.DomainStruct.NewStructure.Default))
+		preInstall = append(preInstall, c.describe(ActionAlter, makeDomainSetDefault(c.Schema.New, c.Name.New, c.DomainStruct.NewStructure.Default)))
 	case dropElement:
-		preInstall = append(preInstall, makeDomainSetDefault(c.Schema.New, c.Name.New, nil))
+		preInstall = append(preInstall, c.describe(ActionAlter, makeDomainSetDefault(c.Schema.New, c.Name.New, nil)))
 	}
 	return
 }
 
 func (c TypeComparator) makeSolution(current *Root) (preInstall []sqt.SqlStmt, postInstall []sqt.SqlStmt) {
-	/*
-		TODO: for types that already uses we must do something like this:
-			create type [schema].tmp_[name] as ([field1], [field2], ...);
-			alter table [related_table] add [column]_tmp1 [schema].tmp_[name];
-			update [related_table] set [column]_tmp1 = row(([column]).[field1], ([column]).[field2], ...) where [column] is not null;
-			alter table [related_table] drop [column];
-			*** ALTERING TYPE ***
-			alter table [related_table] add [column] [schema].[name];
-			update [related_table] set [column] = row(([column]_tmp1).lat, ([column]_tmp1).lng) where [column]_tmp1 is not null;
-			alter table [related_table] drop [column]_tmp1;
-			alter table [related_table] alter [column] set not null;
-			drop type [schema].tmp_[name]
-
-	*/
 	preInstall = make([]sqt.SqlStmt, 0, 0)
 	postInstall = make([]sqt.SqlStmt, 0, 0)
 	// https://www.postgresql.org/docs/9.1/sql-createtype.html
 	if c.TypeStruct.OldStructure == nil {
-		preInstall = append(preInstall, makeType(c.Schema.New, c.Name.New, *c.TypeStruct.NewStructure))
+		preInstall = append(preInstall, c.describe(ActionCreate, makeType(c.Schema.New, c.Name.New, *c.TypeStruct.NewStructure)))
 		return
 	}
 	if c.TypeStruct.NewStructure == nil {
-		postInstall = append(postInstall, makeTypeDrop(c.Schema.Actual, c.Name.Actual))
+		if t := c.TypeStruct.OldStructure.Type; strings.EqualFold(t, "map") || strings.EqualFold(t, "json") {
+			// these types are created as domains
+			postInstall = append(postInstall, c.describe(ActionDrop, makeDomainDrop(c.Schema.Actual, c.Name.Actual)))
+		} else {
+			postInstall = append(postInstall, c.describe(ActionDrop, makeTypeDrop(c.Schema.Actual, c.Name.Actual)))
+		}
 		return
 	}
 	// https://www.postgresql.org/docs/9.1/sql-altertype.html
 	if !strings.EqualFold(c.Schema.New, c.Schema.Actual) {
-		preInstall = append(preInstall, makeTypeSetSchema(c.Name.Actual, c.Schema))
+		preInstall = append(preInstall, c.describe(ActionRename, makeTypeSetSchema(c.Name.Actual, c.Schema)))
 	}
 	if !strings.EqualFold(c.Name.New, c.Name.Actual) {
-		preInstall = append(preInstall, makeTypeRename(c.Schema.New, c.Name))
-	}
-	for _, s := range c.TypeStruct.NewStructure.Fields {
-		if f, ok := c.TypeStruct.OldStructure.Fields.tryToFind(s.Value.Name); ok {
-			*f.used = true
-			*s.used = true
-			if schemaType, nameType, ok := s.Value.Schema.makeCustomType(); ok {
-				// compare domain name
-				fieldDomain := fmt.Sprintf("%s.%s", schemaType, nameType)
-				if !strings.EqualFold(fieldDomain, f.Value.Schema.Value.TypeBase.Type) {
-					preInstall = append(preInstall, makeTypeAlterAttributeDataType(c.Schema.New, c.Name.New, s.Value.Name, TypeBase{Type: fieldDomain}))
-				}
-			} else {
-				if !isMatchedTypes(f.Value.Schema.Value.TypeBase, s.Value.Schema.Value.TypeBase) {
-					preInstall = append(preInstall, makeTypeAlterAttributeDataType(c.Schema.New, c.Name.New, s.Value.Name, s.Value.Schema.Value.TypeBase))
-				}
-			}
-		}
-		// ALTER
+		preInstall = append(preInstall, c.describe(ActionRename, makeTypeRename(c.Schema.New, c.Name)))
+	}
+	if strings.EqualFold(c.TypeStruct.OldStructure.Type, "record") && strings.EqualFold(c.TypeStruct.NewStructure.Type, "record") {
+		preInstall = append(preInstall, c.makeRecordChanges(current)...)
+	}
+	if strings.EqualFold(c.TypeStruct.OldStructure.Type, "enum") && strings.EqualFold(c.TypeStruct.NewStructure.Type, "enum") {
+		preInstall = append(preInstall, c.makeEnumChanges(current)...)
 	}
-	// TODO
-	//  ADD ATTRIBUTE
-	//  ADD VALUE
 	return
 }
 
@@ -771,30 +817,24 @@ func (c TableComparator) makeSolution(
 ) {
 	install = make([]sqt.SqlStmt, 0, 0)
 	afterInstall = make([]sqt.SqlStmt, 0, 0)
-	columnConstraints := make(TableConstraints, 0, 4)
-	for _, column := range c.TableStruct.NewStructure.Columns {
-		for i := range column.Value.Constraints {
-			columnConstraints = append(columnConstraints, ConstraintSchema{
-				Columns:    []string{column.Value.Name},
-				Constraint: column.Value.Constraints[i],
-			})
-		}
-	}
 	if c.Schema.Actual == "" && c.Schema.New != "" {
-		install = append(install, makeTableCreate(c.Schema.New, c.Name.New, *c.TableStruct.NewStructure))
+		install = append(install, c.describe(ActionCreate, makeTableCreate(c.Schema.New, c.Name.New, *c.TableStruct.NewStructure)))
+		install = append(install, c.makeStorageChanges(ActionCreate, nil, c.TableStruct.NewStructure.Storage)...)
 		return
 	}
 	if c.Schema.Actual != "" && c.Schema.New == "" {
-		install = append(install, makeTableDrop(c.Schema.Actual, c.Name.Actual))
+		install = append(install, c.describe(ActionDrop, makeTableDrop(c.Schema.Actual, c.Name.Actual)))
 		return
 	}
 	// TODO drop constraints
 	if !strings.EqualFold(c.Schema.Actual, c.Schema.New) {
-		install = append(install, makeTableSetSchema(c.Name.Actual, c.Schema))
+		install = append(install, c.describe(ActionRename, makeTableSetSchema(c.Name.Actual, c.Schema)))
 	}
 	if !strings.EqualFold(c.Name.Actual, c.Name.New) {
-		install = append(install, makeTableRename(c.Schema.New, c.Name))
+		install = append(install, c.describe(ActionRename, makeTableRename(c.Schema.New, c.Name)))
 	}
+	install = append(install, c.makeStorageChanges(ActionAlter, c.TableStruct.OldStructure.Storage, c.TableStruct.NewStructure.Storage)...)
+	afterInstall = append(afterInstall, c.makeIndicesStorageChanges()...)
 	if c.ColumnsComparator != nil {
 		for _, columnComparator := range c.ColumnsComparator {
 			first, second := columnComparator.makeSolution(current)
@@ -802,39 +842,63 @@ func (c TableComparator) makeSolution(
 			afterInstall = append(afterInstall, second...)
 		}
 	}
-	// TODO add constraints (afterinstall)
-	allConstraints := append(c.TableStruct.NewStructure.Constraints, columnConstraints...)
-	for _, constraint := range allConstraints {
-		if exists, ok := c.TableStruct.OldStructure.Constraints.tryToFind(constraint.Constraint.Name); ok {
+	// the actual structure can be described by the project file as well, so column constraints are also taken into account
+	oldConstraints := c.TableStruct.OldStructure.getAllConstraints()
+	for _, constraint := range c.TableStruct.NewStructure.getAllConstraints() {
+		if exists, ok := oldConstraints.tryToFind(constraint.Constraint.Name); ok {
 			// TODO if used?
 			*exists.Constraint.used = true
 			*constraint.Constraint.used = true
 			// TODO merge
+			if isForeignKeyChanged(*exists, constraint) || isCheckChanged(*exists, constraint) {
+				// the constraint cannot be altered, it is recreated after the columns are changed
+				install = append(install, c.describeConstraint(ActionAlter, exists, &constraint, makeConstraintDropStmt(
+					c.Schema.New,
+					c.Name.New,
+					exists.Constraint.Name,
+					true,
+					false,
+				)))
+				for _, stmt := range c.makeConstraintAdd(constraint) {
+					afterInstall = append(afterInstall, c.describeConstraint(ActionAlter, exists, &constraint, stmt))
+				}
+			}
 		} else {
-			afterInstall = append(afterInstall, &sqt.AlterStmt{
-				Target: sqt.TargetTable,
-				Name: &sqt.Selector{
-					Name:      c.Name.New,
-					Container: c.Schema.New,
-				},
-				Alter: makeAddConstraintExpr(constraint.Columns, constraint.Constraint),
-			})
+			for _, stmt := range c.makeConstraintAdd(constraint) {
+				afterInstall = append(afterInstall, c.describeConstraint(ActionCreate, nil, &constraint, stmt))
+			}
 		}
 	}
-	for _, constraint := range c.TableStruct.OldStructure.Constraints {
+	for _, constraint := range oldConstraints {
 		if !*constraint.Constraint.used {
-			install = append(install, makeConstraintDropStmt(
+			install = append(install, c.describeConstraint(ActionDrop, &constraint, nil, makeConstraintDropStmt(
 				c.Schema.New,
 				c.Name.New,
 				constraint.Constraint.Name,
 				true,
 				true,
-			))
+			)))
 		}
 	}
 	return
 }
 
+func (c TableComparator) makeConstraintAdd(constraint ConstraintSchema) []sqt.SqlStmt {
+	if c.online != nil {
+		return c.online.makeConstraintAdd(c.Schema.New, c.Name.New, constraint)
+	}
+	return []sqt.SqlStmt{
+		&sqt.AlterStmt{
+			Target: sqt.TargetTable,
+			Name: &sqt.Selector{
+				Name:      c.Name.New,
+				Container: c.Schema.New,
+			},
+			Alter: makeAddConstraintExpr(constraint),
+		},
+	}
+}
+
 func (c ColumnComparator) makeSolution(current *Root) (install []sqt.SqlStmt, afterInstall []sqt.SqlStmt) {
 	/*
 		TODO make two modes: soft and hard
@@ -851,40 +915,64 @@ func (c ColumnComparator) makeSolution(current *Root) (install []sqt.SqlStmt, af
 	*/
 	install = make([]sqt.SqlStmt, 0, 0)
 	afterInstall = make([]sqt.SqlStmt, 0, 0)
+	if c.Name.Actual == "" && c.online != nil {
+		for _, stmt := range c.online.makeColumnAdd(c.SchemaName, c.TableName, *c.NewStruct) {
+			install = append(install, c.describe(ActionCreate, stmt))
+		}
+		return
+	}
 	if c.Name.Actual == "" {
-		install = append(install, makeColumnAdd(c.SchemaName, c.TableName, *c.NewStruct))
+		install = append(install, c.describe(ActionCreate, makeColumnAdd(c.SchemaName, c.TableName, *c.NewStruct)))
 		// TODO not for domains
 		if c.NewStruct.Value.Schema.Value.Default != nil {
-			install = append(install, makeAlterColumnSetDefault(c.SchemaName, c.TableName, c.Name.New, c.NewStruct.Value.Schema.Value.Default))
+			install = append(install, c.describe(ActionCreate, makeAlterColumnSetDefault(c.SchemaName, c.TableName, c.Name.New, c.NewStruct.Value.Schema.Value.Default)))
 		}
 		if c.NewStruct.Value.Schema.Value.NotNull {
 			if c.NewStruct.Value.Schema.Value.Default != nil {
-				install = append(install, makeUpdateWholeColumnStatement(c.SchemaName, c.TableName, c.Name.New, c.NewStruct.Value.Schema.Value.Default))
+				install = append(install, c.describe(ActionCreate, makeUpdateWholeColumnStatement(c.SchemaName, c.TableName, c.Name.New, c.NewStruct.Value.Schema.Value.Default)))
 			}
-			install = append(install, makeAlterColumnSetNotNull(c.SchemaName, c.TableName, c.Name.New, true))
+			install = append(install, c.describe(ActionCreate, makeAlterColumnSetNotNull(c.SchemaName, c.TableName, c.Name.New, true)))
 		}
 		return
 	}
 	if c.Name.New == "" {
-		afterInstall = append(afterInstall, makeColumnDropStmt(c.SchemaName, c.TableName, c.Name.Actual, true, true))
+		afterInstall = append(afterInstall, c.describe(ActionDrop, makeColumnDropStmt(c.SchemaName, c.TableName, c.Name.Actual, true, true)))
 		return
 	}
 	if !strings.EqualFold(c.Name.Actual, c.Name.New) {
-		install = append(install, makeColumnRename(c.SchemaName, c.TableName, c.Name))
+		install = append(install, c.describe(ActionRename, makeColumnRename(c.SchemaName, c.TableName, c.Name)))
 	}
+	var typeChanged bool
 	if typeSchema, typeName, ok := c.NewStruct.Value.Schema.makeCustomType(); ok {
+		var domainType = TypeBase{Type: fmt.Sprintf("%s.%s", typeSchema, typeName)}
 		if _, oldTypeName, ok := c.ActualStruct.Value.Schema.makeCustomType(); ok {
 			// strings.EqualFold(typeSchema, oldTypeSchema) &&
 			// TODO need to resolve schema changes?
 			if !strings.EqualFold(typeName, oldTypeName) {
-				install = append(install, makeAlterColumnSetDomain(c.SchemaName, c.TableName, c.Name.New, fmt.Sprintf("%s.%s", typeSchema, typeName)))
+				first, second := c.makeTypeChange(domainType)
+				install = append(install, first...)
+				afterInstall = append(afterInstall, second...)
+				typeChanged = true
 			}
 		} else {
-			install = append(install, makeAlterColumnSetDomain(c.SchemaName, c.TableName, c.Name.New, fmt.Sprintf("%s.%s", typeSchema, typeName)))
+			first, second := c.makeTypeChange(domainType)
+			install = append(install, first...)
+			afterInstall = append(afterInstall, second...)
+			typeChanged = true
 		}
 	} else {
 		if !isMatchedTypes(c.NewStruct.Value.Schema.Value.TypeBase, c.ActualStruct.Value.Schema.Value.TypeBase) {
-			install = append(install, makeAlterColumnSetType(c.SchemaName, c.TableName, c.Name.New, c.NewStruct.Value.Schema.Value))
+			first, second := c.makeTypeChange(c.NewStruct.Value.Schema.Value.TypeBase)
+			install = append(install, first...)
+			afterInstall = append(afterInstall, second...)
+			typeChanged = true
+		}
+	}
+	// the default value of the domain is a part of the domain, the type change sets the default value by itself
+	if c.NewStruct.Value.Schema.Ref == nil && !typeChanged {
+		var newDefault = c.NewStruct.Value.Schema.Value.Default
+		if compareDefault(c.ActualStruct.Value.Schema.Value.Default, newDefault) != matchedElement {
+			install = append(install, c.describe(ActionAlter, makeAlterColumnSetDefault(c.SchemaName, c.TableName, c.Name.New, newDefault)))
 		}
 	}
 	// TODO
@@ -893,6 +981,70 @@ func (c ColumnComparator) makeSolution(current *Root) (install []sqt.SqlStmt, af
 	return
 }
 
+// makeTypeChange converts the values of the column to the new type, the migration hint of the column takes precedence
+// over the built-in casts. If there is no known cast, the new column is filled through the text representation of values
+func (c ColumnComparator) makeTypeChange(newType TypeBase) (install []sqt.SqlStmt, afterInstall []sqt.SqlStmt) {
+	var (
+		oldType  = c.ActualStruct.Value.Schema.Value.TypeBase
+		hint     = c.NewStruct.Value.Migration
+		strategy = MigrationStrategyAlter
+		using    string
+		ok       bool
+	)
+	if c.online != nil && !isInPlaceTypeChange(oldType, newType) {
+		// the table is not rewritten under the exclusive lock
+		strategy = MigrationStrategyStaged
+	}
+	// the unknown strategy is reported by Validate
+	if hinted, err := hint.getStrategy(); err == nil && hinted != "" {
+		strategy = hinted
+	}
+	if c.keyed {
+		// the constraints and the indices of the column would be dropped along with the old column
+		strategy = MigrationStrategyAlter
+	}
+	if hint != nil && hint.Using != "" {
+		using, ok = hint.Using, true
+	} else {
+		using, ok = makeColumnTypeCast(c.Name.New, oldType, newType)
+	}
+	if !ok && c.keyed {
+		// the key column is never swapped, the values are converted in place through the text representation
+		using, ok = makeCastType(c.Name.New+"::text", newType), true
+	}
+	if ok && strategy == MigrationStrategyAlter {
+		var alter sqt.SqlStmt
+		if c.NewStruct.Value.Schema.Ref != nil {
+			alter = makeAlterColumnSetDomain(c.SchemaName, c.TableName, c.Name.New, newType.Type, using)
+		} else {
+			alter = makeAlterColumnSetType(c.SchemaName, c.TableName, c.Name.New, c.NewStruct.Value.Schema.Value, using)
+			if !isWideningTypeChange(oldType, newType) {
+				alter = markStatement(alter, StatementDestructive)
+			}
+		}
+		return []sqt.SqlStmt{c.describe(ActionAlter, alter)}, nil
+	}
+	if !ok {
+		using = makeCastType(c.Name.New+"::text", newType)
+	} else if using == "" {
+		using = c.Name.New
+	}
+	var column = c.NewStruct.Value
+	column.Name = c.Name.New
+	if column.Schema.Ref != nil {
+		// not null and default are the part of the domain
+		column.Schema = ColumnSchemaRef{Value: DomainSchema{TypeBase: newType}}
+	}
+	install, afterInstall = makeStagedTypeChange(c.SchemaName, c.TableName, column, using, c.online)
+	for i := range install {
+		install[i] = c.describe(ActionAlter, install[i])
+	}
+	for i := range afterInstall {
+		afterInstall[i] = c.describe(ActionAlter, afterInstall[i])
+	}
+	return
+}
+
 func fixEmptyColumn(current *Root, schema, table string, column ColumnRef) []sqt.SqlStmt {
 	// this is the case when we change the data type of the relationship between the dependent and dependent table
 	// simply put, the foreign key is changing
@@ -967,6 +1119,10 @@ type (
 		Host     string
 		Database string
 		ConnStr  string
+		// the name of the dialect, PostgreSQL is used if it is empty
+		Dialect string
+		// the objects out of the scope are not read from the database
+		Scope *Scope
 	}
 )
 
@@ -0,0 +1,253 @@
+package dragonfly
+
+import (
+	"fmt"
+	"github.com/iv-menshenin/dragonfly/utils"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+type (
+	DriftState string
+	// Drift is one difference between the live database and the project
+	Drift struct {
+		Kind   ObjectKind `json:"kind"`
+		Object string     `json:"object"`
+		State  DriftState `json:"state"`
+		// what exactly is different, it is empty for missing and unexpected objects
+		Details string `json:"details,omitempty"`
+	}
+	DriftReport []Drift
+)
+
+const (
+	// the object is described in the project, but the database does not contain it
+	DriftMissing DriftState = "missing"
+	// the database contains the object that is not described in the project
+	DriftUnexpected DriftState = "unexpected"
+	// the object exists in both, but differs
+	DriftDifferent DriftState = "different"
+	// the object exists under another name
+	DriftRenamed DriftState = "renamed"
+)
+
+// CheckDrift compares the live database with the project and describes the differences without generating the script.
+// The objects matched by the `unmanaged` patterns of the project and the objects out of its scope are not reported
+func CheckDrift(actual, project *Root) DriftReport {
+	var (
+		report = make(DriftReport, 0)
+		diff   = MakeDiff(actual, project)
+	)
+	for _, schema := range diff.removedSchemas {
+		report = append(report, Drift{Kind: ObjectSchema, Object: schema, State: DriftUnexpected})
+	}
+	report = append(report, diff.drift()...)
+	if project.Scope.hasKind(ObjectIndex) {
+		report = append(report, indicesDrift(project.Scope.apply(actual), project.Scope.apply(project))...)
+	}
+	return report.filter(project.Unmanaged)
+}
+
+func (c *Diff) drift() DriftReport {
+	var result = make(DriftReport, 0)
+	for _, change := range c.Changes() {
+		if change.Kind == "" {
+			continue
+		}
+		var drift = Drift{Kind: change.Kind, Object: change.qualifiedName()}
+		switch change.Action {
+		case ActionCreate:
+			drift.State = DriftMissing
+		case ActionDrop:
+			drift.State = DriftUnexpected
+		case ActionRename:
+			drift.State = DriftRenamed
+			drift.Details = fmt.Sprintf("named %s in the database", change.OldName)
+		default:
+			drift.State = DriftDifferent
+			drift.Details = change.driftDetails()
+		}
+		result = append(result, drift)
+	}
+	return result
+}
+
+func (c Change) qualifiedName() string {
+	var parts = make([]string, 0, 3)
+	for _, part := range []string{c.Schema, c.Table, c.Name} {
+		if part != "" && (len(parts) == 0 || !strings.EqualFold(parts[len(parts)-1], part)) {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// driftDetails describes the differences of the column, other objects are only reported as different
+func (c Change) driftDetails() string {
+	old, ok := c.Old.(Column)
+	if !ok {
+		return ""
+	}
+	new, ok := c.New.(Column)
+	if !ok {
+		return ""
+	}
+	var details = make([]string, 0, 3)
+	for _, difference := range domainDifferences(old.Schema.Value, new.Schema.Value) {
+		if difference.Attribute == "not_null" {
+			details = append(details, fmt.Sprintf("%s, expected %s", difference.Old, difference.New))
+			continue
+		}
+		details = append(details, fmt.Sprintf("%s %s, expected %s", difference.Attribute, difference.Old, difference.New))
+	}
+	return strings.Join(details, "; ")
+}
+
+func typeBaseString(t TypeBase) string {
+	var result = t.Type
+	if t.Length != nil {
+		if t.Precision != nil {
+			result += fmt.Sprintf("(%d, %d)", *t.Length, *t.Precision)
+		} else {
+			result += fmt.Sprintf("(%d)", *t.Length)
+		}
+	}
+	if t.IsArray {
+		result += "[]"
+	}
+	return result
+}
+
+func expressionString(value interface{}) string {
+	if expr := defaultExpression(value); expr != nil {
+		return *expr
+	}
+	return "none"
+}
+
+// indicesDrift compares the indices of the tables that exist in both the database and the project
+func indicesDrift(actual, project *Root) DriftReport {
+	var result = make(DriftReport, 0)
+	for _, schema := range project.Schemas {
+		actualSchema, ok := actual.Schemas.tryToFind(schema.Value.Name)
+		if !ok {
+			continue
+		}
+		var tableNames = make([]string, 0, len(schema.Value.Tables))
+		for tableName := range schema.Value.Tables {
+			tableNames = append(tableNames, tableName)
+		}
+		sort.Strings(tableNames)
+		for _, tableName := range tableNames {
+			actualTable, ok := actualSchema.Value.Tables.tryToFind(tableName)
+			if !ok {
+				continue
+			}
+			var prefix = schema.Value.Name + "." + tableName + "."
+			result = append(result, compareIndices(prefix, actualTable.Indices, schema.Value.Tables[tableName].Indices)...)
+		}
+	}
+	return result
+}
+
+func compareIndices(prefix string, actual, expected IndicesContainer) DriftReport {
+	var (
+		result = make(DriftReport, 0)
+		found  = make(map[int]bool, len(actual))
+	)
+	for _, index := range expected {
+		i := actual.indexOf(index)
+		if i < 0 {
+			result = append(result, Drift{Kind: ObjectIndex, Object: prefix + index.Name, State: DriftMissing})
+			continue
+		}
+		found[i] = true
+		var (
+			details = make([]string, 0, 2)
+			current = actual[i]
+		)
+		if !isSameColumns(current.Columns, index.Columns) {
+			details = append(details, fmt.Sprintf("columns (%s), expected (%s)", strings.Join(current.Columns, ", "), strings.Join(index.Columns, ", ")))
+		}
+		if (current.IndexType == IndexTypeUnique) != (index.IndexType == IndexTypeUnique) {
+			if index.IndexType == IndexTypeUnique {
+				details = append(details, "not unique, expected unique")
+			} else {
+				details = append(details, "unique, expected not unique")
+			}
+		}
+		if len(details) > 0 {
+			result = append(result, Drift{Kind: ObjectIndex, Object: prefix + index.Name, State: DriftDifferent, Details: strings.Join(details, "; ")})
+		}
+	}
+	for i, index := range actual {
+		if !found[i] {
+			result = append(result, Drift{Kind: ObjectIndex, Object: prefix + index.Name, State: DriftUnexpected})
+		}
+	}
+	return result
+}
+
+// indexOf looks for the index by name, the index without a name is looked for by its columns
+func (c IndicesContainer) indexOf(index Index) int {
+	for i, current := range c {
+		if index.Name != "" && strings.EqualFold(current.Name, index.Name) {
+			return i
+		}
+		if index.Name == "" && isSameColumns(current.Columns, index.Columns) {
+			return i
+		}
+	}
+	return -1
+}
+
+// filter removes the objects matched by the patterns, the pattern that matches the table also matches its columns,
+// constraints and indices
+func (c DriftReport) filter(unmanaged []string) DriftReport {
+	if len(unmanaged) == 0 {
+		return c
+	}
+	var result = make(DriftReport, 0, len(c))
+	for _, drift := range c {
+		if !isUnmanaged(unmanaged, drift.Object) {
+			result = append(result, drift)
+		}
+	}
+	return result
+}
+
+// the patterns are checked by Validate, the panic means that the project is used without checking
+func isUnmanaged(patterns []string, object string) bool {
+	var parts = strings.Split(strings.ToLower(object), ".")
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		for i := range parts {
+			matched, err := path.Match(pattern, strings.Join(parts[:i+1], "."))
+			if err != nil {
+				panic(fmt.Sprintf("wrong unmanaged pattern '%s': %v", pattern, err))
+			}
+			if matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Print writes one line for each difference
+func (c DriftReport) Print(w io.Writer) {
+	if len(c) == 0 {
+		utils.WriteWrapper(w, "the database matches the project\n")
+		return
+	}
+	for _, drift := range c {
+		if drift.Details != "" {
+			utils.WriteWrapper(w, "%s %s %s: %s\n", drift.State, drift.Kind, drift.Object, drift.Details)
+		} else {
+			utils.WriteWrapper(w, "%s %s %s\n", drift.State, drift.Kind, drift.Object)
+		}
+	}
+	utils.WriteWrapper(w, "%d difference(s) found\n", len(c))
+}
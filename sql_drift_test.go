@@ -0,0 +1,128 @@
+package dragonfly
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckDrift(t *testing.T) {
+	var (
+		database = []byte(`
+schemas:
+  - name: shop
+    tables:
+      orders:
+        columns:
+          - name: id
+            schema: { type: int4, not_null: true }
+          - name: amount
+            schema: { type: numeric, length: 10, precision: 2 }
+        indices:
+          - name: ix_orders_amount
+            type: index
+            columns: [amount]
+      audit:
+        columns:
+          - name: id
+            schema: { type: int4 }
+      tmp_import:
+        columns:
+          - name: id
+            schema: { type: int4 }
+`)
+		project = []byte(`
+schemas:
+  - name: shop
+    tables:
+      orders:
+        columns:
+          - name: id
+            schema: { type: int8, not_null: true }
+          - name: amount
+            schema: { type: numeric, length: 10, precision: 2 }
+          - name: status
+            schema: { type: text }
+        indices:
+          - name: ix_orders_status
+            type: index
+            columns: [status]
+`)
+	)
+	actual, err := readProjectSnapshot(database)
+	if err != nil {
+		t.Fatalf("readProjectSnapshot() error = %v", err)
+	}
+	expected, err := readProjectSnapshot(project)
+	if err != nil {
+		t.Fatalf("readProjectSnapshot() error = %v", err)
+	}
+	expected.Unmanaged = []string{"shop.tmp_*", "shop.orders.ix_orders_amount"}
+	got := CheckDrift(actual, expected)
+	want := DriftReport{
+		{Kind: ObjectColumn, Object: "shop.orders.id", State: DriftDifferent, Details: "type int4, expected int8"},
+		{Kind: ObjectColumn, Object: "shop.orders.status", State: DriftMissing},
+		{Kind: ObjectTable, Object: "shop.audit", State: DriftUnexpected},
+		{Kind: ObjectIndex, Object: "shop.orders.ix_orders_status", State: DriftMissing},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CheckDrift() = %+v, want %+v", got, want)
+	}
+	var buf bytes.Buffer
+	got.Print(&buf)
+	if line := "different column shop.orders.id: type int4, expected int8\n"; !bytes.Contains(buf.Bytes(), []byte(line)) {
+		t.Errorf("Print() does not contain `%s`:\n%s", line, buf.String())
+	}
+}
+
+func Test_compareIndices(t *testing.T) {
+	tests := []struct {
+		name     string
+		actual   IndicesContainer
+		expected IndicesContainer
+		want     DriftReport
+	}{
+		{
+			name:     "matched",
+			actual:   IndicesContainer{{Name: "ix_a", IndexType: IndexTypeIndex, Columns: []string{"a", "b"}}},
+			expected: IndicesContainer{{Name: "IX_A", IndexType: IndexTypeIndex, Columns: []string{"A", "B"}}},
+			want:     DriftReport{},
+		},
+		{
+			name:     "different",
+			actual:   IndicesContainer{{Name: "ix_a", IndexType: IndexTypeIndex, Columns: []string{"a"}}},
+			expected: IndicesContainer{{Name: "ix_a", IndexType: IndexTypeUnique, Columns: []string{"a", "b"}}},
+			want: DriftReport{{
+				Kind:    ObjectIndex,
+				Object:  "s.t.ix_a",
+				State:   DriftDifferent,
+				Details: "columns (a), expected (a, b); not unique, expected unique",
+			}},
+		},
+		{
+			name:     "unnamed is found by columns",
+			actual:   IndicesContainer{{Name: "t_a_idx", IndexType: IndexTypeIndex, Columns: []string{"a"}}},
+			expected: IndicesContainer{{IndexType: IndexTypeIndex, Columns: []string{"a"}}},
+			want:     DriftReport{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareIndices("s.t.", tt.actual, tt.expected); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compareIndices() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoot_Validate_unmanaged(t *testing.T) {
+	var root = Root{Unmanaged: []string{"reports.*", "legacy.[a-"}}
+	if err := root.Validate(); err == nil || !strings.Contains(err.Error(), "wrong unmanaged pattern 'legacy.[a-'") {
+		t.Errorf("Validate() error = %v, want the malformed unmanaged pattern", err)
+	}
+	root.Unmanaged = root.Unmanaged[:1]
+	if err := root.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
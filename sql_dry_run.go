@@ -0,0 +1,142 @@
+package dragonfly
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/iv-menshenin/dragonfly/utils"
+	sqt "github.com/iv-menshenin/sql-ast"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	dryRunSavepoint = "dragonfly_dry_run"
+)
+
+type (
+	// DryRunStatement is the result of one statement of the migration executed by the dry run
+	DryRunStatement struct {
+		SQL      string
+		Duration time.Duration
+		Error    error
+	}
+	// DryRunReport describes the migration applied inside the transaction that is always rolled back
+	DryRunReport struct {
+		Statements []DryRunStatement
+		// the statements of the diff made after the migration, there are none if the migration converges
+		Remaining []string
+	}
+)
+
+// DryRun executes all the statements of the diff inside the transaction, then reads the structure of the database
+// in the same transaction and compares it with the project again. The transaction is always rolled back.
+// Each statement is executed in its own savepoint, so the failed statement does not prevent the next ones from running
+func (c *Diff) DryRun(options ConnectionOptions, project *Root) (report DryRunReport, err error) {
+	if dialect := getDialect(options.Dialect); !dialect.TransactionalDDL() {
+		err = fmt.Errorf("the dry run is not supported by the `%s` dialect, its structure changes cannot be rolled back", dialect.Name())
+		return
+	}
+	if project.getOnlineMigration() != nil {
+		// concurrent indices and batches committed one by one cannot be run inside the transaction
+		err = fmt.Errorf("the dry run is not supported in the `%s` migration mode, its script must not be run in a transaction", MigrationModeOnline)
+		return
+	}
+	// the objects of the compared project are marked as used, so the project is compared again using its copy
+	var expected = copyRoot(project)
+	err = databaseWork(options, func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		report.Statements = execDryRun(tx, c.allStatements())
+		actual, err := getDialect(options.Dialect).readStructure(tx, options.Database)
+		if err == nil {
+			err = actual.readSeedData(tx, expected)
+		}
+		if err == nil {
+			err = actual.readHookHistory(tx, expected)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		second := MakeDiff(&actual, expected)
+		report.Remaining = second.remainingStatements()
+		return tx.Rollback()
+	})
+	return
+}
+
+func execDryRun(tx *sql.Tx, statements []sqt.SqlStmt) []DryRunStatement {
+	var result = make([]DryRunStatement, 0, len(statements))
+	for _, stmt := range statements {
+		var executed = DryRunStatement{SQL: stmt.String()}
+		if _, executed.Error = tx.Exec("savepoint " + dryRunSavepoint); executed.Error == nil {
+			started := time.Now()
+			_, executed.Error = tx.Exec(executed.SQL)
+			executed.Duration = time.Since(started)
+			if executed.Error != nil {
+				// the failed statement aborts the transaction, it is usable again after rolling back to the savepoint
+				_, _ = tx.Exec("rollback to savepoint " + dryRunSavepoint)
+			}
+		}
+		result = append(result, executed)
+	}
+	return result
+}
+
+// remainingStatements skips the objects renamed by the deprecation, they are still in the database as expected,
+// and the hooks that are run by every migration if there is no history table
+func (c *Diff) remainingStatements() []string {
+	var result = make([]string, 0)
+	for _, change := range c.Changes() {
+		if strings.HasPrefix(change.Name, deprecatedPrefix) || change.Kind == ObjectHook {
+			continue
+		}
+		for _, stmt := range change.Statements {
+			result = append(result, stmt.SQL)
+		}
+	}
+	return result
+}
+
+// Failed returns the statements that were executed with errors
+func (c DryRunReport) Failed() []DryRunStatement {
+	var result = make([]DryRunStatement, 0)
+	for _, stmt := range c.Statements {
+		if stmt.Error != nil {
+			result = append(result, stmt)
+		}
+	}
+	return result
+}
+
+// Succeeded returns true if all the statements are executed without errors and the migration converges
+func (c DryRunReport) Succeeded() bool {
+	return len(c.Failed()) == 0 && len(c.Remaining) == 0
+}
+
+// Print writes the result of each statement and tells whether the database matches the project after the migration
+func (c DryRunReport) Print(w io.Writer) {
+	for _, stmt := range c.Statements {
+		if stmt.Error != nil {
+			utils.WriteWrapper(w, "/* dry run: failed in %s: %s\n   %s */\n", stmt.Duration, stmt.SQL, stmt.Error)
+		} else {
+			utils.WriteWrapper(w, "/* dry run: ok in %s: %s */\n", stmt.Duration, stmt.SQL)
+		}
+	}
+	failed := len(c.Failed())
+	utils.WriteWrapper(
+		w, "/* dry run: %d succeeded, %d failed, the transaction is rolled back */\n",
+		len(c.Statements)-failed, failed,
+	)
+	if len(c.Remaining) == 0 {
+		utils.WriteWrapper(w, "/* dry run: the database matches the project after the migration */\n")
+		return
+	}
+	utils.WriteWrapper(w, "/* dry run: the migration does not converge, %d statement(s) remain: */\n", len(c.Remaining))
+	for _, stmt := range c.Remaining {
+		utils.WriteWrapper(w, "/* remaining: %s */\n", stmt)
+	}
+}
@@ -0,0 +1,83 @@
+package dragonfly
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDiff_remainingStatements(t *testing.T) {
+	var (
+		current = []byte(`
+schemas:
+  - name: test
+    tables:
+      _deprecated_orders:
+        columns:
+          - name: id
+            schema: { type: int8 }
+      items:
+        columns:
+          - name: id
+            schema: { type: int8 }
+`)
+		project = []byte(`
+schemas:
+  - name: test
+    tables:
+      items:
+        columns:
+          - name: id
+            schema: { type: int8 }
+          - name: title
+            schema: { type: text }
+`)
+	)
+	diff, err := diffSnapshots(current, project, nil)
+	if err != nil {
+		t.Fatalf("diffSnapshots() error = %v", err)
+	}
+	got := diff.remainingStatements()
+	if len(got) != 1 || got[0] != "alter table test.items add column title text" {
+		t.Errorf("remainingStatements() = %v, want the new column only", got)
+	}
+}
+
+func TestDryRunReport_Print(t *testing.T) {
+	var report = DryRunReport{
+		Statements: []DryRunStatement{
+			{SQL: "alter table test.items add column title text"},
+			{SQL: "alter table test.items add column title text", Error: errors.New(`column "title" already exists`)},
+		},
+	}
+	if report.Succeeded() {
+		t.Errorf("Succeeded() = true, want false if some statement failed")
+	}
+	var buf bytes.Buffer
+	report.Print(&buf)
+	for _, want := range []string{
+		"/* dry run: 1 succeeded, 1 failed, the transaction is rolled back */",
+		`column "title" already exists`,
+		"the database matches the project after the migration",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Print() does not contain `%s`:\n%s", want, buf.String())
+		}
+	}
+	report = DryRunReport{Remaining: []string{"alter table test.items add column title text"}}
+	if report.Succeeded() {
+		t.Errorf("Succeeded() = true, want false if the migration does not converge")
+	}
+}
+
+func TestDiff_DryRun_online(t *testing.T) {
+	var (
+		diff    Diff
+		project = Root{Migrations: &MigrationSettings{Mode: MigrationModeOnline}}
+	)
+	// the mode is checked before connecting to the database
+	if _, err := diff.DryRun(ConnectionOptions{ConnStr: "unreachable"}, &project); err == nil || !strings.Contains(err.Error(), "must not be run in a transaction") {
+		t.Errorf("DryRun() error = %v, want the online mode is not supported", err)
+	}
+}
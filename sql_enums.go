@@ -0,0 +1,211 @@
+package dragonfly
+
+import (
+	"fmt"
+	"github.com/iv-menshenin/dragonfly/utils"
+	sqt "github.com/iv-menshenin/sql-ast"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	recreatedTypeSuffix = "__new"
+)
+
+var (
+	// the default value of the column taken from the database looks like 'label'::schema.type
+	enumDefaultPattern = regexp.MustCompile(`^'((?:[^']|'')*)'(?:::.*)?$`)
+)
+
+type (
+	// enumChanges describes how the labels of the enumeration are changed
+	enumChanges struct {
+		// old label to new label
+		renamed map[string]string
+		removed []string
+		added   []string
+		// the order of the old labels is changed
+		reordered bool
+	}
+)
+
+func quoteLiteral(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func compareEnums(old, new []EnumEntity) enumChanges {
+	var (
+		changes = enumChanges{renamed: make(map[string]string)}
+		labels  = make([]string, 0, len(old))
+		exists  = func(entities []EnumEntity, label string) bool {
+			for _, e := range entities {
+				if e.Value == label {
+					return true
+				}
+			}
+			return false
+		}
+	)
+	for _, e := range old {
+		labels = append(labels, e.Value)
+	}
+	for _, e := range new {
+		if e.OldValue == "" || exists(old, e.Value) {
+			continue
+		}
+		if i := utils.ArrayFind(labels, e.OldValue); i > -1 {
+			changes.renamed[e.OldValue] = e.Value
+			labels[i] = e.Value
+		}
+	}
+	var position = -1
+	for _, label := range labels {
+		if !exists(new, label) {
+			changes.removed = append(changes.removed, label)
+		}
+	}
+	for _, e := range new {
+		if !utils.ArrayContains(labels, e.Value) {
+			changes.added = append(changes.added, e.Value)
+			continue
+		}
+		// the remaining labels must keep the order
+		if p := utils.ArrayFind(labels, e.Value); p < position {
+			changes.reordered = true
+		} else {
+			position = p
+		}
+	}
+	return changes
+}
+
+// makeEnumChanges alters the enumeration in place if labels are only added or renamed,
+// otherwise the type is recreated and all the columns of this type are converted
+func (c TypeComparator) makeEnumChanges(current *Root) []sqt.SqlStmt {
+	var (
+		result  = make([]sqt.SqlStmt, 0)
+		changes = compareEnums(c.TypeStruct.OldStructure.Enum, c.TypeStruct.NewStructure.Enum)
+	)
+	if len(changes.removed) > 0 || changes.reordered {
+		return c.makeEnumRecreation(current, changes)
+	}
+	for _, e := range c.TypeStruct.OldStructure.Enum {
+		if newLabel, ok := changes.renamed[e.Value]; ok {
+			result = append(result, c.describe(ActionAlter, makeTypeAlter(c.Schema.New, c.Name.New, fmt.Sprintf(
+				"rename value %s to %s", quoteLiteral(e.Value), quoteLiteral(newLabel),
+			))))
+		}
+	}
+	var (
+		labels = c.TypeStruct.NewStructure.Enum
+		first  = len(labels)
+	)
+	// the leading new labels are placed before the first existing label in their order
+	for i, e := range labels {
+		if !utils.ArrayContains(changes.added, e.Value) {
+			first = i
+			break
+		}
+	}
+	for i, e := range labels {
+		if !utils.ArrayContains(changes.added, e.Value) {
+			continue
+		}
+		var position string
+		if i < first && first < len(labels) {
+			position = "before " + quoteLiteral(labels[first].Value)
+		} else if i > 0 {
+			position = "after " + quoteLiteral(labels[i-1].Value)
+		}
+		result = append(result, c.describe(ActionAlter, makeTypeAlter(c.Schema.New, c.Name.New, utils.NonEmptyStringsConcatSpaceSeparated(
+			"add value if not exists", quoteLiteral(e.Value), position,
+		))))
+	}
+	return result
+}
+
+// makeEnumRecreation creates the new type with the required labels, converts all the columns
+// through the text representation (taking renamed labels into account), drops the old type and renames the new one
+func (c TypeComparator) makeEnumRecreation(current *Root, changes enumChanges) []sqt.SqlStmt {
+	var (
+		result   = make([]sqt.SqlStmt, 0)
+		tempName = makeSuffixedName(c.Name.New, recreatedTypeSuffix)
+		tempType = fmt.Sprintf("%s.%s", c.Schema.New, tempName)
+		defaults = make([]sqt.SqlStmt, 0)
+	)
+	result = append(result, c.describe(ActionAlter, makeType(c.Schema.New, tempName, *c.TypeStruct.NewStructure)))
+	for _, usage := range current.getDomainUsages(c.Schema.Actual, c.Name.Actual) {
+		column, ok := current.findColumn(usage)
+		if !ok {
+			continue
+		}
+		if def := column.Value.Schema.Value.Default; def != nil {
+			// the default value cannot be converted automatically
+			result = append(result, c.describe(ActionAlter, makeAlterColumnSetDefault(usage.TableSchema, usage.TableName, usage.ColumnName, nil)))
+			if label, ok := getEnumDefaultLabel(def); ok {
+				if newLabel, renamed := changes.renamed[label]; renamed {
+					def = newLabel
+				} else if utils.ArrayContains(changes.removed, label) {
+					// there is nothing to restore
+					continue
+				}
+			}
+			defaults = append(defaults, c.describe(ActionAlter, makeAlterColumnSetDefault(usage.TableSchema, usage.TableName, usage.ColumnName, def)))
+		}
+		var alter = makeAlterColumnSetType(
+			usage.TableSchema,
+			usage.TableName,
+			usage.ColumnName,
+			DomainSchema{TypeBase: TypeBase{Type: tempType, IsArray: column.Value.Schema.Value.IsArray}},
+			makeEnumConversion(usage.ColumnName, tempType, column.Value.Schema.Value.IsArray, changes.renamed),
+		)
+		if len(changes.removed) > 0 {
+			// the rows with removed labels cannot be converted
+			alter = markStatement(alter, StatementDestructive)
+		}
+		result = append(result, c.describe(ActionAlter, alter))
+	}
+	result = append(
+		result,
+		c.describe(ActionAlter, makeTypeDrop(c.Schema.New, c.Name.New)),
+		c.describe(ActionAlter, makeTypeRename(c.Schema.New, NameComparator{Actual: tempName, New: c.Name.New})),
+	)
+	return append(result, defaults...)
+}
+
+// the values are converted through their text representation, renamed labels are replaced
+func makeEnumConversion(column, newType string, isArray bool, renamed map[string]string) string {
+	var makeValue = func(value string) string {
+		if len(renamed) == 0 {
+			return value + "::text"
+		}
+		var (
+			oldLabels = make([]string, 0, len(renamed))
+			cases     = make([]string, 0, len(renamed))
+		)
+		for oldLabel := range renamed {
+			oldLabels = append(oldLabels, oldLabel)
+		}
+		sort.Strings(oldLabels)
+		for _, oldLabel := range oldLabels {
+			cases = append(cases, fmt.Sprintf("when %s then %s", quoteLiteral(oldLabel), quoteLiteral(renamed[oldLabel])))
+		}
+		return fmt.Sprintf("case %s::text %s else %s::text end", value, strings.Join(cases, " "), value)
+	}
+	if isArray {
+		return fmt.Sprintf("array(select %s from unnest(%s) as v)::%s[]", makeValue("v"), column, newType)
+	}
+	return fmt.Sprintf("(%s)::%s", makeValue(column), newType)
+}
+
+func getEnumDefaultLabel(def interface{}) (string, bool) {
+	s, ok := def.(string)
+	if !ok {
+		return "", false
+	}
+	if chains := enumDefaultPattern.FindStringSubmatch(s); chains != nil {
+		return strings.Replace(chains[1], "''", "'", -1), true
+	}
+	return s, true
+}
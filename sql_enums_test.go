@@ -0,0 +1,150 @@
+package dragonfly
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func makeEnum(labels ...string) []EnumEntity {
+	var result = make([]EnumEntity, 0, len(labels))
+	for _, label := range labels {
+		result = append(result, EnumEntity{Value: label})
+	}
+	return result
+}
+
+func Test_compareEnums(t *testing.T) {
+	tests := []struct {
+		name string
+		old  []EnumEntity
+		new  []EnumEntity
+		want enumChanges
+	}{
+		{
+			name: "added labels",
+			old:  makeEnum("new", "done"),
+			new:  makeEnum("draft", "new", "active", "done"),
+			want: enumChanges{renamed: map[string]string{}, added: []string{"draft", "active"}},
+		},
+		{
+			name: "leading added labels",
+			old:  makeEnum("c"),
+			new:  makeEnum("a", "b", "c"),
+			want: enumChanges{renamed: map[string]string{}, added: []string{"a", "b"}},
+		},
+		{
+			name: "renamed label",
+			old:  makeEnum("new", "done"),
+			new:  []EnumEntity{{Value: "new"}, {Value: "closed", OldValue: "done"}},
+			want: enumChanges{renamed: map[string]string{"done": "closed"}},
+		},
+		{
+			name: "removed label",
+			old:  makeEnum("new", "active", "done"),
+			new:  makeEnum("new", "done"),
+			want: enumChanges{renamed: map[string]string{}, removed: []string{"active"}},
+		},
+		{
+			name: "reordered labels",
+			old:  makeEnum("new", "done"),
+			new:  makeEnum("done", "new"),
+			want: enumChanges{renamed: map[string]string{}, reordered: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareEnums(tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compareEnums() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTypeComparator_makeEnumChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		old  []EnumEntity
+		new  []EnumEntity
+		want []string
+	}{
+		{
+			name: "labels are added after the previous ones",
+			old:  makeEnum("new", "done"),
+			new:  makeEnum("new", "active", "paused", "done", "archived"),
+			want: []string{
+				"alter type public.status add value if not exists 'active' after 'new'",
+				"alter type public.status add value if not exists 'paused' after 'active'",
+				"alter type public.status add value if not exists 'archived' after 'done'",
+			},
+		},
+		{
+			name: "leading labels are added before the first existing one",
+			old:  makeEnum("c"),
+			new:  makeEnum("a", "b", "c"),
+			want: []string{
+				"alter type public.status add value if not exists 'a' before 'c'",
+				"alter type public.status add value if not exists 'b' before 'c'",
+			},
+		},
+		{
+			name: "labels of the empty enumeration",
+			old:  makeEnum(),
+			new:  makeEnum("a", "b"),
+			want: []string{
+				"alter type public.status add value if not exists 'a'",
+				"alter type public.status add value if not exists 'b' after 'a'",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := TypeComparator{
+				Name:   NameComparator{Actual: "status", New: "status"},
+				Schema: NameComparator{Actual: "public", New: "public"},
+				TypeStruct: TypeStructComparator{
+					OldStructure: &TypeSchema{TypeBase: TypeBase{Type: "enum"}, Enum: tt.old},
+					NewStructure: &TypeSchema{TypeBase: TypeBase{Type: "enum"}, Enum: tt.new},
+				},
+			}
+			var got = make([]string, 0)
+			for _, stmt := range c.makeEnumChanges(&Root{}) {
+				got = append(got, stmt.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("makeEnumChanges() got:\n%s\nwant:\n%s", strings.Join(got, ";\n"), strings.Join(tt.want, ";\n"))
+			}
+		})
+	}
+}
+
+func Test_makeEnumConversion(t *testing.T) {
+	tests := []struct {
+		name    string
+		isArray bool
+		renamed map[string]string
+		want    string
+	}{
+		{
+			name: "scalar",
+			want: "(state::text)::public.status__new",
+		},
+		{
+			name:    "scalar with renamed labels",
+			renamed: map[string]string{"done": "closed", "new": "opened"},
+			want:    "(case state::text when 'done' then 'closed' when 'new' then 'opened' else state::text end)::public.status__new",
+		},
+		{
+			name:    "array",
+			isArray: true,
+			want:    "array(select v::text from unnest(state) as v)::public.status__new[]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := makeEnumConversion("state", "public.status__new", tt.isArray, tt.renamed); got != tt.want {
+				t.Errorf("makeEnumConversion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,577 @@
+package dragonfly
+
+import (
+	"github.com/iv-menshenin/dragonfly/pg_tree_node"
+	"github.com/iv-menshenin/dragonfly/utils"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	exprCurrentTimestamp = "now()"
+)
+
+var (
+	// these functions return the same value as current_timestamp in the transaction
+	currentTimestampSynonyms = []string{"transaction_timestamp()", "now()"}
+	textTypes                = []string{"text", "varchar", "character", "bpchar", "name"}
+	// the operators that are evaluated after comparisons
+	logicalOperators = []string{"and", "or", "not"}
+	// the keywords that separate the parts of the case expression
+	caseKeywords = []string{"case", "when", "then", "else", "end"}
+	// the tokens that end the operand of between, it is evaluated before comparisons
+	operandBounds = []string{"and", "or", "not", "case", "when", "then", "else", "end", ",", "=", "<>", "<", ">", "<=", ">="}
+	// the pattern matching operators as postgres stores them
+	likeOperators = map[string]string{"like": "~~", "ilike": "~~*"}
+	// type names that consist of several words
+	multiWordTypes = map[string][]string{
+		"character": {"varying"},
+		"double":    {"precision"},
+		"timestamp": {"with", "without", "time", "zone"},
+		"time":      {"with", "without", "time", "zone"},
+		"bit":       {"varying"},
+	}
+)
+
+// expressionDeparser restores the expressions of the database from their trees,
+// the columns of tables are needed to resolve the column references
+type expressionDeparser struct {
+	catalog pg_tree_node.Catalog
+	columns map[string]map[int]string
+}
+
+func newExpressionDeparser(catalog pg_tree_node.Catalog, columns []rawColumnStruct) *expressionDeparser {
+	var deparser = expressionDeparser{
+		catalog: catalog,
+		columns: make(map[string]map[int]string),
+	}
+	for _, column := range columns {
+		var table = strings.ToLower(column.TableSchema + "." + column.TableName)
+		if _, ok := deparser.columns[table]; !ok {
+			deparser.columns[table] = make(map[int]string)
+		}
+		deparser.columns[table][column.Ord] = column.Column
+	}
+	return &deparser
+}
+
+// deparse returns false if the tree cannot be restored, in this case the expression of the database is used
+func (c *expressionDeparser) deparse(schema, table string, tree *string) (string, bool) {
+	if c == nil || tree == nil {
+		return "", false
+	}
+	nodes, err := pg_tree_node.Parse(*tree)
+	if err != nil || len(nodes) != 1 {
+		return "", false
+	}
+	expr, err := pg_tree_node.Deparse(nodes[0], c.catalog, c.columns[strings.ToLower(schema+"."+table)])
+	if err != nil {
+		return "", false
+	}
+	return expr, true
+}
+
+// makeDefaultFromNodeTree converts the default value of the database into the value as it can be described
+// in the project file, the expression tree is used to recognize the constants and the current timestamp
+func makeDefaultFromNodeTree(text *string, tree *string) interface{} {
+	if text == nil {
+		return nil
+	}
+	if tree == nil {
+		return text
+	}
+	nodes, err := pg_tree_node.Parse(*tree)
+	if err != nil || len(nodes) != 1 {
+		return text
+	}
+	if pg_tree_node.IsCurrentTimestamp(nodes[0]) {
+		return exprCurrentTimestamp
+	}
+	value, ok := pg_tree_node.ConstValue(nodes[0])
+	if !ok || value == nil {
+		return text
+	}
+	if s, ok := value.(string); ok && strings.ContainsAny(s, "():-+") {
+		// such a string is considered as an expression by the generator
+		return text
+	}
+	return value
+}
+
+// isSameExpression compares two sql expressions after normalization
+func isSameExpression(expr1, expr2 string) bool {
+	return normalizeExpression(expr1) == normalizeExpression(expr2)
+}
+
+// isCheckChanged returns true if the check constraint with the same name has another meaning,
+// the empty expression means that the expression is unknown
+func isCheckChanged(old, new ConstraintSchema) bool {
+	oldCheck, ok1 := old.Constraint.Parameters.Parameter.(Check)
+	newCheck, ok2 := new.Constraint.Parameters.Parameter.(Check)
+	if !ok1 || !ok2 || oldCheck.Expression == "" || newCheck.Expression == "" {
+		return false
+	}
+	return !isSameExpression(oldCheck.Expression, newCheck.Expression)
+}
+
+// isSameDefault compares default values of the project and the database by their meaning
+func isSameDefault(old, new interface{}) bool {
+	oldSQL, newSQL := defaultExpression(old), defaultExpression(new)
+	if oldSQL == nil || newSQL == nil {
+		return oldSQL == nil && newSQL == nil
+	}
+	return isSameExpression(*oldSQL, *newSQL)
+}
+
+// defaultExpression returns the sql expression of the default value,
+// the string pointer is the expression of the database and it is not quoted
+func defaultExpression(value interface{}) *string {
+	if value == nil {
+		return nil
+	}
+	if expr, ok := value.(*string); ok {
+		return expr
+	}
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		value = v.Elem().Interface()
+	}
+	return defaultToSQL(value)
+}
+
+// normalizeExpression brings the expression to a canonical form: keywords are lowercase, spaces and redundant
+// parentheses are removed, casts of literals are omitted, synonyms of the current timestamp are replaced with now().
+// The expressions that postgres rewrites on storing (between, like, lists of values) are rewritten the same way
+func normalizeExpression(expr string) string {
+	var tokens = tokenizeExpression(expr)
+	tokens = replaceCurrentTimestamp(tokens)
+	tokens = replaceOperators(tokens)
+	tokens = replaceArrayComparisons(tokens)
+	tokens = replaceBetween(tokens)
+	tokens = removeLiteralCasts(tokens)
+	tokens = removeRedundantParentheses(tokens)
+	return strings.Join(tokens, " ")
+}
+
+func tokenizeExpression(expr string) []string {
+	var (
+		tokens = make([]string, 0, 16)
+		runes  = []rune(expr)
+	)
+	for i := 0; i < len(runes); {
+		var r = runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'' || r == '"':
+			var j = i + 1
+			for j < len(runes) {
+				if runes[j] == r {
+					if j+1 < len(runes) && runes[j+1] == r {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j < len(runes) {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			var j = i + 1
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '.' || runes[j] == '$') {
+				j++
+			}
+			tokens = append(tokens, strings.ToLower(string(runes[i:j])))
+			i = j
+		case unicode.IsDigit(r):
+			var j = i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, normalizeNumber(string(runes[i:j])))
+			i = j
+		case r == ':' && i+1 < len(runes) && runes[i+1] == ':':
+			tokens = append(tokens, "::")
+			i += 2
+		case strings.ContainsRune("(),[]", r):
+			tokens = append(tokens, string(r))
+			i++
+		default:
+			var j = i + 1
+			for j < len(runes) && strings.ContainsRune("<>=!~+-*/%|&^#@", runes[j]) {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		}
+	}
+	return tokens
+}
+
+func normalizeNumber(number string) string {
+	if !strings.Contains(number, ".") {
+		return number
+	}
+	if f, err := strconv.ParseFloat(number, 64); err == nil {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return number
+}
+
+func replaceCurrentTimestamp(tokens []string) []string {
+	var result = make([]string, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i] == "current_timestamp" {
+			result = append(result, exprCurrentTimestamp)
+			continue
+		}
+		if i+2 < len(tokens) && tokens[i+1] == "(" && tokens[i+2] == ")" {
+			var call = tokens[i] + "()"
+			if utils.ArrayContains(currentTimestampSynonyms, call) {
+				result = append(result, exprCurrentTimestamp)
+				i += 2
+				continue
+			}
+		}
+		result = append(result, tokens[i])
+	}
+	return result
+}
+
+// replaceOperators replaces the synonyms of operators and the pattern matching keywords with the operators
+func replaceOperators(tokens []string) []string {
+	var result = make([]string, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i] == "!=" {
+			result = append(result, "<>")
+			continue
+		}
+		if tokens[i] == "not" && i+1 < len(tokens) && likeOperators[tokens[i+1]] != "" {
+			result = append(result, "!"+likeOperators[tokens[i+1]])
+			i++
+			continue
+		}
+		if operator, ok := likeOperators[tokens[i]]; ok {
+			result = append(result, operator)
+			continue
+		}
+		result = append(result, tokens[i])
+	}
+	return result
+}
+
+// replaceArrayComparisons replaces `= any (array[...])` with `in (...)` and `<> all (array[...])` with `not in (...)`
+func replaceArrayComparisons(tokens []string) []string {
+	var result = make([]string, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		var list = "in"
+		switch {
+		case i+4 < len(tokens) && tokens[i] == "=" && tokens[i+1] == "any":
+		case i+4 < len(tokens) && tokens[i] == "<>" && tokens[i+1] == "all":
+			list = "not in"
+		default:
+			result = append(result, tokens[i])
+			continue
+		}
+		var closing = closingParenthesis(tokens, i+2)
+		if tokens[i+2] != "(" || tokens[i+3] != "array" || tokens[i+4] != "[" || closing < 0 || tokens[closing-1] != "]" {
+			result = append(result, tokens[i])
+			continue
+		}
+		result = append(result, strings.Fields(list)...)
+		result = append(result, "(")
+		result = append(result, tokens[i+5:closing-1]...)
+		result = append(result, ")")
+		i = closing
+	}
+	return result
+}
+
+// replaceBetween replaces `x between a and b` with `(x >= a and x <= b)` and `x not between a and b`
+// with `(x < a or x > b)`, the parentheses are removed later if they are redundant
+func replaceBetween(tokens []string) []string {
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i] != "between" || (i+1 < len(tokens) && tokens[i+1] == "symmetric") {
+			continue
+		}
+		var (
+			negated = i > 0 && tokens[i-1] == "not"
+			end     = i
+		)
+		if negated {
+			end--
+		}
+		var (
+			start = operandStart(tokens, end)
+			and   = operandEnd(tokens, i+1)
+		)
+		if start == end || and >= len(tokens) || tokens[and] != "and" || and == i+1 {
+			continue
+		}
+		var last = operandEnd(tokens, and+1)
+		if last == and+1 {
+			continue
+		}
+		var (
+			operand = wrapOperand(tokens[start:end])
+			lower   = wrapOperand(tokens[i+1 : and])
+			upper   = wrapOperand(tokens[and+1 : last])
+			result  = make([]string, 0, len(tokens)+len(operand)+4)
+		)
+		result = append(result, tokens[:start]...)
+		result = append(result, "(")
+		if negated {
+			result = append(append(append(result, operand...), "<"), lower...)
+			result = append(append(append(append(result, "or"), operand...), ">"), upper...)
+		} else {
+			result = append(append(append(result, operand...), ">="), lower...)
+			result = append(append(append(append(result, "and"), operand...), "<="), upper...)
+		}
+		result = append(result, ")")
+		tokens = append(result, tokens[last:]...)
+	}
+	return tokens
+}
+
+// operandStart returns the position of the first token of the operand that ends before the position
+func operandStart(tokens []string, pos int) int {
+	var level = 0
+	for i := pos - 1; i >= 0; i-- {
+		switch {
+		case tokens[i] == ")" || tokens[i] == "]":
+			level++
+		case tokens[i] == "(" || tokens[i] == "[":
+			if level == 0 {
+				return i + 1
+			}
+			level--
+		case level == 0 && utils.ArrayContains(operandBounds, tokens[i]):
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// operandEnd returns the position after the last token of the operand that starts at the position
+func operandEnd(tokens []string, pos int) int {
+	var level = 0
+	for i := pos; i < len(tokens); i++ {
+		switch {
+		case tokens[i] == "(" || tokens[i] == "[":
+			level++
+		case tokens[i] == ")" || tokens[i] == "]":
+			if level == 0 {
+				return i
+			}
+			level--
+		case level == 0 && utils.ArrayContains(operandBounds, tokens[i]):
+			return i
+		}
+	}
+	return len(tokens)
+}
+
+// wrapOperand wraps the operand in parentheses if it contains operators at the top level,
+// postgres does the same when it shows the operands of comparisons
+func wrapOperand(tokens []string) []string {
+	var level = 0
+	for i, token := range tokens {
+		switch {
+		case token == "(" || token == "[":
+			level++
+		case token == ")" || token == "]":
+			level--
+		case level == 0 && token != "::" && !isIdentifierToken(token) && !isLiteralToken(token) && (i == 0 || tokens[i-1] != "::"):
+			return append(append([]string{"("}, tokens...), ")")
+		}
+	}
+	return tokens
+}
+
+func isLiteralToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	return token[0] == '\'' || unicode.IsDigit(rune(token[0])) || token == "true" || token == "false" || token == "null"
+}
+
+// removeLiteralCasts removes casts like '1'::text, (0)::numeric or (name)::text, such casts are added by postgres itself
+func removeLiteralCasts(tokens []string) []string {
+	var result = make([]string, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i] == "::" && len(result) > 0 && (isCastOfLiteral(result) || isTextCastOfColumn(result, tokens, i+1)) {
+			i = skipTypeName(tokens, i+1) - 1
+			continue
+		}
+		result = append(result, tokens[i])
+	}
+	return result
+}
+
+// the columns of character types are implicitly converted to text, postgres shows it as (name)::text
+func isTextCastOfColumn(tokens, next []string, pos int) bool {
+	var last = len(tokens) - 1
+	if pos >= len(next) || !utils.ArrayContains(textTypes, next[pos]) {
+		return false
+	}
+	return last >= 2 && tokens[last] == ")" && isIdentifierToken(tokens[last-1]) && tokens[last-2] == "("
+}
+
+func isCastOfLiteral(tokens []string) bool {
+	var last = len(tokens) - 1
+	if isLiteralToken(tokens[last]) {
+		return true
+	}
+	// parenthesized literal, the minus of negative numbers is also allowed
+	if tokens[last] == ")" && last >= 2 && isLiteralToken(tokens[last-1]) {
+		return tokens[last-2] == "(" || (tokens[last-2] == "-" && last >= 3 && tokens[last-3] == "(")
+	}
+	return false
+}
+
+// skipTypeName returns the position after the name of type that starts at the position
+func skipTypeName(tokens []string, pos int) int {
+	if pos >= len(tokens) {
+		return pos
+	}
+	var words = multiWordTypes[tokens[pos]]
+	pos++
+	for pos < len(tokens) && utils.ArrayContains(words, tokens[pos]) {
+		pos++
+	}
+	if pos < len(tokens) && tokens[pos] == "(" {
+		for pos < len(tokens) && tokens[pos] != ")" {
+			pos++
+		}
+		pos++
+	}
+	for pos+1 < len(tokens) && tokens[pos] == "[" && tokens[pos+1] == "]" {
+		pos += 2
+	}
+	return pos
+}
+
+// removeRedundantParentheses removes parentheses around the single token, around the whole expression
+// and around the operands of logical operators if they do not contain logical operators themselves
+func removeRedundantParentheses(tokens []string) []string {
+	var changed = true
+	for changed {
+		changed = false
+		for i := 0; i < len(tokens); i++ {
+			if tokens[i] != "(" || (i > 0 && isIdentifierToken(tokens[i-1]) &&
+				!utils.ArrayContains(logicalOperators, tokens[i-1]) && !utils.ArrayContains(caseKeywords, tokens[i-1])) {
+				// function call
+				continue
+			}
+			var closing = closingParenthesis(tokens, i)
+			if closing < 0 || closing == i+1 {
+				continue
+			}
+			if closing == i+2 || isLogicalOperand(tokens, i, closing) {
+				var result = make([]string, 0, len(tokens)-2)
+				result = append(result, tokens[:i]...)
+				result = append(result, tokens[i+1:closing]...)
+				tokens = append(result, tokens[closing+1:]...)
+				changed = true
+				break
+			}
+		}
+	}
+	return tokens
+}
+
+// isLogicalOperand returns true if the group is surrounded by logical operators or by the bounds of expression
+// and it does not contain logical operators or casts at the top level
+func isLogicalOperand(tokens []string, opening, closing int) bool {
+	var (
+		isBound = func(pos int) bool {
+			return pos < 0 || pos >= len(tokens) || tokens[pos] == "(" || tokens[pos] == ")" || tokens[pos] == "," ||
+				utils.ArrayContains(logicalOperators, tokens[pos]) || utils.ArrayContains(caseKeywords, tokens[pos])
+		}
+		level = 0
+	)
+	if !isBound(opening-1) || !isBound(closing+1) {
+		return false
+	}
+	for i := opening + 1; i < closing; i++ {
+		switch tokens[i] {
+		case "(":
+			level++
+		case ")":
+			level--
+		default:
+			if level == 0 && (tokens[i] == "and" || tokens[i] == "or") {
+				return (opening == 0 && closing == len(tokens)-1) || isWrapped(tokens, opening, closing) ||
+					isJoinedBy(tokens, opening, closing, tokens[i])
+			}
+		}
+	}
+	return true
+}
+
+// isJoinedBy returns true if the group contains the only logical operator at the top level and it is joined
+// with the neighbours by the same operator, such as `a and (b and c)`
+func isJoinedBy(tokens []string, opening, closing int, operator string) bool {
+	var (
+		isJoint = func(pos int) bool {
+			return pos < 0 || pos >= len(tokens) || tokens[pos] == operator || tokens[pos] == "," ||
+				utils.ArrayContains(caseKeywords, tokens[pos]) ||
+				(pos < opening && tokens[pos] == "(") || (pos > closing && tokens[pos] == ")")
+		}
+		level = 0
+	)
+	if !isJoint(opening-1) || !isJoint(closing+1) {
+		return false
+	}
+	for i := opening + 1; i < closing; i++ {
+		switch tokens[i] {
+		case "(":
+			level++
+		case ")":
+			level--
+		case "and", "or", "not":
+			if level == 0 && tokens[i] != operator {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// the group is already wrapped with parentheses or commas of function arguments
+func isWrapped(tokens []string, opening, closing int) bool {
+	return opening > 0 && closing < len(tokens)-1 &&
+		(tokens[opening-1] == "(" || tokens[opening-1] == ",") && (tokens[closing+1] == ")" || tokens[closing+1] == ",")
+}
+
+func isIdentifierToken(token string) bool {
+	if token == "" || isLiteralToken(token) {
+		return false
+	}
+	var r = rune(token[0])
+	return unicode.IsLetter(r) || r == '_' || r == '"'
+}
+
+func closingParenthesis(tokens []string, pos int) int {
+	var level = 0
+	for i := pos; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "(":
+			level++
+		case ")":
+			level--
+			if level == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,214 @@
+package dragonfly
+
+import (
+	"github.com/iv-menshenin/dragonfly/pg_tree_node"
+	"github.com/iv-menshenin/dragonfly/utils"
+	"testing"
+)
+
+func Test_isSameExpression(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr1 string
+		expr2 string
+		want  bool
+	}{
+		{
+			name:  "current timestamp",
+			expr1: "now()",
+			expr2: "CURRENT_TIMESTAMP",
+			want:  true,
+		},
+		{
+			name:  "cast of literal",
+			expr1: "'a'::text",
+			expr2: "'a'",
+			want:  true,
+		},
+		{
+			name:  "cast of character varying",
+			expr1: "'new'::character varying(12)",
+			expr2: "'new'",
+			want:  true,
+		},
+		{
+			name:  "check deparsed by postgres",
+			expr1: "((price > (0)::numeric) AND (price < 1000.00))",
+			expr2: "price > 0 and price < 1000",
+			want:  true,
+		},
+		{
+			name:  "different literals",
+			expr1: "'a'::text",
+			expr2: "'b'",
+			want:  false,
+		},
+		{
+			name:  "case of literals matters",
+			expr1: "'A'",
+			expr2: "'a'",
+			want:  false,
+		},
+		{
+			name:  "different operators",
+			expr1: "price > 0",
+			expr2: "price >= 0",
+			want:  false,
+		},
+		{
+			name:  "precedence of logical operators",
+			expr1: "((a > 0) OR (b > 0)) AND (c > 0)",
+			expr2: "a > 0 or b > 0 and c > 0",
+			want:  false,
+		},
+		{
+			name:  "between deparsed by postgres",
+			expr1: "((a >= 1) AND (a <= 5))",
+			expr2: "a between 1 and 5",
+			want:  true,
+		},
+		{
+			name:  "between restored from the tree",
+			expr1: "x > 0 and a >= 1 and a <= 5",
+			expr2: "x > 0 AND a BETWEEN 1 AND 5",
+			want:  true,
+		},
+		{
+			name:  "between inside the conjunction",
+			expr1: "((x > 0) AND ((a >= 1) AND (a <= 5)))",
+			expr2: "x > 0 and a between 1 and 5",
+			want:  true,
+		},
+		{
+			name:  "between of expressions",
+			expr1: "(((a + 1) >= 0) AND ((a + 1) <= (b * 2)))",
+			expr2: "a + 1 between 0 and b * 2",
+			want:  true,
+		},
+		{
+			name:  "not between",
+			expr1: "((a < 1) OR (a > 5))",
+			expr2: "a not between 1 and 5",
+			want:  true,
+		},
+		{
+			name:  "negated between",
+			expr1: "NOT ((a >= 1) AND (a <= 5))",
+			expr2: "not a between 1 and 5",
+			want:  true,
+		},
+		{
+			name:  "between in the case condition",
+			expr1: "case when a >= 1 and a <= 2 then 1 else 0 end = 1",
+			expr2: "case when a between 1 and 2 then 1 else 0 end = 1",
+			want:  true,
+		},
+		{
+			name:  "between under the negation",
+			expr1: "NOT ((a >= 1) AND (a <= 5))",
+			expr2: "not a >= 1 and a <= 5",
+			want:  false,
+		},
+		{
+			name:  "different bounds of between",
+			expr1: "((a >= 1) AND (a <= 5))",
+			expr2: "a between 1 and 6",
+			want:  false,
+		},
+		{
+			name:  "like",
+			expr1: "((name)::text ~~ 'a%'::text)",
+			expr2: "name like 'a%'",
+			want:  true,
+		},
+		{
+			name:  "not ilike",
+			expr1: "((name)::text !~~* 'a%'::text)",
+			expr2: "name NOT ILIKE 'a%'",
+			want:  true,
+		},
+		{
+			name:  "list of values",
+			expr1: "(a = ANY (ARRAY[1, 2]))",
+			expr2: "a in (1, 2)",
+			want:  true,
+		},
+		{
+			name:  "not equal",
+			expr1: "(a <> 0)",
+			expr2: "a != 0",
+			want:  true,
+		},
+		{
+			name:  "function arguments are kept",
+			expr1: "lower((name)::text) <> ''::text",
+			expr2: "lower(name) <> ''",
+			want:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSameExpression(tt.expr1, tt.expr2); got != tt.want {
+				t.Errorf("isSameExpression() = %v, want %v: `%s` and `%s`", got, tt.want, normalizeExpression(tt.expr1), normalizeExpression(tt.expr2))
+			}
+		})
+	}
+}
+
+func Test_makeDefaultFromNodeTree(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		tree string
+		want interface{}
+	}{
+		{
+			name: "text constant",
+			text: "'a'::text",
+			tree: "{CONST :consttype 25 :consttypmod -1 :constcollid 100 :constlen -1 :constbyval false :constisnull false :location 33 :constvalue 5 [ 20 0 0 0 97 ]}",
+			want: "a",
+		},
+		{
+			name: "current timestamp",
+			text: "CURRENT_TIMESTAMP",
+			tree: "{SQLVALUEFUNCTION :op 3 :type 1184 :typmod -1 :location 40}",
+			want: "now()",
+		},
+		{
+			name: "integer constant",
+			text: "5",
+			tree: "{CONST :consttype 23 :consttypmod -1 :constcollid 0 :constlen 4 :constbyval true :constisnull false :location 134 :constvalue 4 [ 5 0 0 0 0 0 0 0 ]}",
+			want: int64(5),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got = makeDefaultFromNodeTree(utils.RefString(tt.text), utils.RefString(tt.tree))
+			if got != tt.want {
+				t.Errorf("makeDefaultFromNodeTree() = %v, want %v", got, tt.want)
+			}
+			if !isSameDefault(got, utils.RefString(tt.text)) {
+				t.Errorf("isSameDefault() the default `%v` differs from `%s`", got, tt.text)
+			}
+		})
+	}
+}
+
+func Test_expressionDeparser_deparse(t *testing.T) {
+	var deparser = newExpressionDeparser(
+		pg_tree_node.Catalog{Operators: map[int]string{521: ">"}},
+		[]rawColumnStruct{
+			{TableSchema: "shop", TableName: "items", Ord: 1, Column: "id"},
+			{TableSchema: "shop", TableName: "items", Ord: 2, Column: "amount"},
+		},
+	)
+	var tree = "{OPEXPR :opno 521 :opfuncid 147 :opresulttype 16 :opretset false :opcollid 0 :inputcollid 0 :args (" +
+		"{VAR :varno 1 :varattno 2 :vartype 23 :vartypmod -1 :varcollid 0 :varlevelsup 0 :varnoold 1 :varoattno 2 :location 7} " +
+		"{CONST :consttype 23 :consttypmod -1 :constcollid 0 :constlen 4 :constbyval true :constisnull false :location 16 :constvalue 4 [ 0 0 0 0 0 0 0 0 ]}) :location 14}"
+	if got, ok := deparser.deparse("shop", "items", &tree); !ok || got != "amount > 0" {
+		t.Errorf("deparse() = %v, %v, want `amount > 0`", got, ok)
+	}
+	if _, ok := deparser.deparse("shop", "orders", &tree); ok {
+		t.Error("deparse() the columns of unknown table are resolved")
+	}
+}
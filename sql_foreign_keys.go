@@ -0,0 +1,102 @@
+package dragonfly
+
+import (
+	"fmt"
+	sqt "github.com/iv-menshenin/sql-ast"
+	"strings"
+)
+
+const (
+	ForeignKeyMatchSimple = "simple"
+	ForeignKeyMatchFull   = "full"
+)
+
+type (
+	// foreignKeyExpr extends the foreign key of the syntax tree with several referenced columns and the match type,
+	// the first referenced column is kept in ToColumn so that dependencies are resolved as usual
+	foreignKeyExpr struct {
+		*sqt.ConstraintForeignKeyExpr
+		RefColumns []string
+		Match      string
+	}
+)
+
+func (c *foreignKeyExpr) ConstraintParams() string {
+	var (
+		refColumns = c.RefColumns
+		options    = make([]string, 0, 3)
+	)
+	if len(refColumns) == 0 && c.ToColumn != "" {
+		refColumns = []string{c.ToColumn}
+	}
+	if c.Match != "" && c.Match != ForeignKeyMatchSimple {
+		options = append(options, "match "+c.Match)
+	}
+	if int(c.OnUpdate) > -1 {
+		options = append(options, fmt.Sprintf("on update %s", c.OnUpdate))
+	}
+	if int(c.OnDelete) > -1 {
+		options = append(options, fmt.Sprintf("on delete %s", c.OnDelete))
+	}
+	var references = "references " + c.ToTable.GetName()
+	if len(refColumns) > 0 {
+		references += fmt.Sprintf(" (%s)", strings.Join(refColumns, ", "))
+	}
+	if len(options) > 0 {
+		return references + " " + strings.Join(options, " ")
+	}
+	return references
+}
+
+func makeForeignKeyMatch(match *string) string {
+	if match == nil {
+		return ForeignKeyMatchSimple
+	}
+	switch strings.ToLower(*match) {
+	case ForeignKeyMatchSimple, "none", "":
+		return ForeignKeyMatchSimple
+	case ForeignKeyMatchFull:
+		return ForeignKeyMatchFull
+	default:
+		panic(fmt.Sprintf("cannot resolve foreign key match type `%s`", *match))
+	}
+}
+
+// referencedColumns returns the columns of the referenced table, a single column can be set by the foreign key parameters
+func (c ConstraintSchema) referencedColumns() []string {
+	if len(c.RefColumns) > 0 {
+		return c.RefColumns
+	}
+	if fk, ok := c.Constraint.Parameters.Parameter.(ForeignKey); ok && fk.ToColumn != "" {
+		return []string{fk.ToColumn}
+	}
+	return nil
+}
+
+func isSameColumns(columns1, columns2 []string) bool {
+	if len(columns1) != len(columns2) {
+		return false
+	}
+	for i := range columns1 {
+		if !strings.EqualFold(columns1[i], columns2[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isForeignKeyChanged returns true if the foreign key with the same name refers to other columns or has other rules,
+// such a constraint cannot be altered, so it must be dropped and created again
+func isForeignKeyChanged(old, new ConstraintSchema) bool {
+	oldFK, ok1 := old.Constraint.Parameters.Parameter.(ForeignKey)
+	newFK, ok2 := new.Constraint.Parameters.Parameter.(ForeignKey)
+	if !ok1 || !ok2 {
+		return false
+	}
+	return !strings.EqualFold(oldFK.ToTable, newFK.ToTable) ||
+		!isSameColumns(old.Columns, new.Columns) ||
+		!isSameColumns(old.referencedColumns(), new.referencedColumns()) ||
+		stringToOnDeleteUpdateRule(oldFK.OnDelete) != stringToOnDeleteUpdateRule(newFK.OnDelete) ||
+		stringToOnDeleteUpdateRule(oldFK.OnUpdate) != stringToOnDeleteUpdateRule(newFK.OnUpdate) ||
+		makeForeignKeyMatch(oldFK.Match) != makeForeignKeyMatch(newFK.Match)
+}
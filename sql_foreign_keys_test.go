@@ -0,0 +1,84 @@
+package dragonfly
+
+import (
+	"github.com/iv-menshenin/dragonfly/utils"
+	"testing"
+)
+
+func Test_isForeignKeyChanged(t *testing.T) {
+	var makeFK = func(onDelete, match *string, columns []string, refColumns ...string) ConstraintSchema {
+		return ConstraintSchema{
+			Columns:    columns,
+			RefColumns: refColumns,
+			Constraint: Constraint{
+				Name: "fk_orders_customer",
+				Type: ConstraintForeignKey,
+				Parameters: ConstraintParameters{Parameter: ForeignKey{
+					ToTable:  "crm.customers",
+					OnDelete: onDelete,
+					Match:    match,
+				}},
+			},
+		}
+	}
+	var full = "full"
+	tests := []struct {
+		name string
+		old  ConstraintSchema
+		new  ConstraintSchema
+		want bool
+	}{
+		{
+			name: "default rules are the same as no action",
+			old:  makeFK(utils.RefString("NO ACTION"), nil, []string{"customer_id"}, "id"),
+			new:  makeFK(nil, nil, []string{"customer_id"}, "id"),
+			want: false,
+		},
+		{
+			name: "changed delete rule",
+			old:  makeFK(nil, nil, []string{"customer_id"}, "id"),
+			new:  makeFK(utils.RefString("cascade"), nil, []string{"customer_id"}, "id"),
+			want: true,
+		},
+		{
+			name: "changed match type",
+			old:  makeFK(nil, nil, []string{"region", "customer_id"}, "region", "id"),
+			new:  makeFK(nil, &full, []string{"region", "customer_id"}, "region", "id"),
+			want: true,
+		},
+		{
+			name: "changed referenced columns",
+			old:  makeFK(nil, nil, []string{"region", "customer_id"}, "region", "id"),
+			new:  makeFK(nil, nil, []string{"region", "customer_id"}, "id", "region"),
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isForeignKeyChanged(tt.old, tt.new); got != tt.want {
+				t.Errorf("isForeignKeyChanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_makeAddConstraintExpr(t *testing.T) {
+	var full = "full"
+	var constraint = ConstraintSchema{
+		Columns:    []string{"region", "customer_id"},
+		RefColumns: []string{"region", "id"},
+		Constraint: Constraint{
+			Name: "fk_orders_customer",
+			Type: ConstraintForeignKey,
+			Parameters: ConstraintParameters{Parameter: ForeignKey{
+				ToTable:  "crm.customers",
+				OnDelete: utils.RefString("cascade"),
+				Match:    &full,
+			}},
+		},
+	}
+	const want = "add constraint fk_orders_customer foreign key ( region, customer_id ) references crm.customers (region, id) match full on update no action on delete cascade"
+	if got := makeAddConstraintExpr(constraint).String(); got != want {
+		t.Errorf("makeAddConstraintExpr() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,275 @@
+package dragonfly
+
+import (
+	"fmt"
+	sqt "github.com/iv-menshenin/sql-ast"
+	"strings"
+)
+
+const (
+	HookPhasePreInstall   = "preInstall"
+	HookPhaseInstall      = "install"
+	HookPhaseAfterInstall = "afterInstall"
+
+	HookBefore = "before"
+	HookAfter  = "after"
+)
+
+// historyTable returns the schema and the name of the history table, the schema is empty if it is not specified
+func (c *MigrationSettings) historyTable() (schema, table string) {
+	if c == nil || c.HistoryTable == "" {
+		return "", ""
+	}
+	if parts := strings.SplitN(c.HistoryTable, ".", 2); len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return "", c.HistoryTable
+}
+
+func (c *MigrationSettings) getHooks() []MigrationHook {
+	if c == nil {
+		return nil
+	}
+	var ids = make(map[string]bool, len(c.Hooks))
+	for _, hook := range c.Hooks {
+		hook.check()
+		if ids[strings.ToLower(hook.ID)] {
+			panic(fmt.Sprintf("the hook `%s` is declared twice", hook.ID))
+		}
+		ids[strings.ToLower(hook.ID)] = true
+	}
+	return c.Hooks
+}
+
+func (c MigrationHook) check() {
+	if c.ID == "" {
+		panic("the hook must have an id")
+	}
+	if strings.TrimSpace(c.SQL) == "" {
+		panic(fmt.Sprintf("the hook `%s` has no sql", c.ID))
+	}
+	switch c.Phase {
+	case HookPhasePreInstall, HookPhaseInstall, HookPhaseAfterInstall:
+	default:
+		panic(fmt.Sprintf(
+			"unknown phase `%s` of the hook `%s`, expected one of: %s, %s, %s",
+			c.Phase, c.ID, HookPhasePreInstall, HookPhaseInstall, HookPhaseAfterInstall,
+		))
+	}
+	if c.On == nil {
+		return
+	}
+	if c.On.Kind == "" || c.On.Object == "" {
+		panic(fmt.Sprintf("the event of the hook `%s` must have the kind and the object", c.ID))
+	}
+	switch c.On.When {
+	case "", HookBefore, HookAfter:
+	default:
+		panic(fmt.Sprintf("unknown `%s` of the hook `%s`, expected %s or %s", c.On.When, c.ID, HookBefore, HookAfter))
+	}
+}
+
+// isAppliedHook returns true if the hook is found in the history table or in the snapshot of the previous migration
+func (c *Root) isAppliedHook(id string) bool {
+	for _, applied := range c.appliedHooks {
+		if strings.EqualFold(applied, id) {
+			return true
+		}
+	}
+	if c.Migrations == nil {
+		return false
+	}
+	for _, hook := range c.Migrations.Hooks {
+		if strings.EqualFold(hook.ID, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// findHistoryTable returns the schemas of the database that contain the history table of the project
+func (c *Root) findHistoryTable(settings *MigrationSettings) []string {
+	var schemaName, tableName = settings.historyTable()
+	if tableName == "" {
+		return nil
+	}
+	var result = make([]string, 0, 1)
+	for _, schema := range c.Schemas {
+		if schemaName != "" && !strings.EqualFold(schema.Value.Name, schemaName) {
+			continue
+		}
+		if _, ok := schema.Value.Tables.tryToFind(tableName); ok {
+			result = append(result, schema.Value.Name)
+		}
+	}
+	return result
+}
+
+// forgetHistoryTable removes the history table from the database structure, so it is never dropped as unknown
+func (c *Root) forgetHistoryTable(settings *MigrationSettings) {
+	var _, tableName = settings.historyTable()
+	for _, schemaName := range c.findHistoryTable(settings) {
+		schema, _ := c.Schemas.tryToFind(schemaName)
+		for name := range schema.Value.Tables {
+			if strings.EqualFold(name, tableName) {
+				delete(schema.Value.Tables, name)
+			}
+		}
+	}
+}
+
+// readHookHistory reads the identifiers of the hooks that have already been run
+func (c *Root) readHookHistory(db queryer, project *Root) error {
+	var _, tableName = project.Migrations.historyTable()
+	for _, schemaName := range c.findHistoryTable(project.Migrations) {
+		q, err := db.Query(fmt.Sprintf("select id from %s", project.getDialect().qualifiedName(schemaName, tableName)))
+		if err != nil {
+			return err
+		}
+		for q.Next() {
+			var id string
+			if err = q.Scan(&id); err != nil {
+				q.Close()
+				return err
+			}
+			c.appliedHooks = append(c.appliedHooks, id)
+		}
+		if err = q.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addHooks places the hooks that have not been run yet in their phases.
+// The hook with the event is placed next to the statements of the changed object, if they are in the same phase,
+// otherwise at the end of the phase. The hook is skipped if the object is not changed at all
+func (c *Root) addHooks(diff *Diff, current *Root) {
+	var (
+		phases = map[string]*[]sqt.SqlStmt{
+			HookPhasePreInstall:   &diff.preInstall,
+			HookPhaseInstall:      &diff.install,
+			HookPhaseAfterInstall: &diff.afterInstall,
+		}
+		added bool
+	)
+	for _, hook := range c.Migrations.getHooks() {
+		if current.isAppliedHook(hook.ID) || !c.Scope.hasKind(ObjectHook) {
+			continue
+		}
+		if hook.On != nil && !hook.On.happensIn(diff.allStatements()) {
+			continue
+		}
+		var (
+			phase    = phases[hook.Phase]
+			position = hook.position(*phase)
+			stmts    = c.makeHookStatements(hook)
+		)
+		*phase = append((*phase)[:position], append(stmts, (*phase)[position:]...)...)
+		added = true
+	}
+	if schemaName, tableName := c.Migrations.historyTable(); added && tableName != "" {
+		if schemaName != "" {
+			tableName = c.getDialect().qualifiedName(schemaName, tableName)
+		}
+		diff.preInstall = append([]sqt.SqlStmt{scriptStatement(
+			fmt.Sprintf("create table if not exists %s (id varchar(255) not null primary key)", tableName),
+			Change{},
+			StatementSafe,
+		)}, diff.preInstall...)
+	}
+}
+
+// makeHookStatements makes the statement of the hook and records it in the history table if the table is set
+func (c *Root) makeHookStatements(hook MigrationHook) []sqt.SqlStmt {
+	var change = Change{Kind: ObjectHook, Name: hook.ID, Action: ActionRun}
+	var result = []sqt.SqlStmt{
+		scriptStatement(strings.TrimRight(strings.TrimSpace(hook.SQL), ";"), change, StatementSafe),
+	}
+	if schemaName, tableName := c.Migrations.historyTable(); tableName != "" {
+		if schemaName != "" {
+			tableName = c.getDialect().qualifiedName(schemaName, tableName)
+		}
+		result = append(result, scriptStatement(
+			fmt.Sprintf("insert into %s (id) values (%s)", tableName, quoteLiteral(hook.ID)),
+			change,
+			StatementSafe,
+		))
+	}
+	for _, stmt := range result {
+		toMigrationStmt(stmt).hook = &hook
+	}
+	return result
+}
+
+// orderWithHooks orders the statements of the phase without the hooks and then places the hooks again,
+// the statements of the hooks have no dependencies, so the ordering could move them away from their events
+func orderWithHooks(phase []sqt.SqlStmt, order func([]sqt.SqlStmt) []sqt.SqlStmt) []sqt.SqlStmt {
+	var (
+		stmts = make([]sqt.SqlStmt, 0, len(phase))
+		hooks = make([]*MigrationHook, 0)
+		runs  = make([][]sqt.SqlStmt, 0)
+	)
+	for _, stmt := range phase {
+		m, ok := stmt.(*migrationStmt)
+		if !ok || m.hook == nil {
+			stmts = append(stmts, stmt)
+			continue
+		}
+		if n := len(hooks); n > 0 && hooks[n-1] == m.hook {
+			runs[n-1] = append(runs[n-1], stmt)
+			continue
+		}
+		hooks = append(hooks, m.hook)
+		runs = append(runs, []sqt.SqlStmt{stmt})
+	}
+	var result = order(stmts)
+	for i, hook := range hooks {
+		position := hook.position(result)
+		result = append(result[:position], append(runs[i], result[position:]...)...)
+	}
+	return result
+}
+
+// position returns the index in the phase where the statements of the hook are inserted
+func (c MigrationHook) position(phase []sqt.SqlStmt) int {
+	if c.On == nil {
+		return len(phase)
+	}
+	var first, last = -1, -1
+	for i, stmt := range phase {
+		if c.On.matches(stmt) {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	switch {
+	case first < 0:
+		return len(phase)
+	case c.On.When == HookAfter:
+		return last + 1
+	}
+	return first
+}
+
+func (c HookEvent) happensIn(stmts []sqt.SqlStmt) bool {
+	for _, stmt := range stmts {
+		if c.matches(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c HookEvent) matches(stmt sqt.SqlStmt) bool {
+	m, ok := stmt.(*migrationStmt)
+	if !ok || m.change == nil {
+		return false
+	}
+	if !strings.EqualFold(string(c.Kind), string(m.change.Kind)) || !strings.EqualFold(c.Object, m.change.qualifiedName()) {
+		return false
+	}
+	return c.Action == "" || strings.EqualFold(string(c.Action), string(m.change.Action))
+}
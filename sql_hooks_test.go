@@ -0,0 +1,215 @@
+package dragonfly
+
+import (
+	sqt "github.com/iv-menshenin/sql-ast"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoot_addHooks(t *testing.T) {
+	const current = `
+schemas:
+  - name: shop
+    tables:
+      users:
+        columns:
+          - name: id
+            schema: { type: int8, not_null: true }
+          - name: name
+            schema: { type: varchar, length: 100 }
+`
+	const splitName = `
+schemas:
+  - name: shop
+    tables:
+      users:
+        columns:
+          - name: id
+            schema: { type: int8, not_null: true }
+          - name: first_name
+            schema: { type: varchar, length: 50 }
+          - name: last_name
+            schema: { type: varchar, length: 50 }
+`
+	tests := []struct {
+		name    string
+		project string
+		applied []string
+		want    []string
+	}{
+		{
+			name: "hook is run before the column is dropped",
+			project: `
+migrations:
+  hooks:
+    - id: split_name
+      phase: install
+      on: { kind: column, object: shop.users.name, action: drop }
+      sql: update shop.users set first_name = name;
+` + splitName,
+			want: []string{
+				"alter table shop.users add column first_name varchar(50)",
+				"alter table shop.users add column last_name varchar(50)",
+				"update shop.users set first_name = name",
+				"alter table shop.users drop column if exists name cascade",
+			},
+		},
+		{
+			name: "hook is run after the column is added",
+			project: `
+migrations:
+  hooks:
+    - id: fill_last_name
+      phase: preInstall
+      on: { kind: column, object: shop.users.last_name, when: after }
+      sql: update shop.users set last_name = name
+` + splitName,
+			want: []string{
+				"alter table shop.users add column first_name varchar(50)",
+				"alter table shop.users add column last_name varchar(50)",
+				"update shop.users set last_name = name",
+				"alter table shop.users drop column if exists name cascade",
+			},
+		},
+		{
+			name: "object is not changed",
+			project: `
+migrations:
+  hooks:
+    - id: split_name
+      phase: install
+      on: { kind: column, object: shop.users.name, action: drop }
+      sql: update shop.users set first_name = name
+` + current,
+			want: []string{},
+		},
+		{
+			name: "hooks are recorded in the history table",
+			project: `
+migrations:
+  history_table: shop.hooks
+  hooks:
+    - id: applied
+      phase: preInstall
+      sql: select 1
+    - id: refresh
+      phase: afterInstall
+      sql: analyze shop.users
+` + current,
+			applied: []string{"applied"},
+			want: []string{
+				"create table if not exists shop.hooks (id varchar(255) not null primary key)",
+				"analyze shop.users",
+				"insert into shop.hooks (id) values ('refresh')",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := readProjectSnapshot([]byte(current))
+			if err != nil {
+				t.Fatalf("readProjectSnapshot() error = %v", err)
+			}
+			actual.appliedHooks = tt.applied
+			project, err := readProjectSnapshot([]byte(tt.project))
+			if err != nil {
+				t.Fatalf("readProjectSnapshot() error = %v", err)
+			}
+			diff := MakeDiff(actual, project)
+			ResolveDependencies(&diff)
+			var got = make([]string, 0)
+			for _, stmt := range diff.allStatements() {
+				got = append(got, stmt.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("makeDiff() got:\n%s\nwant:\n%s", strings.Join(got, ";\n"), strings.Join(tt.want, ";\n"))
+			}
+		})
+	}
+}
+
+func TestRoot_forgetHistoryTable(t *testing.T) {
+	var settings = &MigrationSettings{HistoryTable: "hooks"}
+	var root = Root{
+		Schemas: Schemas{
+			{Value: Schema{Name: "shop", Tables: TablesContainer{"Hooks": {}, "users": {}}}},
+			{Value: Schema{Name: "sales", Tables: TablesContainer{"orders": {}}}},
+		},
+	}
+	if got := root.findHistoryTable(settings); !reflect.DeepEqual(got, []string{"shop"}) {
+		t.Errorf("findHistoryTable() = %v, want [shop]", got)
+	}
+	root.forgetHistoryTable(settings)
+	if _, ok := root.Schemas[0].Value.Tables.tryToFind("hooks"); ok {
+		t.Errorf("forgetHistoryTable() did not remove the history table")
+	}
+	if _, ok := root.Schemas[0].Value.Tables.tryToFind("users"); !ok {
+		t.Errorf("forgetHistoryTable() removed the table users")
+	}
+}
+
+func Test_diffSnapshots_hooks(t *testing.T) {
+	var project = Root{
+		Schemas: Schemas{{Value: Schema{Name: "shop"}}},
+		Migrations: &MigrationSettings{
+			Hooks: []MigrationHook{{ID: "init", Phase: HookPhaseAfterInstall, SQL: "select 1"}},
+		},
+	}
+	snapshot, err := makeProjectSnapshot(&project)
+	if err != nil {
+		t.Fatalf("makeProjectSnapshot() error = %v", err)
+	}
+	first, err := diffSnapshots(nil, snapshot, project.Migrations)
+	if err != nil {
+		t.Fatalf("diffSnapshots() error = %v", err)
+	}
+	if got := first.afterInstall; len(got) != 1 || got[0].String() != "select 1" {
+		t.Errorf("the hook is not run by the first migration: %v", got)
+	}
+	next, err := diffSnapshots(snapshot, snapshot, project.Migrations)
+	if err != nil {
+		t.Fatalf("diffSnapshots() error = %v", err)
+	}
+	if !next.isEmpty() {
+		t.Errorf("the hook of the previous migration is run again: %v", next.allStatements())
+	}
+}
+
+func TestResolveDependencies_hooks(t *testing.T) {
+	var (
+		orders = Table{Columns: ColumnsContainer{{Value: Column{
+			Name:   "user_id",
+			Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "int8"}}},
+			Constraints: []Constraint{{
+				Name:       "fk_orders_user",
+				Type:       ConstraintForeignKey,
+				Parameters: ConstraintParameters{Parameter: ForeignKey{ToTable: "shop.users", ToColumn: "id"}},
+			}},
+		}}}}
+		users = Table{Columns: ColumnsContainer{{Value: Column{
+			Name:   "id",
+			Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "int8"}}},
+		}}}}
+		project = Root{Migrations: &MigrationSettings{Hooks: []MigrationHook{{
+			ID:    "fill_orders",
+			Phase: HookPhaseInstall,
+			On:    &HookEvent{Kind: ObjectTable, Object: "shop.orders", When: HookAfter},
+			SQL:   "insert into shop.orders select 1",
+		}}}}
+		// the table that depends on another one goes first, so the ordering moves it
+		diff = Diff{install: []sqt.SqlStmt{
+			describeStatement(makeTableCreate("shop", "orders", orders), Change{Kind: ObjectTable, Schema: "shop", Name: "orders", Action: ActionCreate}),
+			describeStatement(makeTableCreate("shop", "users", users), Change{Kind: ObjectTable, Schema: "shop", Name: "users", Action: ActionCreate}),
+		}}
+	)
+	project.addHooks(&diff, &Root{})
+	ResolveDependencies(&diff)
+	var got = make([]string, 0)
+	for _, stmt := range diff.install {
+		got = append(got, strings.SplitN(stmt.String(), " (", 2)[0])
+	}
+	if want := []string{"create table shop.users", "create table shop.orders", "insert into shop.orders select 1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveDependencies() order = %v, want %v", got, want)
+	}
+}
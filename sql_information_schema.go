@@ -3,6 +3,7 @@ package dragonfly
 import (
 	"database/sql"
 	"fmt"
+	"github.com/iv-menshenin/dragonfly/pg_tree_node"
 	"github.com/iv-menshenin/dragonfly/utils"
 	"strings"
 )
@@ -15,7 +16,11 @@ where schema_name not in ('information_schema','pg_catalog')
   and lower(catalog_name) = $1;`
 
 	sqlGetAllTableColumns = `
-select table_schema, table_name, ordinal_position, column_name, data_type, character_maximum_length, column_default, is_nullable != 'NO', numeric_precision, numeric_precision_radix, numeric_scale, domain_schema, domain_name, udt_schema, udt_name
+select table_schema, table_name, ordinal_position, column_name, data_type, character_maximum_length, column_default, is_nullable != 'NO', numeric_precision, numeric_precision_radix, numeric_scale, domain_schema, domain_name, udt_schema, udt_name,
+       (select ad.adbin::text
+          from pg_catalog.pg_attrdef ad
+          join pg_catalog.pg_attribute a on a.attrelid = ad.adrelid and a.attnum = ad.adnum
+         where ad.adrelid = format('%I.%I', table_schema, table_name)::regclass and a.attname = column_name)
 from information_schema.columns
 where table_schema not in ('information_schema','pg_catalog')
   and lower(table_catalog) = $1;`
@@ -23,24 +28,56 @@ where table_schema not in ('information_schema','pg_catalog')
 	sqlGetAllDomains = `
 select d.domain_schema, d.domain_name, d.data_type, d.character_maximum_length, d.domain_default, d.numeric_precision,
        d.numeric_precision_radix, d.numeric_scale, d.udt_name,
-       not exists((select true from pg_type where typnotnull and typtype='d' and typname=d.domain_name limit 1))
+       not exists((select true from pg_type where typnotnull and typtype='d' and typname=d.domain_name limit 1)),
+       (select t.typdefaultbin::text
+          from pg_catalog.pg_type t
+          join pg_catalog.pg_namespace n on n.oid = t.typnamespace
+         where n.nspname = d.domain_schema and t.typname = d.domain_name)
   from information_schema.domains d
 where d.domain_schema not in ('information_schema','pg_catalog')
   and lower(d.udt_catalog) = $1;`
 
 	sqlGetAllTablesConstraints = `
 select tc.table_schema, tc.table_name, tc.constraint_schema, tc.constraint_name, tc.constraint_type, kcu.column_name,
-       ccu.table_schema, ccu.table_name, ccu.column_name
+       rcu.table_schema, rcu.table_name, rcu.column_name, rc.match_option, rc.update_rule, rc.delete_rule
  from information_schema.table_constraints as tc
  join information_schema.key_column_usage as kcu
    on tc.constraint_name = kcu.constraint_name
   and tc.table_schema = kcu.table_schema
- left join information_schema.constraint_column_usage as ccu
-   on ccu.constraint_name = tc.constraint_name
-  and ccu.constraint_schema = tc.constraint_schema
+ left join information_schema.referential_constraints as rc
+   on rc.constraint_name = tc.constraint_name
+  and rc.constraint_schema = tc.constraint_schema
   and tc.constraint_type='FOREIGN KEY'
+ left join information_schema.key_column_usage as rcu
+   on rcu.constraint_name = rc.unique_constraint_name
+  and rcu.constraint_schema = rc.unique_constraint_schema
+  and rcu.ordinal_position = kcu.position_in_unique_constraint
 where tc.table_schema not in ('information_schema','pg_catalog')
-  and lower(tc.table_catalog) = $1;`
+  and lower(tc.table_catalog) = $1
+order by tc.constraint_name, kcu.ordinal_position;`
+
+	sqlGetAllTablesChecks = `
+select n.nspname, c.relname, pc.conname, pg_get_expr(pc.conbin, pc.conrelid), pc.conbin::text,
+       array_to_string(array(select a.attname from pg_catalog.pg_attribute a
+                              where a.attrelid = pc.conrelid and a.attnum = any(pc.conkey)
+                              order by a.attnum), ',')
+  from pg_catalog.pg_constraint pc
+  join pg_catalog.pg_class c on c.oid = pc.conrelid
+  join pg_catalog.pg_namespace n on n.oid = c.relnamespace
+ where pc.contype = 'c'
+   and n.nspname not in ('information_schema','pg_catalog')
+   and lower(current_database()) = $1;`
+
+	sqlGetExpressionCatalog = `
+select 'f', p.oid::int, case when n.nspname = 'pg_catalog' then p.proname else n.nspname || '.' || p.proname end
+  from pg_catalog.pg_proc p
+  join pg_catalog.pg_namespace n on n.oid = p.pronamespace
+union all
+select 'o', o.oid::int, o.oprname
+  from pg_catalog.pg_operator o
+union all
+select 't', t.oid::int, format_type(t.oid, null)
+  from pg_catalog.pg_type t;`
 
 	sqlGetRecordTypes = `
 select n.nspname, t.typname, a.attname, a.attnum, at.typname, at.typnotnull, a.attnotnull,
@@ -69,32 +106,38 @@ join pg_type t on e.enumtypid = t.oid
 inner join pg_catalog.pg_namespace n on n.oid = t.typnamespace;
 `
 
+	// the indexes of constraints and the indexes on expressions are not taken into account
 	sqlGetIndices = `
 select
     n.nspname,
-    ix.indnatts,
-    ix.indkey,
     t.relname as table_name,
     i.relname as index_name,
-    a.attname as column_name,
-    t.relkind,
-    t.relname,
-    ix.indexprs
+    ix.indisunique,
+    pg_get_expr(ix.indpred, ix.indrelid) as index_where,
+    a.attname as column_name
 from pg_index ix
-inner join pg_attribute a on a.attrelid = ix.indrelid and a.attnum = ANY(ix.indkey)
 inner join pg_class i on i.oid = ix.indexrelid
 inner join pg_namespace n on n.oid = i.relnamespace
 inner join pg_class t on t.oid = ix.indrelid
+inner join unnest(ix.indkey::int2[]) with ordinality as k(attnum, position) on true
+inner join pg_attribute a on a.attrelid = ix.indrelid and a.attnum = k.attnum
 where not ix.indisprimary
-  and not ix.indisclustered
   and ix.indisvalid
+  and ix.indexprs is null
+  and not exists(select 1 from pg_constraint c where c.conindid = ix.indexrelid)
   and n.nspname not in('information_schema', 'pg_catalog')
 order by
+    n.nspname,
+    t.relname,
     i.relname,
-    t.relname;`
+    k.position;`
 )
 
 type (
+	// queryer is the database or the transaction in which the structure of the database is read
+	queryer interface {
+		Query(query string, args ...interface{}) (*sql.Rows, error)
+	}
 	rawEnumStruct struct {
 		Schema    string
 		Type      string
@@ -122,6 +165,7 @@ type (
 		Type         string
 		Max          *int
 		Default      *string
+		DefaultTree  *string
 		Nullable     bool
 		Precision    *int
 		Radix        *int
@@ -137,6 +181,7 @@ type (
 		Type         string
 		Max          *int
 		Default      *string
+		DefaultTree  *string
 		Nullable     bool
 		Precision    *int
 		Radix        *int
@@ -154,9 +199,21 @@ type (
 		ConstraintName   string
 		ConstraintType   string
 		Columns          []string
+		RefColumns       []string
 		ForeignKey       *ForeignKeyInformation
+		CheckExpression  string
+		CheckTree        *string
 	}
 	rawActualConstraints map[string]actualConstraint
+	rawIndexStruct       struct {
+		TableSchema string
+		TableName   string
+		IndexName   string
+		IsUnique    bool
+		Where       *string
+		Column      string
+	}
+	rawIndices []rawIndexStruct
 
 	actualSchema struct {
 		Name  string
@@ -272,8 +329,12 @@ func (c *rawDomainStruct) toDomainSchema() DomainSchema {
 		Check:    nil, // TODO
 		used:     utils.RefBool(false),
 	}
-	if c.Default != nil {
-		domain.Default = *c.Default
+	switch def := makeDefaultFromNodeTree(c.Default, c.DefaultTree).(type) {
+	case nil:
+	case *string:
+		domain.Default = *def
+	default:
+		domain.Default = def
 	}
 	return domain
 }
@@ -305,7 +366,7 @@ func (c *rawColumnStruct) toColumnRef() ColumnRef {
 		used:     utils.RefBool(false),
 	}
 	if c.Default != nil {
-		domainSchema.Default = c.Default
+		domainSchema.Default = makeDefaultFromNodeTree(c.Default, c.DefaultTree)
 	}
 	return ColumnRef{
 		Value: Column{
@@ -482,20 +543,26 @@ type (
 	}
 )
 
+// getDomainUsages returns the columns of the domain or the custom type, the type can be referred by its name as well
 func (c *Root) getDomainUsages(domainSchema, domainName string) []ColumnFullName {
-	var usages = make([]ColumnFullName, 0, 50)
+	var (
+		usages   = make([]ColumnFullName, 0, 50)
+		fullName = fmt.Sprintf("%s.%s", domainSchema, domainName)
+	)
 	for _, schema := range c.Schemas {
 		schemaName := schema.Value.Name
-		for tableName, table := range schema.Value.Tables {
-			for _, column := range table.Columns {
+		for _, tableName := range schema.Value.Tables.getNames() {
+			for _, column := range schema.Value.Tables[tableName].Columns {
+				var matched = strings.EqualFold(column.Value.Schema.Value.Type, fullName)
 				if domainSchema1, domainName1, ok := column.Value.Schema.makeCustomType(); ok {
-					if strings.EqualFold(domainSchema1, domainSchema) && strings.EqualFold(domainName1, domainName) {
-						usages = append(usages, ColumnFullName{
-							TableSchema: schemaName,
-							TableName:   tableName,
-							ColumnName:  column.Value.Name,
-						})
-					}
+					matched = strings.EqualFold(domainSchema1, domainSchema) && strings.EqualFold(domainName1, domainName)
+				}
+				if matched {
+					usages = append(usages, ColumnFullName{
+						TableSchema: schemaName,
+						TableName:   tableName,
+						ColumnName:  column.Value.Name,
+					})
 				}
 			}
 		}
@@ -503,6 +570,15 @@ func (c *Root) getDomainUsages(domainSchema, domainName string) []ColumnFullName
 	return usages
 }
 
+func (c *Root) findColumn(name ColumnFullName) (*ColumnRef, bool) {
+	if schema, ok := c.Schemas.tryToFind(name.TableSchema); ok {
+		if table, ok := schema.Value.Tables.tryToFind(name.TableName); ok {
+			return table.Columns.tryToFind(name.ColumnName)
+		}
+	}
+	return nil, false
+}
+
 func (c *Root) getForeignKey(schemaName, foreignSchema, tableName, foreignTable string) (string, *ForeignKey) {
 	if schema, ok := c.Schemas.tryToFind(schemaName); ok {
 		for name, table := range schema.Value.Tables {
@@ -532,7 +608,10 @@ func (c *Root) getForeignKey(schemaName, foreignSchema, tableName, foreignTable
 func (c rawActualConstraints) toTableConstraints() TableConstraints {
 	constraints := make(TableConstraints, 0, len(c))
 	for name, constraint := range c {
-		var parameter interface{} = nil
+		var (
+			parameter  interface{} = nil
+			refColumns []string
+		)
 		cType, ok := constraintReference[strings.ToLower(constraint.ConstraintType)]
 		if !ok {
 			panic(fmt.Sprintf("cannot resolve constraint type `%s` for `%s`", constraint.ConstraintType, name))
@@ -544,18 +623,23 @@ func (c rawActualConstraints) toTableConstraints() TableConstraints {
 			parameter = ForeignKey{
 				ToTable:  fmt.Sprintf("%s.%s", constraint.ForeignKey.ForeignTable.SchemaName, constraint.ForeignKey.ForeignTable.TableName),
 				ToColumn: constraint.ForeignKey.ForeignTable.ColumnName,
-				OnUpdate: nil, // TODO rules
-				OnDelete: nil, // TODO rules
+				OnUpdate: constraint.ForeignKey.rule(constraint.ForeignKey.UpdateRule),
+				OnDelete: constraint.ForeignKey.rule(constraint.ForeignKey.DeleteRule),
+				Match:    constraint.ForeignKey.match(),
+			}
+			if len(constraint.RefColumns) > 1 {
+				refColumns = constraint.RefColumns
 			}
 		case ConstraintUniqueKey:
 			parameter = nil
 		case ConstraintCheck:
-			parameter = Check{Expression: ""} // TODO check expression
+			parameter = Check{Expression: constraint.CheckExpression}
 		default:
 			panic("unimplemented")
 		}
 		constraints = append(constraints, ConstraintSchema{
-			Columns: constraint.Columns,
+			Columns:    constraint.Columns,
+			RefColumns: refColumns,
 			Constraint: Constraint{
 				Name:       constraint.ConstraintName,
 				Type:       cType,
@@ -567,6 +651,23 @@ func (c rawActualConstraints) toTableConstraints() TableConstraints {
 	return constraints
 }
 
+func (c ForeignKeyInformation) rule(rule *string) *string {
+	if rule == nil {
+		return nil
+	}
+	var lower = strings.ToLower(*rule)
+	return &lower
+}
+
+// match returns the match type of the foreign key, postgres names the simple match type as NONE
+func (c ForeignKeyInformation) match() *string {
+	if c.Match == nil || !strings.EqualFold(*c.Match, ForeignKeyMatchFull) {
+		return nil
+	}
+	var full = ForeignKeyMatchFull
+	return &full
+}
+
 func (c rawActualConstraints) filterConstraints(schemaName, tableName string) rawActualConstraints {
 	constraints := make(rawActualConstraints, 0)
 	for name, constraint := range c {
@@ -577,7 +678,37 @@ func (c rawActualConstraints) filterConstraints(schemaName, tableName string) ra
 	return constraints
 }
 
-func getAllSchemaNames(db *sql.DB, catalog string) (list rawActualSchemaNames, err error) {
+// toTableIndices gathers the columns of each index of the table in the order of the index key
+func (c rawIndices) toTableIndices(schemaName, tableName string) IndicesContainer {
+	var indices = make(IndicesContainer, 0)
+	for _, raw := range c {
+		if !strings.EqualFold(raw.TableSchema, schemaName) || !strings.EqualFold(raw.TableName, tableName) {
+			continue
+		}
+		if last := len(indices) - 1; last > -1 && indices[last].Name == raw.IndexName {
+			indices[last].Columns = append(indices[last].Columns, raw.Column)
+			continue
+		}
+		var index = Index{
+			Name:      raw.IndexName,
+			IndexType: IndexTypeIndex,
+			Columns:   []string{raw.Column},
+		}
+		if raw.IsUnique {
+			index.IndexType = IndexTypeUnique
+		}
+		if raw.Where != nil {
+			index.Where = *raw.Where
+		}
+		indices = append(indices, index)
+	}
+	if len(indices) == 0 {
+		return nil
+	}
+	return indices
+}
+
+func getAllSchemaNames(db queryer, catalog string) (list rawActualSchemaNames, err error) {
 	var q *sql.Rows
 	if q, err = db.Query(sqlGetSchemaList, strings.ToLower(catalog)); err != nil {
 		return
@@ -601,7 +732,7 @@ func getAllSchemaNames(db *sql.DB, catalog string) (list rawActualSchemaNames, e
 	return
 }
 
-func getAllTables(db *sql.DB, catalog string) (columns []rawColumnStruct, err error) {
+func getAllTables(db queryer, catalog string) (columns []rawColumnStruct, err error) {
 	var q *sql.Rows
 	if q, err = db.Query(sqlGetAllTableColumns, strings.ToLower(catalog)); err != nil {
 		return
@@ -628,6 +759,7 @@ func getAllTables(db *sql.DB, catalog string) (columns []rawColumnStruct, err er
 				&column.Domain,
 				&column.UdtSchema,
 				&column.UdtName,
+				&column.DefaultTree,
 			); err != nil {
 				return
 			} else {
@@ -638,7 +770,7 @@ func getAllTables(db *sql.DB, catalog string) (columns []rawColumnStruct, err er
 	return
 }
 
-func getAllDomains(db *sql.DB, catalog string) (domains []rawDomainStruct, err error) {
+func getAllDomains(db queryer, catalog string) (domains []rawDomainStruct, err error) {
 	var q *sql.Rows
 	if q, err = db.Query(sqlGetAllDomains, strings.ToLower(catalog)); err != nil {
 		return
@@ -660,6 +792,7 @@ func getAllDomains(db *sql.DB, catalog string) (domains []rawDomainStruct, err e
 				&domain.Scale,
 				&domain.UdtName,
 				&domain.Nullable,
+				&domain.DefaultTree,
 			); err != nil {
 				return
 			} else {
@@ -671,7 +804,7 @@ func getAllDomains(db *sql.DB, catalog string) (domains []rawDomainStruct, err e
 	return
 }
 
-func getAllRecords(db *sql.DB, catalog string) (attributes []rawTypeStruct, err error) {
+func getAllRecords(db queryer, catalog string) (attributes []rawTypeStruct, err error) {
 	var q *sql.Rows
 	if q, err = db.Query(sqlGetRecordTypes, strings.ToLower(catalog)); err != nil {
 		return
@@ -708,7 +841,7 @@ func getAllRecords(db *sql.DB, catalog string) (attributes []rawTypeStruct, err
 	return
 }
 
-func getAllEnums(db *sql.DB, _ string) (enums rawEnums, err error) {
+func getAllEnums(db queryer, _ string) (enums rawEnums, err error) {
 	var q *sql.Rows
 	if q, err = db.Query(sqlGetEnumTypes); err != nil {
 		return
@@ -735,7 +868,7 @@ func getAllEnums(db *sql.DB, _ string) (enums rawEnums, err error) {
 	return
 }
 
-func getAllConstraints(db *sql.DB, catalog string) (constraints rawActualConstraints, err error) {
+func getAllConstraints(db queryer, catalog string) (constraints rawActualConstraints, err error) {
 	var q *sql.Rows
 	type constraintFlat struct {
 		TableSchema        string
@@ -747,6 +880,9 @@ func getAllConstraints(db *sql.DB, catalog string) (constraints rawActualConstra
 		ForeignTableSchema *string
 		ForeignTableName   *string
 		ForeignTableColumn *string
+		MatchOption        *string
+		UpdateRule         *string
+		DeleteRule         *string
 	}
 	if q, err = db.Query(sqlGetAllTablesConstraints, catalog); err != nil {
 		return
@@ -768,6 +904,9 @@ func getAllConstraints(db *sql.DB, catalog string) (constraints rawActualConstra
 				&constraint.ForeignTableSchema,
 				&constraint.ForeignTableName,
 				&constraint.ForeignTableColumn,
+				&constraint.MatchOption,
+				&constraint.UpdateRule,
+				&constraint.DeleteRule,
 			); err != nil {
 				return
 			} else {
@@ -786,6 +925,9 @@ func getAllConstraints(db *sql.DB, catalog string) (constraints rawActualConstra
 				}
 				c.Columns = append(c.Columns, constraint.ColumnName)
 				if constraint.ForeignTableColumn != nil {
+					c.RefColumns = append(c.RefColumns, *constraint.ForeignTableColumn)
+				}
+				if constraint.ForeignTableColumn != nil && c.ForeignKey == nil {
 					c.ForeignKey = &ForeignKeyInformation{
 						KeyName: constraint.ConstraintName,
 						MainTable: TableColumn{
@@ -798,6 +940,9 @@ func getAllConstraints(db *sql.DB, catalog string) (constraints rawActualConstra
 							TableName:  *constraint.ForeignTableName,
 							ColumnName: *constraint.ForeignTableColumn,
 						},
+						Match:      constraint.MatchOption,
+						UpdateRule: constraint.UpdateRule,
+						DeleteRule: constraint.DeleteRule,
 					}
 				}
 				constraints[strings.ToLower(constraint.ConstraintName)] = c
@@ -808,6 +953,113 @@ func getAllConstraints(db *sql.DB, catalog string) (constraints rawActualConstra
 	return
 }
 
+// getAllChecks adds the check constraints of tables, they are not listed in the key column usage
+func getAllChecks(db queryer, catalog string, constraints rawActualConstraints) (err error) {
+	var q *sql.Rows
+	if q, err = db.Query(sqlGetAllTablesChecks, strings.ToLower(catalog)); err != nil {
+		return
+	}
+	for q.Next() {
+		if err = q.Err(); err != nil {
+			return
+		}
+		var (
+			c       actualConstraint
+			columns string
+		)
+		if err = q.Scan(
+			&c.TableSchema,
+			&c.TableName,
+			&c.ConstraintName,
+			&c.CheckExpression,
+			&c.CheckTree,
+			&columns,
+		); err != nil {
+			return
+		}
+		c.ConstraintSchema = c.TableSchema
+		c.ConstraintType = "CHECK"
+		c.Columns = make([]string, 0, 1)
+		if columns != "" {
+			c.Columns = strings.Split(columns, ",")
+		}
+		constraints[strings.ToLower(c.ConstraintName)] = c
+	}
+	return
+}
+
+// getAllIndices loads the columns of the indices that are not made by constraints, one row for each column
+func getAllIndices(db queryer) (indices rawIndices, err error) {
+	var q *sql.Rows
+	if q, err = db.Query(sqlGetIndices); err != nil {
+		return
+	}
+	indices = make(rawIndices, 0, 100)
+	var index rawIndexStruct
+	for q.Next() {
+		if err = q.Err(); err != nil {
+			return
+		}
+		if err = q.Scan(
+			&index.TableSchema,
+			&index.TableName,
+			&index.IndexName,
+			&index.IsUnique,
+			&index.Where,
+			&index.Column,
+		); err != nil {
+			return
+		}
+		indices = append(indices, index)
+	}
+	return
+}
+
+// getExpressionCatalog loads the names of functions, operators and types to restore the expressions
+func getExpressionCatalog(db queryer) (catalog pg_tree_node.Catalog, err error) {
+	var q *sql.Rows
+	if q, err = db.Query(sqlGetExpressionCatalog); err != nil {
+		return
+	}
+	catalog = pg_tree_node.Catalog{
+		Functions: make(map[int]string, 3000),
+		Operators: make(map[int]string, 1000),
+		Types:     make(map[int]string, 1000),
+	}
+	for q.Next() {
+		if err = q.Err(); err != nil {
+			return
+		}
+		var (
+			kind string
+			oid  int
+			name string
+		)
+		if err = q.Scan(&kind, &oid, &name); err != nil {
+			return
+		}
+		switch kind {
+		case "f":
+			catalog.Functions[oid] = name
+		case "o":
+			catalog.Operators[oid] = name
+		case "t":
+			catalog.Types[oid] = name
+		}
+	}
+	return
+}
+
+// deparseChecks replaces the expressions of check constraints with the restored from their trees
+func (c rawActualConstraints) deparseChecks(deparser *expressionDeparser) {
+	for name, constraint := range c {
+		if expr, ok := deparser.deparse(constraint.TableSchema, constraint.TableName, constraint.CheckTree); ok {
+			constraint.CheckExpression = expr
+			c[name] = constraint
+		}
+	}
+}
+
 func filterByUsedNil(columns ColumnsContainer) ColumnsContainer {
 	var cc = make(ColumnsContainer, 0, len(columns))
 	for i, column := range columns {
@@ -818,7 +1070,7 @@ func filterByUsedNil(columns ColumnsContainer) ColumnsContainer {
 	return cc
 }
 
-func getAllDatabaseInformation(db *sql.DB, dbName string) (info Root, err error) {
+func getAllDatabaseInformation(db queryer, dbName string) (info Root, err error) {
 	var (
 		allSchemas     rawActualSchemaNames
 		allDomains     []rawDomainStruct
@@ -826,6 +1078,9 @@ func getAllDatabaseInformation(db *sql.DB, dbName string) (info Root, err error)
 		allEnumTypes   rawEnums
 		allTables      []rawColumnStruct
 		allConstraints rawActualConstraints
+		allIndices     rawIndices
+		allStorages    rawStorages
+		catalog        pg_tree_node.Catalog
 	)
 	if allSchemas, err = getAllSchemaNames(db, dbName); err != nil {
 		return
@@ -845,6 +1100,25 @@ func getAllDatabaseInformation(db *sql.DB, dbName string) (info Root, err error)
 	if allConstraints, err = getAllConstraints(db, dbName); err != nil {
 		return
 	}
+	if err = getAllChecks(db, dbName, allConstraints); err != nil {
+		return
+	}
+	if allIndices, err = getAllIndices(db); err != nil {
+		return
+	}
+	if allStorages, err = getAllStorages(db); err != nil {
+		return
+	}
+	if catalog, err = getExpressionCatalog(db); err != nil {
+		return
+	}
+	var deparser = newExpressionDeparser(catalog, allTables)
+	allConstraints.deparseChecks(deparser)
+	for i, domain := range allDomains {
+		if expr, ok := deparser.deparse("", "", domain.DefaultTree); ok && domain.Default != nil {
+			allDomains[i].Default = &expr
+		}
+	}
 	info.Schemas = make([]SchemaRef, 0, len(allSchemas.Schemas))
 	for actualSchemaName := range allSchemas.Schemas {
 		schemaDomains := make(DomainsContainer, 0)
@@ -868,6 +1142,8 @@ func getAllDatabaseInformation(db *sql.DB, dbName string) (info Root, err error)
 					if serial, ok := extractSerialType(columnStruct); ok {
 						columnStruct.UdtName = serial
 						columnStruct.Default = nil
+					} else if expr, ok := deparser.deparse(columnStruct.TableSchema, tableName, columnStruct.DefaultTree); ok {
+						columnStruct.Default = &expr
 					}
 				}
 				if _, ok := schemaColumns[strings.ToLower(tableName)]; !ok {
@@ -882,13 +1158,19 @@ func getAllDatabaseInformation(db *sql.DB, dbName string) (info Root, err error)
 			table := Table{
 				Columns:     filterByUsedNil(tableStruct),
 				Constraints: allConstraints.filterConstraints(actualSchemaName, tableName).toTableConstraints(),
+				Indices:     allIndices.toTableIndices(actualSchemaName, tableName),
+				Storage:     allStorages.tableStorage(actualSchemaName, tableName),
 				used:        utils.RefBool(false),
 			}
+			for i, index := range table.Indices {
+				table.Indices[i].Storage = allStorages.indexStorage(actualSchemaName, index.Name)
+			}
 			schemaTables[tableName] = table
 		}
 		schema := SchemaRef{
 			Value: Schema{
 				Name:    actualSchemaName,
+				Owner:   allSchemas.Schemas[actualSchemaName].Owner,
 				Types:   schemaTypes,
 				Domains: schemaDomains,
 				Tables:  schemaTables,
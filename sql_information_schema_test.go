@@ -168,3 +168,25 @@ func TestRoot_getUnusedDomainAndSetItAsUsed(t *testing.T) {
 		})
 	}
 }
+
+func Test_rawIndices_toTableIndices(t *testing.T) {
+	var (
+		where   = "deleted_at is null"
+		indices = rawIndices{
+			{TableSchema: "shop", TableName: "orders", IndexName: "ix_orders_customer", Column: "customer_id"},
+			{TableSchema: "shop", TableName: "orders", IndexName: "ix_orders_customer", Column: "created_at"},
+			{TableSchema: "shop", TableName: "orders", IndexName: "uq_orders_code", IsUnique: true, Where: &where, Column: "code"},
+			{TableSchema: "shop", TableName: "items", IndexName: "ix_items_order", Column: "order_id"},
+		}
+		want = IndicesContainer{
+			{Name: "ix_orders_customer", IndexType: IndexTypeIndex, Columns: []string{"customer_id", "created_at"}},
+			{Name: "uq_orders_code", IndexType: IndexTypeUnique, Columns: []string{"code"}, Where: where},
+		}
+	)
+	if got := indices.toTableIndices("shop", "orders"); !reflect.DeepEqual(got, want) {
+		t.Errorf("toTableIndices() = %+v, want %+v", got, want)
+	}
+	if got := indices.toTableIndices("shop", "customers"); got != nil {
+		t.Errorf("toTableIndices() = %+v, want nil for the table without indices", got)
+	}
+}
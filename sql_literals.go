@@ -0,0 +1,211 @@
+package dragonfly
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// the number as it can be written in SQL without quotes, the fractions like 1/3 are not numbers
+	decimalLiteral = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][+-]?[0-9]+)?$`)
+)
+
+// encodeLiteral renders the value of the seed data as the SQL literal of the column type,
+// domains are resolved to their base types and custom types are looked for in the project
+func (c *Root) encodeLiteral(t TypeBase, value interface{}) string {
+	if value == nil {
+		return "null"
+	}
+	base, custom := c.resolveLiteralType(t)
+	if base.IsArray {
+		return c.encodeArray(base, value)
+	}
+	if custom != nil {
+		return c.encodeCustom(base, custom, value)
+	}
+	return encodeScalar(canonicalTypeName(base.Type), value)
+}
+
+// resolveLiteralType follows the `schema.name` of the domain or the custom type,
+// the root can be nil, then only the built-in types are known
+func (c *Root) resolveLiteralType(t TypeBase) (TypeBase, *TypeSchema) {
+	parts := strings.SplitN(t.Type, ".", 2)
+	if c == nil || len(parts) < 2 {
+		return t, nil
+	}
+	schema, ok := c.Schemas.tryToFind(parts[0])
+	if !ok {
+		return t, nil
+	}
+	for name, domain := range schema.Value.Domains {
+		if strings.EqualFold(name, parts[1]) {
+			var base = domain.TypeBase
+			base.IsArray = base.IsArray || t.IsArray
+			return c.resolveLiteralType(base)
+		}
+	}
+	for name, custom := range schema.Value.Types {
+		if strings.EqualFold(name, parts[1]) {
+			return t, &custom
+		}
+	}
+	return t, nil
+}
+
+func (c *Root) encodeArray(t TypeBase, value interface{}) string {
+	var element = t
+	element.IsArray = false
+	switch v := value.(type) {
+	case []interface{}:
+		if len(v) == 0 {
+			return fmt.Sprintf("'{}'::%s", typeBaseString(t))
+		}
+		var items = make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, c.encodeLiteral(element, item))
+		}
+		return fmt.Sprintf("array[%s]::%s", strings.Join(items, ", "), typeBaseString(t))
+	case string:
+		// the array is written as the text representation of PostgreSQL
+		return fmt.Sprintf("%s::%s", quoteLiteral(v), typeBaseString(t))
+	}
+	panic(fmt.Sprintf("cannot use `%v` <%T> as the value of type `%s`", value, value, typeBaseString(t)))
+}
+
+func (c *Root) encodeCustom(t TypeBase, custom *TypeSchema, value interface{}) string {
+	switch strings.ToLower(custom.Type) {
+	case "record":
+		fields, ok := jsonValue(value).(map[string]interface{})
+		if !ok {
+			return fmt.Sprintf("%s::%s", quoteLiteral(fmt.Sprintf("%v", value)), t.Type)
+		}
+		var items = make([]string, 0, len(custom.Fields))
+		for _, field := range custom.Fields {
+			var fieldValue interface{}
+			for name, v := range fields {
+				if strings.EqualFold(name, field.Value.Name) {
+					fieldValue = v
+				}
+			}
+			items = append(items, c.encodeLiteral(field.Value.Schema.Value.TypeBase, fieldValue))
+		}
+		return fmt.Sprintf("row(%s)::%s", strings.Join(items, ", "), t.Type)
+	case "json", "map":
+		return encodeScalar("jsonb", value)
+	}
+	return fmt.Sprintf("%s::%s", quoteLiteral(fmt.Sprintf("%v", value)), t.Type)
+}
+
+func encodeScalar(typeName string, value interface{}) string {
+	switch typeName {
+	case "int2", "int4", "int8":
+		switch v := value.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			return fmt.Sprintf("%d", v)
+		case float64:
+			if v == float64(int64(v)) {
+				return strconv.FormatInt(int64(v), 10)
+			}
+		case string:
+			if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return v
+			}
+		}
+	case "numeric", "float4", "float8":
+		switch v := value.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			return fmt.Sprintf("%d", v)
+		case float32:
+			return strconv.FormatFloat(float64(v), 'f', -1, 32)
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		case string:
+			if decimalLiteral.MatchString(v) && (typeName == "numeric" || isFloatInRange(typeName, v)) {
+				return v
+			}
+			if strings.EqualFold(v, "NaN") || strings.EqualFold(strings.TrimLeft(v, "+-"), "Infinity") {
+				return quoteLiteral(v)
+			}
+			// the value is checked by the database
+			return fmt.Sprintf("%s::%s", quoteLiteral(v), typeName)
+		}
+	case "bool":
+		switch v := value.(type) {
+		case bool:
+			return strconv.FormatBool(v)
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return strconv.FormatBool(b)
+			}
+		}
+	case "json", "jsonb":
+		if v, ok := value.(string); ok {
+			return quoteLiteral(v)
+		}
+		data, err := json.Marshal(jsonValue(value))
+		if err != nil {
+			panic(err)
+		}
+		return quoteLiteral(string(data))
+	case "bytea":
+		switch v := value.(type) {
+		case []byte:
+			return quoteLiteral(`\x` + hex.EncodeToString(v))
+		case string:
+			if strings.HasPrefix(v, `\x`) {
+				return quoteLiteral(v)
+			}
+			return quoteLiteral(`\x` + hex.EncodeToString([]byte(v)))
+		}
+	default:
+		switch v := value.(type) {
+		case string:
+			return quoteLiteral(v)
+		case time.Time:
+			return quoteLiteral(v.Format("2006-01-02 15:04:05.999999999Z07:00"))
+		default:
+			return quoteLiteral(fmt.Sprintf("%v", v))
+		}
+	}
+	panic(fmt.Sprintf("cannot use `%v` <%T> as the value of type `%s`", value, value, typeName))
+}
+
+// isFloatInRange returns false if the number does not fit the floating point type
+func isFloatInRange(typeName, number string) bool {
+	var bitSize = 64
+	if typeName == "float4" {
+		bitSize = 32
+	}
+	_, err := strconv.ParseFloat(number, bitSize)
+	return err == nil
+}
+
+// jsonValue makes the maps decoded from YAML suitable for JSON encoding
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		var result = make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[fmt.Sprintf("%v", key)] = jsonValue(item)
+		}
+		return result
+	case map[string]interface{}:
+		var result = make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = jsonValue(item)
+		}
+		return result
+	case []interface{}:
+		var result = make([]interface{}, 0, len(v))
+		for _, item := range v {
+			result = append(result, jsonValue(item))
+		}
+		return result
+	}
+	return value
+}
@@ -0,0 +1,51 @@
+package dragonfly
+
+import (
+	"testing"
+)
+
+func TestRoot_encodeLiteral(t *testing.T) {
+	var db = Root{Schemas: Schemas{{Value: Schema{
+		Name: "app",
+		Types: TypesContainer{
+			"status": {TypeBase: TypeBase{Type: "enum"}},
+			"address": {TypeBase: TypeBase{Type: "record"}, Fields: ColumnsContainer{
+				{Value: Column{Name: "city", Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "text"}}}}},
+				{Value: Column{Name: "zip", Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "int4"}}}}},
+			}},
+		},
+		Domains: DomainsContainer{
+			"amount": {TypeBase: TypeBase{Type: "numeric"}},
+		},
+	}}}}
+	tests := []struct {
+		name  string
+		typ   TypeBase
+		value interface{}
+		want  string
+	}{
+		{name: "null", typ: TypeBase{Type: "text"}, value: nil, want: "null"},
+		{name: "quotes", typ: TypeBase{Type: "text"}, value: "O'Brien", want: "'O''Brien'"},
+		{name: "integer from text", typ: TypeBase{Type: "bigint"}, value: "42", want: "42"},
+		{name: "float", typ: TypeBase{Type: "float8"}, value: 0.25, want: "0.25"},
+		{name: "numeric from text", typ: TypeBase{Type: "numeric"}, value: "-1.5e3", want: "-1.5e3"},
+		{name: "fraction is not a number", typ: TypeBase{Type: "numeric"}, value: "1/3", want: "'1/3'::numeric"},
+		{name: "float out of range", typ: TypeBase{Type: "float8"}, value: "1e400", want: "'1e400'::float8"},
+		{name: "boolean from text", typ: TypeBase{Type: "boolean"}, value: "t", want: "true"},
+		{name: "timestamp", typ: TypeBase{Type: "timestamptz"}, value: "2001-02-03 04:05:06+00", want: "'2001-02-03 04:05:06+00'"},
+		{name: "json", typ: TypeBase{Type: "jsonb"}, value: map[interface{}]interface{}{"b": []interface{}{1}, "a": "x"}, want: `'{"a":"x","b":[1]}'`},
+		{name: "bytea", typ: TypeBase{Type: "bytea"}, value: "ab", want: `'\x6162'`},
+		{name: "array", typ: TypeBase{Type: "varchar", IsArray: true}, value: []interface{}{"a", nil}, want: "array['a', null]::varchar[]"},
+		{name: "empty array", typ: TypeBase{Type: "int4", IsArray: true}, value: []interface{}{}, want: "'{}'::int4[]"},
+		{name: "domain", typ: TypeBase{Type: "app.amount"}, value: "10.50", want: "10.50"},
+		{name: "enum", typ: TypeBase{Type: "app.status"}, value: "done", want: "'done'::app.status"},
+		{name: "record", typ: TypeBase{Type: "app.address"}, value: map[interface{}]interface{}{"zip": 1, "city": "Cork"}, want: "row('Cork', 1)::app.address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := db.encodeLiteral(tt.typ, tt.value); got != tt.want {
+				t.Errorf("encodeLiteral() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,394 @@
+package dragonfly
+
+import (
+	"fmt"
+	"github.com/iv-menshenin/dragonfly/pg_tree_node"
+	"github.com/iv-menshenin/dragonfly/utils"
+	sqt "github.com/iv-menshenin/sql-ast"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+const (
+	// the changes are made by plain statements, some of them hold the exclusive lock while the whole table is scanned
+	MigrationModeDefault = "default"
+	// the changes of existing tables are split into phases that do not block reads and writes for a long time,
+	// the migration must not be executed inside a transaction block
+	MigrationModeOnline = "online"
+
+	defaultBatchSize   = 10000
+	notNullCheckSuffix = "_not_null"
+	syncTriggerSuffix  = "_sync"
+	// identifies rows of the table that has no primary key
+	rowIdentifier     = "ctid"
+	rowIdentifierType = "tid"
+)
+
+var (
+	// the characters that cannot be used in the names of variables without quotes
+	nonVariableChars = regexp.MustCompile(`[^a-z0-9_]`)
+)
+
+type (
+	// onlineMigration describes how the changes of the existing table are split into phases, nil means the default mode
+	onlineMigration struct {
+		batchSize int
+		// the columns identifying the rows of the table, the backfill goes through the rows in the order of them
+		key []keyColumn
+	}
+	keyColumn struct {
+		Name     string
+		DataType string
+	}
+	// batchUpdateStmt fills the column in batches ordered by the key, each batch is committed separately.
+	// The rows that got the value before the batch are not updated again
+	batchUpdateStmt struct {
+		*sqt.UpdateStmt
+		Column    string
+		Value     string
+		Key       []keyColumn
+		BatchSize int
+	}
+	// scriptStmt is the statement that has no representation in the syntax tree,
+	// the embedded statement does the same with the data and brings the dependencies
+	scriptStmt struct {
+		sqt.SqlStmt
+		Script string
+	}
+	// notValidConstraintExpr adds the constraint that is checked for new rows only, the existing rows are validated later
+	notValidConstraintExpr struct {
+		*sqt.AddExpr
+	}
+	// validateConstraintExpr checks the existing rows without blocking reads and writes
+	validateConstraintExpr struct {
+		*sqt.Literal
+	}
+	// provenNotNullExpr sets not null when the validated check constraint has already proven it,
+	// so the table is not scanned again (postgres 12+)
+	provenNotNullExpr struct {
+		*sqt.AlterExpr
+	}
+	// concurrentIndexStmt builds the unique index of the new constraint without blocking writes
+	concurrentIndexStmt struct {
+		*sqt.AlterStmt
+		Index   string
+		Columns []string
+	}
+	// attachIndexExpr adds the unique constraint using the index that is already built, the table is not scanned
+	attachIndexExpr struct {
+		*sqt.AddExpr
+		Index string
+	}
+)
+
+func (c *batchUpdateStmt) String() string {
+	var (
+		table     = c.Table.Table.GetName()
+		column    = (&sqt.Literal{Text: c.Column}).String()
+		names     = make([]string, 0, len(c.Key))
+		qualified = make([]string, 0, len(c.Key))
+		batch     = make([]string, 0, len(c.Key))
+		joined    = make([]string, 0, len(c.Key))
+		last      = make([]string, 0, len(c.Key))
+		declare   = make([]string, 0, len(c.Key))
+		order     = make([]string, 0, len(c.Key))
+	)
+	for i, variable := range keyVariables(c.Key) {
+		name := pg_tree_node.QuoteIdent(c.Key[i].Name)
+		names = append(names, name)
+		qualified = append(qualified, table+"."+name)
+		batch = append(batch, "batch_"+variable)
+		joined = append(joined, "batch.batch_"+variable)
+		last = append(last, "_last_"+variable)
+		declare = append(declare, fmt.Sprintf("\t_last_%s %s;\n", variable, c.Key[i].DataType))
+		order = append(order, "batch_"+variable+" desc")
+	}
+	var (
+		keyList   = strings.Join(names, ", ")
+		lastList  = strings.Join(last, ", ")
+		batchList = strings.Join(batch, ", ")
+	)
+	return "do $$\ndeclare\n" + strings.Join(declare, "") + "begin\n" +
+		fmt.Sprintf("\tselect %s into %s from %s order by %s limit 1;\n", keyList, lastList, table, keyList) +
+		fmt.Sprintf("\tupdate %s set %s = %s where (%s) = (%s) and %s is null;\n", table, column, c.Value, keyList, lastList, column) +
+		"\tloop\n" +
+		fmt.Sprintf("\t\twith batch (%s) as (\n", batchList) +
+		fmt.Sprintf("\t\t\tselect %s from %s where (%s) > (%s) order by %s limit %d\n", keyList, table, keyList, lastList, keyList, c.BatchSize) +
+		"\t\t), filled as (\n" +
+		fmt.Sprintf(
+			"\t\t\tupdate %s set %s = %s from batch where (%s) = (%s) and %s.%s is null\n",
+			table, column, c.Value, strings.Join(qualified, ", "), strings.Join(joined, ", "), table, column,
+		) +
+		"\t\t)\n" +
+		fmt.Sprintf("\t\tselect %s into %s from batch order by %s limit 1;\n", batchList, lastList, strings.Join(order, ", ")) +
+		"\t\texit when not found;\n" +
+		"\t\tcommit;\n" +
+		"\tend loop;\n" +
+		"end\n$$"
+}
+
+// keyVariables makes the names of the variables for the key columns, the names of the columns may contain
+// upper-case letters and other characters that are not allowed in the names without quotes
+func keyVariables(key []keyColumn) []string {
+	var result = make([]string, 0, len(key))
+	for i, column := range key {
+		var name = nonVariableChars.ReplaceAllString(strings.ToLower(column.Name), "_")
+		if utils.ArrayContains(result, name) {
+			name = fmt.Sprintf("%s_%d", name, i+1)
+		}
+		result = append(result, name)
+	}
+	return result
+}
+
+func (c *scriptStmt) String() string {
+	return c.Script
+}
+
+func (c *notValidConstraintExpr) String() string {
+	return c.AddExpr.String() + " not valid"
+}
+
+func (c *validateConstraintExpr) String() string {
+	return "validate constraint " + c.Literal.String()
+}
+
+func (c *concurrentIndexStmt) String() string {
+	return fmt.Sprintf(
+		"create unique index concurrently if not exists %s on %s (%s)",
+		c.Index, c.Name.GetName(), strings.Join(c.Columns, ", "),
+	)
+}
+
+func (c *attachIndexExpr) String() string {
+	return fmt.Sprintf("add constraint %s unique using index %s", c.Name.GetName(), c.Index)
+}
+
+// getOnlineMigration returns nil if the changes are not required to be made online
+func (c *Root) getOnlineMigration() *onlineMigration {
+	if c.Migrations == nil {
+		return nil
+	}
+	switch strings.ToLower(c.Migrations.Mode) {
+	case "", MigrationModeDefault:
+		return nil
+	case MigrationModeOnline:
+		var batchSize = c.Migrations.BatchSize
+		if batchSize <= 0 {
+			batchSize = defaultBatchSize
+		}
+		return &onlineMigration{batchSize: batchSize}
+	}
+	panic(fmt.Sprintf("unknown migration mode `%s`", c.Migrations.Mode))
+}
+
+// SetMigrationMode overrides the migration mode described in the project file
+func (c *Root) SetMigrationMode(mode string) {
+	if c.Migrations == nil {
+		c.Migrations = &MigrationSettings{}
+	}
+	c.Migrations.Mode = mode
+}
+
+// forTable identifies the rows of the actual table by its primary key, or by ctid if the table has no primary key.
+// The variables of the key cannot be declared with the domain that does not allow nulls, so its base type is used
+func (c *onlineMigration) forTable(current *Root, table Table) *onlineMigration {
+	if c == nil {
+		return nil
+	}
+	var result = onlineMigration{batchSize: c.batchSize}
+	for _, column := range table.extractPrimaryKeyColumns() {
+		var dataType = column.Value.Schema.Value.TypeBase
+		if schema, name, ok := column.Value.Schema.makeCustomType(); ok {
+			dataType = TypeBase{Type: schema + "." + name, IsArray: dataType.IsArray}
+		}
+		dataType, _ = current.resolveLiteralType(dataType)
+		if strings.Contains(strings.ToLower(dataType.Type), "serial") {
+			// serial is not a real type, variables cannot be declared with it
+			dataType.Type = canonicalTypeName(dataType.Type)
+		}
+		result.key = append(result.key, keyColumn{
+			Name: column.Value.Name,
+			DataType: (&sqt.DataTypeExpr{
+				DataType:  dataType.Type,
+				IsArray:   dataType.IsArray,
+				Length:    dataType.Length,
+				Precision: dataType.Precision,
+			}).String(),
+		})
+	}
+	if len(result.key) == 0 {
+		result.key = []keyColumn{{Name: rowIdentifier, DataType: rowIdentifierType}}
+	}
+	return &result
+}
+
+// makeColumnAdd adds the column as nullable, fills existing rows with the default value in batches
+// and then sets not null without scanning the table under the exclusive lock
+func (c *onlineMigration) makeColumnAdd(schema, table string, column ColumnRef) []sqt.SqlStmt {
+	var (
+		name         = column.Value.Name
+		defaultValue = column.Value.Schema.Value.Default
+		result       = []sqt.SqlStmt{makeColumnAdd(schema, table, column)}
+	)
+	if defaultValue != nil {
+		result = append(result, makeAlterColumnSetDefault(schema, table, name, defaultValue))
+	}
+	if column.Value.Schema.Value.NotNull {
+		if defaultValue != nil {
+			result = append(result, c.makeBackfill(schema, table, name, *defaultToSQL(defaultValue)))
+		}
+		result = append(result, c.makeSetNotNull(schema, table, name)...)
+	}
+	return result
+}
+
+func (c *onlineMigration) makeBackfill(schema, table, column, value string) sqt.SqlStmt {
+	return &batchUpdateStmt{
+		UpdateStmt: makeColumnFill(schema, table, column, value),
+		Column:     column,
+		Value:      value,
+		Key:        c.key,
+		BatchSize:  c.batchSize,
+	}
+}
+
+func makeColumnFill(schema, table, column, value string) *sqt.UpdateStmt {
+	return &sqt.UpdateStmt{
+		Table: sqt.TableDesc{
+			Table: &sqt.Selector{
+				Name:      table,
+				Container: schema,
+			},
+		},
+		Set: []sqt.SqlExpr{
+			&sqt.BinaryExpr{
+				Left:  &sqt.Literal{Text: column},
+				Right: &sqt.Literal{Text: value},
+				Op:    token.ASSIGN,
+			},
+		},
+	}
+}
+
+// makeSetNotNull proves that the column has no nulls by the check constraint which is validated without blocking writes,
+// the check is not needed after not null is set
+func (c *onlineMigration) makeSetNotNull(schema, table, column string) []sqt.SqlStmt {
+	var check = ConstraintSchema{
+		Columns: []string{column},
+		Constraint: Constraint{
+			Name: makeSuffixedName(table+"_"+column, notNullCheckSuffix),
+			Type: ConstraintCheck,
+			Parameters: ConstraintParameters{
+				Parameter: Check{Expression: (&sqt.Literal{Text: column}).String() + " is not null"},
+			},
+		},
+	}
+	return append(
+		c.makeConstraintAdd(schema, table, check),
+		&sqt.AlterStmt{
+			Target: sqt.TargetTable,
+			Name: &sqt.Selector{
+				Name:      table,
+				Container: schema,
+			},
+			Alter: &provenNotNullExpr{
+				AlterExpr: &sqt.AlterExpr{
+					Target: sqt.TargetColumn,
+					Name:   &sqt.Literal{Text: column},
+					Alter:  makeSetDropExpr(true, &sqt.NotNullClause{}),
+				},
+			},
+		},
+		makeConstraintDropStmt(schema, table, check.Constraint.Name, true, false),
+	)
+}
+
+// makeConstraintAdd builds the unique index concurrently before the unique constraint is added,
+// check constraints and foreign keys are added as not valid and validated separately
+func (c *onlineMigration) makeConstraintAdd(schema, table string, constraint ConstraintSchema) []sqt.SqlStmt {
+	var (
+		add        = makeAddConstraintExpr(constraint)
+		alterTable = func(alter sqt.SqlExpr) *sqt.AlterStmt {
+			return &sqt.AlterStmt{
+				Target: sqt.TargetTable,
+				Name: &sqt.Selector{
+					Name:      table,
+					Container: schema,
+				},
+				Alter: alter,
+			}
+		}
+	)
+	switch constraint.Constraint.Type {
+	case ConstraintUniqueKey:
+		return []sqt.SqlStmt{
+			&concurrentIndexStmt{
+				AlterStmt: alterTable(add),
+				Index:     constraint.Constraint.Name,
+				Columns:   constraint.Columns,
+			},
+			alterTable(&attachIndexExpr{AddExpr: add, Index: constraint.Constraint.Name}),
+		}
+	case ConstraintCheck, ConstraintForeignKey:
+		return []sqt.SqlStmt{
+			alterTable(&notValidConstraintExpr{AddExpr: add}),
+			alterTable(&validateConstraintExpr{Literal: &sqt.Literal{Text: constraint.Constraint.Name}}),
+		}
+	}
+	return []sqt.SqlStmt{alterTable(add)}
+}
+
+// makeSyncTrigger fills the column with the value for every inserted or updated row until the trigger is dropped,
+// the value can refer to any column of the row by its name
+func makeSyncTrigger(schema, table, column, value string) (create []sqt.SqlStmt, drop []sqt.SqlStmt) {
+	var (
+		fill     = makeColumnFill(schema, table, column, value)
+		name     = makeSuffixedName(table+"_"+column, syncTriggerSuffix)
+		function = fmt.Sprintf("%s.%s", schema, name)
+		target   = fmt.Sprintf("%s.%s", schema, table)
+	)
+	create = []sqt.SqlStmt{
+		&scriptStmt{
+			SqlStmt: fill,
+			Script: fmt.Sprintf(
+				"create or replace function %s() returns trigger language plpgsql as $$\nbegin\n"+
+					"\tnew.%s := (select %s from (select new.*) as row_value);\n\treturn new;\nend\n$$",
+				function, (&sqt.Literal{Text: column}).String(), value,
+			),
+		},
+		&scriptStmt{
+			SqlStmt: fill,
+			Script:  fmt.Sprintf("create trigger %s before insert or update on %s for each row execute procedure %s()", name, target, function),
+		},
+	}
+	drop = []sqt.SqlStmt{
+		&scriptStmt{
+			SqlStmt: fill,
+			Script:  fmt.Sprintf("drop trigger if exists %s on %s", name, target),
+		},
+		&scriptStmt{
+			SqlStmt: fill,
+			Script:  fmt.Sprintf("drop function if exists %s()", function),
+		},
+	}
+	return
+}
+
+// isInPlaceTypeChange returns true if postgres changes the type of the column without rewriting the table
+func isInPlaceTypeChange(old, new TypeBase) bool {
+	oldType, newType := canonicalTypeName(old.Type), canonicalTypeName(new.Type)
+	if old.IsArray != new.IsArray {
+		return false
+	}
+	if oldType != newType {
+		return oldType == "varchar" && newType == "text"
+	}
+	if oldType == "char" || !isWideningTypeChange(old, new) {
+		return false
+	}
+	// the change of the scale rewrites numeric values
+	return (old.Precision == nil && new.Precision == nil) ||
+		(old.Precision != nil && new.Precision != nil && *old.Precision == *new.Precision)
+}
@@ -0,0 +1,204 @@
+package dragonfly
+
+import (
+	"github.com/iv-menshenin/dragonfly/utils"
+	"strings"
+	"testing"
+)
+
+func Test_isInPlaceTypeChange(t *testing.T) {
+	var (
+		two    = 2
+		three  = 3
+		ten    = 10
+		twenty = 20
+	)
+	tests := []struct {
+		name string
+		old  TypeBase
+		new  TypeBase
+		want bool
+	}{
+		{
+			name: "longer varchar",
+			old:  TypeBase{Type: "varchar", Length: &ten},
+			new:  TypeBase{Type: "character varying", Length: &twenty},
+			want: true,
+		},
+		{
+			name: "varchar to text",
+			old:  TypeBase{Type: "varchar", Length: &ten},
+			new:  TypeBase{Type: "text"},
+			want: true,
+		},
+		{
+			name: "longer char",
+			old:  TypeBase{Type: "char", Length: &ten},
+			new:  TypeBase{Type: "char", Length: &twenty},
+			want: false,
+		},
+		{
+			name: "int4 to int8",
+			old:  TypeBase{Type: "int4"},
+			new:  TypeBase{Type: "int8"},
+			want: false,
+		},
+		{
+			name: "numeric precision",
+			old:  TypeBase{Type: "numeric", Length: &ten, Precision: &two},
+			new:  TypeBase{Type: "numeric", Length: &twenty, Precision: &two},
+			want: true,
+		},
+		{
+			name: "numeric scale",
+			old:  TypeBase{Type: "numeric", Length: &ten, Precision: &two},
+			new:  TypeBase{Type: "numeric", Length: &twenty, Precision: &three},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isInPlaceTypeChange(tt.old, tt.new); got != tt.want {
+				t.Errorf("isInPlaceTypeChange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_onlineMigration_makeColumnAdd(t *testing.T) {
+	var (
+		online = (&onlineMigration{batchSize: 100}).forTable(nil, Table{
+			Columns: ColumnsContainer{
+				{Value: Column{
+					Name:        "id",
+					Schema:      ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "bigserial"}, NotNull: true}},
+					Constraints: []Constraint{{Name: "pk_test", Type: ConstraintPrimaryKey}},
+				}},
+			},
+		})
+		column = ColumnRef{Value: Column{
+			Name:   "status",
+			Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "int2"}, NotNull: true, Default: 1}},
+		}}
+		want = []string{
+			"alter table public.test add column status int2",
+			"alter table public.test alter column status set default 1",
+			"do $$",
+			"alter table public.test add constraint test_status_not_null check (status is not null) not valid",
+			"alter table public.test validate constraint test_status_not_null",
+			"alter table public.test alter column status set not null",
+			"alter table public.test drop constraint if exists test_status_not_null",
+		}
+	)
+	got := online.makeColumnAdd("public", "test", column)
+	if len(got) != len(want) {
+		t.Fatalf("makeColumnAdd() returned %d statements, want %d: %v", len(got), len(want), got)
+	}
+	for i, stmt := range got {
+		if sql := stmt.String(); !strings.HasPrefix(sql, want[i]) {
+			t.Errorf("makeColumnAdd() statement #%d = %s, want %s", i, sql, want[i])
+		}
+		if class := classifyStatement(stmt); class != StatementSafe {
+			t.Errorf("makeColumnAdd() statement #%d is %s, want safe", i, class)
+		}
+	}
+	backfill := got[2].String()
+	for _, part := range []string{
+		"_last_id int8;",
+		"select id from public.test where (id) > (_last_id) order by id limit 100",
+		"update public.test set status = 1 from batch where (public.test.id) = (batch.batch_id) and public.test.status is null",
+		"commit;",
+	} {
+		if !strings.Contains(backfill, part) {
+			t.Errorf("makeColumnAdd() backfill does not contain `%s`:\n%s", part, backfill)
+		}
+	}
+}
+
+func Test_onlineMigration_makeConstraintAdd(t *testing.T) {
+	var online = (&onlineMigration{batchSize: 100}).forTable(nil, Table{})
+	if len(online.key) != 1 || online.key[0].Name != rowIdentifier {
+		t.Errorf("forTable() key = %v, want %s for the table without primary key", online.key, rowIdentifier)
+	}
+	tests := []struct {
+		name       string
+		constraint ConstraintSchema
+		want       []string
+	}{
+		{
+			name: "unique",
+			constraint: ConstraintSchema{
+				Columns:    []string{"code", "region"},
+				Constraint: Constraint{Name: "uq_test", Type: ConstraintUniqueKey},
+			},
+			want: []string{
+				"create unique index concurrently if not exists uq_test on public.test (code, region)",
+				"alter table public.test add constraint uq_test unique using index uq_test",
+			},
+		},
+		{
+			name: "check",
+			constraint: ConstraintSchema{
+				Columns:    []string{"amount"},
+				Constraint: Constraint{Name: "chk_amount", Type: ConstraintCheck, Parameters: ConstraintParameters{Parameter: Check{Expression: "amount > 0"}}},
+			},
+			want: []string{
+				"alter table public.test add constraint chk_amount check (amount > 0) not valid",
+				"alter table public.test validate constraint chk_amount",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := online.makeConstraintAdd("public", "test", tt.constraint)
+			if len(got) != len(tt.want) {
+				t.Fatalf("makeConstraintAdd() returned %d statements, want %d: %v", len(got), len(tt.want), got)
+			}
+			for i, stmt := range got {
+				if sql := stmt.String(); sql != tt.want[i] {
+					t.Errorf("makeConstraintAdd() statement #%d = %s, want %s", i, sql, tt.want[i])
+				}
+				if class := classifyStatement(stmt); class != StatementSafe {
+					t.Errorf("makeConstraintAdd() statement #%d is %s, want safe", i, class)
+				}
+			}
+		})
+	}
+}
+
+func Test_onlineMigration_makeBackfill_key(t *testing.T) {
+	var current = &Root{Schemas: Schemas{{Value: Schema{
+		Name: "app",
+		Domains: DomainsContainer{
+			"user_id": {TypeBase: TypeBase{Type: "int8"}, NotNull: true},
+		},
+	}}}}
+	var online = (&onlineMigration{batchSize: 100}).forTable(current, Table{
+		Columns: ColumnsContainer{
+			{Value: Column{
+				Name:   "UserId",
+				Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "app.user_id"}}},
+			}},
+			{Value: Column{
+				Name:   "user-id",
+				Schema: ColumnSchemaRef{Ref: utils.RefString("#/schemas/app/domains/user_id")},
+			}},
+		},
+		Constraints: TableConstraints{{
+			Columns:    []string{"UserId", "user-id"},
+			Constraint: Constraint{Name: "pk_test", Type: ConstraintPrimaryKey},
+		}},
+	})
+	backfill := online.makeBackfill("public", "test", "status", "1").String()
+	for _, part := range []string{
+		"_last_userid int8;",
+		"_last_user_id int8;",
+		"with batch (batch_userid, batch_user_id) as (",
+		"select batch_userid, batch_user_id into _last_userid, _last_user_id from batch",
+		`select "UserId", "user-id" from public.test where ("UserId", "user-id") > (_last_userid, _last_user_id)`,
+	} {
+		if !strings.Contains(backfill, part) {
+			t.Errorf("makeBackfill() does not contain `%s`:\n%s", part, backfill)
+		}
+	}
+}
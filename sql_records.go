@@ -0,0 +1,292 @@
+package dragonfly
+
+import (
+	"fmt"
+	"github.com/iv-menshenin/dragonfly/utils"
+	sqt "github.com/iv-menshenin/sql-ast"
+	"go/token"
+	"strings"
+)
+
+const (
+	recordTempSuffix = "__tmp"
+)
+
+type (
+	// recordAttribute is the attribute of the new composite type along with its previous data type
+	recordAttribute struct {
+		name    string
+		oldType TypeBase
+		newType TypeBase
+		// the attribute did not exist before the migration
+		added bool
+	}
+)
+
+func recordAttributeType(field ColumnRef) TypeBase {
+	if typeSchema, typeName, ok := field.Value.Schema.makeCustomType(); ok {
+		return TypeBase{
+			Type:    fmt.Sprintf("%s.%s", typeSchema, typeName),
+			IsArray: field.Value.Schema.Value.IsArray,
+		}
+	}
+	return field.Value.Schema.Value.TypeBase
+}
+
+// compareRecords returns the attributes of the new type in their order along with the names of dropped attributes
+func compareRecords(old, new ColumnsContainer) (attributes []recordAttribute, dropped []string) {
+	for _, field := range new {
+		var attribute = recordAttribute{
+			name:    field.Value.Name,
+			newType: recordAttributeType(field),
+		}
+		if oldField, ok := old.tryToFind(field.Value.Name); ok {
+			attribute.oldType = recordAttributeType(*oldField)
+		} else {
+			attribute.added = true
+		}
+		attributes = append(attributes, attribute)
+	}
+	for _, field := range old {
+		if !new.exists(field.Value.Name) {
+			dropped = append(dropped, field.Value.Name)
+		}
+	}
+	return
+}
+
+func (c recordAttribute) isChanged() bool {
+	return c.added || !isMatchedTypes(c.oldType, c.newType)
+}
+
+// makeRecordChanges adds, drops and alters attributes of the composite type. The type that is used by columns cannot be
+// altered, so the values of these columns are moved to the temporary columns of the copy of the old type
+// and are converted back after the type is altered
+func (c TypeComparator) makeRecordChanges(current *Root) []sqt.SqlStmt {
+	var (
+		result              = make([]sqt.SqlStmt, 0)
+		attributes, dropped = compareRecords(c.TypeStruct.OldStructure.Fields, c.TypeStruct.NewStructure.Fields)
+	)
+	for _, name := range dropped {
+		// the data of the attribute is lost
+		result = append(result, c.describe(ActionAlter, markStatement(makeTypeAlter(c.Schema.New, c.Name.New, fmt.Sprintf(
+			"drop attribute if exists %s", name,
+		)), StatementDestructive)))
+	}
+	for _, attribute := range attributes {
+		if !attribute.isChanged() {
+			continue
+		}
+		if attribute.added {
+			result = append(result, c.describe(ActionAlter, makeTypeAlter(c.Schema.New, c.Name.New, fmt.Sprintf(
+				"add attribute %s %s", attribute.name, makeAttributeDataType(attribute.newType),
+			))))
+			continue
+		}
+		alter := makeTypeAlterAttributeDataType(c.Schema.New, c.Name.New, attribute.name, attribute.newType)
+		if !isWideningTypeChange(attribute.oldType, attribute.newType) {
+			alter = markStatement(alter, StatementDestructive)
+		}
+		result = append(result, c.describe(ActionAlter, alter))
+	}
+	if len(result) == 0 {
+		return result
+	}
+	if usages := current.getDomainUsages(c.Schema.Actual, c.Name.Actual); len(usages) > 0 {
+		return c.makeRecordRewrite(current, usages, attributes, result)
+	}
+	return result
+}
+
+func makeAttributeDataType(typeBase TypeBase) *sqt.DataTypeExpr {
+	return &sqt.DataTypeExpr{
+		DataType:  typeBase.Type,
+		IsArray:   typeBase.IsArray,
+		Length:    typeBase.Length,
+		Precision: typeBase.Precision,
+		Collation: typeBase.Collate,
+	}
+}
+
+// makeRecordRewrite wraps the altering of the type with the moving of column values to the temporary columns and back.
+// The recreated columns get their default, not null, constraints and indices back, but they are placed at the end of the table
+func (c TypeComparator) makeRecordRewrite(
+	current *Root,
+	usages []ColumnFullName,
+	attributes []recordAttribute,
+	alter []sqt.SqlStmt,
+) []sqt.SqlStmt {
+	var (
+		tempName   = makeSuffixedName(c.Name.New, recordTempSuffix)
+		tempType   = fmt.Sprintf("%s.%s", c.Schema.New, tempName)
+		newType    = fmt.Sprintf("%s.%s", c.Schema.New, c.Name.New)
+		oldFields  = make([]string, 0, len(c.TypeStruct.OldStructure.Fields))
+		moveOut    = make([]sqt.SqlStmt, 0)
+		moveIn     = make([]sqt.SqlStmt, 0)
+		tempStruct = *c.TypeStruct.OldStructure
+	)
+	for _, field := range c.TypeStruct.OldStructure.Fields {
+		oldFields = append(oldFields, field.Value.Name)
+	}
+	for _, usage := range usages {
+		column, ok := current.findColumn(usage)
+		if !ok {
+			continue
+		}
+		var (
+			columnType = column.Value.Schema.Value
+			tempColumn = makeSuffixedName(usage.ColumnName, recordTempSuffix)
+			copyValues = func(value string) []string {
+				var values = make([]string, 0, len(oldFields))
+				for _, field := range oldFields {
+					values = append(values, fmt.Sprintf("(%s).%s", value, field))
+				}
+				return values
+			}
+			convertValues = func(value string) []string {
+				var values = make([]string, 0, len(attributes))
+				for _, attribute := range attributes {
+					values = append(values, makeAttributeConversion(value, attribute))
+				}
+				return values
+			}
+		)
+		moveOut = append(
+			moveOut,
+			makeColumnAdd(usage.TableSchema, usage.TableName, makeRecordColumn(tempColumn, tempType, columnType.IsArray)),
+			makeRecordUpdate(usage.TableSchema, usage.TableName, tempColumn, usage.ColumnName, makeRecordConversion(usage.ColumnName, tempType, columnType.IsArray, copyValues)),
+			markPreserved(makeColumnDropStmt(usage.TableSchema, usage.TableName, usage.ColumnName, false, false)),
+		)
+		moveIn = append(
+			moveIn,
+			makeColumnAdd(usage.TableSchema, usage.TableName, makeRecordColumn(usage.ColumnName, newType, columnType.IsArray)),
+			makeRecordUpdate(usage.TableSchema, usage.TableName, usage.ColumnName, tempColumn, makeRecordConversion(tempColumn, newType, columnType.IsArray, convertValues)),
+			markPreserved(makeColumnDropStmt(usage.TableSchema, usage.TableName, tempColumn, false, false)),
+		)
+		if columnType.Default != nil {
+			moveIn = append(moveIn, makeAlterColumnSetDefault(usage.TableSchema, usage.TableName, usage.ColumnName, columnType.Default))
+		}
+		if columnType.NotNull {
+			moveIn = append(moveIn, makeAlterColumnSetNotNull(usage.TableSchema, usage.TableName, usage.ColumnName, true))
+		}
+		moveIn = append(moveIn, restoreColumnKeys(current, usage)...)
+	}
+	var result = make([]sqt.SqlStmt, 0, len(moveOut)+len(alter)+len(moveIn)+2)
+	result = append(result, c.describe(ActionAlter, makeType(c.Schema.New, tempName, tempStruct)))
+	for _, stmt := range moveOut {
+		result = append(result, c.describe(ActionAlter, stmt))
+	}
+	result = append(result, alter...)
+	for _, stmt := range moveIn {
+		result = append(result, c.describe(ActionAlter, stmt))
+	}
+	return append(result, c.describe(ActionAlter, markPreserved(makeTypeDrop(c.Schema.New, tempName))))
+}
+
+// restoreColumnKeys makes the constraints and the indices that involve the column, they are dropped along with the column
+func restoreColumnKeys(current *Root, usage ColumnFullName) []sqt.SqlStmt {
+	var result = make([]sqt.SqlStmt, 0)
+	schema, ok := current.Schemas.tryToFind(usage.TableSchema)
+	if !ok {
+		return result
+	}
+	table, ok := schema.Value.Tables.tryToFind(usage.TableName)
+	if !ok {
+		return result
+	}
+	for _, constraint := range table.getAllConstraints() {
+		if !utils.ArrayContainsCI(constraint.Columns, usage.ColumnName) {
+			continue
+		}
+		result = append(result, &sqt.AlterStmt{
+			Target: sqt.TargetTable,
+			Name: &sqt.Selector{
+				Name:      usage.TableName,
+				Container: usage.TableSchema,
+			},
+			Alter: makeAddConstraintExpr(constraint),
+		})
+	}
+	for _, index := range table.Indices {
+		if utils.ArrayContainsCI(index.Columns, usage.ColumnName) {
+			result = append(result, scriptStatement(makeIndexCreate(usage.TableSchema, usage.TableName, index), Change{}, StatementBlocking))
+		}
+	}
+	return result
+}
+
+func makeIndexCreate(schema, table string, index Index) string {
+	var parts = []string{"create"}
+	if index.IndexType == IndexTypeUnique {
+		parts = append(parts, "unique")
+	}
+	parts = append(parts, "index", index.Name, "on", fmt.Sprintf("%s.%s (%s)", schema, table, strings.Join(index.Columns, ", ")))
+	if parameters := index.Storage.parameters(); len(parameters) > 0 {
+		var with = make([]string, 0, len(parameters))
+		for _, name := range sortedKeys(parameters) {
+			with = append(with, fmt.Sprintf("%s = %s", name, parameters[name]))
+		}
+		parts = append(parts, fmt.Sprintf("with (%s)", strings.Join(with, ", ")))
+	}
+	if tablespace := index.Storage.getTablespace(); tablespace != "" {
+		parts = append(parts, "tablespace", tablespace)
+	}
+	if index.Where != "" {
+		parts = append(parts, "where", index.Where)
+	}
+	return strings.Join(parts, " ")
+}
+
+func makeRecordColumn(name, typeName string, isArray bool) ColumnRef {
+	return ColumnRef{
+		Value: Column{
+			Name: name,
+			Schema: ColumnSchemaRef{
+				Value: DomainSchema{TypeBase: TypeBase{Type: typeName, IsArray: isArray}},
+			},
+		},
+	}
+}
+
+// makeAttributeConversion returns the expression of the new attribute value taken from the temporary column
+func makeAttributeConversion(column string, attribute recordAttribute) string {
+	if attribute.added {
+		return "null"
+	}
+	var value = fmt.Sprintf("(%s).%s", column, attribute.name)
+	if !attribute.isChanged() {
+		return value
+	}
+	if using, ok := makeColumnTypeCast(value, attribute.oldType, attribute.newType); ok && using != "" {
+		return using
+	}
+	return makeCastType(value, attribute.newType)
+}
+
+// makeRecordConversion makes the value of the new type from the attributes of the old one, arrays are converted element by element
+func makeRecordConversion(column, typeName string, isArray bool, values func(string) []string) string {
+	if isArray {
+		return fmt.Sprintf("array(select row(%s)::%s from unnest(%s) as v)::%s[]", strings.Join(values("v"), ", "), typeName, column, typeName)
+	}
+	return fmt.Sprintf("row(%s)::%s", strings.Join(values(column), ", "), typeName)
+}
+
+func makeRecordUpdate(schema, table, column, source, value string) sqt.SqlStmt {
+	return &sqt.UpdateStmt{
+		Table: sqt.TableDesc{
+			Table: &sqt.Selector{
+				Name:      table,
+				Container: schema,
+			},
+		},
+		Set: []sqt.SqlExpr{
+			&sqt.BinaryExpr{
+				Left:  &sqt.Literal{Text: column},
+				Right: &sqt.Literal{Text: value},
+				Op:    token.ASSIGN,
+			},
+		},
+		// the record with any null attribute is not `is not null`, but it must be copied too
+		Where: &sqt.Literal{Text: fmt.Sprintf("%s is distinct from null", source)},
+	}
+}
@@ -0,0 +1,157 @@
+package dragonfly
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_compareRecords(t *testing.T) {
+	var makeFields = func(fields ...string) ColumnsContainer {
+		var result = make(ColumnsContainer, 0, len(fields)/2)
+		for i := 0; i < len(fields); i += 2 {
+			result = append(result, ColumnRef{Value: Column{
+				Name:   fields[i],
+				Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: fields[i+1]}}},
+			}})
+		}
+		return result
+	}
+	tests := []struct {
+		name           string
+		old            ColumnsContainer
+		new            ColumnsContainer
+		wantAttributes []recordAttribute
+		wantDropped    []string
+	}{
+		{
+			name: "added attribute",
+			old:  makeFields("lat", "int4"),
+			new:  makeFields("lat", "int4", "lng", "int4"),
+			wantAttributes: []recordAttribute{
+				{name: "lat", oldType: TypeBase{Type: "int4"}, newType: TypeBase{Type: "int4"}},
+				{name: "lng", newType: TypeBase{Type: "int4"}, added: true},
+			},
+		},
+		{
+			name: "dropped and changed attributes",
+			old:  makeFields("lat", "int4", "alt", "int4"),
+			new:  makeFields("lat", "float8"),
+			wantAttributes: []recordAttribute{
+				{name: "lat", oldType: TypeBase{Type: "int4"}, newType: TypeBase{Type: "float8"}},
+			},
+			wantDropped: []string{"alt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotAttributes, gotDropped := compareRecords(tt.old, tt.new)
+			if !reflect.DeepEqual(gotAttributes, tt.wantAttributes) {
+				t.Errorf("compareRecords() attributes = %+v, want %+v", gotAttributes, tt.wantAttributes)
+			}
+			if !reflect.DeepEqual(gotDropped, tt.wantDropped) {
+				t.Errorf("compareRecords() dropped = %+v, want %+v", gotDropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func Test_makeRecordConversion(t *testing.T) {
+	var attributes = []recordAttribute{
+		{name: "lat", oldType: TypeBase{Type: "varchar"}, newType: TypeBase{Type: "float8"}},
+		{name: "lng", oldType: TypeBase{Type: "int4"}, newType: TypeBase{Type: "int4"}},
+		{name: "label", newType: TypeBase{Type: "text"}, added: true},
+	}
+	var values = func(value string) []string {
+		var result = make([]string, 0, len(attributes))
+		for _, attribute := range attributes {
+			result = append(result, makeAttributeConversion(value, attribute))
+		}
+		return result
+	}
+	tests := []struct {
+		name    string
+		isArray bool
+		want    string
+	}{
+		{
+			name: "scalar",
+			want: "row((pos__tmp).lat::float8, (pos__tmp).lng, null)::geo.point",
+		},
+		{
+			name:    "array",
+			isArray: true,
+			want:    "array(select row((v).lat::float8, (v).lng, null)::geo.point from unnest(pos__tmp) as v)::geo.point[]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := makeRecordConversion("pos__tmp", "geo.point", tt.isArray, values); got != tt.want {
+				t.Errorf("makeRecordConversion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_makeRecordUpdate(t *testing.T) {
+	got := makeRecordUpdate("geo", "places", "point__tmp", "point", "point").String()
+	if want := "where point is distinct from null"; !strings.HasSuffix(got, want) {
+		t.Errorf("makeRecordUpdate() = %q, want the rows with null attributes to be copied: %q", got, want)
+	}
+}
+
+func TestTypeComparator_makeRecordRewrite(t *testing.T) {
+	const project = `
+schemas:
+  - name: geo
+    types:
+      position:
+        type: record
+        fields:
+          - name: lat
+            schema: { type: int4 }%s
+    tables:
+      places:
+        columns:
+          - name: id
+            schema: { type: int8 }
+          - name: pos
+            schema: { type: geo.position, not_null: true }
+            constraints:
+              - name: uq_places_pos
+                type: unique
+        indices:
+          - name: ix_places_pos
+            type: index
+            columns: [id, pos]
+            where: id > 0
+`
+	actual, err := readProjectSnapshot([]byte(fmt.Sprintf(project, "")))
+	if err != nil {
+		t.Fatalf("readProjectSnapshot() error = %v", err)
+	}
+	root, err := readProjectSnapshot([]byte(fmt.Sprintf(project, "\n          - name: lng\n            schema: { type: int4 }")))
+	if err != nil {
+		t.Fatalf("readProjectSnapshot() error = %v", err)
+	}
+	diff := MakeDiff(actual, root)
+	ResolveDependencies(&diff)
+	var got = make([]string, 0)
+	for _, stmt := range diff.allStatements() {
+		got = append(got, stmt.String())
+	}
+	// the constraints and the indices are dropped along with the column, they are made again after its values are restored
+	want := []string{
+		"alter table geo.places add column pos geo.position",
+		"update geo.places  set pos = row((pos__tmp).lat, null)::geo.position where pos__tmp is distinct from null",
+		"alter table geo.places drop column pos__tmp",
+		"alter table geo.places alter column pos set not null",
+		"alter table geo.places add constraint uq_places_pos unique ( pos )",
+		"create index ix_places_pos on geo.places (id, pos) where id > 0",
+		"drop type geo.position__tmp",
+	}
+	if len(got) < len(want) || !reflect.DeepEqual(got[len(got)-len(want):], want) {
+		t.Errorf("makeRecordRewrite() got:\n%s\nwant the end:\n%s", strings.Join(got, ";\n"), strings.Join(want, ";\n"))
+	}
+}
@@ -1,48 +1,317 @@
 package dragonfly
 
 import (
+	"fmt"
 	sqt "github.com/iv-menshenin/sql-ast"
-	"sort"
+	"strings"
 )
 
-type sqlDepended []sqt.SqlStmt
+type (
+	// sqlDepended is the graph of statements, each node refers to the statements it depends on
+	sqlDepended struct {
+		heap  []sqt.SqlStmt
+		edges [][]int
+	}
+)
+
+// fixTheOrderOf sorts statements topologically: the objects are created before they are used.
+// Statements that do not depend on each other keep the order in which the comparator made them.
+// If the statements depend on each other cyclically, foreign keys of the created tables are extracted
+// into separate statements which are executed after all the tables are created
+func fixTheOrderOf(heap []sqt.SqlStmt) []sqt.SqlStmt {
+	for {
+		graph := makeDependencyGraph(heap)
+		ordered, cycle := graph.sort()
+		if len(cycle) == 0 {
+			return ordered
+		}
+		var deferred bool
+		if heap, deferred = deferForeignKeys(heap, cycle); !deferred {
+			// nothing to break, so we have to keep the order of the comparator
+			return append(ordered, cycle...)
+		}
+	}
+}
+
+func makeDependencyGraph(heap []sqt.SqlStmt) sqlDepended {
+	var (
+		graph = sqlDepended{
+			heap:  heap,
+			edges: make([][]int, len(heap)),
+		}
+		resolved = make([]sqt.Dependencies, len(heap))
+	)
+	for i, stmt := range heap {
+		resolved[i] = resolvedBy(stmt)
+	}
+	for i, stmt := range heap {
+		for _, dep := range dependenciesOf(stmt) {
+			for j := range heap {
+				if i != j && containsObject(resolved[j], dep) && !containsIndex(graph.edges[i], j) {
+					graph.edges[i] = append(graph.edges[i], j)
+				}
+			}
+		}
+	}
+	return graph
+}
+
+// sort returns statements in topological order and all the statements that cannot be ordered because of a cycle
+func (c sqlDepended) sort() (ordered []sqt.SqlStmt, cycle []sqt.SqlStmt) {
+	var (
+		done   = make([]bool, len(c.heap))
+		result = make([]sqt.SqlStmt, 0, len(c.heap))
+	)
+	for len(result) < len(c.heap) {
+		var next = -1
+		for i := range c.heap {
+			if !done[i] && c.isReady(i, done) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+		done[next] = true
+		result = append(result, c.heap[next])
+	}
+	for i, stmt := range c.heap {
+		if !done[i] {
+			cycle = append(cycle, stmt)
+		}
+	}
+	return result, cycle
+}
+
+func (c sqlDepended) isReady(i int, done []bool) bool {
+	for _, j := range c.edges[i] {
+		if !done[j] {
+			return false
+		}
+	}
+	return true
+}
+
+func unwrapStatement(stmt sqt.SqlStmt) sqt.SqlStmt {
+	if m, ok := stmt.(*migrationStmt); ok {
+		return m.SqlStmt
+	}
+	return stmt
+}
+
+// resolvedBy returns objects that appear after the statement is executed,
+// altering of an object does not resolve the object itself, only its new fields and constraints, or its new name
+func resolvedBy(stmt sqt.SqlStmt) sqt.Dependencies {
+	switch s := unwrapStatement(stmt).(type) {
+	case *sqt.CreateStmt:
+		return sqt.ExploreResolved(stmt)
+	case *sqt.AlterStmt:
+		var result = make(sqt.Dependencies, 0)
+		if rename, ok := s.Alter.(*sqt.SqlRename); ok && rename.Target == sqt.TargetNone {
+			if s.Target == sqt.TargetSchema {
+				result = append(result, sqt.NamedObject{Schema: rename.NewName.GetName()})
+			} else {
+				result = append(result, sqt.NamedObject{Schema: identToObject(s.Name).Schema, Object: rename.NewName.GetName()})
+			}
+		}
+		for _, obj := range sqt.ExploreResolved(stmt) {
+			if obj.Field != "" {
+				result = append(result, obj)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// dependenciesOf returns objects that must exist before the statement is executed:
+// the objects it refers to, the object it changes and the schemas of created objects
+func dependenciesOf(stmt sqt.SqlStmt) sqt.Dependencies {
+	var result = append(make(sqt.Dependencies, 0), sqt.ExploreDependencies(stmt)...)
+	switch s := unwrapStatement(stmt).(type) {
+	case *sqt.InsertStmt:
+		// the library does not split the table name of an inserting statement
+		result = append(make(sqt.Dependencies, 0), identToObject(s.Table.Table))
+	case *sqt.UpdateStmt:
+		result = append(result, identToObject(s.Table.Table))
+	case *sqt.AlterStmt:
+		if s.Target != sqt.TargetSchema {
+			result = append(result, identToObject(s.Name))
+		}
+	}
+	for _, obj := range sqt.ExploreResolved(stmt) {
+		if obj.Object != "" {
+			result = append(result, sqt.NamedObject{Schema: obj.Schema})
+		}
+	}
+	return result
+}
+
+func identToObject(ident sqt.SqlIdent) sqt.NamedObject {
+	if selector, ok := ident.(*sqt.Selector); ok {
+		return sqt.NamedObject{Schema: selector.Container, Object: selector.Name}
+	}
+	if name := strings.SplitN(ident.GetName(), ".", 2); len(name) > 1 {
+		return sqt.NamedObject{Schema: name[0], Object: name[1]}
+	}
+	return sqt.NamedObject{Object: ident.GetName()}
+}
 
-func (p sqlDepended) Len() int {
-	return len(p)
+func containsObject(objects sqt.Dependencies, obj sqt.NamedObject) bool {
+	for _, o := range objects {
+		if strings.EqualFold(o.Schema, obj.Schema) && strings.EqualFold(o.Object, obj.Object) && strings.EqualFold(o.Field, obj.Field) {
+			return true
+		}
+	}
+	return false
 }
 
-// TODO
-func (p sqlDepended) Less(i, j int) bool {
-	depI := sqt.ExploreDependencies(p[i])
-	depJ := sqt.ExploreDependencies(p[j])
-	resI := sqt.ExploreResolved(p[i])
-	resJ := sqt.ExploreResolved(p[j])
-	scoreI, scoreJ := 0, 0
-	for _, dep := range depI {
-		for _, res := range resJ {
-			if dep == res {
-				scoreJ++
+func containsIndex(indexes []int, index int) bool {
+	for _, i := range indexes {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+// deferForeignKeys extracts foreign keys that refer to the objects of the cycle from the first table of the cycle,
+// returns false if there is no such table
+func deferForeignKeys(heap, cycle []sqt.SqlStmt) ([]sqt.SqlStmt, bool) {
+	var cycleResolved = make(sqt.Dependencies, 0)
+	for _, stmt := range cycle {
+		cycleResolved = append(cycleResolved, resolvedBy(stmt)...)
+	}
+	for _, stmt := range cycle {
+		create, deferred := splitForeignKeys(stmt, func(fk *foreignKeyExpr) bool {
+			var target = identToObject(fk.ToTable)
+			target.Field = fk.ToColumn
+			return containsObject(cycleResolved, target)
+		})
+		if len(deferred) == 0 {
+			continue
+		}
+		var result = make([]sqt.SqlStmt, 0, len(heap)+len(deferred))
+		for _, s := range heap {
+			if s == stmt {
+				s = create
 			}
+			result = append(result, s)
 		}
+		return append(result, deferred...), true
+	}
+	return heap, false
+}
+
+// splitForeignKeys removes the matched foreign keys from the table creation statement
+// and returns them as separate `alter table add constraint` statements
+func splitForeignKeys(stmt sqt.SqlStmt, match func(*foreignKeyExpr) bool) (sqt.SqlStmt, []sqt.SqlStmt) {
+	create, ok := unwrapStatement(stmt).(*sqt.CreateStmt)
+	if !ok || create.Target != sqt.TargetTable {
+		return stmt, nil
+	}
+	body, ok := create.Create.(*sqt.TableBodyDescriber)
+	if !ok {
+		return stmt, nil
 	}
-	for _, dep := range depJ {
-		for _, res := range resI {
-			if dep == res {
-				scoreI++
+	var (
+		deferred = make([]sqt.SqlStmt, 0)
+		newBody  = sqt.TableBodyDescriber{
+			Fields:      make([]*sqt.SqlField, 0, len(body.Fields)),
+			Constraints: make([]sqt.ConstraintExpr, 0, len(body.Constraints)),
+		}
+		table = identToObject(create.Name)
+	)
+	for _, field := range body.Fields {
+		var newField = *field
+		newField.Constraints = make([]sqt.ConstraintExpr, 0, len(field.Constraints))
+		for _, constraint := range field.Constraints {
+			name, fk := extractForeignKey(constraint)
+			if fk == nil || !match(fk) {
+				newField.Constraints = append(newField.Constraints, constraint)
+				continue
+			}
+			if name == "" {
+				// postgres makes the same name for unnamed foreign keys
+				name = fmt.Sprintf("%s_%s_fkey", table.Object, field.Name.GetName())
 			}
+			var tableFK = *fk
+			tableFK.ConstraintForeignKeyExpr = new(sqt.ConstraintForeignKeyExpr)
+			*tableFK.ConstraintForeignKeyExpr = *fk.ConstraintForeignKeyExpr
+			tableFK.InColumn = false
+			deferred = append(deferred, makeDeferredForeignKey(create.Name, name, []string{field.Name.GetName()}, &tableFK))
 		}
+		newBody.Fields = append(newBody.Fields, &newField)
 	}
-	if scoreI == scoreJ {
-		return p[i].String() < p[j].String()
-	} else {
-		return scoreI > scoreJ
+	for _, constraint := range body.Constraints {
+		withColumns, ok := constraint.(*sqt.ConstraintWithColumns)
+		if !ok {
+			newBody.Constraints = append(newBody.Constraints, constraint)
+			continue
+		}
+		name, fk := extractForeignKey(withColumns.Constraint)
+		if fk == nil || !match(fk) {
+			newBody.Constraints = append(newBody.Constraints, constraint)
+			continue
+		}
+		if name == "" {
+			name = fmt.Sprintf("%s_%s_fkey", table.Object, strings.Join(withColumns.Columns, "_"))
+		}
+		deferred = append(deferred, makeDeferredForeignKey(create.Name, name, withColumns.Columns, fk))
+	}
+	if len(deferred) == 0 {
+		return stmt, nil
+	}
+	var newCreate = *create
+	newCreate.Create = &newBody
+	if m, ok := stmt.(*migrationStmt); ok {
+		var wrapped = *m
+		wrapped.SqlStmt = &newCreate
+		if m.change != nil {
+			// foreign keys are still a part of the table creation
+			for i := range deferred {
+				deferred[i] = describeStatement(deferred[i], *m.change)
+			}
+		}
+		return &wrapped, deferred
 	}
+	return &newCreate, deferred
 }
 
-func (p sqlDepended) Swap(i, j int) {
-	p[i], p[j] = p[j], p[i]
+func extractForeignKey(constraint sqt.ConstraintExpr) (string, *foreignKeyExpr) {
+	var (
+		name  string
+		inner sqt.ConstraintInterface
+	)
+	switch c := constraint.(type) {
+	case *sqt.NamedConstraintExpr:
+		name, inner = c.Name.GetName(), c.Constraint
+	case *sqt.UnnamedConstraintExpr:
+		inner = c.Constraint
+	default:
+		return "", nil
+	}
+	switch fk := inner.(type) {
+	case *foreignKeyExpr:
+		return name, fk
+	case *sqt.ConstraintForeignKeyExpr:
+		return name, &foreignKeyExpr{ConstraintForeignKeyExpr: fk}
+	}
+	return "", nil
 }
 
-func fixTheOrderOf(heap []sqt.SqlStmt) {
-	sort.Sort(sqlDepended(heap))
+func makeDeferredForeignKey(table sqt.SqlIdent, name string, columns []string, fk *foreignKeyExpr) sqt.SqlStmt {
+	return &sqt.AlterStmt{
+		Target: sqt.TargetTable,
+		Name:   table,
+		Alter: &sqt.AddExpr{
+			Target: sqt.TargetConstraint,
+			Name:   &sqt.Literal{Text: name},
+			Definition: &sqt.ConstraintWithColumns{
+				Columns:    columns,
+				Constraint: &sqt.UnnamedConstraintExpr{Constraint: fk},
+			},
+		},
+	}
 }
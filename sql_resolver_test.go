@@ -0,0 +1,73 @@
+package dragonfly
+
+import (
+	sqt "github.com/iv-menshenin/sql-ast"
+	"testing"
+)
+
+func Test_fixTheOrderOf(t *testing.T) {
+	var (
+		idColumn = ColumnRef{Value: Column{
+			Name:   "id",
+			Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "int8"}}},
+		}}
+		makeRefColumn = func(name, table string) ColumnRef {
+			return ColumnRef{Value: Column{
+				Name:   name,
+				Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "int8"}}},
+				Constraints: []Constraint{{
+					Name:       "fk_" + name,
+					Type:       ConstraintForeignKey,
+					Parameters: ConstraintParameters{Parameter: ForeignKey{ToTable: table, ToColumn: "id"}},
+				}},
+			}}
+		}
+		schema = &sqt.CreateStmt{Target: sqt.TargetSchema, Name: &sqt.Literal{Text: "test"}, IfNotX: true}
+		domain = makeDomain("test", "code", DomainSchema{TypeBase: TypeBase{Type: "varchar"}})
+		codes  = makeTableCreate("test", "codes", Table{Columns: ColumnsContainer{
+			idColumn,
+			{Value: Column{Name: "code", Schema: ColumnSchemaRef{Value: DomainSchema{TypeBase: TypeBase{Type: "test.code"}}}}},
+		}})
+		parents  = makeTableCreate("test", "parents", Table{Columns: ColumnsContainer{idColumn, makeRefColumn("child_id", "test.children")}})
+		children = makeTableCreate("test", "children", Table{Columns: ColumnsContainer{idColumn, makeRefColumn("parent_id", "test.parents")}})
+		items    = makeTableCreate("test", "items", Table{Columns: ColumnsContainer{idColumn, makeRefColumn("code_id", "test.codes")}})
+	)
+	tests := []struct {
+		name string
+		heap []sqt.SqlStmt
+		want []string
+	}{
+		{
+			name: "objects are created before they are used",
+			heap: []sqt.SqlStmt{items, codes, domain, schema},
+			want: []string{schema.String(), domain.String(), codes.String(), items.String()},
+		},
+		{
+			name: "independent statements keep their order",
+			heap: []sqt.SqlStmt{codes, schema, makeTableDrop("test", "b"), makeTableDrop("test", "a")},
+			want: []string{schema.String(), codes.String(), "drop table test.b", "drop table test.a"},
+		},
+		{
+			name: "cyclic foreign keys are deferred",
+			heap: []sqt.SqlStmt{parents, children},
+			want: []string{
+				"create table test.parents (\n\tid int8,\n\tchild_id int8\n)",
+				children.String(),
+				"alter table test.parents add constraint fk_child_id foreign key ( child_id ) references test.children (id) on update no action on delete no action",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fixTheOrderOf(tt.heap)
+			if len(got) != len(tt.want) {
+				t.Fatalf("fixTheOrderOf() got %d statements, want %d: %s", len(got), len(tt.want), got)
+			}
+			for i, stmt := range got {
+				if stmt.String() != tt.want[i] {
+					t.Errorf("fixTheOrderOf() got `%s`, want `%s`", stmt, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package dragonfly
+
+import (
+	"fmt"
+	"github.com/iv-menshenin/dragonfly/utils"
+	sqt "github.com/iv-menshenin/sql-ast"
+	"strings"
+)
+
+const (
+	// system schemas are never dropped
+	systemSchemaPrefix = "pg_"
+)
+
+var (
+	// the schemas of the database that are never dropped even if the project does not describe them
+	builtInSchemas = []string{"public", "information_schema"}
+)
+
+func (c SchemaRef) describe(action ChangeAction, stmt sqt.SqlStmt) sqt.SqlStmt {
+	var change = Change{
+		Kind:   ObjectSchema,
+		Schema: c.Value.Name,
+		Name:   c.Value.Name,
+		Action: action,
+	}
+	if action == ActionRename {
+		change.OldName = c.Value.OldName
+	}
+	return describeStatement(stmt, change)
+}
+
+// makeSchemaChanges creates new schemas, renames schemas that have the old name and changes their owners.
+// It returns the copy of the current structure with the renamed schemas, so their objects are compared as usual
+func makeSchemaChanges(current, new *Root) ([]sqt.SqlStmt, *Root) {
+	var (
+		result  = make([]sqt.SqlStmt, 0)
+		renamed = current
+	)
+	for _, schema := range new.Schemas {
+		actual, ok := current.Schemas.tryToFind(schema.Value.Name)
+		if !ok && schema.Value.OldName != "" {
+			if actual, ok = current.Schemas.tryToFind(schema.Value.OldName); ok {
+				result = append(result, schema.describe(ActionRename, makeSchemaRename(NameComparator{
+					Actual: actual.Value.Name,
+					New:    schema.Value.Name,
+				})))
+				if renamed == current {
+					renamed = copyRoot(current)
+				}
+				renamed.renameSchema(actual.Value.Name, schema.Value.Name)
+			}
+		}
+		if !ok {
+			result = append(result, schema.describe(ActionCreate, makeSchemaCreate(schema.Value.Name, schema.Value.Owner)))
+			continue
+		}
+		if schema.Value.Owner != "" && !strings.EqualFold(schema.Value.Owner, actual.Value.Owner) {
+			result = append(result, schema.describe(ActionAlter, makeSchemaOwner(schema.Value.Name, schema.Value.Owner)))
+		}
+	}
+	return result, renamed
+}
+
+// getRemovedSchemas returns the schemas of the current structure that are missing in the new one
+func getRemovedSchemas(current, new *Root) []string {
+	var result = make([]string, 0)
+	for _, schema := range current.Schemas {
+		if strings.HasPrefix(strings.ToLower(schema.Value.Name), systemSchemaPrefix) || utils.ArrayContainsCI(builtInSchemas, schema.Value.Name) {
+			continue
+		}
+		if _, ok := new.Schemas.tryToFind(schema.Value.Name); !ok {
+			result = append(result, schema.Value.Name)
+		}
+	}
+	return result
+}
+
+// renameSchema changes the name of the schema and all the references to its objects
+func (c *Root) renameSchema(oldName, newName string) {
+	var (
+		renameObject = func(name string) string {
+			if parts := strings.SplitN(name, ".", 2); len(parts) == 2 && strings.EqualFold(parts[0], oldName) {
+				return newName + "." + parts[1]
+			}
+			return name
+		}
+		oldPath      = fmt.Sprintf("#/%s/%s/", schemas, oldName)
+		renameColumn = func(column *Column) {
+			column.Schema.Value.Type = renameObject(column.Schema.Value.Type)
+			if ref := column.Schema.Ref; ref != nil && strings.HasPrefix(strings.ToLower(*ref), strings.ToLower(oldPath)) {
+				newRef := fmt.Sprintf("#/%s/%s/", schemas, newName) + (*ref)[len(oldPath):]
+				column.Schema.Ref = &newRef
+			}
+			for i, constraint := range column.Constraints {
+				if fk, ok := constraint.Parameters.Parameter.(ForeignKey); ok {
+					fk.ToTable = renameObject(fk.ToTable)
+					column.Constraints[i].Parameters.Parameter = fk
+				}
+			}
+		}
+	)
+	for i, schema := range c.Schemas {
+		if strings.EqualFold(schema.Value.Name, oldName) {
+			c.Schemas[i].Value.Name = newName
+		}
+		for _, customType := range schema.Value.Types {
+			for j := range customType.Fields {
+				renameColumn(&customType.Fields[j].Value)
+			}
+		}
+		for _, table := range schema.Value.Tables {
+			for j := range table.Columns {
+				renameColumn(&table.Columns[j].Value)
+			}
+			for j, constraint := range table.Constraints {
+				if fk, ok := constraint.Constraint.Parameters.Parameter.(ForeignKey); ok {
+					fk.ToTable = renameObject(fk.ToTable)
+					table.Constraints[j].Constraint.Parameters.Parameter = fk
+				}
+			}
+		}
+	}
+}
+
+// the removed schemas are dropped with all their objects
+func (c *Diff) dropRemovedSchemas() {
+	for _, schema := range c.removedSchemas {
+		c.afterInstall = append(c.afterInstall, describeStatement(makeSchemaDrop(schema), Change{
+			Kind:   ObjectSchema,
+			Schema: schema,
+			Name:   schema,
+			Action: ActionDrop,
+		}))
+	}
+	c.removedSchemas = nil
+}
@@ -0,0 +1,75 @@
+package dragonfly
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_makeSchemaChanges(t *testing.T) {
+	var makeRoot = func(schemas ...Schema) *Root {
+		var root = Root{Schemas: make(Schemas, 0, len(schemas))}
+		for _, schema := range schemas {
+			root.Schemas = append(root.Schemas, SchemaRef{Value: schema})
+		}
+		return &root
+	}
+	tests := []struct {
+		name        string
+		current     *Root
+		new         *Root
+		want        []string
+		wantRemoved []string
+	}{
+		{
+			name:    "new schema",
+			current: makeRoot(Schema{Name: "public"}),
+			new:     makeRoot(Schema{Name: "public"}, Schema{Name: "shop", Owner: "admin"}),
+			want:    []string{"create schema if not exists shop authorization admin"},
+		},
+		{
+			name:    "renamed schema",
+			current: makeRoot(Schema{Name: "shop", Owner: "admin"}),
+			new:     makeRoot(Schema{Name: "store", OldName: "shop", Owner: "admin"}),
+			want:    []string{"alter schema shop rename to store"},
+		},
+		{
+			name:    "changed owner",
+			current: makeRoot(Schema{Name: "shop", Owner: "postgres"}),
+			new:     makeRoot(Schema{Name: "shop", Owner: "admin"}),
+			want:    []string{"alter schema shop owner to admin"},
+		},
+		{
+			name:        "removed schema",
+			current:     makeRoot(Schema{Name: "shop"}, Schema{Name: "legacy"}, Schema{Name: "pg_toast"}, Schema{Name: "public"}, Schema{Name: "information_schema"}),
+			new:         makeRoot(Schema{Name: "shop"}),
+			want:        []string{},
+			wantRemoved: []string{"legacy"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				got       = make([]string, 0)
+				nameOf    = func(root *Root) string { return root.Schemas[0].Value.Name }
+				firstName = nameOf(tt.current)
+			)
+			stmts, current := makeSchemaChanges(tt.current, tt.new)
+			if name := nameOf(tt.current); name != firstName {
+				t.Errorf("makeSchemaChanges() renamed the schema %s of the current structure to %s", firstName, name)
+			}
+			for _, stmt := range stmts {
+				got = append(got, stmt.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("makeSchemaChanges() = %v, want %v", got, tt.want)
+			}
+			var wantRemoved = tt.wantRemoved
+			if wantRemoved == nil {
+				wantRemoved = []string{}
+			}
+			if removed := getRemovedSchemas(current, tt.new); !reflect.DeepEqual(removed, wantRemoved) {
+				t.Errorf("getRemovedSchemas() = %v, want %v", removed, wantRemoved)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package dragonfly
+
+import (
+	"fmt"
+	sqt "github.com/iv-menshenin/sql-ast"
+	"path"
+	"strings"
+)
+
+var (
+	// the kinds of the objects that can be selected by the scope
+	scopeKinds = []ObjectKind{
+		ObjectSchema, ObjectDomain, ObjectType, ObjectTable, ObjectColumn, ObjectConstraint, ObjectIndex, ObjectRow, ObjectHook,
+	}
+)
+
+// checkPatterns returns an error if any of the patterns is malformed, the subject is used in the message
+func checkPatterns(subject string, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(strings.ToLower(pattern), ""); err != nil {
+			return fmt.Errorf("wrong %s pattern '%s': %v", subject, pattern, err)
+		}
+	}
+	return nil
+}
+
+// the patterns are checked by Validate, the panic means that the scope is used without checking
+func isPatternMatched(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+		if err != nil {
+			panic(fmt.Sprintf("wrong scope pattern '%s': %v", pattern, err))
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Filter) matches(name string) bool {
+	if len(c.Include) > 0 && !isPatternMatched(c.Include, name) {
+		return false
+	}
+	return !isPatternMatched(c.Exclude, name)
+}
+
+func (c Filter) check(subject string) error {
+	if err := checkPatterns(subject, c.Include); err != nil {
+		return err
+	}
+	return checkPatterns(subject, c.Exclude)
+}
+
+// Validate returns an error if any of the patterns is malformed or does not match any kind of the objects
+func (c *Scope) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if err := c.Schemas.check("schema"); err != nil {
+		return err
+	}
+	if err := c.Tables.check("table"); err != nil {
+		return err
+	}
+	if err := c.Kinds.check("kind"); err != nil {
+		return err
+	}
+	for _, pattern := range append(append([]string{}, c.Kinds.Include...), c.Kinds.Exclude...) {
+		var known bool
+		for _, kind := range scopeKinds {
+			known = known || isPatternMatched([]string{pattern}, string(kind))
+		}
+		if !known {
+			return fmt.Errorf("unknown kind '%s', expected one of: %s", pattern, joinKinds(scopeKinds))
+		}
+	}
+	return nil
+}
+
+func joinKinds(kinds []ObjectKind) string {
+	var names = make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		names = append(names, string(kind))
+	}
+	return strings.Join(names, ", ")
+}
+
+func (c Filter) merge(other Filter) Filter {
+	var result = Filter{
+		Include: c.Include,
+		Exclude: append(append([]string{}, c.Exclude...), other.Exclude...),
+	}
+	if len(other.Include) > 0 {
+		result.Include = other.Include
+	}
+	return result
+}
+
+// Merge overrides the scope of the project by the scope of the command line:
+// the include patterns replace the patterns of the project, the exclude patterns are added to them
+func (c *Scope) Merge(other *Scope) *Scope {
+	switch {
+	case c == nil:
+		return other
+	case other == nil:
+		return c
+	}
+	return &Scope{
+		Schemas: c.Schemas.merge(other.Schemas),
+		Tables:  c.Tables.merge(other.Tables),
+		Kinds:   c.Kinds.merge(other.Kinds),
+	}
+}
+
+func (c *Scope) hasSchema(schemaName string) bool {
+	return c == nil || c.Schemas.matches(schemaName)
+}
+
+func (c *Scope) hasTable(schemaName, tableName string) bool {
+	return c == nil || c.Tables.matches(fmt.Sprintf("%s.%s", schemaName, tableName))
+}
+
+func (c *Scope) hasKind(kind ObjectKind) bool {
+	return c == nil || kind == "" || c.Kinds.matches(string(kind))
+}
+
+// apply returns the structure without the schemas and the tables out of the scope, the structure itself is not changed
+func (c *Scope) apply(root *Root) *Root {
+	if c == nil {
+		return root
+	}
+	var result = *root
+	result.Schemas = make(Schemas, 0, len(root.Schemas))
+	for _, schema := range root.Schemas {
+		if !c.hasSchema(schema.Value.Name) {
+			continue
+		}
+		var tables = make(TablesContainer, len(schema.Value.Tables))
+		for tableName, table := range schema.Value.Tables {
+			if c.hasTable(schema.Value.Name, tableName) {
+				tables[tableName] = table
+			}
+		}
+		var data = make([]DataContainer, 0, len(schema.Value.Data))
+		for _, container := range schema.Value.Data {
+			if c.hasTable(schema.Value.Name, container.Name) {
+				data = append(data, container)
+			}
+		}
+		schema.Value.Tables = tables
+		schema.Value.Data = data
+		result.Schemas = append(result.Schemas, schema)
+	}
+	return &result
+}
+
+// filterDiff removes the statements that change the objects of the kinds out of the scope
+func (c *Scope) filterDiff(diff *Diff) {
+	if c == nil {
+		return
+	}
+	for _, phase := range []*[]sqt.SqlStmt{&diff.preInstall, &diff.install, &diff.afterInstall, &diff.data} {
+		var result = make([]sqt.SqlStmt, 0, len(*phase))
+		for _, stmt := range *phase {
+			if m, ok := stmt.(*migrationStmt); ok && m.change != nil && !c.hasKind(m.change.Kind) {
+				continue
+			}
+			result = append(result, stmt)
+		}
+		*phase = result
+	}
+	// the removed schema is dropped with all its tables, some of them may be out of the scope
+	if !c.hasKind(ObjectSchema) || len(c.Tables.Include)+len(c.Tables.Exclude) > 0 {
+		diff.removedSchemas = nil
+	}
+}
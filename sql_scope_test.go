@@ -0,0 +1,175 @@
+package dragonfly
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScope_MakeDiff(t *testing.T) {
+	const current = `
+schemas:
+  - name: billing
+    tables:
+      invoices:
+        columns:
+          - name: id
+            schema: { type: int8, not_null: true }
+      audit_log:
+        columns:
+          - name: message
+            schema: { type: varchar }
+  - name: reports
+    tables:
+      totals:
+        columns:
+          - name: amount
+            schema: { type: int8 }
+`
+	const project = `
+schemas:
+  - name: billing
+    tables:
+      invoices:
+        columns:
+          - name: id
+            schema: { type: int8, not_null: true }
+          - name: paid
+            schema: { type: bool }
+      payments:
+        columns:
+          - name: invoice_id
+            schema: { type: int8 }
+`
+	tests := []struct {
+		name  string
+		scope *Scope
+		want  []string
+	}{
+		{
+			name: "the tables of others are dropped without the scope",
+			want: []string{
+				"alter table billing.invoices add column paid bool",
+				"create table billing.payments (\n\tinvoice_id int8\n)",
+				"drop table billing.audit_log",
+			},
+		},
+		{
+			name: "the schemas and the tables out of the scope are not touched",
+			scope: &Scope{
+				Schemas: Filter{Include: []string{"billing"}},
+				Tables:  Filter{Exclude: []string{"billing.audit_*"}},
+			},
+			want: []string{
+				"alter table billing.invoices add column paid bool",
+				"create table billing.payments (\n\tinvoice_id int8\n)",
+			},
+		},
+		{
+			name: "the tables are not created if they are out of the scope",
+			scope: &Scope{
+				Tables: Filter{Include: []string{"billing.invoices"}},
+			},
+			want: []string{
+				"alter table billing.invoices add column paid bool",
+			},
+		},
+		{
+			name: "the objects of other kinds are not changed",
+			scope: &Scope{
+				Schemas: Filter{Exclude: []string{"reports"}},
+				Kinds:   Filter{Include: []string{"table"}},
+			},
+			want: []string{
+				"create table billing.payments (\n\tinvoice_id int8\n)",
+				"drop table billing.audit_log",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := readProjectSnapshot([]byte(current))
+			if err != nil {
+				t.Fatalf("readProjectSnapshot() error = %v", err)
+			}
+			root, err := readProjectSnapshot([]byte(project))
+			if err != nil {
+				t.Fatalf("readProjectSnapshot() error = %v", err)
+			}
+			root.Scope = tt.scope
+			// the project is compared again by its copy, as the dry run does, and the scope must be the same
+			var expected = copyRoot(root)
+			diff := MakeDiff(actual, root)
+			ResolveDependencies(&diff)
+			var got = make([]string, 0)
+			for _, stmt := range diff.allStatements() {
+				got = append(got, stmt.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("makeDiff() got:\n%s\nwant:\n%s", strings.Join(got, ";\n"), strings.Join(tt.want, ";\n"))
+			}
+			if tt.scope != nil && len(diff.removedSchemas) > 0 {
+				t.Errorf("removedSchemas = %v, want none", diff.removedSchemas)
+			}
+			again, err := readProjectSnapshot([]byte(current))
+			if err != nil {
+				t.Fatalf("readProjectSnapshot() error = %v", err)
+			}
+			second := MakeDiff(again, expected)
+			ResolveDependencies(&second)
+			var gotAgain = make([]string, 0)
+			for _, stmt := range second.allStatements() {
+				gotAgain = append(gotAgain, stmt.String())
+			}
+			if !reflect.DeepEqual(gotAgain, got) {
+				t.Errorf("the copy of the project got:\n%s\nwant:\n%s", strings.Join(gotAgain, ";\n"), strings.Join(got, ";\n"))
+			}
+		})
+	}
+}
+
+func TestScope_Merge(t *testing.T) {
+	var project = &Scope{
+		Schemas: Filter{Include: []string{"billing", "sales"}, Exclude: []string{"sales_archive"}},
+		Tables:  Filter{Exclude: []string{"*.tmp_*"}},
+	}
+	got := project.Merge(&Scope{Schemas: Filter{Include: []string{"sales*"}}, Tables: Filter{Exclude: []string{"sales.legacy"}}})
+	for name, want := range map[string]bool{"billing": false, "sales": true, "sales_archive": false} {
+		if got.hasSchema(name) != want {
+			t.Errorf("hasSchema(%s) = %v, want %v", name, !want, want)
+		}
+	}
+	for name, want := range map[string]bool{"orders": true, "tmp_orders": false, "legacy": false} {
+		if got.hasTable("sales", name) != want {
+			t.Errorf("hasTable(sales.%s) = %v, want %v", name, !want, want)
+		}
+	}
+	if project.Merge(nil) != project {
+		t.Errorf("Merge(nil) must return the scope of the project")
+	}
+}
+
+func TestScope_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		scope   *Scope
+		wantErr string
+	}{
+		{name: "no scope"},
+		{name: "correct patterns", scope: &Scope{Schemas: Filter{Include: []string{"billing*"}}, Kinds: Filter{Exclude: []string{"col*", "index"}}}},
+		{name: "malformed schema pattern", scope: &Scope{Schemas: Filter{Include: []string{"billing["}}}, wantErr: "wrong schema pattern 'billing['"},
+		{name: "malformed table pattern", scope: &Scope{Tables: Filter{Exclude: []string{"billing.[a-"}}}, wantErr: "wrong table pattern"},
+		{name: "unknown kind", scope: &Scope{Kinds: Filter{Include: []string{"tables"}}}, wantErr: "unknown kind 'tables'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.scope.Validate()
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,502 @@
+package dragonfly
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/iv-menshenin/dragonfly/utils"
+	sqt "github.com/iv-menshenin/sql-ast"
+	"go/token"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// the forms of the date and time that are written in the project or output by PostgreSQL
+	seedTimeLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02 15:04:05.999999999Z07:00",
+		"2006-01-02 15:04:05.999999999Z07",
+		"2006-01-02T15:04:05.999999999Z07",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02",
+	}
+)
+
+type (
+	// seedInsertStmt inserts the row with the columns in a stable order
+	seedInsertStmt struct {
+		*sqt.InsertStmt
+		Columns []string
+	}
+	// seedUpdateStmt changes the columns of one row found by its key
+	seedUpdateStmt struct {
+		*sqt.UpdateStmt
+	}
+	// seedDeleteStmt deletes the rows selected by the embedded statement
+	seedDeleteStmt struct {
+		*sqt.SelectStmt
+	}
+	// seedValueExpr is the literal value, unlike identifiers it is never quoted
+	seedValueExpr struct {
+		*sqt.Literal
+	}
+	// seedTable is the seed data of one table along with the columns that identify its rows
+	seedTable struct {
+		db     *Root
+		schema string
+		table  *Table
+		data   DataContainer
+		key    []string
+	}
+)
+
+const (
+	// the rows of the table that are not described in the project stay as is
+	DataExtraRowsKeep = "keep"
+	// the rows of the table that are not described in the project are deleted
+	DataExtraRowsDelete = "delete"
+)
+
+func (c *seedValueExpr) String() string {
+	return c.Text
+}
+
+func (c *seedInsertStmt) String() string {
+	var (
+		columns = make([]string, 0, len(c.Columns))
+		values  = make([]string, 0, len(c.Columns))
+	)
+	for _, column := range c.Columns {
+		columns = append(columns, (&sqt.Literal{Text: column}).String())
+		values = append(values, c.Insert[column].String())
+	}
+	return fmt.Sprintf(
+		"insert into %s (%s) values (%s)",
+		c.Table.Table.GetName(), strings.Join(columns, ", "), strings.Join(values, ", "),
+	)
+}
+
+func (c *seedUpdateStmt) String() string {
+	var set = make([]string, 0, len(c.Set))
+	for _, expr := range c.Set {
+		set = append(set, expr.String())
+	}
+	return fmt.Sprintf("update %s set %s where %s", c.Table.Table.GetName(), strings.Join(set, ", "), c.Where)
+}
+
+func (c *seedDeleteStmt) String() string {
+	return fmt.Sprintf("delete from %s where %s", c.From.Table.GetName(), c.Where)
+}
+
+// makeDataChanges compares the seed data of the project with the rows of the current structure,
+// the rows are inserted in the order of the project and deleted in the reverse order, so the referenced rows come first
+func makeDataChanges(current, new *Root) []sqt.SqlStmt {
+	var (
+		inserts = make([]sqt.SqlStmt, 0)
+		deletes = make([]sqt.SqlStmt, 0)
+	)
+	for _, schema := range new.Schemas {
+		for _, data := range schema.Value.Data {
+			var (
+				seed   = makeSeedTable(new, schema.Value.Name, schema.Value.Tables, data)
+				actual = current.findSeedRows(schema.Value.Name, data.Name)
+			)
+			ins, del := seed.diff(actual)
+			inserts = append(inserts, ins...)
+			deletes = append(del, deletes...)
+		}
+	}
+	return append(deletes, inserts...)
+}
+
+func makeSeedTable(db *Root, schemaName string, tables TablesContainer, data DataContainer) seedTable {
+	table, ok := tables.tryToFind(data.Name)
+	if !ok {
+		panic(fmt.Sprintf("cannot find table `%s` in `%s`", data.Name, schemaName))
+	}
+	switch data.ExtraRows {
+	case "", DataExtraRowsKeep, DataExtraRowsDelete:
+	default:
+		panic(fmt.Sprintf("unknown extra_rows option `%s` of `%s.%s`, use `%s` or `%s`", data.ExtraRows, schemaName, data.Name, DataExtraRowsKeep, DataExtraRowsDelete))
+	}
+	var seed = seedTable{db: db, schema: schemaName, table: table, data: data}
+	for _, key := range [][]ColumnRef{table.extractPrimaryKeyColumns(), table.extractUniqueKeyColumns()} {
+		if len(key) > 0 && data.Data.hasColumns(key) {
+			for _, column := range key {
+				seed.key = append(seed.key, column.Value.Name)
+			}
+			return seed
+		}
+	}
+	panic(fmt.Sprintf("the rows of `%s.%s` must contain all the columns of the primary or unique key", schemaName, data.Name))
+}
+
+func (c TableData) hasColumns(columns []ColumnRef) bool {
+	for _, row := range c {
+		for _, column := range columns {
+			if _, ok := row.tryToFind(column.Value.Name); !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (c TableDataRow) tryToFind(column string) (interface{}, bool) {
+	for name, value := range c {
+		if strings.EqualFold(name, column) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func (c TableDataRow) columns() []string {
+	var result = make([]string, 0, len(c))
+	for name := range c {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// findSeedRows returns the rows of the table if the current structure contains them
+func (c *Root) findSeedRows(schemaName, tableName string) TableData {
+	schema, ok := c.Schemas.tryToFind(schemaName)
+	if !ok {
+		return nil
+	}
+	for _, data := range schema.Value.Data {
+		if strings.EqualFold(data.Name, tableName) {
+			return data.Data
+		}
+	}
+	return nil
+}
+
+// diff returns the statements that insert and update the rows of the project and the statements that delete extra rows
+func (c seedTable) diff(actual TableData) (install, drop []sqt.SqlStmt) {
+	var found = make(map[string]TableDataRow, len(actual))
+	for _, row := range actual {
+		found[c.rowKey(row)] = row
+	}
+	for _, row := range c.data.Data {
+		key := c.rowKey(row)
+		current, ok := found[key]
+		delete(found, key)
+		if !ok {
+			install = append(install, c.describe(ActionCreate, row, c.makeInsert(row)))
+			continue
+		}
+		if stmt := c.makeUpdate(current, row); stmt != nil {
+			install = append(install, c.describe(ActionAlter, row, stmt))
+		}
+	}
+	if c.data.ExtraRows != DataExtraRowsDelete {
+		return
+	}
+	for _, row := range actual {
+		if _, ok := found[c.rowKey(row)]; ok {
+			drop = append(drop, c.describe(ActionDrop, row, markStatement(c.makeDelete(row), StatementDestructive)))
+		}
+	}
+	return
+}
+
+func (c seedTable) rowKey(row TableDataRow) string {
+	var parts = make([]string, 0, len(c.key))
+	for _, name := range c.key {
+		value, _ := row.tryToFind(name)
+		parts = append(parts, normalizeSeedValue(c.valueType(name), value))
+	}
+	return strings.Join(parts, "\x00")
+}
+
+func (c seedTable) column(name string) ColumnRef {
+	column, ok := c.table.Columns.tryToFind(name)
+	if !ok {
+		panic(fmt.Sprintf("cannot find column `%s` in `%s.%s`", name, c.schema, c.data.Name))
+	}
+	return *column
+}
+
+func (c seedTable) columnType(name string) TypeBase {
+	return c.column(name).Value.Schema.Value.TypeBase
+}
+
+func (c seedTable) selector() *sqt.Selector {
+	return &sqt.Selector{Name: c.data.Name, Container: c.schema}
+}
+
+func (c seedTable) makeInsert(row TableDataRow) sqt.SqlStmt {
+	var stmt = seedInsertStmt{
+		InsertStmt: &sqt.InsertStmt{
+			Table:  sqt.TableDesc{Table: c.selector()},
+			Insert: make(map[string]sqt.SqlExpr, len(row)),
+		},
+		Columns: row.columns(),
+	}
+	for _, name := range stmt.Columns {
+		stmt.Insert[name] = c.makeValue(name, row[name])
+	}
+	return &stmt
+}
+
+// makeUpdate returns nil if all the columns of the project row have the same values in the current row
+func (c seedTable) makeUpdate(current, row TableDataRow) sqt.SqlStmt {
+	var set = make([]sqt.SqlExpr, 0, len(row))
+	for _, name := range row.columns() {
+		value, ok := current.tryToFind(name)
+		if ok && normalizeSeedValue(c.valueType(name), value) == normalizeSeedValue(c.valueType(name), row[name]) {
+			continue
+		}
+		set = append(set, &sqt.BinaryExpr{
+			Left:  &sqt.Literal{Text: name},
+			Right: c.makeValue(name, row[name]),
+			Op:    token.ASSIGN,
+		})
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	return &seedUpdateStmt{UpdateStmt: &sqt.UpdateStmt{
+		Table: sqt.TableDesc{Table: c.selector()},
+		Set:   set,
+		Where: c.keyCondition(row),
+	}}
+}
+
+func (c seedTable) makeDelete(row TableDataRow) sqt.SqlStmt {
+	return &seedDeleteStmt{SelectStmt: &sqt.SelectStmt{
+		From:  sqt.TableDesc{Table: c.selector()},
+		Where: c.keyCondition(row),
+	}}
+}
+
+func (c seedTable) keyCondition(row TableDataRow) sqt.SqlExpr {
+	var conditions = make([]string, 0, len(c.key))
+	for _, name := range c.key {
+		value, _ := row.tryToFind(name)
+		conditions = append(conditions, (&sqt.BinaryExpr{
+			Left:  &sqt.Literal{Text: name},
+			Right: c.makeValue(name, value),
+			Op:    token.ASSIGN,
+		}).String())
+	}
+	return &sqt.Literal{Text: strings.Join(conditions, " and ")}
+}
+
+func (c seedTable) describe(action ChangeAction, row TableDataRow, stmt sqt.SqlStmt) sqt.SqlStmt {
+	var key = make([]string, 0, len(c.key))
+	for _, name := range c.key {
+		value, _ := row.tryToFind(name)
+		key = append(key, fmt.Sprintf("%s=%v", name, value))
+	}
+	return describeStatement(stmt, Change{
+		Kind:   ObjectRow,
+		Schema: c.schema,
+		Table:  c.data.Name,
+		Name:   strings.Join(key, ","),
+		Action: action,
+	})
+}
+
+func (c seedTable) makeValue(name string, value interface{}) sqt.SqlExpr {
+	return &seedValueExpr{Literal: &sqt.Literal{Text: c.db.encodeLiteral(c.columnType(name), value)}}
+}
+
+// valueType resolves the domain of the column, the custom json types are compared as jsonb
+func (c seedTable) valueType(name string) TypeBase {
+	base, custom := c.db.resolveLiteralType(c.columnType(name))
+	if custom != nil && (strings.EqualFold(custom.Type, "json") || strings.EqualFold(custom.Type, "map")) {
+		base.Type = "jsonb"
+	}
+	return base
+}
+
+// normalizeSeedValue brings the value read from the database as text and the value of the project to the same form
+func normalizeSeedValue(t TypeBase, value interface{}) string {
+	if value == nil {
+		return "\x00null"
+	}
+	if t.IsArray {
+		if items, ok := value.([]interface{}); ok {
+			return arrayText(items)
+		}
+		return fmt.Sprintf("%v", value)
+	}
+	var text = fmt.Sprintf("%v", value)
+	switch canonicalTypeName(t.Type) {
+	case "int2", "int4", "int8", "numeric", "float4", "float8":
+		if number, ok := new(big.Rat).SetString(text); ok && decimalLiteral.MatchString(text) {
+			return number.RatString()
+		}
+	case "bool":
+		if b, err := strconv.ParseBool(text); err == nil {
+			return strconv.FormatBool(b)
+		}
+	case "timestamptz":
+		if moment, ok := parseSeedTime(value); ok {
+			return moment.UTC().Format(time.RFC3339Nano)
+		}
+	case "timestamp":
+		// the time zone of the value is ignored by PostgreSQL
+		if moment, ok := parseSeedTime(value); ok {
+			return moment.Format("2006-01-02T15:04:05.999999999")
+		}
+	case "date":
+		if moment, ok := parseSeedTime(value); ok {
+			return moment.Format("2006-01-02")
+		}
+	case "uuid":
+		var digits = strings.ToLower(strings.NewReplacer("-", "", "{", "", "}", "").Replace(text))
+		if len(digits) == 32 {
+			return digits[:8] + "-" + digits[8:12] + "-" + digits[12:16] + "-" + digits[16:20] + "-" + digits[20:]
+		}
+	case "bytea":
+		// PostgreSQL outputs the hex form, the project may contain the raw value
+		if data, ok := value.([]byte); ok {
+			return `\x` + hex.EncodeToString(data)
+		}
+		if strings.HasPrefix(text, `\x`) {
+			return strings.ToLower(text)
+		}
+		return `\x` + hex.EncodeToString([]byte(text))
+	case "json", "jsonb":
+		if s, ok := value.(string); ok {
+			var decoded interface{}
+			if err := json.Unmarshal([]byte(s), &decoded); err != nil {
+				return s
+			}
+			value = decoded
+		}
+		// the keys of the maps are sorted by the encoder
+		if data, err := json.Marshal(jsonValue(value)); err == nil {
+			return string(data)
+		}
+	}
+	return text
+}
+
+// parseSeedTime reads the date and time decoded from YAML or output by PostgreSQL as text,
+// the time without an offset is considered to be UTC
+func parseSeedTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range seedTimeLayouts {
+			if moment, err := time.Parse(layout, v); err == nil {
+				return moment, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// arrayText makes the text representation of the array as PostgreSQL outputs it
+func arrayText(items []interface{}) string {
+	var elements = make([]string, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case nil:
+			elements = append(elements, "NULL")
+		case []interface{}:
+			elements = append(elements, arrayText(v))
+		default:
+			text := fmt.Sprintf("%v", v)
+			if text == "" || strings.EqualFold(text, "null") || strings.ContainsAny(text, "{},\"\\ \t\n") {
+				text = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text) + `"`
+			}
+			elements = append(elements, text)
+		}
+	}
+	return "{" + strings.Join(elements, ",") + "}"
+}
+
+// readSeedData reads the rows of the tables that have seed data in the project, only the columns of the project rows
+// that exist in the database are read
+func (c *Root) readSeedData(db queryer, project *Root) error {
+	for _, schema := range project.Schemas {
+		// the rows are read by the casts of PostgreSQL
+		if dialect := project.getDialect(); len(schema.Value.Data) > 0 && dialect.Name() != DialectPostgres {
+			return fmt.Errorf("seed data is not supported by the `%s` dialect", dialect.Name())
+		}
+		current, ok := c.Schemas.tryToFind(schema.Value.Name)
+		if !ok {
+			continue
+		}
+		for _, data := range schema.Value.Data {
+			table, ok := current.Value.Tables.tryToFind(data.Name)
+			if !ok {
+				continue
+			}
+			seed := makeSeedTable(project, schema.Value.Name, schema.Value.Tables, data)
+			columns := seed.readableColumns(table)
+			if len(columns) == 0 {
+				continue
+			}
+			rows, err := seed.readRows(db, columns)
+			if err != nil {
+				return err
+			}
+			current.Value.Data = append(current.Value.Data, DataContainer{Name: data.Name, Data: rows})
+		}
+	}
+	return nil
+}
+
+func (c seedTable) readableColumns(actual *Table) []string {
+	var result = make([]string, 0)
+	for _, row := range c.data.Data {
+		for name := range row {
+			if actual.Columns.exists(name) && !utils.ArrayContainsCI(result, name) {
+				result = append(result, name)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// readRows reads all the rows of the table as text, so the values are compared regardless of the driver types
+func (c seedTable) readRows(db queryer, columns []string) (TableData, error) {
+	var selected = make([]string, 0, len(columns))
+	for _, name := range columns {
+		selected = append(selected, (&sqt.Literal{Text: name}).String()+"::text")
+	}
+	q, err := db.Query(fmt.Sprintf("select %s from %s", strings.Join(selected, ", "), c.selector().GetName()))
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	var result = make(TableData, 0)
+	for q.Next() {
+		var (
+			values = make([]sql.NullString, len(columns))
+			dest   = make([]interface{}, len(columns))
+		)
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = q.Scan(dest...); err != nil {
+			return nil, err
+		}
+		var row = make(TableDataRow, len(columns))
+		for i, name := range columns {
+			if values[i].Valid {
+				row[name] = values[i].String
+			} else {
+				row[name] = nil
+			}
+		}
+		result = append(result, row)
+	}
+	return result, q.Err()
+}
@@ -0,0 +1,114 @@
+package dragonfly
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiff_seedData(t *testing.T) {
+	var (
+		current = []byte(`
+schemas:
+  - name: ref
+    tables:
+      currencies:
+        columns:
+          - name: code
+            schema: { type: varchar, length: 3, not_null: true }
+            constraints:
+              - name: pk_currencies
+                type: primary key
+          - name: name
+            schema: { type: varchar, length: 50 }
+          - name: rate
+            schema: { type: numeric, length: 10, precision: 4 }
+    data:
+      - name: currencies
+        data:
+          - { code: USD, name: Dollar, rate: 1 }
+          - { code: EUR, name: Euro, rate: 0.9 }
+          - { code: DEM, name: Mark, rate: 0.5 }
+`)
+		project = []byte(`
+schemas:
+  - name: ref
+    tables:
+      currencies:
+        columns:
+          - name: code
+            schema: { type: varchar, length: 3, not_null: true }
+            constraints:
+              - name: pk_currencies
+                type: primary key
+          - name: name
+            schema: { type: varchar, length: 50 }
+          - name: rate
+            schema: { type: numeric, length: 10, precision: 4 }
+    data:
+      - name: currencies
+        extra_rows: delete
+        data:
+          - { code: USD, name: Dollar, rate: 1.0000 }
+          - { code: EUR, name: Euro, rate: 0.92 }
+          - { code: GBP, name: Pound, rate: 1.2 }
+`)
+	)
+	diff, err := diffSnapshots(current, project, nil)
+	if err != nil {
+		t.Fatalf("diffSnapshots() error = %v", err)
+	}
+	var want = []struct {
+		sql   string
+		class StatementClass
+	}{
+		{sql: "delete from ref.currencies where code = 'DEM'", class: StatementDestructive},
+		{sql: "update ref.currencies set rate = 0.92 where code = 'EUR'", class: StatementSafe},
+		{sql: "insert into ref.currencies (code, name, rate) values ('GBP', 'Pound', 1.2)", class: StatementSafe},
+	}
+	got := diff.allStatements()
+	if len(got) != len(want) {
+		t.Fatalf("diff returned %d statements, want %d: %v", len(got), len(want), got)
+	}
+	for i, stmt := range got {
+		if sql := stmt.String(); sql != want[i].sql {
+			t.Errorf("statement #%d = %s, want %s", i, sql, want[i].sql)
+		}
+		if class := classifyStatement(stmt); class != want[i].class {
+			t.Errorf("statement #%d is %s, want %s", i, class, want[i].class)
+		}
+	}
+}
+
+func Test_normalizeSeedValue(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  TypeBase
+		a    interface{}
+		b    interface{}
+		want bool
+	}{
+		{name: "numeric scale", typ: TypeBase{Type: "numeric"}, a: "0.9000", b: 0.9, want: true},
+		{name: "integer", typ: TypeBase{Type: "int8"}, a: "42", b: 42, want: true},
+		{name: "boolean text", typ: TypeBase{Type: "boolean"}, a: "t", b: true, want: true},
+		{name: "different text", typ: TypeBase{Type: "varchar"}, a: "Euro", b: "euro", want: false},
+		{name: "null", typ: TypeBase{Type: "varchar"}, a: nil, b: "null", want: false},
+		{name: "json keys", typ: TypeBase{Type: "jsonb"}, a: `{"b": 1, "a": [true]}`, b: map[interface{}]interface{}{"a": []interface{}{true}, "b": 1}, want: true},
+		{name: "array", typ: TypeBase{Type: "text", IsArray: true}, a: `{a,"b c",NULL}`, b: []interface{}{"a", "b c", nil}, want: true},
+		{name: "timestamptz", typ: TypeBase{Type: "timestamp with time zone"}, a: "2020-01-01 00:00:00+00", b: "2020-01-01T00:00:00Z", want: true},
+		{name: "timestamptz offset", typ: TypeBase{Type: "timestamptz"}, a: "2020-01-01 03:30:00.5+03:30", b: time.Date(2020, 1, 1, 0, 0, 0, 500000000, time.UTC), want: true},
+		{name: "different timestamptz", typ: TypeBase{Type: "timestamptz"}, a: "2020-01-01 00:00:00+00", b: "2020-01-01T00:00:00+03:00", want: false},
+		{name: "timestamp", typ: TypeBase{Type: "timestamp"}, a: "2020-01-01 10:00:00", b: "2020-01-01T10:00:00", want: true},
+		{name: "date", typ: TypeBase{Type: "date"}, a: "2020-01-01", b: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), want: true},
+		{name: "uuid case", typ: TypeBase{Type: "uuid"}, a: "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", b: "A0EEBC99-9C0B-4EF8-BB6D-6BB9BD380A11", want: true},
+		{name: "uuid without hyphens", typ: TypeBase{Type: "uuid"}, a: "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", b: "{a0eebc999c0b4ef8bb6d6bb9bd380a11}", want: true},
+		{name: "bytea", typ: TypeBase{Type: "bytea"}, a: `\x6b6579`, b: "key", want: true},
+		{name: "bytea hex", typ: TypeBase{Type: "bytea"}, a: `\x6b6579`, b: `\x6B6579`, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeSeedValue(tt.typ, tt.a) == normalizeSeedValue(tt.typ, tt.b); got != tt.want {
+				t.Errorf("normalizeSeedValue(%v) == normalizeSeedValue(%v) is %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
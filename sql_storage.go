@@ -0,0 +1,310 @@
+package dragonfly
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/iv-menshenin/dragonfly/utils"
+	sqt "github.com/iv-menshenin/sql-ast"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// the tables and the indices of the system schemas are not read
+	sqlGetStorage = `
+select
+    n.nspname,
+    c.relname,
+    c.relkind = 'i' as is_index,
+    c.relpersistence = 'u' as unlogged,
+    coalesce(t.spcname, '') as tablespace,
+    coalesce(array_to_string(c.reloptions, ','), '') as options
+from pg_class c
+inner join pg_namespace n on n.oid = c.relnamespace
+left join pg_tablespace t on t.oid = c.reltablespace
+where c.relkind in ('r', 'i')
+  and (c.relpersistence = 'u' or c.reltablespace <> 0 or c.reloptions is not null)
+  and n.nspname not in('information_schema', 'pg_catalog');`
+
+	storageFillFactor        = "fillfactor"
+	storageAutovacuumPrefix  = "autovacuum_"
+	defaultTablespaceKeyword = "pg_default"
+)
+
+type (
+	rawStorageStruct struct {
+		Schema     string
+		Name       string
+		IsIndex    bool
+		Unlogged   bool
+		Tablespace string
+		Options    string
+	}
+	rawStorages []rawStorageStruct
+)
+
+func getAllStorages(db queryer) (storages rawStorages, err error) {
+	var q *sql.Rows
+	if q, err = db.Query(sqlGetStorage); err != nil {
+		return
+	}
+	defer q.Close()
+	storages = make(rawStorages, 0, 10)
+	var storage rawStorageStruct
+	for q.Next() {
+		if err = q.Err(); err != nil {
+			return
+		}
+		if err = q.Scan(
+			&storage.Schema,
+			&storage.Name,
+			&storage.IsIndex,
+			&storage.Unlogged,
+			&storage.Tablespace,
+			&storage.Options,
+		); err != nil {
+			return
+		}
+		storages = append(storages, storage)
+	}
+	return
+}
+
+func (c rawStorages) find(schemaName, name string, isIndex bool) *rawStorageStruct {
+	for i, raw := range c {
+		if raw.IsIndex == isIndex && strings.EqualFold(raw.Schema, schemaName) && strings.EqualFold(raw.Name, name) {
+			return &c[i]
+		}
+	}
+	return nil
+}
+
+// tableStorage returns nil if the table is stored by default
+func (c rawStorages) tableStorage(schemaName, tableName string) *TableStorage {
+	raw := c.find(schemaName, tableName, false)
+	if raw == nil {
+		return nil
+	}
+	var storage = TableStorage{
+		Storage:  Storage{Tablespace: raw.Tablespace},
+		Unlogged: raw.Unlogged,
+	}
+	for name, value := range parseStorageOptions(raw.Options) {
+		switch {
+		case name == storageFillFactor:
+			storage.FillFactor, _ = strconv.Atoi(value)
+		case strings.HasPrefix(name, storageAutovacuumPrefix):
+			if storage.Autovacuum == nil {
+				storage.Autovacuum = make(map[string]string)
+			}
+			storage.Autovacuum[strings.TrimPrefix(name, storageAutovacuumPrefix)] = value
+		}
+	}
+	return &storage
+}
+
+// indexStorage returns nil if the index is stored by default
+func (c rawStorages) indexStorage(schemaName, indexName string) *Storage {
+	raw := c.find(schemaName, indexName, true)
+	if raw == nil {
+		return nil
+	}
+	var storage = Storage{Tablespace: raw.Tablespace}
+	if value, ok := parseStorageOptions(raw.Options)[storageFillFactor]; ok {
+		storage.FillFactor, _ = strconv.Atoi(value)
+	}
+	return &storage
+}
+
+// parseStorageOptions parses `pg_class.reloptions` joined by commas, such as `fillfactor=70,autovacuum_enabled=false`
+func parseStorageOptions(options string) map[string]string {
+	var result = make(map[string]string)
+	for _, option := range strings.Split(options, ",") {
+		if parts := strings.SplitN(option, "=", 2); len(parts) == 2 {
+			result[strings.ToLower(strings.TrimSpace(parts[0]))] = strings.TrimSpace(parts[1])
+		}
+	}
+	return result
+}
+
+// hasStorageOptions returns true if the storage of the table or any of its indices is described
+func (c Table) hasStorageOptions() bool {
+	if c.Storage != nil {
+		return true
+	}
+	for _, index := range c.Indices {
+		if index.Storage != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Storage) getTablespace() string {
+	if c == nil || strings.EqualFold(c.Tablespace, defaultTablespaceKeyword) {
+		return ""
+	}
+	return c.Tablespace
+}
+
+func (c *Storage) parameters() map[string]string {
+	var result = make(map[string]string)
+	if c != nil && c.FillFactor > 0 {
+		result[storageFillFactor] = strconv.Itoa(c.FillFactor)
+	}
+	return result
+}
+
+func (c *TableStorage) getStorage() *Storage {
+	if c == nil {
+		return nil
+	}
+	return &c.Storage
+}
+
+func (c *TableStorage) isUnlogged() bool {
+	return c != nil && c.Unlogged
+}
+
+// parameters returns the storage parameters as they are written in `with (...)`
+func (c *TableStorage) parameters() map[string]string {
+	var result = c.getStorage().parameters()
+	if c != nil {
+		for name, value := range c.Autovacuum {
+			result[storageAutovacuumPrefix+strings.ToLower(name)] = strings.ToLower(value)
+		}
+	}
+	return result
+}
+
+// diffStorageParameters returns the parameters to set and the names of the parameters to reset, both are sorted
+func diffStorageParameters(old, new map[string]string) (set []string, reset []string) {
+	for name, value := range new {
+		if oldValue, ok := old[name]; !ok || !strings.EqualFold(oldValue, value) {
+			set = append(set, fmt.Sprintf("%s = %s", name, value))
+		}
+	}
+	for name := range old {
+		if _, ok := new[name]; !ok {
+			reset = append(reset, name)
+		}
+	}
+	sort.Strings(set)
+	sort.Strings(reset)
+	return
+}
+
+func makeTableAlterKeyword(schemaName, tableName, alter string) sqt.SqlStmt {
+	return &sqt.AlterStmt{
+		Target: sqt.TargetTable,
+		Name: &sqt.Selector{
+			Name:      tableName,
+			Container: schemaName,
+		},
+		Alter: keywordExpr{&sqt.Literal{Text: alter}},
+	}
+}
+
+// makeStorageChanges changes the storage of the existing table, the old storage is nil for the new table.
+// Changing the persistence or the tablespace rewrites the table, so these statements are blocking
+func (c TableComparator) makeStorageChanges(action ChangeAction, old, new *TableStorage) []sqt.SqlStmt {
+	var result = make([]sqt.SqlStmt, 0)
+	if old.isUnlogged() != new.isUnlogged() {
+		var alter = "set logged"
+		if new.isUnlogged() {
+			alter = "set unlogged"
+		}
+		result = append(result, markStatement(makeTableAlterKeyword(c.Schema.New, c.Name.New, alter), StatementBlocking))
+	}
+	set, reset := diffStorageParameters(old.parameters(), new.parameters())
+	if len(set) > 0 {
+		alter := fmt.Sprintf("set (%s)", strings.Join(set, ", "))
+		result = append(result, makeTableAlterKeyword(c.Schema.New, c.Name.New, alter))
+	}
+	if len(reset) > 0 {
+		alter := fmt.Sprintf("reset (%s)", strings.Join(reset, ", "))
+		result = append(result, makeTableAlterKeyword(c.Schema.New, c.Name.New, alter))
+	}
+	if oldTablespace, newTablespace := old.getStorage().getTablespace(), new.getStorage().getTablespace(); !strings.EqualFold(oldTablespace, newTablespace) {
+		if newTablespace == "" {
+			newTablespace = defaultTablespaceKeyword
+		}
+		alter := fmt.Sprintf("set tablespace %s", newTablespace)
+		result = append(result, markStatement(makeTableAlterKeyword(c.Schema.New, c.Name.New, alter), StatementBlocking))
+	}
+	for i, stmt := range result {
+		result[i] = c.describe(action, stmt)
+	}
+	return result
+}
+
+// makeIndicesStorageChanges changes the storage of the indices that exist in both the database and the project
+func (c TableComparator) makeIndicesStorageChanges() []sqt.SqlStmt {
+	var result = make([]sqt.SqlStmt, 0)
+	for _, index := range c.TableStruct.NewStructure.Indices {
+		if index.Name == "" {
+			continue
+		}
+		i := c.TableStruct.OldStructure.Indices.indexOf(index)
+		if i < 0 {
+			continue
+		}
+		var (
+			actual = c.TableStruct.OldStructure.Indices[i]
+			name   = fmt.Sprintf("%s.%s", c.Schema.New, index.Name)
+			change = Change{Kind: ObjectIndex, Schema: c.Schema.New, Table: c.Name.New, Name: index.Name, Action: ActionAlter, Old: actual, New: index}
+		)
+		set, reset := diffStorageParameters(actual.Storage.parameters(), index.Storage.parameters())
+		if len(set) > 0 {
+			result = append(result, scriptStatement(fmt.Sprintf("alter index %s set (%s)", name, strings.Join(set, ", ")), change, StatementSafe))
+		}
+		if len(reset) > 0 {
+			result = append(result, scriptStatement(fmt.Sprintf("alter index %s reset (%s)", name, strings.Join(reset, ", ")), change, StatementSafe))
+		}
+		if oldTablespace, newTablespace := actual.Storage.getTablespace(), index.Storage.getTablespace(); !strings.EqualFold(oldTablespace, newTablespace) {
+			if newTablespace == "" {
+				newTablespace = defaultTablespaceKeyword
+			}
+			result = append(result, scriptStatement(fmt.Sprintf("alter index %s set tablespace %s", name, newTablespace), change, StatementBlocking))
+		}
+	}
+	return result
+}
+
+// storageDifferences compares the storage of the tables or the indices
+func storageDifferences(oldUnlogged, newUnlogged bool, old, new *Storage, oldParameters, newParameters map[string]string) []Difference {
+	var result = make([]Difference, 0)
+	if oldUnlogged != newUnlogged {
+		result = append(result, Difference{Attribute: "unlogged", Old: strconv.FormatBool(oldUnlogged), New: strconv.FormatBool(newUnlogged)})
+	}
+	for _, name := range sortedKeys(oldParameters, newParameters) {
+		if oldValue, newValue := oldParameters[name], newParameters[name]; !strings.EqualFold(oldValue, newValue) {
+			result = append(result, Difference{Attribute: name, Old: valueOrNone(oldValue), New: valueOrNone(newValue)})
+		}
+	}
+	if oldTablespace, newTablespace := old.getTablespace(), new.getTablespace(); !strings.EqualFold(oldTablespace, newTablespace) {
+		result = append(result, Difference{Attribute: "tablespace", Old: valueOrNone(oldTablespace), New: valueOrNone(newTablespace)})
+	}
+	return result
+}
+
+func sortedKeys(maps ...map[string]string) []string {
+	var result = make([]string, 0)
+	for _, m := range maps {
+		for key := range m {
+			if !utils.ArrayContainsCI(result, key) {
+				result = append(result, key)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func valueOrNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
@@ -0,0 +1,136 @@
+package dragonfly
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTableComparator_makeStorageChanges(t *testing.T) {
+	const current = `
+schemas:
+  - name: queue
+    tables:
+      jobs:
+        columns:
+          - name: id
+            schema: { type: int8, not_null: true }
+        indices:
+          - name: ix_jobs_id
+            type: index
+            columns: [id]
+        storage:
+          fillfactor: 90
+          autovacuum: { enabled: false }
+`
+	tests := []struct {
+		name    string
+		project string
+		want    []string
+	}{
+		{
+			name:    "nothing changed",
+			project: current,
+			want:    []string{},
+		},
+		{
+			name: "storage of the table and the index is changed",
+			project: `
+schemas:
+  - name: queue
+    tables:
+      jobs:
+        columns:
+          - name: id
+            schema: { type: int8, not_null: true }
+        indices:
+          - name: ix_jobs_id
+            type: index
+            columns: [id]
+            storage: { fillfactor: 80, tablespace: fast }
+        storage:
+          unlogged: true
+          fillfactor: 70
+          tablespace: fast
+          autovacuum: { vacuum_scale_factor: 0.01 }
+`,
+			want: []string{
+				"alter table queue.jobs set unlogged",
+				"alter table queue.jobs set (autovacuum_vacuum_scale_factor = 0.01, fillfactor = 70)",
+				"alter table queue.jobs reset (autovacuum_enabled)",
+				"alter table queue.jobs set tablespace fast",
+				"alter index queue.ix_jobs_id set (fillfactor = 80)",
+				"alter index queue.ix_jobs_id set tablespace fast",
+			},
+		},
+		{
+			name: "storage is not described",
+			project: `
+schemas:
+  - name: queue
+    tables:
+      jobs:
+        columns:
+          - name: id
+            schema: { type: int8, not_null: true }
+        indices:
+          - name: ix_jobs_id
+            type: index
+            columns: [id]
+      logs:
+        columns:
+          - name: message
+            schema: { type: varchar }
+        storage: { unlogged: true, autovacuum: { enabled: false } }
+`,
+			want: []string{
+				"alter table queue.jobs reset (autovacuum_enabled, fillfactor)",
+				"create table queue.logs (\n\tmessage varchar\n)",
+				"alter table queue.logs set unlogged",
+				"alter table queue.logs set (autovacuum_enabled = false)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := readProjectSnapshot([]byte(current))
+			if err != nil {
+				t.Fatalf("readProjectSnapshot() error = %v", err)
+			}
+			project, err := readProjectSnapshot([]byte(tt.project))
+			if err != nil {
+				t.Fatalf("readProjectSnapshot() error = %v", err)
+			}
+			diff := MakeDiff(actual, project)
+			ResolveDependencies(&diff)
+			var got = make([]string, 0)
+			for _, stmt := range diff.allStatements() {
+				got = append(got, stmt.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("makeDiff() got:\n%s\nwant:\n%s", strings.Join(got, ";\n"), strings.Join(tt.want, ";\n"))
+			}
+		})
+	}
+}
+
+func Test_rawStorages_tableStorage(t *testing.T) {
+	var storages = rawStorages{
+		{Schema: "queue", Name: "jobs", Unlogged: true, Tablespace: "fast", Options: "fillfactor=70,autovacuum_enabled=false,toast_tuple_target=128"},
+		{Schema: "queue", Name: "ix_jobs_id", IsIndex: true, Options: "fillfactor=80"},
+	}
+	want := &TableStorage{
+		Storage:    Storage{Tablespace: "fast", FillFactor: 70},
+		Unlogged:   true,
+		Autovacuum: map[string]string{"enabled": "false"},
+	}
+	if got := storages.tableStorage("queue", "jobs"); !reflect.DeepEqual(got, want) {
+		t.Errorf("tableStorage() = %+v, want %+v", got, want)
+	}
+	if got := storages.tableStorage("queue", "ix_jobs_id"); got != nil {
+		t.Errorf("tableStorage() = %+v, want nil for the index", got)
+	}
+	if got := storages.indexStorage("queue", "ix_jobs_id"); !reflect.DeepEqual(got, &Storage{FillFactor: 80}) {
+		t.Errorf("indexStorage() = %+v, want fillfactor 80", got)
+	}
+}
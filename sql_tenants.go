@@ -0,0 +1,216 @@
+package dragonfly
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/iv-menshenin/dragonfly/utils"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// the name of the target of the schemas that are not templates
+	sharedTarget = "shared"
+	// the number of targets processed at once if it is not set
+	defaultParallelism = 4
+)
+
+type (
+	// TenantProject is the part of the project applied to the database separately:
+	// the shared schemas, or the template schema renamed to one of the tenant schemas
+	TenantProject struct {
+		// the name of the tenant schema, it is empty for the shared schemas
+		Tenant string
+		// the structure the project is compared with
+		Current *Root
+		Project *Root
+	}
+	// TargetResult tells whether the project is applied to the target
+	TargetResult struct {
+		Target string `json:"target"`
+		Err    error  `json:"-"`
+	}
+	TargetResults []TargetResult
+)
+
+// HasTemplates returns true if any of the schemas of the project is applied to the tenant schemas
+func (c *Root) HasTemplates() bool {
+	for _, schema := range c.Schemas {
+		if schema.Value.Template != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// the templates are checked by Validate, the panic means that the project is used without checking
+func isTemplateMatched(pattern, name string) bool {
+	matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+	if err != nil {
+		panic(fmt.Sprintf("wrong template pattern '%s': %v", pattern, err))
+	}
+	return matched
+}
+
+// templateOf returns the template schema of the project the actual schema is matched with
+func (c *Root) templateOf(name string) (*SchemaRef, bool) {
+	for i, schema := range c.Schemas {
+		if schema.Value.Template != "" && isTemplateMatched(schema.Value.Template, name) {
+			return &c.Schemas[i], true
+		}
+	}
+	return nil, false
+}
+
+// copyRoot makes the deep copy of the project, each target changes its own copy while being compared
+func copyRoot(project *Root) *Root {
+	snapshot, err := makeProjectSnapshot(project)
+	if err != nil {
+		panic(err)
+	}
+	result, err := readProjectSnapshot(snapshot)
+	if err != nil {
+		panic(err)
+	}
+	result.Migrations = project.Migrations
+	result.Unmanaged = project.Unmanaged
+	result.Scope = project.Scope
+	result.appliedHooks = project.appliedHooks
+	return result
+}
+
+// SplitTenants makes the project of the shared schemas, which goes first, and the projects of every tenant schema
+// of the database that matches the template. The tenant schemas are compared as if the shared schemas were already
+// migrated, so their statements are not repeated. The hooks are run by the shared project only
+func SplitTenants(actual, project *Root) []TenantProject {
+	var (
+		shared        = copyRoot(project)
+		sharedCurrent = Root{Dialect: actual.Dialect, Schemas: make(Schemas, 0, len(actual.Schemas))}
+		tenants       = make([]string, 0)
+	)
+	shared.Schemas = make(Schemas, 0, len(project.Schemas))
+	for _, schema := range copyRoot(project).Schemas {
+		if schema.Value.Template == "" {
+			shared.Schemas = append(shared.Schemas, schema)
+		}
+	}
+	for _, schema := range actual.Schemas {
+		if _, ok := project.templateOf(schema.Value.Name); ok {
+			tenants = append(tenants, schema.Value.Name)
+			continue
+		}
+		sharedCurrent.Schemas = append(sharedCurrent.Schemas, schema)
+	}
+	sort.Strings(tenants)
+	var result = []TenantProject{{Current: &sharedCurrent, Project: shared}}
+	for _, tenant := range tenants {
+		template, _ := project.templateOf(tenant)
+		var (
+			tenantProject = copyRoot(project)
+			tenantCurrent = copyRoot(shared)
+		)
+		tenantProject.Schemas = make(Schemas, 0, len(project.Schemas))
+		for _, schema := range copyRoot(project).Schemas {
+			if schema.Value.Template == "" || schema.Value.Name == template.Value.Name {
+				schema.Value.Template = ""
+				tenantProject.Schemas = append(tenantProject.Schemas, schema)
+			}
+		}
+		tenantProject.renameSchema(template.Value.Name, tenant)
+		if project.Migrations != nil {
+			var settings = *project.Migrations
+			settings.Hooks = nil
+			tenantProject.Migrations = &settings
+		}
+		tenantCurrent.Dialect = actual.Dialect
+		tenantCurrent.Migrations = nil
+		schema, _ := actual.Schemas.tryToFind(tenant)
+		tenantCurrent.Schemas = append(tenantCurrent.Schemas, *schema)
+		result = append(result, TenantProject{Tenant: tenant, Current: tenantCurrent, Project: tenantProject})
+	}
+	return result
+}
+
+// Name is the name of the target used in the report
+func (c TenantProject) Name() string {
+	if c.Tenant == "" {
+		return sharedTarget
+	}
+	return c.Tenant
+}
+
+// ReadState reads the seed data and the hooks history of the target, the tenant reads the rows of its own schema only,
+// the rows of the shared schemas are compared by the shared target
+func (c TenantProject) ReadState(options ConnectionOptions) error {
+	var project = *c.Project
+	if c.Tenant != "" {
+		project.Schemas = make(Schemas, 0, len(c.Project.Schemas))
+		for _, schema := range c.Project.Schemas {
+			if !strings.EqualFold(schema.Value.Name, c.Tenant) {
+				schema.Value.Data = nil
+			}
+			project.Schemas = append(project.Schemas, schema)
+		}
+	}
+	return databaseWork(options, func(db *sql.DB) error {
+		if err := c.Current.readSeedData(db, &project); err != nil {
+			return err
+		}
+		return c.Current.readHookHistory(db, &project)
+	})
+}
+
+// RunTargets calls the function for each of the targets, no more than `parallel` at once.
+// The results are in the order of the targets regardless of the order in which they are finished
+func RunTargets(targets []string, parallel int, run func(i int) error) TargetResults {
+	if parallel <= 0 {
+		parallel = defaultParallelism
+	}
+	var (
+		results = make(TargetResults, len(targets))
+		limit   = make(chan struct{}, parallel)
+		wg      sync.WaitGroup
+	)
+	for i, target := range targets {
+		results[i].Target = target
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(i int) {
+			defer func() {
+				if r := recover(); r != nil {
+					results[i].Err = fmt.Errorf("%v", r)
+				}
+				<-limit
+				wg.Done()
+			}()
+			results[i].Err = run(i)
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// Failed returns the number of targets that are not migrated
+func (c TargetResults) Failed() int {
+	var failed int
+	for _, result := range c {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+func (c TargetResults) Print(w io.Writer) {
+	for _, result := range c {
+		if result.Err != nil {
+			utils.WriteWrapper(w, "%s: failed: %s\n", result.Target, result.Err)
+		} else {
+			utils.WriteWrapper(w, "%s: ok\n", result.Target)
+		}
+	}
+	utils.WriteWrapper(w, "%d target(s), %d failed\n", len(c), c.Failed())
+}
@@ -0,0 +1,151 @@
+package dragonfly
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSplitTenants(t *testing.T) {
+	const current = `
+schemas:
+  - name: common
+    tables:
+      plans:
+        columns:
+          - name: id
+            schema: { type: int8, not_null: true }
+  - name: tenant_002
+    tables:
+      orders:
+        columns:
+          - name: id
+            schema: { type: int8, not_null: true }
+          - name: plan_id
+            schema: { type: int8 }
+  - name: tenant_001
+    tables:
+      orders:
+        columns:
+          - name: id
+            schema: { type: int8, not_null: true }
+`
+	const project = `
+schemas:
+  - name: common
+    tables:
+      plans:
+        columns:
+          - name: id
+            schema: { type: int8, not_null: true }
+          - name: title
+            schema: { type: varchar, length: 50 }
+  - name: tenant
+    template: tenant_*
+    tables:
+      orders:
+        columns:
+          - name: id
+            schema: { type: int8, not_null: true }
+          - name: plan_id
+            schema: { type: int8 }
+`
+	actual, err := readProjectSnapshot([]byte(current))
+	if err != nil {
+		t.Fatalf("readProjectSnapshot() error = %v", err)
+	}
+	root, err := readProjectSnapshot([]byte(project))
+	if err != nil {
+		t.Fatalf("readProjectSnapshot() error = %v", err)
+	}
+	if !root.HasTemplates() {
+		t.Fatalf("HasTemplates() = false, want true")
+	}
+	want := map[string][]string{
+		"shared":     {"alter table common.plans add column title varchar(50)"},
+		"tenant_001": {"alter table tenant_001.orders add column plan_id int8"},
+		"tenant_002": {},
+	}
+	var names = make([]string, 0)
+	for _, tenant := range SplitTenants(actual, root) {
+		names = append(names, tenant.Name())
+		diff := MakeDiff(tenant.Current, tenant.Project)
+		ResolveDependencies(&diff)
+		var got = make([]string, 0)
+		for _, stmt := range diff.allStatements() {
+			got = append(got, stmt.String())
+		}
+		if !reflect.DeepEqual(got, want[tenant.Name()]) {
+			t.Errorf("%s got:\n%s\nwant:\n%s", tenant.Name(), strings.Join(got, ";\n"), strings.Join(want[tenant.Name()], ";\n"))
+		}
+	}
+	if wantNames := []string{"shared", "tenant_001", "tenant_002"}; !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("SplitTenants() targets = %v, want %v", names, wantNames)
+	}
+}
+
+func TestRoot_Validate_template(t *testing.T) {
+	const project = `
+schemas:
+  - name: tenant
+    template: %s
+`
+	for template, wantErr := range map[string]string{
+		"tenant_*":    "",
+		"tenant_[0-9": "schema `tenant`: wrong template pattern 'tenant_[0-9'",
+	} {
+		root, err := readProjectSnapshot([]byte(fmt.Sprintf(project, template)))
+		if err != nil {
+			t.Fatalf("readProjectSnapshot() error = %v", err)
+		}
+		err = root.Validate()
+		if wantErr == "" && err != nil {
+			t.Errorf("Validate() error = %v for the template %s", err, template)
+		}
+		if wantErr != "" && (err == nil || !strings.Contains(err.Error(), wantErr)) {
+			t.Errorf("Validate() error = %v, want %s", err, wantErr)
+		}
+	}
+}
+
+func TestRunTargets(t *testing.T) {
+	var (
+		targets = []string{"a", "b", "c", "d", "e"}
+		running int32
+		maximum int32
+	)
+	results := RunTargets(targets, 2, func(i int) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maximum)
+			if n <= m || atomic.CompareAndSwapInt32(&maximum, m, n) {
+				break
+			}
+		}
+		switch targets[i] {
+		case "b":
+			return errors.New("connection refused")
+		case "d":
+			panic("wrong project")
+		}
+		return nil
+	})
+	if maximum > 2 {
+		t.Errorf("RunTargets() ran %d targets at once, want no more than 2", maximum)
+	}
+	if got := results.Failed(); got != 2 {
+		t.Errorf("Failed() = %d, want 2", got)
+	}
+	for i, result := range results {
+		if result.Target != targets[i] {
+			t.Errorf("result %d is of %s, want %s", i, result.Target, targets[i])
+		}
+	}
+	if results[3].Err == nil || results[3].Err.Error() != "wrong project" {
+		t.Errorf("the panic is not recovered: %v", results[3].Err)
+	}
+}
@@ -47,7 +47,7 @@ type (
 		IsArray   bool    `yaml:"array,omitempty" json:"array,omitempty"`
 	}
 	TypeSchema struct {
-		TypeBase `yaml:"-,inline" json:"-,inline"`
+		TypeBase `yaml:"-,inline" json:",inline"`
 		// for type `enum` only
 		Enum []EnumEntity `yaml:"enum,omitempty" json:"enum,omitempty"`
 		// for types `record` and `json`
@@ -58,7 +58,7 @@ type (
 		used      *bool
 	}
 	DomainSchema struct { // TODO DOMAIN CONSTRAINTS NAME (CHECK/NOT NULL)
-		TypeBase `yaml:"-,inline" json:"-,inline"`
+		TypeBase `yaml:"-,inline" json:",inline"`
 		NotNull  bool        `yaml:"not_null,omitempty" json:"not_null,omitempty"`
 		Default  interface{} `yaml:"default,omitempty" json:"default,omitempty"`
 		Check    *string     `yaml:"check,omitempty" json:"check,omitempty"`
@@ -67,17 +67,27 @@ type (
 	EnumEntity struct {
 		Value       string `yaml:"value" json:"value"`
 		Description string `yaml:"description,omitempty" json:"description,omitempty"`
+		// the previous label, if the label is renamed
+		OldValue string `yaml:"old_value,omitempty" json:"old_value,omitempty"`
 	}
 	ColumnSchemaRef struct {
 		Value DomainSchema `yaml:"value,inline" json:"value,inline"`
 		Ref   *string      `yaml:"$ref,omitempty" json:"$ref,omitempty"`
 	}
 	Column struct {
-		Name        string          `yaml:"name" json:"name"`
-		Schema      ColumnSchemaRef `yaml:"schema" json:"schema"`
-		Constraints []Constraint    `yaml:"constraints,omitempty" json:"constraints,omitempty"`
-		Tags        []string        `yaml:"tags,omitempty" json:"tags,omitempty"`
-		Description string          `yaml:"description,omitempty" json:"description,omitempty"`
+		Name        string           `yaml:"name" json:"name"`
+		Schema      ColumnSchemaRef  `yaml:"schema" json:"schema"`
+		Constraints []Constraint     `yaml:"constraints,omitempty" json:"constraints,omitempty"`
+		Tags        []string         `yaml:"tags,omitempty" json:"tags,omitempty"`
+		Description string           `yaml:"description,omitempty" json:"description,omitempty"`
+		Migration   *ColumnMigration `yaml:"migration,omitempty" json:"migration,omitempty"`
+	}
+	// ColumnMigration contains hints for changing the type of the column
+	ColumnMigration struct {
+		// the expression that converts the old value, the column is renamed beforehand, so it is referred by its new name
+		Using string `yaml:"using,omitempty" json:"using,omitempty"`
+		// `alter` or `staged`
+		Strategy string `yaml:"strategy,omitempty" json:"strategy,omitempty"`
 	}
 	ColumnRef struct {
 		Value Column  `yaml:"value,inline" json:"value,inline"`
@@ -92,6 +102,8 @@ type (
 		ToColumn string  `yaml:"column" json:"column"`
 		OnUpdate *string `yaml:"on_update,omitempty" json:"on_update,omitempty"`
 		OnDelete *string `yaml:"on_delete,omitempty" json:"on_delete,omitempty"`
+		// `simple` or `full`
+		Match *string `yaml:"match,omitempty" json:"match,omitempty"`
 	}
 	Check struct {
 		Expression string `yaml:"expression" json:"expression"`
@@ -110,6 +122,8 @@ type (
 	ConstraintSchema struct {
 		Columns    []string   `yaml:"columns" json:"columns"`
 		Constraint Constraint `yaml:"constraint" json:"constraint"`
+		// the referenced columns of the composite foreign key, in the order of the columns
+		RefColumns []string `yaml:"ref_columns,omitempty" json:"ref_columns,omitempty"`
 	}
 	IndexType int
 	//IndexColumn struct {
@@ -122,6 +136,20 @@ type (
 		IndexType IndexType `yaml:"type" json:"type"`
 		Columns   []string  `yaml:"columns" json:"columns"`
 		Where     string    `yaml:"where,omitempty" json:"where,omitempty"`
+		Storage   *Storage  `yaml:"storage,omitempty" json:"storage,omitempty"`
+	}
+	// Storage describes where and how the table or the index is stored
+	Storage struct {
+		Tablespace string `yaml:"tablespace,omitempty" json:"tablespace,omitempty"`
+		// the percentage of the page filled by inserts, the rest is left for updates
+		FillFactor int `yaml:"fillfactor,omitempty" json:"fillfactor,omitempty"`
+	}
+	TableStorage struct {
+		Storage `yaml:",inline" json:",inline"`
+		// the table is not written to the WAL, it is faster, but it is truncated after a crash
+		Unlogged bool `yaml:"unlogged,omitempty" json:"unlogged,omitempty"`
+		// the autovacuum parameters without the prefix, such as `vacuum_scale_factor: 0.01` or `enabled: false`
+		Autovacuum map[string]string `yaml:"autovacuum,omitempty" json:"autovacuum,omitempty"`
 	}
 	ApiFindOption struct {
 		Column   string                 `yaml:"column,omitempty" json:"column,omitempty"`
@@ -155,6 +183,7 @@ type (
 		Constraints TableConstraints `yaml:"constraints,omitempty" json:"constraints,omitempty"`
 		Indices     IndicesContainer `yaml:"indices,omitempty" json:"indices,omitempty"`
 		Description string           `yaml:"description,omitempty" json:"description,omitempty"`
+		Storage     *TableStorage    `yaml:"storage,omitempty" json:"storage,omitempty"`
 		Api         ApiContainer     `yaml:"api,omitempty" json:"api,omitempty"`
 		used        *bool
 	}
@@ -172,13 +201,29 @@ type (
 	DataContainer    struct {
 		Name string    `yaml:"name" json:"name"`
 		Data TableData `yaml:"data" json:"data"`
+		// `keep` or `delete`, what to do with the rows of the table that are not described in the project
+		ExtraRows string `yaml:"extra_rows,omitempty" json:"extra_rows,omitempty"`
+		// the file with more rows, they are added to the rows described in the project
+		Source *DataSource `yaml:"source,omitempty" json:"source,omitempty"`
+	}
+	DataSource struct {
+		File string `yaml:"file" json:"file"`
+		// `csv`, `jsonl` or `yaml`, it is taken from the file extension if not set
+		Format string `yaml:"format,omitempty" json:"format,omitempty"`
+		// the columns of the file mapped to the columns of the table, all the columns are taken as is if not set
+		Columns map[string]string `yaml:"columns,omitempty" json:"columns,omitempty"`
 	}
 	Schema struct {
-		Name    string           `yaml:"name" json:"name"`
-		Types   TypesContainer   `yaml:"types,omitempty" json:"types,omitempty"`
-		Domains DomainsContainer `yaml:"domains,omitempty" json:"domains,omitempty"`
-		Tables  TablesContainer  `yaml:"tables,omitempty" json:"tables,omitempty"`
-		Data    []DataContainer  `yaml:"data,omitempty" json:"data,omitempty"`
+		Name string `yaml:"name" json:"name"`
+		// the previous name, if the schema is renamed
+		OldName string `yaml:"old_name,omitempty" json:"old_name,omitempty"`
+		Owner   string `yaml:"owner,omitempty" json:"owner,omitempty"`
+		// the pattern of the names of the tenant schemas, the schema is applied to each of them instead of itself
+		Template string           `yaml:"template,omitempty" json:"template,omitempty"`
+		Types    TypesContainer   `yaml:"types,omitempty" json:"types,omitempty"`
+		Domains  DomainsContainer `yaml:"domains,omitempty" json:"domains,omitempty"`
+		Tables   TablesContainer  `yaml:"tables,omitempty" json:"tables,omitempty"`
+		Data     []DataContainer  `yaml:"data,omitempty" json:"data,omitempty"`
 	}
 	SchemaRef struct {
 		Value Schema  `yaml:"value,inline" json:"value,inline"`
@@ -188,11 +233,69 @@ type (
 		Columns map[string]Column     `yaml:"columns" json:"columns"`
 		Classes map[string]TableClass `yaml:"classes" json:"classes"`
 	}
+	// Filter selects the names by glob patterns, all the names are selected if there are no include patterns.
+	// The exclude patterns take precedence
+	Filter struct {
+		Include []string `yaml:"include,omitempty" json:"include,omitempty"`
+		Exclude []string `yaml:"exclude,omitempty" json:"exclude,omitempty"`
+	}
+	// Scope restricts dragonfly to the objects it owns in the shared database
+	Scope struct {
+		// the names of the schemas
+		Schemas Filter `yaml:"schemas,omitempty" json:"schemas,omitempty"`
+		// the qualified names of the tables: `schema.table`
+		Tables Filter `yaml:"tables,omitempty" json:"tables,omitempty"`
+		// the kinds of the changed objects: schema, domain, type, table, column, constraint, index, row or hook
+		Kinds Filter `yaml:"kinds,omitempty" json:"kinds,omitempty"`
+	}
+	// MigrationSettings describes how the changes are applied to the database
+	MigrationSettings struct {
+		// `default` or `online`
+		Mode string `yaml:"mode,omitempty" json:"mode,omitempty"`
+		// the number of rows updated at once by the online backfill
+		BatchSize int `yaml:"batch_size,omitempty" json:"batch_size,omitempty"`
+		// the table that keeps the identifiers of the hooks that have already been run
+		HistoryTable string `yaml:"history_table,omitempty" json:"history_table,omitempty"`
+		// the custom statements that cannot be inferred from the structure
+		Hooks []MigrationHook `yaml:"hooks,omitempty" json:"hooks,omitempty"`
+	}
+	// MigrationHook is the custom SQL that is run in the phase of the migration
+	MigrationHook struct {
+		// the stable identifier, the hook is run only once if the history table is set
+		ID string `yaml:"id" json:"id"`
+		// `preInstall`, `install` or `afterInstall`
+		Phase string `yaml:"phase" json:"phase"`
+		// the hook is run only if the object is changed
+		On  *HookEvent `yaml:"on,omitempty" json:"on,omitempty"`
+		SQL string     `yaml:"sql" json:"sql"`
+	}
+	// HookEvent is the change of the object, such as the column being dropped
+	HookEvent struct {
+		Kind ObjectKind `yaml:"kind" json:"kind"`
+		// the qualified name of the object: `schema.table.column` for columns
+		Object string `yaml:"object" json:"object"`
+		// any change of the object if it is not set
+		Action ChangeAction `yaml:"action,omitempty" json:"action,omitempty"`
+		// `before` or `after` the statements of the change, `before` is used by default
+		When string `yaml:"when,omitempty" json:"when,omitempty"`
+	}
 	Schemas []SchemaRef
 	Root    struct {
 		Schemas Schemas `yaml:"schemas" json:"schemas"`
+		// the database engine: `postgres` or `sqlite`, PostgreSQL is used if it is not set
+		Dialect    string             `yaml:"dialect,omitempty" json:"dialect,omitempty"`
+		Migrations *MigrationSettings `yaml:"migrations,omitempty" json:"migrations,omitempty"`
+		// patterns of the objects that are changed by someone else, the drift check does not report them,
+		// but the migration still changes them, use the scope to keep the migration away
+		Unmanaged []string `yaml:"unmanaged,omitempty" json:"unmanaged,omitempty"`
+		// the objects that are read from the database and changed by the migration, all of them if it is not set
+		Scope *Scope `yaml:"scope,omitempty" json:"scope,omitempty"`
 		// important: avoid getting any components directly, they are not normalized
 		Components Components `yaml:"components" json:"components"`
+		// included files are read by this function, the working tree is read if it is not set
+		readFile fileReader
+		// the hooks that are found in the history table of the database
+		appliedHooks []string
 	}
 )
 
@@ -220,6 +323,23 @@ func (c *IndexType) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return errors.New("cannot resolve index type '" + s + "'")
 }
 
+func (c IndexType) MarshalYAML() (interface{}, error) {
+	for name, t := range indexTypes {
+		if t == c {
+			return name, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot resolve index type #%d", c)
+}
+
+func (c IndexType) MarshalJSON() ([]byte, error) {
+	name, err := c.MarshalYAML()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(name)
+}
+
 func (c *IndexType) UnmarshalJSON(data []byte) error {
 	var s = string(data)
 	if t, ok := indexTypes[strings.ToLower(s)]; ok {
@@ -263,6 +383,13 @@ var (
 		"unique":      ConstraintUniqueKey,
 		"check":       ConstraintCheck,
 	}
+	// canonical names, the same constraint can be declared with any alias from constraintReference
+	constraintNames = map[ConstraintType]string{
+		ConstraintPrimaryKey: "primary key",
+		ConstraintForeignKey: "foreign key",
+		ConstraintUniqueKey:  "unique key",
+		ConstraintCheck:      "check",
+	}
 )
 
 func splitPath(path string) (result map[string]string) {
@@ -343,6 +470,14 @@ func (c *ConstraintParameters) UnmarshalYAML(unmarshal func(interface{}) error)
 	return errors.New("cannot resolve parameter type")
 }
 
+func (c ConstraintParameters) MarshalYAML() (interface{}, error) {
+	return c.Parameter, nil
+}
+
+func (c ConstraintParameters) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.Parameter)
+}
+
 func (c *ConstraintParameters) UnmarshalJSON(data []byte) error {
 	decoder := json.NewDecoder(bytes.NewReader(data))
 	decoder.DisallowUnknownFields()
@@ -383,14 +518,27 @@ func (c *ConstraintType) UnmarshalJSON(data []byte) error {
 }
 
 func (c ConstraintType) String() string {
-	for key, value := range constraintReference {
-		if value == c {
-			return key
-		}
+	if name, ok := constraintNames[c]; ok {
+		return name
 	}
 	return "unknown"
 }
 
+func (c ConstraintType) MarshalYAML() (interface{}, error) {
+	if name, ok := constraintNames[c]; ok {
+		return name, nil
+	}
+	return nil, fmt.Errorf("cannot resolve constraint type #%d", c)
+}
+
+func (c ConstraintType) MarshalJSON() ([]byte, error) {
+	name, err := c.MarshalYAML()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(name)
+}
+
 func processRef(db *Root, ref string, i interface{}) {
 	if ref == "" {
 		panic(errors.New("cannot resolve empty $ref"))
@@ -398,7 +546,7 @@ func processRef(db *Root, ref string, i interface{}) {
 	if chains := strings.Split(strings.TrimSpace(ref), " "); len(chains) > 1 {
 		if chains[0] == "!include" {
 			fileName := strings.TrimSpace(strings.Join(chains[1:], " "))
-			readAndParseFile(fileName, i)
+			readAndParseFileWith(db.fileReader(), fileName, i)
 			return
 		}
 	}
@@ -506,10 +654,24 @@ func (c *Constraint) normalize(schema *SchemaRef, tableName string, constraintIn
 		cIndex:        strconv.Itoa(constraintIndex),
 		cNN:           strconv.Itoa(constraintIndex),
 	})
+	if fk, ok := c.Parameters.Parameter.(ForeignKey); ok && !strings.Contains(fk.ToTable, ".") {
+		// the referenced table is in the same schema unless another schema is specified
+		fk.ToTable = fmt.Sprintf("%s.%s", schema.Value.Name, fk.ToTable)
+		c.Parameters.Parameter = fk
+	}
 }
 
 func (c *ConstraintSchema) normalize(schema *SchemaRef, tableName string, constraintIndex int, db *Root) {
 	c.Constraint.normalize(schema, tableName, constraintIndex, db)
+	if len(c.RefColumns) == 0 {
+		return
+	}
+	if _, ok := c.Constraint.Parameters.Parameter.(ForeignKey); !ok {
+		panic(fmt.Sprintf("constraint `%s` of table `%s`: only foreign keys can refer to columns", c.Constraint.Name, tableName))
+	}
+	if len(c.RefColumns) != len(c.Columns) {
+		panic(fmt.Sprintf("constraint `%s` of table `%s`: the number of referenced columns does not match the number of columns", c.Constraint.Name, tableName))
+	}
 }
 
 func (c *ColumnSchemaRef) normalize(tableName string, columnIndex int, db *Root) {
@@ -764,6 +926,10 @@ func (c *SchemaRef) normalize(db *Root) {
 		table.normalize(c, tableName, db)
 		c.Value.Tables[tableName] = table
 	}
+	for i, data := range c.Value.Data {
+		data.normalize(c, db)
+		c.Value.Data[i] = data
+	}
 }
 
 func (c *TypeSchema) normalize(schema *SchemaRef, typeName string, db *Root) {
@@ -884,6 +1050,32 @@ func (c *Root) follow(path []string, i interface{}) (ok bool) {
 	return false
 }
 
+// Validate checks the settings of the project that are not checked while it is read
+func (c *Root) Validate() error {
+	if err := checkPatterns("unmanaged", c.Unmanaged); err != nil {
+		return err
+	}
+	if err := c.Scope.Validate(); err != nil {
+		return err
+	}
+	for _, schema := range c.Schemas {
+		if schema.Value.Template != "" {
+			if err := checkPatterns("template", []string{schema.Value.Template}); err != nil {
+				return fmt.Errorf("schema `%s`: %v", schema.Value.Name, err)
+			}
+		}
+		for _, tableName := range schema.Value.Tables.getNames() {
+			table := schema.Value.Tables[tableName]
+			for _, column := range table.Columns {
+				if err := c.checkColumnMigration(schema.Value.Name, tableName, &table, column.Value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
 func (c *Root) normalize() {
 	// avoid of breaking links to types
 	for i, schemaRef := range c.Schemas {